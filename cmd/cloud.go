@@ -84,13 +84,13 @@ This will execute the test on the k6 cloud service. Use "k6 login cloud" to auth
 
 			// Runner
 			filename := args[0]
-			src, filesystems, err := readSource(filename, logger)
+			osEnvironment := buildEnvMap(os.Environ())
+			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), osEnvironment)
 			if err != nil {
 				return err
 			}
 
-			osEnvironment := buildEnvMap(os.Environ())
-			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), osEnvironment)
+			src, filesystems, err := readSource(filename, runtimeOptions, logger)
 			if err != nil {
 				return err
 			}
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
@@ -33,6 +34,7 @@ import (
 	"github.com/spf13/pflag"
 	"gopkg.in/guregu/null.v3"
 
+	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/loader"
 )
@@ -91,17 +93,46 @@ func exactArgsWithMsg(n int, msg string) cobra.PositionalArgs {
 
 // readSource is a small wrapper around loader.ReadSource returning
 // result of the load and filesystems map
-func readSource(filename string, logger *logrus.Logger) (*loader.SourceData, map[string]afero.Fs, error) {
+func readSource(
+	filename string, rtOpts lib.RuntimeOptions, logger *logrus.Logger,
+) (*loader.SourceData, map[string]afero.Fs, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
 		return nil, nil, err
 	}
 
 	filesystems := loader.CreateFilesystems()
+	cache, err := newModuleCache(pwd, rtOpts, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cache != nil {
+		filesystems["https"] = loader.NewModuleCacheFs(filesystems["https"], cache)
+	}
 	src, err := loader.ReadSource(logger, filename, pwd, filesystems, os.Stdin)
 	return src, filesystems, err
 }
 
+// newModuleCache returns the cache of the remote modules, with the lockfile in
+// the working directory. The cache is in the user cache directory by default,
+// it's disabled if there isn't one, unless the test is run offline.
+func newModuleCache(pwd string, rtOpts lib.RuntimeOptions, logger logrus.FieldLogger) (*loader.ModuleCache, error) {
+	dir := rtOpts.ModuleCache.String
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			if rtOpts.Offline.Bool {
+				return nil, fmt.Errorf("the module cache is needed offline, but there is no default one, "+
+					"set it with --module-cache: %w", err)
+			}
+			logger.WithError(err).Debug("The remote modules aren't cached, as there is no user cache directory")
+			return nil, nil
+		}
+		dir = filepath.Join(cacheDir, "k6", "modules")
+	}
+	return loader.NewModuleCache(afero.NewOsFs(), dir, filepath.Join(pwd, loader.LockFileName), rtOpts.Offline.Bool)
+}
+
 func detectType(data []byte) string {
 	if _, err := tar.NewReader(bytes.NewReader(data)).Next(); err == nil {
 		return typeArchive
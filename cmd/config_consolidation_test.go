@@ -513,6 +513,58 @@ func getConfigConsolidationTestCases() []configConsolidationTestCase {
 				}, c.Options.DNS)
 			},
 		},
+		{
+			opts{
+				fs:  defaultConfig(`{"dns": {"servers": ["1.1.1.1", "https://dns.example/dns-query"]}}`),
+				cli: []string{"--dns", "policy=onlyIPv4,servers=tls://9.9.9.9;tcp://8.8.8.8:53"},
+			},
+			exp{},
+			func(t *testing.T, c Config) {
+				assert.Equal(t, types.DNSConfig{
+					TTL:     null.NewString("5m", false),
+					Select:  types.NullDNSSelect{DNSSelect: types.DNSrandom, Valid: false},
+					Policy:  types.NullDNSPolicy{DNSPolicy: types.DNSonlyIPv4, Valid: true},
+					Servers: []string{"tls://9.9.9.9", "tcp://8.8.8.8:53"},
+				}, c.Options.DNS)
+			},
+		},
+		{
+			opts{fs: defaultConfig(`{"dns": {"servers": ["1.1.1.1", "https://dns.example/dns-query"]}}`)},
+			exp{},
+			func(t *testing.T, c Config) {
+				assert.Equal(t, []string{"1.1.1.1", "https://dns.example/dns-query"}, c.Options.DNS.Servers)
+			},
+		},
+		{
+			// CLI overrides all, a preset discards the less specific values
+			opts{
+				fs:  defaultConfig(`{"network": {"latency": "100ms", "packetLoss": 1}}`),
+				env: []string{"K6_NETWORK=download=1000"},
+				cli: []string{"--network", "3g,jitter=0"},
+			},
+			exp{},
+			func(t *testing.T, c Config) {
+				assert.Equal(t, types.NetworkConditions{
+					Preset: null.StringFrom("3g"),
+					Jitter: types.NewNullDuration(0, true),
+				}, c.Options.Network)
+			},
+		},
+		{
+			opts{
+				fs:  defaultConfig(`{"network": {"latency": "100ms", "packetLoss": 1}}`),
+				env: []string{"K6_NETWORK=download=1000"},
+			},
+			exp{},
+			func(t *testing.T, c Config) {
+				assert.Equal(t, types.NetworkConditions{
+					Latency:    types.NewNullDuration(100*time.Millisecond, true),
+					Download:   null.IntFrom(1000),
+					PacketLoss: null.FloatFrom(1),
+				}, c.Options.Network)
+			},
+		},
+		{opts{cli: []string{"--network", "5g"}}, exp{cliReadError: true}, nil},
 		{
 			opts{env: []string{"K6_NO_SETUP=true", "K6_NO_TEARDOWN=false"}},
 			exp{},
@@ -38,7 +38,7 @@ import (
 )
 
 func getInspectCmd(logger *logrus.Logger, globalFlags *commandFlags) *cobra.Command {
-	var addExecReqs bool
+	var addExecReqs, addDependencies bool
 
 	// inspectCmd represents the inspect command
 	inspectCmd := &cobra.Command{
@@ -47,12 +47,12 @@ func getInspectCmd(logger *logrus.Logger, globalFlags *commandFlags) *cobra.Comm
 		Long:  `Inspect a script or archive.`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			src, filesystems, err := readSource(args[0], logger)
+			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), buildEnvMap(os.Environ()))
 			if err != nil {
 				return err
 			}
 
-			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), buildEnvMap(os.Environ()))
+			src, filesystems, err := readSource(args[0], runtimeOptions, logger)
 			if err != nil {
 				return err
 			}
@@ -91,6 +91,13 @@ func getInspectCmd(logger *logrus.Logger, globalFlags *commandFlags) *cobra.Comm
 				}
 			}
 
+			if addDependencies {
+				inspectOutput, err = addDependencyTree(inspectOutput, b)
+				if err != nil {
+					return err
+				}
+			}
+
 			data, err := json.MarshalIndent(inspectOutput, "", "  ")
 			if err != nil {
 				return err
@@ -108,10 +115,29 @@ func getInspectCmd(logger *logrus.Logger, globalFlags *commandFlags) *cobra.Comm
 		"execution-requirements",
 		false,
 		"include calculations of execution requirements for the test")
+	inspectCmd.Flags().BoolVar(&addDependencies,
+		"dependencies",
+		false,
+		"include the tree of the modules imported by the script")
 
 	return inspectCmd
 }
 
+// addDependencyTree adds the dependencies of the script to the fields of the
+// output, which is any of the other forms of it.
+func addDependencyTree(inspectOutput interface{}, b *js.Bundle) (interface{}, error) {
+	data, err := json.Marshal(inspectOutput)
+	if err != nil {
+		return nil, err
+	}
+	var output map[string]interface{}
+	if err = json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	output["dependencies"] = b.Dependencies()
+	return output, nil
+}
+
 func addExecRequirements(b *js.Bundle,
 	builtinMetrics *metrics.BuiltinMetrics, registry *metrics.Registry,
 	logger *logrus.Logger, globalFlags *commandFlags) (interface{}, error) {
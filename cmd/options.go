@@ -98,7 +98,12 @@ func optionFlagSet() *pflag.FlagSet {
 		"for a persistent cache, '0' to disable the cache,\nor a positive duration, e.g. '1s', '1m', etc. "+
 		"Milliseconds are assumed if no unit is provided.\n"+
 		"Possible select values to return a single IP are: 'first', 'random' or 'roundRobin'.\n"+
-		"Possible policy values are: 'preferIPv4', 'preferIPv6', 'onlyIPv4', 'onlyIPv6' or 'any'.\n")
+		"Possible policy values are: 'preferIPv4', 'preferIPv6', 'onlyIPv4', 'onlyIPv6' or 'any'.\n"+
+		"Possible servers values are a semicolon-separated list of 'host:port' (UDP), 'tcp://host:port',\n"+
+		"'tls://host:port' (DNS-over-TLS) or 'https://' (DNS-over-HTTPS) URLs, queried instead of the OS resolver.\n")
+	flags.String("network", "", "emulated network conditions, either a preset ('3g', '4g' or 'dsl') or a list of "+
+		"key=value pairs,\ne.g. 'preset=3g,latency=500ms,jitter=50ms,download=1000,upload=500,packetLoss=1'. "+
+		"Bandwidth is in kbit/s and packet loss in percent.\n")
 	return flags
 }
 
@@ -275,6 +280,14 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		}
 	}
 
+	if network, err := flags.GetString("network"); err != nil {
+		return opts, err
+	} else if network != "" {
+		if err := opts.Network.UnmarshalText([]byte(network)); err != nil {
+			return opts, err
+		}
+	}
+
 	return opts, nil
 }
 
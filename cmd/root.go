@@ -193,6 +193,7 @@ func Execute() {
 		getRunCmd(ctx, logger, c.commandFlags),
 		getStatsCmd(ctx, c.commandFlags),
 		getStatusCmd(ctx, c.commandFlags),
+		getVendorCmd(logger, c.commandFlags),
 		getVersionCmd(),
 	)
 
@@ -95,13 +95,13 @@ a commandline interface for interacting with it.`,
 			logger.Debug("Initializing the runner...")
 
 			// Create the Runner.
-			src, filesystems, err := readSource(args[0], logger)
+			osEnvironment := buildEnvMap(os.Environ())
+			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), osEnvironment)
 			if err != nil {
 				return err
 			}
 
-			osEnvironment := buildEnvMap(os.Environ())
-			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), osEnvironment)
+			src, filesystems, err := readSource(args[0], runtimeOptions, logger)
 			if err != nil {
 				return err
 			}
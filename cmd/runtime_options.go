@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -65,6 +66,9 @@ extended: base + Babel with parts of ES2015 preset
 		  slower to compile in case the script uses syntax unsupported by base
 `)
 	flags.StringArrayP("env", "e", nil, "add/override environment variable with `VAR=value`")
+	flags.String("import-map", "", "use the import map in the JSON `file` to resolve the imports of the script")
+	flags.String("module-cache", "", "cache the remote modules in the `directory`, the user cache directory by default")
+	flags.Bool("offline", false, "only load the remote modules from the module cache, with the hashes in k6.lock")
 	flags.Bool("no-thresholds", false, "don't run thresholds")
 	flags.Bool("no-summary", false, "don't show the summary at the end of the test")
 	flags.String(
@@ -100,6 +104,9 @@ func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib
 		NoThresholds:         getNullBool(flags, "no-thresholds"),
 		NoSummary:            getNullBool(flags, "no-summary"),
 		SummaryExport:        getNullString(flags, "summary-export"),
+		ImportMap:            getNullString(flags, "import-map"),
+		ModuleCache:          getNullString(flags, "module-cache"),
+		Offline:              getNullBool(flags, "offline"),
 		Env:                  make(map[string]string),
 	}
 
@@ -130,6 +137,29 @@ func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib
 		}
 	}
 
+	if envVar, ok := environment["K6_IMPORT_MAP"]; ok {
+		if !opts.ImportMap.Valid {
+			opts.ImportMap = null.StringFrom(envVar)
+		}
+	}
+	if opts.ImportMap.String != "" && !filepath.IsAbs(opts.ImportMap.String) {
+		// it's relative to the working directory, like the script
+		importMap, err := filepath.Abs(opts.ImportMap.String)
+		if err != nil {
+			return opts, err
+		}
+		opts.ImportMap = null.StringFrom(importMap)
+	}
+
+	if envVar, ok := environment["K6_MODULE_CACHE"]; ok {
+		if !opts.ModuleCache.Valid {
+			opts.ModuleCache = null.StringFrom(envVar)
+		}
+	}
+	if err := saveBoolFromEnv(environment, "K6_OFFLINE", &opts.Offline); err != nil {
+		return opts, err
+	}
+
 	if opts.IncludeSystemEnvVars.Bool { // If enabled, gather the actual system environment variables
 		opts.Env = environment
 	}
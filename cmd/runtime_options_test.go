@@ -78,6 +78,9 @@ func testRuntimeOptionsCase(t *testing.T, tc runtimeOptionsTestCase) {
 
 	fs := afero.NewMemMapFs()
 	require.NoError(t, afero.WriteFile(fs, "/script.js", jsCode.Bytes(), 0o644))
+	if rtOpts.ImportMap.String != "" {
+		require.NoError(t, afero.WriteFile(fs, rtOpts.ImportMap.String, []byte(`{"imports": {}}`), 0o644))
+	}
 	registry := metrics.NewRegistry()
 	builtinMetrics := metrics.RegisterBuiltinMetrics(registry)
 	runner, err := newRunner(
@@ -349,6 +352,39 @@ func TestRuntimeOptions(t *testing.T) {
 				SummaryExport:        null.NewString("bar", true),
 			},
 		},
+		"import map from env": {
+			useSysEnv: false,
+			systemEnv: map[string]string{"K6_IMPORT_MAP": "/env/importmap.json"},
+			expRTOpts: lib.RuntimeOptions{
+				IncludeSystemEnvVars: null.NewBool(false, false),
+				CompatibilityMode:    defaultCompatMode,
+				Env:                  map[string]string{},
+				ImportMap:            null.NewString("/env/importmap.json", true),
+			},
+		},
+		"import map from env overwritten by CLI": {
+			useSysEnv: false,
+			systemEnv: map[string]string{"K6_IMPORT_MAP": "/env/importmap.json"},
+			cliFlags:  []string{"--import-map", "/cli/importmap.json"},
+			expRTOpts: lib.RuntimeOptions{
+				IncludeSystemEnvVars: null.NewBool(false, false),
+				CompatibilityMode:    defaultCompatMode,
+				Env:                  map[string]string{},
+				ImportMap:            null.NewString("/cli/importmap.json", true),
+			},
+		},
+		"module cache from env overwritten by CLI": {
+			useSysEnv: false,
+			systemEnv: map[string]string{"K6_MODULE_CACHE": "/env/cache", "K6_OFFLINE": "true"},
+			cliFlags:  []string{"--module-cache", "/cli/cache"},
+			expRTOpts: lib.RuntimeOptions{
+				IncludeSystemEnvVars: null.NewBool(false, false),
+				CompatibilityMode:    defaultCompatMode,
+				Env:                  map[string]string{},
+				ModuleCache:          null.NewString("/cli/cache", true),
+				Offline:              null.NewBool(true, true),
+			},
+		},
 		"env var error detected even when CLI flags overwrite 1": {
 			useSysEnv: false,
 			systemEnv: map[string]string{"K6_NO_THRESHOLDS": "boo"},
@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"go.k6.io/k6/js"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/loader"
+)
+
+func getVendorCmd(logger *logrus.Logger, globalFlags *commandFlags) *cobra.Command {
+	// vendorCmd represents the vendor command
+	vendorCmd := &cobra.Command{
+		Use:   "vendor [file]",
+		Short: "Download the remote modules of a script",
+		Long: `Download the remote modules of a script.
+
+The modules are stored in the module cache by the SHA-256 of their content, and their
+hashes are written to the k6.lock file in the working directory. Tests can then be run
+with --offline, which only loads the remote modules from the cache, and any module that
+doesn't match its hash in k6.lock is an error.`,
+		Example: `
+  # Download the remote modules to a directory next to the script.
+  k6 vendor --module-cache ./vendor script.js
+
+  # Run the test without network access to the remote modules.
+  k6 run --module-cache ./vendor --offline script.js`[1:],
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), buildEnvMap(os.Environ()))
+			if err != nil {
+				return err
+			}
+			if runtimeOptions.Offline.Bool {
+				return errors.New("the remote modules can't be downloaded offline")
+			}
+
+			src, filesystems, err := readSource(args[0], runtimeOptions, logger)
+			if err != nil {
+				return err
+			}
+			cache, ok := filesystems["https"].(loader.ModuleCacheGetter)
+			if !ok {
+				return errors.New("there is no module cache, set it with --module-cache")
+			}
+
+			// the bundle loads all the modules that the script imports
+			if _, err = js.NewBundle(logger, src, filesystems, runtimeOptions, metrics.NewRegistry()); err != nil {
+				return err
+			}
+
+			modules := cache.GetModuleCache().Modules()
+			urls := make([]string, 0, len(modules))
+			for u := range modules {
+				urls = append(urls, u)
+			}
+			sort.Strings(urls)
+			for _, u := range urls {
+				fprintf(globalFlags.stdout, "%s %s\n", modules[u], u)
+			}
+			return nil
+		},
+	}
+
+	vendorCmd.Flags().SortFlags = false
+	vendorCmd.Flags().AddFlagSet(runtimeOptionFlagSet(false))
+
+	return vendorCmd
+}
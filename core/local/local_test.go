@@ -46,6 +46,7 @@ import (
 	"go.k6.io/k6/lib/netext"
 	"go.k6.io/k6/lib/netext/httpext"
 	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/lib/testutils/dnstest"
 	"go.k6.io/k6/lib/testutils/httpmultibin"
 	"go.k6.io/k6/lib/testutils/minirunner"
 	"go.k6.io/k6/lib/testutils/mockresolver"
@@ -1111,6 +1112,57 @@ func TestDNSResolver(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("servers", func(t *testing.T) {
+		t.Parallel()
+		dns := dnstest.NewServer(t)
+		dns.AddIP("myhost", net.ParseIP(sr("HTTPBIN_IP")))
+
+		logger := logrus.New()
+		logger.SetOutput(ioutil.Discard)
+		logHook := testutils.SimpleLogrusHook{HookedLevels: []logrus.Level{logrus.WarnLevel}}
+		logger.AddHook(&logHook)
+
+		registry := metrics.NewRegistry()
+		builtinMetrics := metrics.RegisterBuiltinMetrics(registry)
+		runner, err := js.New(logger, &loader.SourceData{
+			URL: &url.URL{Path: "/script.js"}, Data: []byte(sr(`
+				import http from "k6/http";
+
+				export let options = {
+					vus: 1,
+					iterations: 2,
+					noConnectionReuse: true,
+				}
+
+				export default function () {
+					const res = http.get("http://myhost:HTTPBIN_PORT/");
+					if (res.status != 200) { throw new Error("unexpected status " + res.status); }
+					if (res.timings.looking_up < 0) { throw new Error("unexpected looking_up"); }
+				}`)),
+		}, nil, lib.RuntimeOptions{}, builtinMetrics, registry)
+		require.NoError(t, err)
+
+		// the OS resolver doesn't know about myhost
+		runner.ActualResolver = mockresolver.New(nil, nil).LookupIPAll
+
+		err = runner.SetOptions(runner.GetOptions().Apply(lib.Options{DNS: types.DNSConfig{
+			Servers: []string{"quic://" + dns.Addr},
+		}}))
+		require.EqualError(t, err, "invalid DNS server 'quic://"+dns.Addr+"': unsupported protocol 'quic'")
+
+		ctx, cancel, execScheduler, samples := newTestExecutionScheduler(t, runner, logger, lib.Options{
+			DNS: types.DNSConfig{
+				TTL:     null.StringFrom("0"),
+				Servers: []string{"tcp://" + dns.Addr},
+			},
+		})
+		defer cancel()
+		require.NoError(t, execScheduler.Run(ctx, ctx, samples, builtinMetrics))
+		assert.Empty(t, logHook.Drain())
+		// an A and an AAAA query for each iteration
+		assert.Equal(t, int64(4), atomic.LoadInt64(&dns.Queries))
+	})
 }
 
 func TestRealTimeAndSetupTeardownMetrics(t *testing.T) {
@@ -9,6 +9,7 @@ require (
 	github.com/Soontao/goHttpDigestClient v0.0.0-20170320082612-6d28bb1415c5
 	github.com/andybalholm/brotli v1.0.3
 	github.com/dop251/goja v0.0.0-20220124171016-cfb079cdc7b4
+	github.com/evanw/esbuild v0.17.19
 	github.com/fatih/color v1.12.0
 	github.com/golang/protobuf v1.4.3
 	github.com/gorilla/websocket v1.4.2
@@ -51,7 +52,7 @@ require (
 	github.com/onsi/ginkgo v1.14.0 // indirect
 	github.com/onsi/gomega v1.10.1 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
-	golang.org/x/sys v0.0.0-20210511113859-b0526f3d8744 // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 	golang.org/x/text v0.3.7-0.20210503195748-5c7c50ebbd4f // indirect
-	google.golang.org/genproto v0.0.0-20200903010400-9bfcb5116336 // indirect
+	google.golang.org/genproto v0.0.0-20200903010400-9bfcb5116336
 )
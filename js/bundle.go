@@ -27,7 +27,9 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/dop251/goja"
 	"github.com/sirupsen/logrus"
@@ -92,6 +94,10 @@ func NewBundle(
 	if err != nil {
 		return nil, err
 	}
+	importMap, err := loadImportMap(logger, filesystems, src.URL, rtOpts.ImportMap.String)
+	if err != nil {
+		return nil, err
+	}
 	// Make a bundle, instantiate it into a throwaway VM to populate caches.
 	rt := goja.New()
 	bundle := Bundle{
@@ -105,6 +111,8 @@ func NewBundle(
 		exports:           make(map[string]goja.Callable),
 		registry:          registry,
 	}
+	bundle.BaseInitContext.moduleURL = src.URL
+	bundle.BaseInitContext.importMap = importMap
 	if err = bundle.instantiate(logger, rt, bundle.BaseInitContext, 0); err != nil {
 		return nil, err
 	}
@@ -148,6 +156,8 @@ func NewBundleFromArchive(
 	rt := goja.New()
 	initctx := NewInitContext(logger, rt, c, compatMode,
 		new(context.Context), arc.Filesystems, arc.PwdURL)
+	initctx.moduleURL = arc.FilenameURL
+	initctx.importMap = arc.ImportMap
 
 	env := arc.Env
 	if env == nil {
@@ -193,6 +203,7 @@ func (b *Bundle) makeArchive() *lib.Archive {
 		FilenameURL:       b.Filename,
 		Data:              []byte(b.Source),
 		PwdURL:            b.BaseInitContext.pwd,
+		ImportMap:         b.BaseInitContext.importMap,
 		Env:               make(map[string]string, len(b.RuntimeOptions.Env)),
 		CompatibilityMode: b.CompatibilityMode.String(),
 		K6Version:         consts.Version,
@@ -315,6 +326,9 @@ func (b *Bundle) instantiate(logger logrus.FieldLogger, rt *goja.Runtime, init *
 	rt.Set("__ENV", env)
 	rt.Set("__VU", vuID)
 	_ = rt.Set("console", newConsole(logger))
+	if err := common.RegisterWebAPIs(rt); err != nil {
+		return err
+	}
 
 	if init.compatibilityMode == lib.CompatibilityModeExtended {
 		rt.Set("global", rt.GlobalObject())
@@ -357,6 +371,28 @@ func (b *Bundle) instantiate(logger logrus.FieldLogger, rt *goja.Runtime, init *
 	return nil
 }
 
+// loadImportMap loads the import map at filename, a relative one is resolved
+// from the directory of the script.
+func loadImportMap(
+	logger logrus.FieldLogger, filesystems map[string]afero.Fs, script *url.URL, filename string,
+) (*loader.ImportMap, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	if !strings.Contains(filename, "://") && !filepath.IsAbs(filename) && !strings.HasPrefix(filename, ".") {
+		filename = "./" + filename // it's a path, not a remote module without a scheme
+	}
+	u, err := loader.Resolve(loader.Dir(script), filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := loader.Load(logger, filesystems, u, filename)
+	if err != nil {
+		return nil, err
+	}
+	return loader.ParseImportMap(data.Data, data.URL)
+}
+
 func generateSourceMapLoader(logger logrus.FieldLogger, filesystems map[string]afero.Fs,
 ) func(path string) ([]byte, error) {
 	return func(path string) ([]byte, error) {
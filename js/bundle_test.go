@@ -21,6 +21,7 @@
 package js
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
@@ -976,3 +977,132 @@ func TestBundleMakeArchive(t *testing.T) {
 		})
 	}
 }
+
+func TestBundleMakeArchiveStreamedFile(t *testing.T) {
+	t.Parallel()
+	script := `
+		import { open } from "k6/experimental/fs";
+		const file = open("./file.txt");
+		export default function() { file.seek(0); return file.readLine(); };`
+
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/path/to", 0o755)
+	_ = afero.WriteFile(fs, "/path/to/file.txt", []byte("first\nsecond"), 0o644)
+	b, err := getSimpleBundle(t, "/path/to/script.js", script, fs)
+	require.NoError(t, err)
+
+	arc := b.makeArchive()
+	fileData, err := afero.ReadFile(arc.Filesystems["file"], "/path/to/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond", string(fileData))
+
+	b, err = NewBundleFromArchive(testutils.NewLogger(t), arc, lib.RuntimeOptions{}, metrics.NewRegistry())
+	require.NoError(t, err)
+	bi, err := b.Instantiate(testutils.NewLogger(t), 0, newModuleVUImpl())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		v, err := bi.exports[consts.DefaultFn](goja.Undefined())
+		require.NoError(t, err)
+		assert.Equal(t, "first", v.Export())
+	}
+}
+
+func TestBundleMakeArchiveTypeScript(t *testing.T) {
+	t.Parallel()
+	script := `
+		import exclaim from "./exclaim.ts";
+		interface Options { vus: number }
+		export let options: Options = { vus: 12345 };
+		export default function(): string { return exclaim("hi"); };`
+	exclaim := `export default function(s: string): string { return s + "!" };`
+
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/path/to", 0o755)
+	_ = afero.WriteFile(fs, "/path/to/exclaim.ts", []byte(exclaim), 0o644)
+	b, err := getSimpleBundle(t, "/path/to/script.ts", script, fs)
+	require.NoError(t, err)
+
+	// the archive has the original sources, which are transpiled again when it's run
+	arc := b.makeArchive()
+	assert.Equal(t, "file:///path/to/script.ts", arc.FilenameURL.String())
+	assert.Equal(t, script, string(arc.Data))
+	exclaimData, err := afero.ReadFile(arc.Filesystems["file"], "/path/to/exclaim.ts")
+	require.NoError(t, err)
+	assert.Equal(t, exclaim, string(exclaimData))
+
+	b, err = NewBundleFromArchive(testutils.NewLogger(t), arc, lib.RuntimeOptions{}, metrics.NewRegistry())
+	require.NoError(t, err)
+	assert.Equal(t, lib.Options{VUs: null.IntFrom(12345)}, b.Options)
+	bi, err := b.Instantiate(testutils.NewLogger(t), 0, newModuleVUImpl())
+	require.NoError(t, err)
+	v, err := bi.exports[consts.DefaultFn](goja.Undefined())
+	require.NoError(t, err)
+	assert.Equal(t, "hi!", v.Export())
+}
+
+func TestBundleNodeModules(t *testing.T) {
+	t.Parallel()
+	script := `
+		import { greet } from "greet";
+		import { exclaim } from "greet/exclaim";
+		import shout from "shout";
+		import http from "k6/http";
+		export default function() { return shout(exclaim(greet("k6"))); };`
+
+	baseFs := afero.NewMemMapFs()
+	files := map[string]string{
+		"/path/node_modules/greet/package.json": `{"main": "lib/index.js"}`,
+		"/path/node_modules/greet/lib/index.js": `export { exclaim } from "./exclaim.js";
+			export function greet(name) { return "hello " + name; }`,
+		"/path/node_modules/greet/lib/exclaim.js": `export function exclaim(s) { return s + "!"; }`,
+		"/path/node_modules/greet/exclaim.js":     `export { exclaim } from "./lib/exclaim.js";`,
+		"/path/node_modules/greet/unused.js":      `throw "not imported";`,
+		"/path/node_modules/greet/README.md":      `# greet`,
+		"/path/to/vendor/shout.js":                `export default function(s) { return s.toUpperCase(); }`,
+		"/path/to/importmap.json":                 `{"imports": {"shout": "./vendor/shout.js"}}`,
+	}
+	for name, data := range files {
+		require.NoError(t, afero.WriteFile(baseFs, name, []byte(data), 0o644))
+	}
+	require.NoError(t, afero.WriteFile(baseFs, "/path/to/script.js", []byte(script), 0o644))
+	fs := fsext.NewCacheOnReadFs(baseFs, afero.NewMemMapFs(), 0)
+	_, err := afero.ReadFile(fs, "/path/to/script.js") // like when the script is loaded
+	require.NoError(t, err)
+	b, err := getSimpleBundle(t, "/path/to/script.js", script, fs,
+		lib.RuntimeOptions{ImportMap: null.StringFrom("importmap.json")})
+	require.NoError(t, err)
+
+	assert.Equal(t, []*Dependency{
+		{Specifier: "greet", URL: "file:///path/node_modules/greet/lib/index.js", Dependencies: []*Dependency{
+			{Specifier: "./exclaim.js", URL: "file:///path/node_modules/greet/lib/exclaim.js"},
+		}},
+		{Specifier: "greet/exclaim", URL: "file:///path/node_modules/greet/exclaim.js", Dependencies: []*Dependency{
+			{Specifier: "./lib/exclaim.js", URL: "file:///path/node_modules/greet/lib/exclaim.js"},
+		}},
+		{Specifier: "shout", URL: "file:///path/to/vendor/shout.js"},
+		{Specifier: "k6/http", URL: "k6/http"},
+	}, b.Dependencies())
+
+	// only the files that were imported are in the archive
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, b.makeArchive().Write(buf))
+	arc, err := lib.ReadArchive(buf)
+	require.NoError(t, err)
+	for name := range files {
+		exists, err := afero.Exists(arc.Filesystems["file"], name)
+		require.NoError(t, err)
+		assert.Equal(t, !strings.HasSuffix(name, "unused.js") && !strings.HasSuffix(name, ".md"), exists, name)
+	}
+	require.NotNil(t, arc.ImportMap)
+	assert.Equal(t, map[string]string{"shout": "file:///path/to/vendor/shout.js"}, arc.ImportMap.Imports)
+
+	b, err = NewBundleFromArchive(testutils.NewLogger(t), arc, lib.RuntimeOptions{}, metrics.NewRegistry())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		bi, err := b.Instantiate(testutils.NewLogger(t), uint64(i), newModuleVUImpl())
+		require.NoError(t, err)
+		v, err := bi.exports[consts.DefaultFn](goja.Undefined())
+		require.NoError(t, err)
+		assert.Equal(t, "HELLO K6!", v.Export())
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ErrAborted is wrapped by the errors of the aborted AbortSignals.
+var ErrAborted = errors.New("aborted")
+
+// abortSignalSymbol is the key of the state of the AbortSignals, which is the
+// same on all runtimes so GetAbortSignal doesn't need the class.
+var abortSignalSymbol = goja.NewSymbol("AbortSignal") //nolint:gochecknoglobals
+
+// AbortSignal is the Go side of an AbortSignal. Its Done and Err can be used
+// like the ones of a context from any goroutine, e.g. to cancel a request.
+type AbortSignal struct {
+	done chan struct{}
+	mu   sync.Mutex
+	err  error
+
+	// these are only used on the runtime of the signal
+	reason    goja.Value
+	onabort   goja.Value
+	listeners []goja.Value
+}
+
+func newAbortSignal() *AbortSignal {
+	return &AbortSignal{done: make(chan struct{})}
+}
+
+// Done returns a channel that's closed when the signal is aborted.
+func (s *AbortSignal) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns nil if the signal isn't aborted, or an error with the reason.
+func (s *AbortSignal) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// GetAbortSignal returns the AbortSignal of the value, or nil if it isn't one.
+func GetAbortSignal(v goja.Value) *AbortSignal {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil
+	}
+	state := obj.GetSymbol(abortSignalSymbol)
+	if state == nil {
+		return nil
+	}
+	signal, _ := state.Export().(*AbortSignal)
+	return signal
+}
+
+// setErr aborts the signal with the error, if it isn't aborted yet. It can be
+// called from any goroutine.
+func (s *AbortSignal) setErr(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false
+	}
+	s.err = err
+	close(s.done)
+	return true
+}
+
+// syncReason sets the reason of the signals that timed out, as they are
+// aborted outside of the runtime.
+func (s *AbortSignal) syncReason(rt *goja.Runtime) {
+	if s.reason == nil && s.Err() != nil {
+		s.reason = NewDOMException(rt, "The operation timed out.", "TimeoutError")
+	}
+}
+
+// abort aborts the signal and dispatches the abort event to its listeners.
+// Unlike in the browsers, the exceptions of the listeners are thrown.
+func (s *AbortSignal) abort(rt *goja.Runtime, target *goja.Object, reason goja.Value) {
+	s.syncReason(rt)
+	if s.reason != nil {
+		return
+	}
+	if reason == nil || goja.IsUndefined(reason) {
+		reason = NewDOMException(rt, "The operation was aborted.", "AbortError")
+	}
+	s.reason = reason
+	s.setErr(fmt.Errorf("%w: %s", ErrAborted, reason.String()))
+
+	event := rt.NewObject()
+	_ = event.Set("type", "abort")
+	_ = event.Set("target", target)
+	_ = event.Set("currentTarget", target)
+	listeners := s.listeners
+	if s.onabort != nil {
+		listeners = append([]goja.Value{s.onabort}, listeners...)
+	}
+	s.listeners = nil
+	for _, l := range listeners {
+		fn, _ := goja.AssertFunction(l)
+		if _, err := fn(target, event); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func newAbortSignalClass(rt *goja.Runtime) *webClass {
+	c := newWebClass(rt, "AbortSignal", nil)
+	c.symbol = abortSignalSymbol
+
+	get := func(call goja.FunctionCall) *AbortSignal {
+		signal := c.mustState(call.This).(*AbortSignal)
+		signal.syncReason(rt)
+		return signal
+	}
+	c.static("abort", func(call goja.FunctionCall) goja.Value {
+		signal := newAbortSignal()
+		obj := c.newInstance(signal)
+		signal.abort(rt, obj, call.Argument(0))
+		return obj
+	})
+	// the signals of timeout are aborted from another goroutine, so their abort
+	// event isn't dispatched, but they are aborted and can cancel requests.
+	c.static("timeout", func(call goja.FunctionCall) goja.Value {
+		ms := call.Argument(0).ToFloat()
+		if ms < 0 || math.IsNaN(ms) {
+			panic(rt.NewTypeError("the timeout needs to be a non-negative number"))
+		}
+		signal := newAbortSignal()
+		time.AfterFunc(time.Duration(ms*float64(time.Millisecond)), func() {
+			signal.setErr(fmt.Errorf("%w: the operation timed out", ErrAborted))
+		})
+		return c.newInstance(signal)
+	})
+	c.accessor("aborted", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(get(call).reason != nil)
+	}, nil)
+	c.accessor("reason", func(call goja.FunctionCall) goja.Value {
+		if reason := get(call).reason; reason != nil {
+			return reason
+		}
+		return goja.Undefined()
+	}, nil)
+	c.accessor("onabort", func(call goja.FunctionCall) goja.Value {
+		if onabort := get(call).onabort; onabort != nil {
+			return onabort
+		}
+		return goja.Null()
+	}, func(call goja.FunctionCall) goja.Value {
+		signal := get(call)
+		signal.onabort = nil
+		if _, ok := goja.AssertFunction(call.Argument(0)); ok {
+			signal.onabort = call.Argument(0)
+		}
+		return goja.Undefined()
+	})
+	c.method("throwIfAborted", func(call goja.FunctionCall) goja.Value {
+		if reason := get(call).reason; reason != nil {
+			panic(reason)
+		}
+		return goja.Undefined()
+	})
+	c.method("addEventListener", func(call goja.FunctionCall) goja.Value {
+		signal := get(call)
+		fn := call.Argument(1)
+		if _, ok := goja.AssertFunction(fn); !ok || call.Argument(0).String() != "abort" || signal.reason != nil {
+			return goja.Undefined()
+		}
+		// the listeners are only called once anyway, as a signal is only aborted once
+		for _, l := range signal.listeners {
+			if l.StrictEquals(fn) {
+				return goja.Undefined()
+			}
+		}
+		signal.listeners = append(signal.listeners, fn)
+		return goja.Undefined()
+	})
+	c.method("removeEventListener", func(call goja.FunctionCall) goja.Value {
+		signal := get(call)
+		if call.Argument(0).String() != "abort" {
+			return goja.Undefined()
+		}
+		for i, l := range signal.listeners {
+			if l.StrictEquals(call.Argument(1)) {
+				signal.listeners = append(signal.listeners[:i:i], signal.listeners[i+1:]...)
+				break
+			}
+		}
+		return goja.Undefined()
+	})
+	return c
+}
+
+func newAbortControllerClass(rt *goja.Runtime, signalClass *webClass) *webClass {
+	type abortController struct {
+		signal    *AbortSignal
+		signalObj *goja.Object
+	}
+	c := newWebClass(rt, "AbortController", func(call goja.ConstructorCall) interface{} {
+		signal := newAbortSignal()
+		return &abortController{signal: signal, signalObj: signalClass.newInstance(signal)}
+	})
+	c.accessor("signal", func(call goja.FunctionCall) goja.Value {
+		return c.mustState(call.This).(*abortController).signalObj
+	}, nil)
+	c.method("abort", func(call goja.FunctionCall) goja.Value {
+		ac := c.mustState(call.This).(*abortController)
+		ac.signal.abort(rt, ac.signalObj, call.Argument(0))
+		return goja.Undefined()
+	})
+	return c
+}
@@ -0,0 +1,198 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+)
+
+// cloner makes the deep copies of structuredClone, the objects that it has
+// already copied are kept, so the cycles and the shared references are too.
+type cloner struct {
+	rt     *goja.Runtime
+	copies map[*goja.Object]*goja.Object
+
+	typedArrayProto *goja.Object
+	dataViewProto   *goja.Object
+}
+
+// structuredClone implements structuredClone(value, [options]), the only
+// option is transfer with the ArrayBuffers that are moved to the copy.
+func structuredClone(rt *goja.Runtime, v, options goja.Value) goja.Value {
+	c := &cloner{
+		rt:              rt,
+		copies:          make(map[*goja.Object]*goja.Object),
+		typedArrayProto: rt.Get("Uint8Array").ToObject(rt).Get("prototype").ToObject(rt).Prototype(),
+		dataViewProto:   rt.Get("DataView").ToObject(rt).Get("prototype").ToObject(rt),
+	}
+
+	var transfer []goja.ArrayBuffer
+	if obj, ok := options.(*goja.Object); ok {
+		if list, ok := obj.Get("transfer").(*goja.Object); ok {
+			isIterable := iterate(rt, list, func(v goja.Value) {
+				obj, ok := v.(*goja.Object)
+				if !ok || obj.ExportType() != arrayBufferT {
+					panic(NewDOMException(rt, "Only ArrayBuffers can be transferred.", "DataCloneError"))
+				}
+				if _, ok := c.copies[obj]; ok {
+					panic(NewDOMException(rt, "An ArrayBuffer is transferred more than once.", "DataCloneError"))
+				}
+				ab, _ := obj.Export().(goja.ArrayBuffer)
+				transfer = append(transfer, ab)
+				c.copies[obj] = rt.ToValue(rt.NewArrayBuffer(append([]byte(nil), ab.Bytes()...))).ToObject(rt)
+			})
+			if !isIterable {
+				panic(rt.NewTypeError("The transfer option needs to be an iterable"))
+			}
+		}
+	}
+
+	clone := c.clone(v)
+	for _, ab := range transfer {
+		ab.Detach()
+	}
+	return clone
+}
+
+func (c *cloner) dataCloneError(what string) *goja.Object {
+	return NewDOMException(c.rt, fmt.Sprintf("%s could not be cloned.", what), "DataCloneError")
+}
+
+func (c *cloner) construct(name string, args ...goja.Value) *goja.Object {
+	obj, err := c.rt.New(c.rt.Get(name), args...)
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+func (c *cloner) call(obj *goja.Object, method string, args ...goja.Value) goja.Value {
+	fn, ok := goja.AssertFunction(obj.Get(method))
+	if !ok {
+		panic(c.dataCloneError(obj.String()))
+	}
+	v, err := fn(obj, args...)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (c *cloner) inherits(obj, proto *goja.Object) bool {
+	for p := obj.Prototype(); p != nil; p = p.Prototype() {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+//nolint:funlen,cyclop
+func (c *cloner) clone(v goja.Value) goja.Value {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		if _, ok := v.(*goja.Symbol); ok {
+			panic(c.dataCloneError(v.String()))
+		}
+		return v
+	}
+	if clone, ok := c.copies[obj]; ok {
+		return clone
+	}
+	if _, ok := goja.AssertFunction(obj); ok {
+		panic(c.dataCloneError(obj.String()))
+	}
+
+	rt := c.rt
+	var clone *goja.Object
+	switch obj.ClassName() {
+	case "Boolean", "Number", "String":
+		clone = c.construct("Object", c.call(obj, "valueOf"))
+	case "Date":
+		clone = c.construct("Date", obj.ToNumber())
+	case "RegExp":
+		clone = c.construct("RegExp", obj.Get("source"), obj.Get("flags"))
+	case "Error":
+		name := obj.Get("name").String()
+		switch name {
+		case "EvalError", "RangeError", "ReferenceError", "SyntaxError", "TypeError", "URIError":
+		default:
+			name = "Error"
+		}
+		clone = c.construct(name, obj.Get("message"))
+		if stack := obj.Get("stack"); stack != nil {
+			_ = clone.Set("stack", stack.String())
+		}
+	case "Map", "Set":
+		var values []goja.Value
+		c.call(obj, "forEach", rt.ToValue(func(call goja.FunctionCall) goja.Value {
+			values = append(values, call.Argument(1), call.Argument(0))
+			return goja.Undefined()
+		}))
+		clone = c.construct(obj.ClassName())
+		c.copies[obj] = clone
+		for i := 0; i < len(values); i += 2 {
+			if obj.ClassName() == "Map" {
+				c.call(clone, "set", c.clone(values[i]), c.clone(values[i+1]))
+			} else {
+				c.call(clone, "add", c.clone(values[i]))
+			}
+		}
+		return clone
+	case "Array":
+		clone = rt.NewArray()
+		c.copies[obj] = clone
+		_ = clone.Set("length", obj.Get("length"))
+		c.cloneProperties(obj, clone)
+		return clone
+	default:
+		switch {
+		case obj.ExportType() == arrayBufferT:
+			ab, _ := obj.Export().(goja.ArrayBuffer)
+			clone = rt.ToValue(rt.NewArrayBuffer(append([]byte(nil), ab.Bytes()...))).ToObject(rt)
+		case c.inherits(obj, c.typedArrayProto):
+			buffer := c.clone(obj.Get("buffer"))
+			clone = c.construct(obj.GetSymbol(goja.SymToStringTag).String(), buffer, obj.Get("byteOffset"), obj.Get("length"))
+		case c.inherits(obj, c.dataViewProto):
+			buffer := c.clone(obj.Get("buffer"))
+			clone = c.construct("DataView", buffer, obj.Get("byteOffset"), obj.Get("byteLength"))
+		default:
+			clone = rt.NewObject()
+			c.copies[obj] = clone
+			c.cloneProperties(obj, clone)
+			return clone
+		}
+	}
+	c.copies[obj] = clone
+	return clone
+}
+
+// cloneProperties copies the own enumerable properties, which are all that
+// is copied of the plain objects and the arrays.
+func (c *cloner) cloneProperties(obj, clone *goja.Object) {
+	for _, k := range obj.Keys() {
+		if err := clone.Set(k, c.clone(obj.Get(k))); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+)
+
+// textEncodingLabels maps the labels of the encodings that TextDecoder
+// supports to their names, see https://encoding.spec.whatwg.org/#names-and-labels
+var textEncodingLabels = map[string]string{ //nolint:gochecknoglobals
+	"unicode-1-1-utf-8": "utf-8", "unicode11utf8": "utf-8", "unicode20utf8": "utf-8", "utf-8": "utf-8",
+	"utf8": "utf-8", "x-unicode20utf8": "utf-8",
+	"csunicode": "utf-16le", "iso-10646-ucs-2": "utf-16le", "ucs-2": "utf-16le", "unicode": "utf-16le",
+	"unicodefeff": "utf-16le", "utf-16": "utf-16le", "utf-16le": "utf-16le",
+	"unicodefffe": "utf-16be", "utf-16be": "utf-16be",
+	"ansi_x3.4-1968": "windows-1252", "ascii": "windows-1252", "cp1252": "windows-1252", "cp819": "windows-1252",
+	"csisolatin1": "windows-1252", "ibm819": "windows-1252", "iso-8859-1": "windows-1252",
+	"iso-ir-100": "windows-1252", "iso8859-1": "windows-1252", "iso88591": "windows-1252",
+	"iso_8859-1": "windows-1252", "iso_8859-1:1987": "windows-1252", "l1": "windows-1252", "latin1": "windows-1252",
+	"us-ascii": "windows-1252", "windows-1252": "windows-1252", "x-cp1252": "windows-1252",
+}
+
+// windows1252 has the code points of the bytes from 0x80 to 0x9F in
+// windows-1252, the others are the same as their code points.
+var windows1252 = [32]rune{ //nolint:gochecknoglobals
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func newTextEncoderClass(rt *goja.Runtime) *webClass {
+	c := newWebClass(rt, "TextEncoder", func(goja.ConstructorCall) interface{} {
+		return &struct{}{}
+	})
+	c.accessor("encoding", func(call goja.FunctionCall) goja.Value {
+		c.mustState(call.This)
+		return rt.ToValue("utf-8")
+	}, nil)
+	c.method("encode", func(call goja.FunctionCall) goja.Value {
+		c.mustState(call.This)
+		var input string
+		if v := call.Argument(0); !goja.IsUndefined(v) {
+			input = v.String()
+		}
+		return newUint8Array(rt, []byte(input))
+	})
+	c.method("encodeInto", func(call goja.FunctionCall) goja.Value {
+		c.mustState(call.This)
+		source := call.Argument(0).String()
+		dest, ok := bufferSourceBytes(call.Argument(1))
+		if !ok {
+			panic(rt.NewTypeError("The destination of encodeInto needs to be a Uint8Array"))
+		}
+		var read, written int
+		for _, r := range source {
+			n := utf8.RuneLen(r)
+			if written+n > len(dest) {
+				break
+			}
+			utf8.EncodeRune(dest[written:], r)
+			written += n
+			read += len(utf16.Encode([]rune{r}))
+		}
+		result := rt.NewObject()
+		_ = result.Set("read", read)
+		_ = result.Set("written", written)
+		return result
+	})
+	return c
+}
+
+// textDecoder is the state of a TextDecoder, it keeps the incomplete sequences
+// at the end of the input when it's streamed.
+type textDecoder struct {
+	encoding  string
+	fatal     bool
+	ignoreBOM bool
+
+	bomSeen bool
+	utf8    utf8Decoder
+	utf16   utf16Decoder
+}
+
+func newTextDecoderClass(rt *goja.Runtime) *webClass {
+	c := newWebClass(rt, "TextDecoder", func(call goja.ConstructorCall) interface{} {
+		label := "utf-8"
+		if v := call.Argument(0); !goja.IsUndefined(v) {
+			label = v.String()
+		}
+		encoding, ok := textEncodingLabels[strings.ToLower(strings.TrimSpace(label))]
+		if !ok {
+			panic(newRangeError(rt, fmt.Sprintf("The encoding label provided ('%s') is invalid", label)))
+		}
+		d := &textDecoder{encoding: encoding}
+		if options, ok := call.Argument(1).(*goja.Object); ok {
+			d.fatal = options.Get("fatal") != nil && options.Get("fatal").ToBoolean()
+			d.ignoreBOM = options.Get("ignoreBOM") != nil && options.Get("ignoreBOM").ToBoolean()
+		}
+		d.utf16.bigEndian = encoding == "utf-16be"
+		return d
+	})
+	c.accessor("encoding", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(c.mustState(call.This).(*textDecoder).encoding)
+	}, nil)
+	c.accessor("fatal", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(c.mustState(call.This).(*textDecoder).fatal)
+	}, nil)
+	c.accessor("ignoreBOM", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(c.mustState(call.This).(*textDecoder).ignoreBOM)
+	}, nil)
+	c.method("decode", func(call goja.FunctionCall) goja.Value {
+		d := c.mustState(call.This).(*textDecoder)
+		var input []byte
+		if v := call.Argument(0); !goja.IsUndefined(v) {
+			var ok bool
+			if input, ok = bufferSourceBytes(v); !ok {
+				panic(rt.NewTypeError("The input of decode needs to be an ArrayBuffer or an ArrayBufferView"))
+			}
+		}
+		stream := false
+		if options, ok := call.Argument(1).(*goja.Object); ok && options.Get("stream") != nil {
+			stream = options.Get("stream").ToBoolean()
+		}
+		s, err := d.decode(input, stream)
+		if err != nil {
+			panic(rt.NewTypeError(err.Error()))
+		}
+		return rt.ToValue(s)
+	})
+	return c
+}
+
+func (d *textDecoder) decode(input []byte, stream bool) (string, error) {
+	var (
+		runes []rune
+		ok    bool
+	)
+	switch d.encoding {
+	case "utf-8":
+		runes, ok = d.utf8.decode(input, !stream, d.fatal)
+	case "windows-1252":
+		runes, ok = make([]rune, len(input)), true
+		for i, b := range input {
+			if b >= 0x80 && b <= 0x9F {
+				runes[i] = windows1252[b-0x80]
+			} else {
+				runes[i] = rune(b)
+			}
+		}
+	default:
+		runes, ok = d.utf16.decode(input, !stream, d.fatal)
+	}
+	if !ok {
+		d.reset()
+		return "", fmt.Errorf("the encoded data was not valid for encoding %s", d.encoding)
+	}
+	if !d.ignoreBOM && !d.bomSeen && len(runes) > 0 {
+		d.bomSeen = true
+		if runes[0] == 0xFEFF && d.encoding != "windows-1252" {
+			runes = runes[1:]
+		}
+	}
+	if !stream {
+		d.reset()
+	}
+	return string(runes), nil
+}
+
+func (d *textDecoder) reset() {
+	d.bomSeen = false
+	d.utf8 = utf8Decoder{}
+	d.utf16 = utf16Decoder{bigEndian: d.utf16.bigEndian}
+}
+
+// utf8Decoder decodes UTF-8 like https://encoding.spec.whatwg.org/#utf-8-decoder
+// does, which replaces every maximal invalid subsequence with U+FFFD.
+type utf8Decoder struct {
+	codePoint, bytesSeen, bytesNeeded int
+	lower, upper                      byte
+}
+
+// decode returns the code points of the input, the second result is false if
+// it's invalid and fatal is set.
+func (d *utf8Decoder) decode(input []byte, flush, fatal bool) ([]rune, bool) {
+	runes := make([]rune, 0, len(input))
+	if d.lower == 0 {
+		d.lower, d.upper = 0x80, 0xBF
+	}
+	for i := 0; i < len(input); i++ {
+		b := input[i]
+		if d.bytesNeeded == 0 {
+			switch {
+			case b <= 0x7F:
+				runes = append(runes, rune(b))
+			case b >= 0xC2 && b <= 0xDF:
+				d.bytesNeeded, d.codePoint = 1, int(b&0x1F)
+			case b >= 0xE0 && b <= 0xEF:
+				if b == 0xE0 {
+					d.lower = 0xA0
+				} else if b == 0xED {
+					d.upper = 0x9F
+				}
+				d.bytesNeeded, d.codePoint = 2, int(b&0xF)
+			case b >= 0xF0 && b <= 0xF4:
+				if b == 0xF0 {
+					d.lower = 0x90
+				} else if b == 0xF4 {
+					d.upper = 0x8F
+				}
+				d.bytesNeeded, d.codePoint = 3, int(b&0x7)
+			default:
+				if fatal {
+					return nil, false
+				}
+				runes = append(runes, utf8.RuneError)
+			}
+			continue
+		}
+		if b < d.lower || b > d.upper {
+			*d = utf8Decoder{lower: 0x80, upper: 0xBF}
+			if fatal {
+				return nil, false
+			}
+			runes = append(runes, utf8.RuneError)
+			i-- // the byte is decoded again
+			continue
+		}
+		d.lower, d.upper = 0x80, 0xBF
+		d.codePoint = d.codePoint<<6 | int(b&0x3F)
+		d.bytesSeen++
+		if d.bytesSeen == d.bytesNeeded {
+			runes = append(runes, rune(d.codePoint))
+			d.codePoint, d.bytesSeen, d.bytesNeeded = 0, 0, 0
+		}
+	}
+	if flush && d.bytesNeeded != 0 {
+		*d = utf8Decoder{}
+		if fatal {
+			return nil, false
+		}
+		runes = append(runes, utf8.RuneError)
+	}
+	return runes, true
+}
+
+// utf16Decoder decodes UTF-16 like https://encoding.spec.whatwg.org/#shared-utf-16-decoder
+// does, which replaces the lone surrogates with U+FFFD.
+type utf16Decoder struct {
+	bigEndian     bool
+	leadByte      byte
+	hasLeadByte   bool
+	leadSurrogate uint16
+}
+
+func (d *utf16Decoder) decode(input []byte, flush, fatal bool) ([]rune, bool) {
+	runes := make([]rune, 0, len(input)/2+1)
+	for _, b := range input {
+		if !d.hasLeadByte {
+			d.leadByte, d.hasLeadByte = b, true
+			continue
+		}
+		var unit uint16
+		if d.bigEndian {
+			unit = uint16(d.leadByte)<<8 | uint16(b)
+		} else {
+			unit = uint16(b)<<8 | uint16(d.leadByte)
+		}
+		d.hasLeadByte = false
+		if d.leadSurrogate != 0 {
+			lead := d.leadSurrogate
+			d.leadSurrogate = 0
+			if unit >= 0xDC00 && unit <= 0xDFFF {
+				runes = append(runes, utf16.DecodeRune(rune(lead), rune(unit)))
+				continue
+			}
+			if fatal {
+				return nil, false
+			}
+			runes = append(runes, utf8.RuneError)
+		}
+		switch {
+		case unit >= 0xD800 && unit <= 0xDBFF:
+			d.leadSurrogate = unit
+		case unit >= 0xDC00 && unit <= 0xDFFF:
+			if fatal {
+				return nil, false
+			}
+			runes = append(runes, utf8.RuneError)
+		default:
+			runes = append(runes, rune(unit))
+		}
+	}
+	if flush && (d.hasLeadByte || d.leadSurrogate != 0) {
+		*d = utf16Decoder{bigEndian: d.bigEndian}
+		if fatal {
+			return nil, false
+		}
+		runes = append(runes, utf8.RuneError)
+	}
+	return runes, true
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import "testing"
+
+func TestTextEncoder(t *testing.T) {
+	t.Parallel()
+	runWebAPITests(t, []webAPITestCase{
+		{"encoding", `new TextEncoder().encoding`, "utf-8"},
+		{"encode", `new TextEncoder().encode("a€😀").join()`, "97,226,130,172,240,159,152,128"},
+		{"encode empty", `String(new TextEncoder().encode().length)`, "0"},
+		{"encodeInto", `
+			var buf = new Uint8Array(5), r = new TextEncoder().encodeInto("a€😀", buf);
+			r.read + " " + r.written + " " + buf.join()`,
+			"2 4 97,226,130,172,0"},
+	})
+}
+
+func TestTextDecoder(t *testing.T) {
+	t.Parallel()
+	runWebAPITests(t, []webAPITestCase{
+		{"utf-8", `new TextDecoder().decode(new Uint8Array([0xEF, 0xBB, 0xBF, 97, 226, 130, 172]))`, "a€"},
+		{"ignoreBOM", `new TextDecoder("utf-8", { ignoreBOM: true }).decode(new Uint8Array([0xEF, 0xBB, 0xBF, 97])).length`,
+			"2"},
+		{"replacement", `new TextDecoder().decode(new Uint8Array([97, 0xFF, 98, 0xE2, 0x82]))`, "a�b�"},
+		{"fatal", `try { new TextDecoder("utf-8", { fatal: true }).decode(new Uint8Array([0xFF])); "" } catch (e) { e.name }`,
+			"TypeError"},
+		{"stream", `
+			var d = new TextDecoder(), bytes = new TextEncoder().encode("€😀");
+			d.decode(bytes.subarray(0, 2), { stream: true }) + "|" +
+				d.decode(bytes.subarray(2, 5), { stream: true }) + "|" + d.decode(bytes.subarray(5))`,
+			"|€|😀"},
+		{"utf-16le", `new TextDecoder("utf-16le").decode(new Uint8Array([0xFF, 0xFE, 0x61, 0x00, 0x3D, 0xD8, 0x00, 0xDE]))`,
+			"a😀"},
+		{"utf-16be", `var d = new TextDecoder("UTF-16BE"); d.encoding + " " + d.decode(new Uint8Array([0x00, 0x61]))`,
+			"utf-16be a"},
+		{"latin1", `var d = new TextDecoder("latin1"); d.encoding + " " + d.decode(new Uint8Array([0x61, 0x80, 0xE9]))`,
+			"windows-1252 a€é"},
+		{"ArrayBuffer", `new TextDecoder().decode(new Uint8Array([104, 105]).buffer)`, "hi"},
+		{"invalid label", `try { new TextDecoder("nope"); "" } catch (e) { e.name }`, "RangeError"},
+	})
+}
@@ -0,0 +1,748 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/dop251/goja"
+	"golang.org/x/net/idna"
+)
+
+// specialSchemes are the schemes of the special URLs of the URL standard with
+// their default ports, which are left out of the serialized URLs.
+var specialSchemes = map[string]string{ //nolint:gochecknoglobals
+	"ftp": "21", "file": "", "http": "80", "https": "443", "ws": "80", "wss": "443",
+}
+
+var errInvalidURL = errors.New("invalid URL")
+
+// urlState is the state of a URL, its searchParams are only created when
+// they are first used.
+type urlState struct {
+	u      *url.URL
+	params *searchParams
+	obj    *goja.Object
+}
+
+func newURLClass(rt *goja.Runtime, searchParamsClass *webClass) *webClass {
+	parse := func(input, base goja.Value) (*url.URL, error) {
+		var baseURL *url.URL
+		if !goja.IsUndefined(base) {
+			var err error
+			if baseURL, err = parseWebURL(base.String(), nil); err != nil {
+				return nil, err
+			}
+		}
+		return parseWebURL(input.String(), baseURL)
+	}
+	c := newWebClass(rt, "URL", func(call goja.ConstructorCall) interface{} {
+		u, err := parse(call.Argument(0), call.Argument(1))
+		if err != nil {
+			panic(rt.NewTypeError(fmt.Sprintf("Failed to construct 'URL': Invalid URL '%s'", call.Argument(0))))
+		}
+		return &urlState{u: u}
+	})
+	c.static("canParse", func(call goja.FunctionCall) goja.Value {
+		_, err := parse(call.Argument(0), call.Argument(1))
+		return rt.ToValue(err == nil)
+	})
+
+	get := func(call goja.FunctionCall) *urlState {
+		return c.mustState(call.This).(*urlState)
+	}
+	// property defines a property of the URL, set returns the changed URL,
+	// which is ignored when it's nil.
+	property := func(name string, getFn func(u *url.URL) string, setFn func(u url.URL, v string) *url.URL) {
+		var setter func(call goja.FunctionCall) goja.Value
+		if setFn != nil {
+			setter = func(call goja.FunctionCall) goja.Value {
+				st := get(call)
+				if u := setFn(*st.u, call.Argument(0).String()); u != nil {
+					st.update(u)
+				}
+				return goja.Undefined()
+			}
+		}
+		c.accessor(name, func(call goja.FunctionCall) goja.Value {
+			return rt.ToValue(getFn(get(call).u))
+		}, setter)
+	}
+
+	c.accessor("href", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(get(call).u.String())
+	}, func(call goja.FunctionCall) goja.Value {
+		u, err := parseWebURL(call.Argument(0).String(), nil)
+		if err != nil {
+			panic(rt.NewTypeError(fmt.Sprintf("Failed to set the 'href' property on 'URL': Invalid URL '%s'",
+				call.Argument(0))))
+		}
+		get(call).update(u)
+		return goja.Undefined()
+	})
+	property("origin", urlOrigin, nil)
+	property("protocol", func(u *url.URL) string { return u.Scheme + ":" }, func(u url.URL, v string) *url.URL {
+		scheme := strings.ToLower(strings.SplitN(v, ":", 2)[0])
+		_, wasSpecial := specialSchemes[u.Scheme]
+		if _, special := specialSchemes[scheme]; special != wasSpecial || !isURLScheme(scheme) {
+			return nil
+		}
+		u.Scheme = scheme
+		return normalizedURL(&u)
+	})
+	property("username", func(u *url.URL) string { return u.User.Username() }, func(u url.URL, v string) *url.URL {
+		if u.Host == "" || u.Scheme == "file" {
+			return nil
+		}
+		password, ok := u.User.Password()
+		switch {
+		case ok:
+			u.User = url.UserPassword(v, password)
+		case v == "":
+			u.User = nil
+		default:
+			u.User = url.User(v)
+		}
+		return &u
+	})
+	property("password", func(u *url.URL) string {
+		password, _ := u.User.Password()
+		return password
+	}, func(u url.URL, v string) *url.URL {
+		if u.Host == "" || u.Scheme == "file" {
+			return nil
+		}
+		switch username := u.User.Username(); {
+		case v != "":
+			u.User = url.UserPassword(username, v)
+		case username != "":
+			u.User = url.User(username)
+		default:
+			u.User = nil
+		}
+		return &u
+	})
+	property("host", func(u *url.URL) string { return u.Host }, func(u url.URL, v string) *url.URL {
+		if u.Opaque != "" {
+			return nil
+		}
+		if i := strings.IndexAny(v, "/?#\\"); i >= 0 {
+			v = v[:i]
+		}
+		u.Host = v
+		return normalizedURL(&u)
+	})
+	property("hostname", func(u *url.URL) string {
+		if strings.HasPrefix(u.Host, "[") {
+			return u.Host[:strings.IndexByte(u.Host, ']')+1]
+		}
+		return u.Hostname()
+	}, func(u url.URL, v string) *url.URL {
+		if u.Opaque != "" {
+			return nil
+		}
+		if i := strings.IndexAny(v, ":/?#\\"); i >= 0 && !strings.HasPrefix(v, "[") {
+			v = v[:i]
+		}
+		if port := u.Port(); port != "" {
+			v += ":" + port
+		}
+		u.Host = v
+		return normalizedURL(&u)
+	})
+	property("port", func(u *url.URL) string { return u.Port() }, func(u url.URL, v string) *url.URL {
+		if u.Opaque != "" || u.Host == "" || u.Scheme == "file" {
+			return nil
+		}
+		digits := len(v) - len(strings.TrimLeft(v, "0123456789"))
+		if digits == 0 && v != "" {
+			return nil
+		}
+		hostname := strings.TrimSuffix(u.Host, ":"+u.Port())
+		u.Host = hostname
+		if digits > 0 {
+			u.Host += ":" + v[:digits]
+		}
+		return normalizedURL(&u)
+	})
+	property("pathname", func(u *url.URL) string {
+		if u.Opaque != "" {
+			return u.Opaque
+		}
+		return u.EscapedPath()
+	}, func(u url.URL, v string) *url.URL {
+		if u.Opaque != "" {
+			return nil
+		}
+		if _, special := specialSchemes[u.Scheme]; special {
+			v = strings.ReplaceAll(v, "\\", "/")
+		}
+		if !strings.HasPrefix(v, "/") && (u.Host != "" || v != "") {
+			v = "/" + v
+		}
+		path, err := url.PathUnescape(v)
+		if err != nil {
+			path = v
+		}
+		u.Path = path
+		u.RawPath = ""
+		if escaped := escapeURLPart(v, pathEscapeSet); escaped != u.EscapedPath() {
+			u.RawPath = escaped
+		}
+		return normalizedURL(&u)
+	})
+	property("search", func(u *url.URL) string {
+		if u.RawQuery == "" {
+			return ""
+		}
+		return "?" + u.RawQuery
+	}, func(u url.URL, v string) *url.URL {
+		v = strings.TrimPrefix(v, "?")
+		u.RawQuery = v
+		u.ForceQuery = false
+		return normalizedURL(&u)
+	})
+	property("hash", func(u *url.URL) string {
+		if u.Fragment == "" {
+			return ""
+		}
+		return "#" + u.EscapedFragment()
+	}, func(u url.URL, v string) *url.URL {
+		v = strings.TrimPrefix(v, "#")
+		fragment, err := url.PathUnescape(v)
+		if err != nil {
+			fragment = v
+		}
+		u.Fragment = fragment
+		u.RawFragment = ""
+		return &u
+	})
+	c.accessor("searchParams", func(call goja.FunctionCall) goja.Value {
+		st := get(call)
+		if st.obj == nil {
+			st.params = &searchParams{list: parseURLEncoded(st.u.RawQuery), url: st}
+			st.obj = searchParamsClass.newInstance(st.params)
+		}
+		return st.obj
+	}, nil)
+	toString := func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(get(call).u.String())
+	}
+	c.method("toString", toString)
+	c.method("toJSON", toString)
+	return c
+}
+
+// update changes the URL and the list of its searchParams.
+func (st *urlState) update(u *url.URL) {
+	st.u = u
+	if st.params != nil {
+		st.params.list = parseURLEncoded(u.RawQuery)
+	}
+}
+
+// urlOrigin returns the serialized origin of the URL, which is "null" for
+// the URLs that don't have a tuple origin.
+func urlOrigin(u *url.URL) string {
+	switch u.Scheme {
+	case "http", "https", "ws", "wss", "ftp":
+		return u.Scheme + "://" + u.Host
+	case "blob":
+		if inner, err := parseWebURL(u.Opaque, nil); err == nil && (inner.Scheme == "http" || inner.Scheme == "https") {
+			return urlOrigin(inner)
+		}
+	}
+	return "null"
+}
+
+func isURLScheme(s string) bool {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseWebURL parses the input like the URL parser of the URL standard, where
+// net/url is more lenient about the special URLs and doesn't normalize them.
+func parseWebURL(input string, base *url.URL) (*url.URL, error) {
+	input = strings.TrimFunc(input, func(r rune) bool { return r <= ' ' })
+	input = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(input)
+
+	scheme := ""
+	if i := strings.IndexByte(input, ':'); i > 0 && isURLScheme(strings.ToLower(input[:i])) {
+		scheme = strings.ToLower(input[:i])
+	}
+	_, special := specialSchemes[scheme]
+	if scheme == "" && base != nil {
+		_, special = specialSchemes[base.Scheme]
+	}
+	if special {
+		end := strings.IndexAny(input, "?#")
+		if end < 0 {
+			end = len(input)
+		}
+		input = strings.ReplaceAll(input[:end], "\\", "/") + input[end:]
+	}
+
+	if scheme != "" && special && scheme != "file" {
+		rest := input[len(scheme)+1:]
+		if base != nil && base.Scheme == scheme && !strings.HasPrefix(rest, "/") {
+			// a relative URL with the scheme of the base, like "http:foo"
+			input, scheme = rest, ""
+		} else {
+			input = scheme + "://" + strings.TrimLeft(rest, "/")
+		}
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return nil, errInvalidURL
+	}
+	if scheme == "" {
+		if base == nil || (base.Opaque != "" && !strings.HasPrefix(input, "#")) {
+			return nil, errInvalidURL
+		}
+		u = base.ResolveReference(u)
+		if base.Opaque != "" {
+			u.Opaque = base.Opaque
+		}
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u = normalizedURL(u); u == nil {
+		return nil, errInvalidURL
+	}
+	return u, nil
+}
+
+// normalizedURL returns the URL serialized like in the URL standard, or nil
+// if it's not valid.
+func normalizedURL(u *url.URL) *url.URL {
+	defaultPort, special := specialSchemes[u.Scheme]
+	if !special {
+		return u
+	}
+	if u.Opaque != "" {
+		return nil
+	}
+	host, port := u.Host, ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host, port = host[:i], host[i+1:]
+	}
+	var err error
+	if host, err = normalizeURLHost(host); err != nil {
+		return nil
+	}
+	if host == "" && u.Scheme != "file" {
+		return nil
+	}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 0 || n > 65535 {
+			return nil
+		}
+		if port = strconv.Itoa(n); port == defaultPort {
+			port = ""
+		}
+	}
+	if u.Scheme == "file" {
+		if host == "localhost" {
+			host = ""
+		}
+		port = ""
+		u.User = nil
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+
+	escaped := u.EscapedPath()
+	if escaped == "" {
+		escaped = "/"
+	}
+	cleaned := escapeURLPart(removeDotSegments(escaped), pathEscapeSet)
+	if path, err := url.PathUnescape(cleaned); err == nil {
+		u.Path = path
+		u.RawPath = ""
+		if u.EscapedPath() != cleaned {
+			u.RawPath = cleaned
+		}
+	}
+	u.RawQuery = escapeURLPart(u.RawQuery, queryEscapeSet)
+	return u
+}
+
+// normalizeURLHost returns the ASCII serialization of the host.
+func normalizeURLHost(host string) (string, error) {
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return "", errInvalidURL
+		}
+		ip := net.ParseIP(host[1 : len(host)-1])
+		if ip == nil || ip.To4() != nil && !strings.Contains(host, ":") {
+			return "", errInvalidURL
+		}
+		return "[" + ip.String() + "]", nil
+	}
+	unescaped, err := url.PathUnescape(host)
+	if err != nil {
+		return "", errInvalidURL
+	}
+	if unescaped == "" {
+		return "", nil
+	}
+	ascii, err := idna.Lookup.ToASCII(unescaped)
+	if err != nil {
+		return "", errInvalidURL
+	}
+	if strings.ContainsAny(ascii, " #%/:<>?@[\\]^|") {
+		return "", errInvalidURL
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// removeDotSegments removes the "." and ".." segments of an absolute path.
+func removeDotSegments(path string) string {
+	segments := strings.Split(path, "/")[1:]
+	out := make([]string, 0, len(segments))
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch strings.ToLower(s) {
+		case ".", "%2e":
+			if last {
+				out = append(out, "")
+			}
+		case "..", ".%2e", "%2e.", "%2e%2e":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+const (
+	pathEscapeSet  = " \"#<>?`{}"
+	queryEscapeSet = " \"#<>'"
+)
+
+// escapeURLPart percent-encodes the bytes of s that aren't allowed in a part
+// of a URL, the ones that are already percent-encoded are kept.
+func escapeURLPart(s string, set string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7F || strings.IndexByte(set, c) >= 0 {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// searchParams is the state of URLSearchParams, which updates the query of
+// the URL that it belongs to when it's changed.
+type searchParams struct {
+	list []searchParam
+	url  *urlState
+}
+
+type searchParam struct {
+	name, value string
+}
+
+func (sp *searchParams) update() {
+	if sp.url == nil {
+		return
+	}
+	u := *sp.url.u
+	u.RawQuery = serializeURLEncoded(sp.list)
+	u.ForceQuery = false
+	sp.url.u = &u
+}
+
+func newURLSearchParamsClass(rt *goja.Runtime) *webClass {
+	var c *webClass
+	c = newWebClass(rt, "URLSearchParams", func(call goja.ConstructorCall) interface{} {
+		init := call.Argument(0)
+		if goja.IsUndefined(init) {
+			return &searchParams{}
+		}
+		if other, ok := c.state(init).(*searchParams); ok {
+			return &searchParams{list: append([]searchParam(nil), other.list...)}
+		}
+		obj, ok := init.(*goja.Object)
+		if !ok {
+			return &searchParams{list: parseURLEncoded(strings.TrimPrefix(init.String(), "?"))}
+		}
+		sp := &searchParams{}
+		isIterable := iterate(rt, obj, func(pair goja.Value) {
+			var values []string
+			if pairObj, ok := pair.(*goja.Object); ok {
+				iterate(rt, pairObj, func(v goja.Value) { values = append(values, v.String()) })
+			}
+			if len(values) != 2 {
+				panic(rt.NewTypeError("Failed to construct 'URLSearchParams': Each pair needs to have exactly two values"))
+			}
+			sp.list = append(sp.list, searchParam{values[0], values[1]})
+		})
+		if !isIterable {
+			for _, name := range obj.Keys() {
+				sp.list = append(sp.list, searchParam{name, obj.Get(name).String()})
+			}
+		}
+		return sp
+	})
+
+	get := func(call goja.FunctionCall) *searchParams {
+		return c.mustState(call.This).(*searchParams)
+	}
+	c.accessor("size", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(len(get(call).list))
+	}, nil)
+	c.method("append", func(call goja.FunctionCall) goja.Value {
+		sp := get(call)
+		sp.list = append(sp.list, searchParam{call.Argument(0).String(), call.Argument(1).String()})
+		sp.update()
+		return goja.Undefined()
+	})
+	c.method("delete", func(call goja.FunctionCall) goja.Value {
+		sp := get(call)
+		name, value := call.Argument(0).String(), call.Argument(1)
+		list := sp.list[:0]
+		for _, p := range sp.list {
+			if p.name != name || (!goja.IsUndefined(value) && p.value != value.String()) {
+				list = append(list, p)
+			}
+		}
+		sp.list = list
+		sp.update()
+		return goja.Undefined()
+	})
+	c.method("get", func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+		for _, p := range get(call).list {
+			if p.name == name {
+				return rt.ToValue(p.value)
+			}
+		}
+		return goja.Null()
+	})
+	c.method("getAll", func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+		values := []interface{}{}
+		for _, p := range get(call).list {
+			if p.name == name {
+				values = append(values, p.value)
+			}
+		}
+		return rt.NewArray(values...)
+	})
+	c.method("has", func(call goja.FunctionCall) goja.Value {
+		name, value := call.Argument(0).String(), call.Argument(1)
+		for _, p := range get(call).list {
+			if p.name == name && (goja.IsUndefined(value) || p.value == value.String()) {
+				return rt.ToValue(true)
+			}
+		}
+		return rt.ToValue(false)
+	})
+	c.method("set", func(call goja.FunctionCall) goja.Value {
+		sp := get(call)
+		name, value := call.Argument(0).String(), call.Argument(1).String()
+		list, found := sp.list[:0], false
+		for _, p := range sp.list {
+			switch {
+			case p.name != name:
+				list = append(list, p)
+			case !found:
+				list = append(list, searchParam{name, value})
+				found = true
+			}
+		}
+		if !found {
+			list = append(list, searchParam{name, value})
+		}
+		sp.list = list
+		sp.update()
+		return goja.Undefined()
+	})
+	c.method("sort", func(call goja.FunctionCall) goja.Value {
+		sp := get(call)
+		// the names are compared by their UTF-16 code units, like in JS
+		sort.SliceStable(sp.list, func(i, j int) bool {
+			a, b := utf16.Encode([]rune(sp.list[i].name)), utf16.Encode([]rune(sp.list[j].name))
+			for k := 0; k < len(a) && k < len(b); k++ {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+			return len(a) < len(b)
+		})
+		sp.update()
+		return goja.Undefined()
+	})
+	c.method("forEach", func(call goja.FunctionCall) goja.Value {
+		sp := get(call)
+		callback, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(rt.NewTypeError("The callback provided as parameter 1 is not a function"))
+		}
+		for i := 0; i < len(sp.list); i++ {
+			p := sp.list[i]
+			if _, err := callback(call.Argument(1), rt.ToValue(p.value), rt.ToValue(p.name), call.This); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+	iterator := func(value func(p searchParam) goja.Value) func(call goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			sp, i := get(call), 0
+			return newIterator(rt, "URLSearchParams Iterator", func() (goja.Value, bool) {
+				if i >= len(sp.list) {
+					return nil, false
+				}
+				i++
+				return value(sp.list[i-1]), true
+			})
+		}
+	}
+	c.method("keys", iterator(func(p searchParam) goja.Value { return rt.ToValue(p.name) }))
+	c.method("values", iterator(func(p searchParam) goja.Value { return rt.ToValue(p.value) }))
+	entries := iterator(func(p searchParam) goja.Value { return rt.NewArray(p.name, p.value) })
+	c.method("entries", entries)
+	_ = c.proto.DefineDataPropertySymbol(goja.SymIterator, c.proto.Get("entries"),
+		goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	c.method("toString", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(serializeURLEncoded(get(call).list))
+	})
+	return c
+}
+
+// iterate calls fn with the values of the iterable object, it returns false
+// if the object isn't iterable.
+func iterate(rt *goja.Runtime, obj *goja.Object, fn func(v goja.Value)) bool {
+	method, ok := goja.AssertFunction(obj.GetSymbol(goja.SymIterator))
+	if !ok {
+		return false
+	}
+	itV, err := method(obj)
+	if err != nil {
+		panic(err)
+	}
+	it := itV.ToObject(rt)
+	next, ok := goja.AssertFunction(it.Get("next"))
+	if !ok {
+		panic(rt.NewTypeError("The iterator doesn't have a next method"))
+	}
+	for {
+		resultV, err := next(it)
+		if err != nil {
+			panic(err)
+		}
+		result := resultV.ToObject(rt)
+		if result.Get("done").ToBoolean() {
+			return true
+		}
+		fn(result.Get("value"))
+	}
+}
+
+// parseURLEncoded parses application/x-www-form-urlencoded data.
+func parseURLEncoded(s string) []searchParam {
+	var list []searchParam
+	for _, sequence := range strings.Split(s, "&") {
+		if sequence == "" {
+			continue
+		}
+		name, value := sequence, ""
+		if i := strings.IndexByte(sequence, '='); i >= 0 {
+			name, value = sequence[:i], sequence[i+1:]
+		}
+		list = append(list, searchParam{decodeURLEncoded(name), decodeURLEncoded(value)})
+	}
+	return list
+}
+
+func decodeURLEncoded(s string) string {
+	s = strings.ReplaceAll(s, "+", " ")
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			n, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			b = append(b, byte(n))
+			i += 2
+			continue
+		}
+		b = append(b, s[i])
+	}
+	runes, _ := (&utf8Decoder{}).decode(b, true, false)
+	return string(runes)
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// serializeURLEncoded serializes the list as application/x-www-form-urlencoded.
+func serializeURLEncoded(list []searchParam) string {
+	var sb strings.Builder
+	encode := func(s string) {
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == ' ':
+				sb.WriteByte('+')
+			case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("*-._", c) >= 0:
+				sb.WriteByte(c)
+			default:
+				fmt.Fprintf(&sb, "%%%02X", c)
+			}
+		}
+	}
+	for i, p := range list {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		encode(p.name)
+		sb.WriteByte('=')
+		encode(p.value)
+	}
+	return sb.String()
+}
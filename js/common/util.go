@@ -79,3 +79,12 @@ func ToString(data interface{}) (string, error) {
 		return "", fmt.Errorf("invalid type %T, expected string, []byte or ArrayBuffer", data)
 	}
 }
+
+// ExportOrNil returns the exported value of v, or nil if v is missing,
+// undefined or null.
+func ExportOrNil(v goja.Value) interface{} {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	return v.Export()
+}
@@ -99,3 +99,13 @@ func TestToString(t *testing.T) {
 		})
 	}
 }
+
+func TestExportOrNil(t *testing.T) {
+	t.Parallel()
+	rt := goja.New()
+	assert.Nil(t, ExportOrNil(nil))
+	assert.Nil(t, ExportOrNil(goja.Undefined()))
+	assert.Nil(t, ExportOrNil(goja.Null()))
+	assert.Equal(t, "a", ExportOrNil(rt.ToValue("a")))
+	assert.Equal(t, int64(0), ExportOrNil(rt.ToValue(0)))
+}
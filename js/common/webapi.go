@@ -0,0 +1,291 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// RegisterWebAPIs sets the globals of the web platform that are implemented in
+// Go on the runtime, so scripts and libraries don't need to polyfill them.
+func RegisterWebAPIs(rt *goja.Runtime) error {
+	domException := newDOMExceptionClass(rt)
+	abortSignal := newAbortSignalClass(rt)
+	searchParams := newURLSearchParamsClass(rt)
+	classes := []*webClass{
+		domException,
+		newTextEncoderClass(rt),
+		newTextDecoderClass(rt),
+		newURLClass(rt, searchParams),
+		searchParams,
+		abortSignal,
+		newAbortControllerClass(rt, abortSignal),
+	}
+	for _, class := range classes {
+		if err := rt.Set(class.name, class.ctor); err != nil {
+			return err
+		}
+	}
+	globals := map[string]interface{}{
+		"atob":            func(data goja.Value) goja.Value { return atob(rt, data) },
+		"btoa":            func(data goja.Value) goja.Value { return btoa(rt, data) },
+		"structuredClone": func(v, options goja.Value) goja.Value { return structuredClone(rt, v, options) },
+	}
+	for name, fn := range globals {
+		if err := rt.Set(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webClass is a class of the web APIs. The Go state of its instances is kept
+// in a property with a symbol of the class as the key, which can only be found
+// with the class.
+type webClass struct {
+	rt     *goja.Runtime
+	name   string
+	ctor   *goja.Object
+	proto  *goja.Object
+	symbol *goja.Symbol
+}
+
+// newWebClass defines a class, construct returns the state of a new instance.
+// A nil construct makes a class that can't be constructed from JS.
+func newWebClass(rt *goja.Runtime, name string, construct func(call goja.ConstructorCall) interface{}) *webClass {
+	c := &webClass{rt: rt, name: name, symbol: goja.NewSymbol(name)}
+	c.ctor = rt.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		if construct == nil {
+			panic(rt.NewTypeError("Illegal constructor"))
+		}
+		c.setState(call.This, construct(call))
+		return nil
+	}).ToObject(rt)
+	_ = c.ctor.DefineDataProperty("name", rt.ToValue(name), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	c.proto = c.ctor.Get("prototype").ToObject(rt)
+	_ = c.proto.DefineDataPropertySymbol(goja.SymToStringTag, rt.ToValue(name),
+		goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	return c
+}
+
+func (c *webClass) setState(obj *goja.Object, state interface{}) {
+	_ = obj.DefineDataPropertySymbol(c.symbol, c.rt.ToValue(state), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// newInstance returns a new instance of the class with the state.
+func (c *webClass) newInstance(state interface{}) *goja.Object {
+	obj := c.rt.CreateObject(c.proto)
+	c.setState(obj, state)
+	return obj
+}
+
+// state returns the state of an instance of the class, which is nil if the
+// value isn't one.
+func (c *webClass) state(v goja.Value) interface{} {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil
+	}
+	state := obj.GetSymbol(c.symbol)
+	if state == nil {
+		return nil
+	}
+	return state.Export()
+}
+
+// mustState is state for the methods of the class, which throw if they are
+// called on something else.
+func (c *webClass) mustState(v goja.Value) interface{} {
+	state := c.state(v)
+	if state == nil {
+		panic(c.rt.NewTypeError("Illegal invocation"))
+	}
+	return state
+}
+
+func (c *webClass) method(name string, fn func(call goja.FunctionCall) goja.Value) {
+	_ = c.proto.DefineDataProperty(name, c.rt.ToValue(fn), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+func (c *webClass) accessor(name string, get, set func(call goja.FunctionCall) goja.Value) {
+	var setter goja.Value
+	if set != nil {
+		setter = c.rt.ToValue(set)
+	}
+	_ = c.proto.DefineAccessorProperty(name, c.rt.ToValue(get), setter, goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+func (c *webClass) static(name string, fn func(call goja.FunctionCall) goja.Value) {
+	_ = c.ctor.DefineDataProperty(name, c.rt.ToValue(fn), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+type domException struct {
+	message, name string
+}
+
+// domExceptionCodes are the legacy codes of the names of the DOMExceptions.
+var domExceptionCodes = map[string]int{ //nolint:gochecknoglobals
+	"IndexSizeError": 1, "HierarchyRequestError": 3, "WrongDocumentError": 4, "InvalidCharacterError": 5,
+	"NoModificationAllowedError": 7, "NotFoundError": 8, "NotSupportedError": 9, "InvalidStateError": 11,
+	"SyntaxError": 12, "InvalidModificationError": 13, "NamespaceError": 14, "InvalidAccessError": 15,
+	"TypeMismatchError": 17, "SecurityError": 18, "NetworkError": 19, "AbortError": 20,
+	"URLMismatchError": 21, "QuotaExceededError": 22, "TimeoutError": 23, "InvalidNodeTypeError": 24,
+	"DataCloneError": 25,
+}
+
+// newDOMExceptionClass defines DOMException, which is an Error like in the browsers.
+func newDOMExceptionClass(rt *goja.Runtime) *webClass {
+	c := newWebClass(rt, "DOMException", func(call goja.ConstructorCall) interface{} {
+		e := &domException{name: "Error"}
+		if v := call.Argument(0); !goja.IsUndefined(v) {
+			e.message = v.String()
+		}
+		if v := call.Argument(1); !goja.IsUndefined(v) {
+			e.name = v.String()
+		}
+		return e
+	})
+	_ = c.proto.SetPrototype(rt.Get("Error").ToObject(rt).Get("prototype").ToObject(rt))
+	c.accessor("name", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(c.mustState(call.This).(*domException).name)
+	}, nil)
+	c.accessor("message", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(c.mustState(call.This).(*domException).message)
+	}, nil)
+	c.accessor("code", func(call goja.FunctionCall) goja.Value {
+		return rt.ToValue(domExceptionCodes[c.mustState(call.This).(*domException).name])
+	}, nil)
+	return c
+}
+
+// NewDOMException returns a new DOMException with the message and the name,
+// like "AbortError", if the web APIs are registered on the runtime.
+func NewDOMException(rt *goja.Runtime, message, name string) *goja.Object {
+	if ctor := rt.Get("DOMException"); ctor != nil {
+		if obj, err := rt.New(ctor, rt.ToValue(message), rt.ToValue(name)); err == nil {
+			return obj
+		}
+	}
+	obj := rt.NewGoError(fmt.Errorf("%s: %s", name, message))
+	_ = obj.Set("name", name)
+	return obj
+}
+
+func newRangeError(rt *goja.Runtime, message string) *goja.Object {
+	obj, err := rt.New(rt.Get("RangeError"), rt.ToValue(message))
+	if err != nil {
+		Throw(rt, err)
+	}
+	return obj
+}
+
+// btoa encodes a string, in which every character is a byte, as base64.
+func btoa(rt *goja.Runtime, data goja.Value) goja.Value {
+	s := data.String()
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			panic(NewDOMException(rt, "The string to be encoded contains characters outside of the Latin1 range.",
+				"InvalidCharacterError"))
+		}
+		b = append(b, byte(r))
+	}
+	return rt.ToValue(base64.StdEncoding.EncodeToString(b))
+}
+
+// atob decodes base64 to a string in which every character is a byte.
+func atob(rt *goja.Runtime, data goja.Value) goja.Value {
+	s := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\f' || r == '\r' {
+			return -1
+		}
+		return r
+	}, data.String())
+	if len(s)%4 == 0 {
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "="), "=")
+	}
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil || len(s)%4 == 1 {
+		panic(NewDOMException(rt, "The string to be decoded is not correctly encoded.", "InvalidCharacterError"))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return rt.ToValue(string(runes))
+}
+
+var arrayBufferT = reflect.TypeOf(goja.ArrayBuffer{}) //nolint:gochecknoglobals
+
+// bufferSourceBytes returns the bytes of an ArrayBuffer or of the part of it
+// that a typed array or a DataView covers, without copying them.
+func bufferSourceBytes(v goja.Value) ([]byte, bool) {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	if obj.ExportType() == arrayBufferT {
+		ab, _ := obj.Export().(goja.ArrayBuffer)
+		return ab.Bytes(), true
+	}
+	if buffer, ok := obj.Get("buffer").(*goja.Object); ok && buffer.ExportType() == arrayBufferT {
+		ab, _ := buffer.Export().(goja.ArrayBuffer)
+		offset := obj.Get("byteOffset").ToInteger()
+		length := obj.Get("byteLength").ToInteger()
+		return ab.Bytes()[offset : offset+length], true
+	}
+	return nil, false
+}
+
+// newUint8Array returns a new Uint8Array with the data.
+func newUint8Array(rt *goja.Runtime, data []byte) goja.Value {
+	arr, err := rt.New(rt.Get("Uint8Array"), rt.ToValue(rt.NewArrayBuffer(data)))
+	if err != nil {
+		Throw(rt, err)
+	}
+	return arr
+}
+
+// newIterator returns an iterator object with the next function, which
+// returns the next value or false when there are no more.
+func newIterator(rt *goja.Runtime, tag string, next func() (goja.Value, bool)) *goja.Object {
+	it := rt.NewObject()
+	_ = it.Set("next", func() *goja.Object {
+		result := rt.NewObject()
+		v, ok := next()
+		if !ok {
+			_ = result.Set("value", goja.Undefined())
+			_ = result.Set("done", true)
+			return result
+		}
+		_ = result.Set("value", v)
+		_ = result.Set("done", false)
+		return result
+	})
+	_ = it.SetSymbol(goja.SymIterator, func(goja.FunctionCall) goja.Value { return it })
+	_ = it.DefineDataPropertySymbol(goja.SymToStringTag, rt.ToValue(tag), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	return it
+}
@@ -0,0 +1,190 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type webAPITestCase struct {
+	name, script, expected string
+}
+
+// runWebAPITests runs the scripts on runtimes with the web APIs, they throw
+// or return a string that is compared with the expected one.
+func runWebAPITests(t *testing.T, testCases []webAPITestCase) {
+	t.Helper()
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rt := goja.New()
+			require.NoError(t, RegisterWebAPIs(rt))
+			v, err := rt.RunString(tc.script)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, v.String())
+		})
+	}
+}
+
+func TestBase64(t *testing.T) {
+	t.Parallel()
+	runWebAPITests(t, []webAPITestCase{
+		{"btoa", `btoa("hello, world")`, "aGVsbG8sIHdvcmxk"},
+		{"btoa latin1", `btoa("\xff\xfe")`, "//4="},
+		{"atob", `atob("aGVsbG8sIHdvcmxk")`, "hello, world"},
+		{"atob without padding", `atob("//4")`, "ÿþ"},
+		{"atob with whitespace", `atob(" aGVs\nbG8= ")`, "hello"},
+		{"btoa invalid", `try { btoa("Ā"); "" } catch (e) { e.name + " " + (e instanceof DOMException) }`,
+			"InvalidCharacterError true"},
+		{"atob invalid", `try { atob("a"); "" } catch (e) { e.name + " " + e.code }`, "InvalidCharacterError 5"},
+	})
+}
+
+func TestDOMException(t *testing.T) {
+	t.Parallel()
+	runWebAPITests(t, []webAPITestCase{
+		{"default", `var e = new DOMException(); [e.name, e.message, e.code].join()`, "Error,,0"},
+		{"name", `var e = new DOMException("stop", "AbortError"); [e.name, e.message, e.code].join()`,
+			"AbortError,stop,20"},
+		{"error", `var e = new DOMException("stop", "AbortError"); (e instanceof Error) + " " + e`,
+			"true AbortError: stop"},
+	})
+}
+
+func TestAbortController(t *testing.T) {
+	t.Parallel()
+	runWebAPITests(t, []webAPITestCase{
+		{"abort", `
+			var ac = new AbortController(), events = [];
+			ac.signal.onabort = function (e) { events.push("onabort " + e.type) };
+			ac.signal.addEventListener("abort", function (e) { events.push("listener " + (e.target === ac.signal)) });
+			events.push(ac.signal.aborted);
+			ac.abort();
+			ac.abort();
+			events.push(ac.signal.aborted, ac.signal.reason.name);
+			events.join()`,
+			"false,onabort abort,listener true,true,AbortError"},
+		{"reason", `
+			var ac = new AbortController();
+			ac.abort("enough");
+			try { ac.signal.throwIfAborted(); "" } catch (e) { e }`,
+			"enough"},
+		{"removeEventListener", `
+			var ac = new AbortController(), called = false;
+			function listener() { called = true }
+			ac.signal.addEventListener("abort", listener);
+			ac.signal.removeEventListener("abort", listener);
+			ac.abort();
+			String(called)`,
+			"false"},
+		{"static abort", `var s = AbortSignal.abort(); s.aborted + " " + (s instanceof AbortSignal)`, "true true"},
+		{"constructor", `try { new AbortSignal(); "" } catch (e) { e.message }`, "Illegal constructor"},
+	})
+}
+
+func TestAbortSignalTimeout(t *testing.T) {
+	t.Parallel()
+	rt := goja.New()
+	require.NoError(t, RegisterWebAPIs(rt))
+	v, err := rt.RunString(`var s = AbortSignal.timeout(10); s`)
+	require.NoError(t, err)
+	signal := GetAbortSignal(v)
+	require.NotNil(t, signal)
+	assert.NoError(t, signal.Err())
+
+	select {
+	case <-signal.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the signal wasn't aborted")
+	}
+	require.Error(t, signal.Err())
+	assert.True(t, errors.Is(signal.Err(), ErrAborted))
+
+	v, err = rt.RunString(`s.aborted + " " + s.reason.name`)
+	require.NoError(t, err)
+	assert.Equal(t, "true TimeoutError", v.String())
+
+	_, err = rt.RunString(`AbortSignal.timeout(-1)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the timeout needs to be a non-negative number")
+}
+
+func TestGetAbortSignal(t *testing.T) {
+	t.Parallel()
+	rt := goja.New()
+	require.NoError(t, RegisterWebAPIs(rt))
+	ac, err := rt.RunString(`new AbortController()`)
+	require.NoError(t, err)
+	assert.Nil(t, GetAbortSignal(ac))
+
+	signal := GetAbortSignal(ac.ToObject(rt).Get("signal"))
+	require.NotNil(t, signal)
+	assert.NoError(t, signal.Err())
+	select {
+	case <-signal.Done():
+		t.Fatal("the signal is done before it's aborted")
+	default:
+	}
+
+	abort, _ := goja.AssertFunction(ac.ToObject(rt).Get("abort"))
+	_, err = abort(ac, rt.ToValue("timeout"))
+	require.NoError(t, err)
+	<-signal.Done()
+	assert.ErrorIs(t, signal.Err(), ErrAborted)
+	assert.EqualError(t, signal.Err(), "aborted: timeout")
+}
+
+func TestStructuredClone(t *testing.T) {
+	t.Parallel()
+	runWebAPITests(t, []webAPITestCase{
+		{"primitives", `JSON.stringify([structuredClone(1), structuredClone("a"), structuredClone(null)])`, `[1,"a",null]`},
+		{"object", `
+			var o = { a: [1, { b: 2 }], c: "d" }, c = structuredClone(o);
+			(c !== o) + " " + (c.a !== o.a) + " " + JSON.stringify(c)`,
+			`true true {"a":[1,{"b":2}],"c":"d"}`},
+		{"cycle", `var o = { a: 1 }; o.self = o; var c = structuredClone(o); String(c.self === c && c !== o)`, "true"},
+		{"date", `var d = new Date(1000), c = structuredClone(d); (c instanceof Date) + " " + c.getTime()`, "true 1000"},
+		{"regexp", `String(structuredClone(/a+b/gi))`, "/a+b/gi"},
+		{"map and set", `
+			var m = structuredClone(new Map([["a", { b: 1 }]])), s = structuredClone(new Set([1, 2]));
+			m.get("a").b + " " + s.has(2) + " " + s.size`,
+			"1 true 2"},
+		{"typed array", `
+			var a = new Uint8Array([1, 2, 3]), c = structuredClone(a);
+			a[0] = 9;
+			(c instanceof Uint8Array) + " " + Array.from(c).join()`,
+			"true 1,2,3"},
+		{"error", `var e = structuredClone(new TypeError("bad")); (e instanceof TypeError) + " " + e.message`, "true bad"},
+		{"transfer", `
+			var b = new Uint8Array([1, 2]).buffer, c = structuredClone(b, { transfer: [b] });
+			b.byteLength + " " + c.byteLength`,
+			"0 2"},
+		{"function", `try { structuredClone(function () {}); "" } catch (e) { e.name }`, "DataCloneError"},
+		{"symbol", `try { structuredClone({ a: Symbol() }); "" } catch (e) { e.name }`, "DataCloneError"},
+	})
+}
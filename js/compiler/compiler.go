@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -188,9 +189,17 @@ type compilationState struct {
 	compiler *Compiler
 }
 
-// Compile the program in the given CompatibilityMode, wrapping it between pre and post code
+// Compile the program in the given CompatibilityMode, wrapping it between pre and post code.
+// TypeScript files are recognized by their extension and their types are stripped first.
 func (c *Compiler) Compile(src, filename string, main bool) (*goja.Program, string, error) {
-	return c.compileImpl(src, filename, main, c.Options.CompatibilityMode, nil)
+	var srcMap []byte
+	if isTypeScript(filename) {
+		var err error
+		if src, srcMap, err = c.transformTypeScript(src, filename); err != nil {
+			return nil, src, err
+		}
+	}
+	return c.compileImpl(src, filename, main, c.Options.CompatibilityMode, srcMap)
 }
 
 // sourceMapLoader is to be used with goja's WithSourceMapLoader
@@ -243,6 +252,8 @@ func (c *Compiler) compileImpl(
 	}
 	if err != nil {
 		if compatibilityMode == lib.CompatibilityModeExtended {
+			// the source map of the TypeScript transformation is given to Babel directly
+			src = strings.TrimSuffix(src, "//# sourceMappingURL="+sourceMapURLFromBabel)
 			code, state.srcMap, err = c.Transform(src, filename, state.srcMap)
 			if err != nil {
 				return nil, code, err
@@ -177,6 +177,73 @@ func TestCompile(t *testing.T) {
 	})
 }
 
+func TestCompileTypeScript(t *testing.T) {
+	t.Parallel()
+	t.Run("Base", func(t *testing.T) {
+		t.Parallel()
+		c := New(testutils.NewLogger(t))
+		c.Options.CompatibilityMode = lib.CompatibilityModeBase
+		pgm, code, err := c.Compile(`
+enum Color { Red = 1, Green }
+function add(a: number, b: number): number { return a + b; }
+add(Color.Green, 40 as number);`, "file:///script.ts", true)
+		require.NoError(t, err)
+		assert.NotContains(t, code, ": number")
+		v, err := goja.New().RunProgram(pgm)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(42), v.Export())
+		}
+	})
+
+	t.Run("Extended", func(t *testing.T) {
+		t.Parallel()
+		c := New(testutils.NewLogger(t))
+		c.Options.CompatibilityMode = lib.CompatibilityModeExtended
+		c.Options.SourceMapLoader = func(string) ([]byte, error) { return nil, errors.New("shouldn't be called") }
+		pgm, _, err := c.Compile(`
+import type { Options } from "./types.ts";
+export const options: Options = { vus: 1 };
+export default class Test { private n = 2 ** 3; get(): number { return this.n; } }`, "file:///script.ts", false)
+		require.NoError(t, err)
+		rt := goja.New()
+		v, err := rt.RunProgram(pgm)
+		require.NoError(t, err)
+		fn, ok := goja.AssertFunction(v)
+		require.True(t, ok, "not a function")
+		exports := rt.NewObject()
+		_, err = fn(goja.Undefined(), goja.Undefined(), exports)
+		require.NoError(t, err)
+		require.NoError(t, rt.Set("exports", exports))
+		result, err := rt.RunString(`new exports.default().get() + exports.options.vus`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), result.Export())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		c := New(testutils.NewLogger(t))
+		_, _, err := c.Compile("let a: number = ;", "file:///script.ts", true)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `file:///script.ts: Unexpected ";" (1:17)`)
+	})
+}
+
+func TestIsTypeScript(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bool{
+		"file:///script.ts":                   true,
+		"file:///lib/module.mts":              true,
+		"https://example.com/lib.cts?v=1#foo": true,
+		"/home/user/script.ts":                true,
+		"file:///script.js":                   false,
+		"file:///types.d.ts":                  false,
+		"https://example.com/ts":              false,
+	}
+	for filename, expected := range testCases {
+		assert.Equal(t, expected, isTypeScript(filename), filename)
+	}
+}
+
 func TestCorruptSourceMap(t *testing.T) {
 	t.Parallel()
 	corruptSourceMap := []byte(`{"mappings": 12}`) // 12 is a number not a string
@@ -0,0 +1,90 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// isTypeScript returns whether the file with the given URL or path is a
+// TypeScript file, based on its extension. Declaration files aren't, as they
+// have no code.
+func isTypeScript(filename string) bool {
+	if u, err := url.Parse(filename); err == nil && u.Path != "" {
+		filename = u.Path
+	}
+	if strings.HasSuffix(filename, ".d.ts") {
+		return false
+	}
+	switch path.Ext(filename) {
+	case ".ts", ".mts", ".cts":
+		return true
+	default:
+		return false
+	}
+}
+
+// transformTypeScript strips the types of the TypeScript source and lowers the
+// TypeScript-only syntax, like enums and namespaces. The ES modules syntax is
+// kept, so the result is then handled like any other JavaScript source. The
+// returned source map is nil if source maps aren't enabled.
+func (c *Compiler) transformTypeScript(src, filename string) (string, []byte, error) {
+	opts := api.TransformOptions{
+		Loader:     api.LoaderTS,
+		Sourcefile: filename,
+		// everything after ES2017 is lowered, as neither goja nor Babel support it
+		Target:         api.ES2017,
+		Format:         api.FormatDefault,
+		LegalComments:  api.LegalCommentsNone,
+		LogLevel:       api.LogLevelSilent,
+		Charset:        api.CharsetUTF8,
+		SourcesContent: api.SourcesContentExclude,
+	}
+	sourceMapEnabled := c.Options.SourceMapLoader != nil
+	if sourceMapEnabled {
+		opts.Sourcemap = api.SourceMapExternal
+	}
+
+	startTime := time.Now()
+	result := api.Transform(src, opts)
+	if len(result.Errors) > 0 {
+		msg := result.Errors[0]
+		if loc := msg.Location; loc != nil {
+			return "", nil, fmt.Errorf("%s: %s (%d:%d)", filename, msg.Text, loc.Line, loc.Column+1)
+		}
+		return "", nil, errors.New(msg.Text)
+	}
+	c.logger.WithField("t", time.Since(startTime)).Debug("esbuild: Transformed TypeScript")
+
+	code := string(result.Code)
+	if !sourceMapEnabled {
+		return code, nil, nil
+	}
+	// same as with Babel, goja loads the source map from this special url
+	return code + "//# sourceMappingURL=" + sourceMapURLFromBabel, result.Map, nil
+}
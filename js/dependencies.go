@@ -0,0 +1,64 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+// dependency is a module imported by another module, the url is the name of
+// the module for the builtin ones.
+type dependency struct {
+	specifier string
+	url       string
+}
+
+// Dependency is a node in the tree of the modules that the script imports.
+type Dependency struct {
+	Specifier    string        `json:"specifier"`
+	URL          string        `json:"url"`
+	Dependencies []*Dependency `json:"dependencies,omitempty"`
+	// Deduped is set when the module was already listed before in the tree,
+	// so its dependencies aren't listed again.
+	Deduped bool `json:"deduped,omitempty"`
+}
+
+// Dependencies returns the tree of the modules that the script imports, in the
+// order in which they were first imported.
+func (b *Bundle) Dependencies() []*Dependency {
+	seen := map[string]bool{b.Filename.String(): true}
+	var walk func(url string) []*Dependency
+	walk = func(url string) []*Dependency {
+		deps := b.BaseInitContext.dependencies[url]
+		if len(deps) == 0 {
+			return nil
+		}
+		tree := make([]*Dependency, 0, len(deps))
+		for _, dep := range deps {
+			node := &Dependency{Specifier: dep.specifier, URL: dep.url}
+			if seen[dep.url] {
+				node.Deduped = len(b.BaseInitContext.dependencies[dep.url]) > 0
+			} else {
+				seen[dep.url] = true
+				node.Dependencies = walk(dep.url)
+			}
+			tree = append(tree, node)
+		}
+		return tree
+	}
+	return walk(b.Filename.String())
+}
@@ -0,0 +1,124 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package eventloop implements the event loop of a VU, which lets modules do
+// asynchronous work off the VU goroutine and run JS callbacks once it's done.
+package eventloop
+
+import (
+	"context"
+	"sync"
+)
+
+// EventLoop runs the callbacks that modules queue from other goroutines on
+// the goroutine of the VU, since the JS runtime isn't safe for concurrent use.
+type EventLoop struct {
+	mu         sync.Mutex
+	queue      []func() error
+	pending    int
+	generation uint64
+	wakeup     chan struct{}
+}
+
+// New returns a new EventLoop.
+func New() *EventLoop {
+	return &EventLoop{wakeup: make(chan struct{}, 1)}
+}
+
+// RegisterCallback signals that some asynchronous work was started and that
+// a callback will have to be run on the event loop when it's done. The
+// returned function queues that callback and must be called exactly once.
+// The current run of the event loop won't finish until it is.
+//
+// The returned function reports false if the run of the event loop the
+// callback was registered in has already finished, in which case the
+// callback is discarded and the caller should stop its work.
+func (e *EventLoop) RegisterCallback() func(func() error) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending++
+	generation := e.generation
+
+	called := false
+	return func(f func() error) bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if called {
+			panic("a callback registered with the event loop was queued more than once")
+		}
+		called = true
+		if generation != e.generation {
+			return false
+		}
+		e.queue = append(e.queue, f)
+		e.pending--
+		select {
+		case e.wakeup <- struct{}{}:
+		default:
+		}
+		return true
+	}
+}
+
+// Start runs firstCallback and then all of the callbacks that are queued,
+// until none are pending anymore. It also returns once the context is done,
+// or with the first error that any callback returns. Any callbacks that are
+// still pending at that point are discarded.
+func (e *EventLoop) Start(ctx context.Context, firstCallback func() error) error {
+	defer e.reset()
+	if err := firstCallback(); err != nil {
+		return err
+	}
+	for {
+		e.mu.Lock()
+		queue, pending := e.queue, e.pending
+		e.queue = nil
+		e.mu.Unlock()
+
+		if len(queue) == 0 {
+			if pending == 0 {
+				return nil
+			}
+			select {
+			case <-e.wakeup:
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+
+		for _, f := range queue {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := f(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (e *EventLoop) reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queue = nil
+	e.pending = 0
+	e.generation++
+}
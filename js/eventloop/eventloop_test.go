@@ -0,0 +1,88 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package eventloop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLoop(t *testing.T) {
+	t.Parallel()
+	loop := New()
+	var ran []int
+	err := loop.Start(context.Background(), func() error {
+		for i := 1; i <= 3; i++ {
+			i := i
+			enqueue := loop.RegisterCallback()
+			go func() {
+				time.Sleep(time.Duration(i) * 10 * time.Millisecond)
+				enqueue(func() error {
+					ran = append(ran, i)
+					if i == 3 {
+						// a callback can register more callbacks
+						enqueue := loop.RegisterCallback()
+						go enqueue(func() error { ran = append(ran, 4); return nil })
+					}
+					return nil
+				})
+			}()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4}, ran)
+}
+
+func TestEventLoopError(t *testing.T) {
+	t.Parallel()
+	loop := New()
+	var enqueue func(func() error) bool
+	err := loop.Start(context.Background(), func() error {
+		enqueue = loop.RegisterCallback()
+		fail := loop.RegisterCallback()
+		go fail(func() error { return errors.New("oops") })
+		return nil
+	})
+	require.EqualError(t, err, "oops")
+
+	// the callback belongs to a run that has already finished
+	assert.False(t, enqueue(func() error { return nil }))
+	require.NoError(t, loop.Start(context.Background(), func() error { return nil }))
+}
+
+func TestEventLoopContextDone(t *testing.T) {
+	t.Parallel()
+	loop := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := loop.Start(ctx, func() error {
+		loop.RegisterCallback() // never queued
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Error(t, ctx.Err())
+}
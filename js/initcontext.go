@@ -36,17 +36,26 @@ import (
 
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/compiler"
+	"go.k6.io/k6/js/eventloop"
 	"go.k6.io/k6/js/modules"
 	"go.k6.io/k6/js/modules/k6"
 	"go.k6.io/k6/js/modules/k6/crypto"
+	"go.k6.io/k6/js/modules/k6/crypto/jwt"
 	"go.k6.io/k6/js/modules/k6/crypto/x509"
 	"go.k6.io/k6/js/modules/k6/data"
+	"go.k6.io/k6/js/modules/k6/dns"
 	"go.k6.io/k6/js/modules/k6/encoding"
 	"go.k6.io/k6/js/modules/k6/execution"
+	expfs "go.k6.io/k6/js/modules/k6/experimental/fs"
+	"go.k6.io/k6/js/modules/k6/experimental/sse"
 	"go.k6.io/k6/js/modules/k6/grpc"
 	"go.k6.io/k6/js/modules/k6/html"
 	"go.k6.io/k6/js/modules/k6/http"
 	"go.k6.io/k6/js/modules/k6/metrics"
+	"go.k6.io/k6/js/modules/k6/mqtt"
+	"go.k6.io/k6/js/modules/k6/redis"
+	"go.k6.io/k6/js/modules/k6/socket"
+	"go.k6.io/k6/js/modules/k6/sql"
 	"go.k6.io/k6/js/modules/k6/ws"
 	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/fsext"
@@ -74,6 +83,12 @@ type InitContext struct {
 	// Filesystem to load files and scripts from with the map key being the scheme
 	filesystems map[string]afero.Fs
 	pwd         *url.URL
+	moduleURL   *url.URL // the module that is being loaded, for the import map and the dependencies
+
+	importMap *loader.ImportMap
+
+	// The modules imported by each module, it's only kept by the base init context.
+	dependencies map[string][]dependency
 
 	// Cache of loaded programs and files.
 	programs map[string]programWithSource
@@ -94,12 +109,13 @@ func NewInitContext(
 		compiler:          c,
 		filesystems:       filesystems,
 		pwd:               pwd,
+		dependencies:      make(map[string][]dependency),
 		programs:          make(map[string]programWithSource),
 		compatibilityMode: compatMode,
 		logger:            logger,
 		modules:           getJSModules(),
 		moduleVUImpl: &moduleVUImpl{
-			ctxPtr: ctxPtr, runtime: rt,
+			ctxPtr: ctxPtr, runtime: rt, eventLoop: eventloop.New(),
 		},
 	}
 }
@@ -118,6 +134,8 @@ func newBoundInitContext(base *InitContext, vuImpl *moduleVUImpl) *InitContext {
 	return &InitContext{
 		filesystems: base.filesystems,
 		pwd:         base.pwd,
+		moduleURL:   base.moduleURL,
+		importMap:   base.importMap,
 		compiler:    base.compiler,
 
 		programs:          programs,
@@ -130,6 +148,10 @@ func newBoundInitContext(base *InitContext, vuImpl *moduleVUImpl) *InitContext {
 
 // Require is called when a module/file needs to be loaded by a script
 func (i *InitContext) Require(arg string) goja.Value {
+	specifier := arg
+	if address, ok := i.importMap.Resolve(arg, i.moduleURL); ok {
+		arg = address
+	}
 	switch {
 	case arg == "k6", strings.HasPrefix(arg, "k6/"):
 		// Builtin or external modules ("k6", "k6/*", or "k6/x/*") are handled
@@ -139,10 +161,11 @@ func (i *InitContext) Require(arg string) goja.Value {
 		if err != nil {
 			common.Throw(i.moduleVUImpl.runtime, err)
 		}
+		i.addDependency(specifier, arg)
 		return v
 	default:
 		// Fall back to loading from the filesystem.
-		v, err := i.requireFile(arg)
+		v, err := i.requireFile(specifier, arg)
 		if err != nil {
 			common.Throw(i.moduleVUImpl.runtime, err)
 		}
@@ -151,15 +174,17 @@ func (i *InitContext) Require(arg string) goja.Value {
 }
 
 type moduleVUImpl struct {
-	ctxPtr  *context.Context
-	initEnv *common.InitEnvironment
-	state   *lib.State
-	runtime *goja.Runtime
+	ctxPtr    *context.Context
+	initEnv   *common.InitEnvironment
+	state     *lib.State
+	runtime   *goja.Runtime
+	eventLoop *eventloop.EventLoop
 }
 
 func newModuleVUImpl() *moduleVUImpl {
 	return &moduleVUImpl{
-		ctxPtr: new(context.Context),
+		ctxPtr:    new(context.Context),
+		eventLoop: eventloop.New(),
 	}
 }
 
@@ -179,6 +204,10 @@ func (m *moduleVUImpl) Runtime() *goja.Runtime {
 	return m.runtime
 }
 
+func (m *moduleVUImpl) RegisterCallback() func(func() error) bool {
+	return m.eventLoop.RegisterCallback()
+}
+
 func toESModuleExports(exp modules.Exports) interface{} {
 	if exp.Named == nil {
 		return exp.Default
@@ -224,13 +253,39 @@ func (i *InitContext) requireModule(name string) (goja.Value, error) {
 	return i.moduleVUImpl.runtime.ToValue(common.Bind(i.moduleVUImpl.runtime, mod, i.moduleVUImpl.ctxPtr)), nil
 }
 
-func (i *InitContext) requireFile(name string) (goja.Value, error) {
+// resolveFile resolves the name of an imported file, bare specifiers are
+// looked for in the node_modules directories first.
+func (i *InitContext) resolveFile(name string) (*url.URL, error) {
+	fileURL, err := loader.ResolveNodeModule(i.filesystems["file"], i.pwd, name)
+	if err != nil || fileURL != nil {
+		return fileURL, err
+	}
+	return loader.Resolve(i.pwd, name)
+}
+
+// addDependency records that the module being loaded imports specifier, which
+// was resolved to url. Only the base init context records them.
+func (i *InitContext) addDependency(specifier, url string) {
+	if i.dependencies == nil || i.moduleURL == nil {
+		return
+	}
+	parent := i.moduleURL.String()
+	for _, dep := range i.dependencies[parent] {
+		if dep.specifier == specifier {
+			return
+		}
+	}
+	i.dependencies[parent] = append(i.dependencies[parent], dependency{specifier: specifier, url: url})
+}
+
+func (i *InitContext) requireFile(specifier, name string) (goja.Value, error) {
 	// Resolve the file path, push the target directory as pwd to make relative imports work.
-	pwd := i.pwd
-	fileURL, err := loader.Resolve(pwd, name)
+	pwd, moduleURL := i.pwd, i.moduleURL
+	fileURL, err := i.resolveFile(name)
 	if err != nil {
 		return nil, err
 	}
+	i.addDependency(specifier, fileURL.String())
 
 	// First, check if we have a cached program already.
 	pgm, ok := i.programs[fileURL.String()]
@@ -241,8 +296,8 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 				" import them with the `file://` schema for slightly better compatibility",
 				name)
 		}
-		i.pwd = loader.Dir(fileURL)
-		defer func() { i.pwd = pwd }()
+		i.pwd, i.moduleURL = loader.Dir(fileURL), fileURL
+		defer func() { i.pwd, i.moduleURL = pwd, moduleURL }()
 		exports := i.moduleVUImpl.runtime.NewObject()
 		pgm.module = i.moduleVUImpl.runtime.NewObject()
 		_ = pgm.module.Set("exports", exports)
@@ -359,17 +414,26 @@ func (i *InitContext) allowOnlyOpenedFiles() {
 
 func getInternalJSModules() map[string]interface{} {
 	return map[string]interface{}{
-		"k6":             k6.New(),
-		"k6/crypto":      crypto.New(),
-		"k6/crypto/x509": x509.New(),
-		"k6/data":        data.New(),
-		"k6/encoding":    encoding.New(),
-		"k6/execution":   execution.New(),
-		"k6/net/grpc":    grpc.New(),
-		"k6/html":        html.New(),
-		"k6/http":        http.New(),
-		"k6/metrics":     metrics.New(),
-		"k6/ws":          ws.New(),
+		"k6":                  k6.New(),
+		"k6/crypto":           crypto.New(),
+		"k6/crypto/jwt":       jwt.New(),
+		"k6/crypto/x509":      x509.New(),
+		"k6/data":             data.New(),
+		"k6/encoding":         encoding.New(),
+		"k6/execution":        execution.New(),
+		"k6/experimental/fs":  expfs.New(),
+		"k6/experimental/sse": sse.New(),
+		"k6/net/dns":          dns.New(),
+		"k6/net/grpc":         grpc.New(),
+		"k6/net/mqtt":         mqtt.New(),
+		"k6/net/tcp":          socket.NewTCP(),
+		"k6/net/udp":          socket.NewUDP(),
+		"k6/html":             html.New(),
+		"k6/http":             http.New(),
+		"k6/metrics":          metrics.New(),
+		"k6/redis":            redis.New(),
+		"k6/sql":              sql.New(),
+		"k6/ws":               ws.New(),
 	}
 }
 
@@ -714,3 +714,39 @@ export default function () {
 	// likely settings in the transpilers
 	require.Equal(t, "cool is cool\n\tat webpack:///./test1.ts:2:4(2)\n\tat r (webpack:///./test1.ts:5:4(3))\n\tat file:///script.js:4:2(4)\n\tat native\n", exception.String())
 }
+
+func TestSourceMapsTypeScript(t *testing.T) {
+	t.Parallel()
+	logger := testutils.NewLogger(t)
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/module1.ts", []byte(`
+interface Check {
+    name: string;
+}
+export enum Level { Low = 1, High }
+export function f2(check: Check): never {
+    throw "exception in line 6 for " + check.name + " " + Level.High
+}
+`[1:]), 0o644))
+	data := `
+import { f2 } from "./module1.ts"
+
+type Options = { vus: number };
+export const options: Options = { vus: 1 };
+
+export default function(): void {
+    const name = <string>"ts";
+    f2({ name })
+}
+`[1:]
+	b, err := getSimpleBundle(t, "/script.ts", data, fs)
+	require.NoError(t, err)
+
+	bi, err := b.Instantiate(logger, 0, newModuleVUImpl())
+	require.NoError(t, err)
+	_, err = bi.exports[consts.DefaultFn](goja.Undefined())
+	require.Error(t, err)
+	exception := new(goja.Exception)
+	require.ErrorAs(t, err, &exception)
+	require.Equal(t, "exception in line 6 for ts 2\n\tat f2 (file:///module1.ts:6:4(7))\n\tat file:///script.ts:8:7(9)\n\tat native\n", exception.String())
+}
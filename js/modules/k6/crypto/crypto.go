@@ -87,6 +87,9 @@ func (c *Crypto) Exports() modules.Exports {
 			"sha512_224":  c.sha512_224,
 			"sha512_256":  c.sha512_256,
 			"hexEncode":   c.hexEncode,
+
+			"subtle":          &SubtleCrypto{vu: c.vu},
+			"getRandomValues": c.getRandomValues,
 		},
 	}
 }
@@ -0,0 +1,449 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jwt
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // #nosec G505
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ErrDecryptionFailed is returned when a JWE token can't be decrypted.
+var ErrDecryptionFailed = errors.New("the token couldn't be decrypted")
+
+// contentEncryption is a JWE content encryption algorithm from RFC 7518.
+type contentEncryption struct {
+	keySize int
+	// hash is set for the AES-CBC with HMAC algorithms, the others use AES-GCM.
+	hash gocrypto.Hash
+}
+
+//nolint:gochecknoglobals
+var contentEncryptions = map[string]contentEncryption{
+	"A128GCM":       {keySize: 16},
+	"A192GCM":       {keySize: 24},
+	"A256GCM":       {keySize: 32},
+	"A128CBC-HS256": {keySize: 32, hash: gocrypto.SHA256},
+	"A192CBC-HS384": {keySize: 48, hash: gocrypto.SHA384},
+	"A256CBC-HS512": {keySize: 64, hash: gocrypto.SHA512},
+}
+
+func getContentEncryption(name string) (contentEncryption, error) {
+	enc, ok := contentEncryptions[name]
+	if !ok {
+		return enc, fmt.Errorf("unsupported JWE content encryption %q", name)
+	}
+	return enc, nil
+}
+
+// defaultContentEncryption returns the content encryption that matches the
+// size of a key that is used directly.
+func defaultContentEncryption(keySize int) string {
+	switch keySize {
+	case 16:
+		return "A128GCM"
+	case 24:
+		return "A192GCM"
+	case 48:
+		return "A192CBC-HS384"
+	case 64:
+		return "A256CBC-HS512"
+	default:
+		return "A256GCM"
+	}
+}
+
+func (enc contentEncryption) encrypt(cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	if enc.hash == 0 {
+		aead, err := newGCM(cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv = make([]byte, aead.NonceSize())
+		if _, err = rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		sealed := aead.Seal(nil, iv, plaintext, aad)
+		split := len(sealed) - aead.Overhead()
+		return iv, sealed[:split], sealed[split:], nil
+	}
+
+	macKey, encKey := cek[:len(cek)/2], cek[len(cek)/2:]
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv = make([]byte, aes.BlockSize)
+	if _, err = rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext = append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return iv, ciphertext, cbcTag(enc.hash.New, macKey, aad, iv, ciphertext), nil
+}
+
+func (enc contentEncryption) decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if enc.hash == 0 {
+		aead, err := newGCM(cek)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aead.NonceSize() {
+			return nil, ErrDecryptionFailed
+		}
+		plaintext, err := aead.Open(nil, iv, append(append([]byte{}, ciphertext...), tag...), aad)
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		return plaintext, nil
+	}
+
+	macKey, encKey := cek[:len(cek)/2], cek[len(cek)/2:]
+	if !hmac.Equal(tag, cbcTag(enc.hash.New, macKey, aad, iv, ciphertext)) ||
+		len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrDecryptionFailed
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cbcTag returns the authentication tag of the AES-CBC with HMAC algorithms,
+// see https://datatracker.ietf.org/doc/html/rfc7518#section-5.2.2.1
+func cbcTag(h func() hash.Hash, macKey, aad, iv, ciphertext []byte) []byte {
+	mac := hmac.New(h, macKey)
+	_, _ = mac.Write(aad)
+	_, _ = mac.Write(iv)
+	_, _ = mac.Write(ciphertext)
+	_ = binary.Write(mac, binary.BigEndian, uint64(len(aad))*8)
+	return mac.Sum(nil)[:len(macKey)]
+}
+
+// encryptKey returns the content encryption key and its encrypted value for
+// the JWE key management algorithm.
+func encryptKey(alg string, k *Key, enc contentEncryption) (cek, encryptedKey []byte, err error) {
+	if alg == "dir" {
+		secret, ok := k.handle.([]byte)
+		if !ok {
+			return nil, nil, fmt.Errorf("a %s %s key can't be used with %s", k.Kty, k.Type, alg)
+		}
+		if len(secret) != enc.keySize {
+			return nil, nil, fmt.Errorf("the key must be %d bytes long for the content encryption", enc.keySize)
+		}
+		return secret, nil, nil
+	}
+
+	cek = make([]byte, enc.keySize)
+	if _, err = rand.Read(cek); err != nil {
+		return nil, nil, err
+	}
+	switch alg {
+	case "A128KW", "A192KW", "A256KW":
+		kek, err := keyWrappingKey(alg, k)
+		if err != nil {
+			return nil, nil, err
+		}
+		encryptedKey, err = aesKeyWrap(kek, cek)
+		return cek, encryptedKey, err
+	case "RSA-OAEP", "RSA-OAEP-256":
+		public, ok := k.public().(*rsa.PublicKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("a %s %s key can't be used with %s", k.Kty, k.Type, alg)
+		}
+		encryptedKey, err = rsa.EncryptOAEP(oaepHash(alg), rand.Reader, public, cek, nil)
+		return cek, encryptedKey, err
+	default:
+		return nil, nil, fmt.Errorf("unsupported JWE algorithm %q", alg)
+	}
+}
+
+// decryptKey returns the content encryption key of a token.
+func decryptKey(alg string, k *Key, enc contentEncryption, encryptedKey []byte) ([]byte, error) {
+	var (
+		cek []byte
+		err error
+	)
+	switch alg {
+	case "dir":
+		secret, ok := k.handle.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("a %s %s key can't be used with %s", k.Kty, k.Type, alg)
+		}
+		if len(encryptedKey) != 0 {
+			return nil, ErrDecryptionFailed
+		}
+		cek = secret
+	case "A128KW", "A192KW", "A256KW":
+		kek, err := keyWrappingKey(alg, k)
+		if err != nil {
+			return nil, err
+		}
+		cek, err = aesKeyUnwrap(kek, encryptedKey)
+		if err != nil {
+			return nil, err
+		}
+	case "RSA-OAEP", "RSA-OAEP-256":
+		private, ok := k.handle.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("a %s %s key can't be used with %s", k.Kty, k.Type, alg)
+		}
+		if cek, err = rsa.DecryptOAEP(oaepHash(alg), rand.Reader, private, encryptedKey, nil); err != nil {
+			return nil, ErrDecryptionFailed
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWE algorithm %q", alg)
+	}
+	if len(cek) != enc.keySize {
+		return nil, ErrDecryptionFailed
+	}
+	return cek, nil
+}
+
+func oaepHash(alg string) hash.Hash {
+	if alg == "RSA-OAEP" {
+		return sha1.New() // #nosec G401
+	}
+	return sha256.New()
+}
+
+func keyWrappingKey(alg string, k *Key) ([]byte, error) {
+	kek, ok := k.handle.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("a %s %s key can't be used with %s", k.Kty, k.Type, alg)
+	}
+	if size := map[string]int{"A128KW": 16, "A192KW": 24, "A256KW": 32}[alg]; len(kek) != size {
+		return nil, fmt.Errorf("the key must be %d bytes long for %s", size, alg)
+	}
+	return kek, nil
+}
+
+// keyWrapIV is the default initial value of RFC 3394.
+//
+//nolint:gochecknoglobals
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKeyWrap wraps a key with the AES key wrap algorithm of RFC 3394.
+func aesKeyWrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("the key to wrap must be a multiple of 8 bytes long")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out, keyWrapIV)
+	copy(out[8:], key)
+	b := make([]byte, aes.BlockSize)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, out[:8])
+			copy(b[8:], out[i*8:])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[i*8:], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// aesKeyUnwrap unwraps a key that was wrapped with aesKeyWrap.
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, ErrDecryptionFailed
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wrapped)/8 - 1
+	out := append([]byte{}, wrapped...)
+	b := make([]byte, aes.BlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(out[:8])^t)
+			copy(b[8:], out[i*8:i*8+8])
+			block.Decrypt(b, b)
+			copy(out[:8], b[:8])
+			copy(out[i*8:], b[8:])
+		}
+	}
+	if !hmac.Equal(out[:8], keyWrapIV) {
+		return nil, ErrDecryptionFailed
+	}
+	return out[8:], nil
+}
+
+// encrypt returns a compact JWE token with the given payload, which is
+// encoded to JSON unless it is a string or an ArrayBuffer. Secret keys are
+// used directly by default, RSA keys with RSA-OAEP-256.
+func (mi *ModuleInstance) encrypt(payload, key, options goja.Value) (string, error) {
+	k, err := toKey(key)
+	if err != nil {
+		return "", err
+	}
+	opts, err := exportOptions(options)
+	if err != nil {
+		return "", err
+	}
+	header, err := makeHeader(opts)
+	if err != nil {
+		return "", err
+	}
+	if k, err = k.forKID(stringValue(header["kid"])); err != nil {
+		return "", err
+	}
+	if header["kid"] == nil && k.ID != "" {
+		header["kid"] = k.ID
+	}
+
+	alg, err := optString(opts, "alg")
+	if err != nil {
+		return "", err
+	}
+	if alg == "" {
+		alg = "RSA-OAEP-256"
+		if _, ok := k.handle.([]byte); ok {
+			alg = "dir"
+		}
+	}
+	encName, err := optString(opts, "enc")
+	if err != nil {
+		return "", err
+	}
+	if encName == "" {
+		encName = "A256GCM"
+		if secret, ok := k.handle.([]byte); ok && alg == "dir" {
+			encName = defaultContentEncryption(len(secret))
+		}
+	}
+	enc, err := getContentEncryption(encName)
+	if err != nil {
+		return "", err
+	}
+	header["alg"], header["enc"] = alg, encName
+
+	cek, encryptedKey, err := encryptKey(alg, k, enc)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := encodePayload(payload, opts)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader, err := encodeHeader(header)
+	if err != nil {
+		return "", err
+	}
+	iv, ciphertext, tag, err := enc.encrypt(cek, plaintext, []byte(encodedHeader))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		encodedHeader, encodeSegment(encryptedKey), encodeSegment(iv), encodeSegment(ciphertext), encodeSegment(tag),
+	}, "."), nil
+}
+
+// decrypt decrypts a compact JWE token and checks its claims.
+func (mi *ModuleInstance) decrypt(token string, key, options goja.Value) (*Token, error) {
+	k, err := toKey(key)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := exportOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, ErrMalformedToken
+	}
+	header, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := header["zip"]; ok {
+		return nil, errors.New("compressed JWE tokens aren't supported")
+	}
+
+	alg := stringValue(header["alg"])
+	if err = checkAlgorithm(opts, alg); err != nil {
+		return nil, err
+	}
+	enc, err := getContentEncryption(stringValue(header["enc"]))
+	if err != nil {
+		return nil, err
+	}
+	if k, err = k.forKID(stringValue(header["kid"])); err != nil {
+		return nil, err
+	}
+
+	segments := make([][]byte, 4)
+	for i := range segments {
+		if segments[i], err = decodeSegment(parts[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	cek, err := decryptKey(alg, k, enc, segments[0])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := enc.decrypt(cek, segments[1], segments[2], segments[3], []byte(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	return newToken(header, plaintext, opts)
+}
@@ -0,0 +1,129 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jwt
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESKeyWrap(t *testing.T) {
+	t.Parallel()
+	// https://datatracker.ietf.org/doc/html/rfc3394#section-4.2
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F1011121314151617")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	expected := "96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D"
+
+	wrapped, err := aesKeyWrap(kek, key)
+	require.NoError(t, err)
+	assert.Equal(t, expected, strings.ToUpper(hex.EncodeToString(wrapped)))
+
+	unwrapped, err := aesKeyUnwrap(kek, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, key, unwrapped)
+
+	wrapped[0] ^= 1
+	_, err = aesKeyUnwrap(kek, wrapped)
+	assert.Equal(t, ErrDecryptionFailed, err)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, key, decryptionKey, options, header string
+	}{
+		{
+			name: "Direct", key: `"0123456789abcdef"`,
+			header: "dir A128GCM",
+		},
+		{
+			name: "DirectCBC", key: `"0123456789abcdef0123456789abcdef"`, options: `{ enc: "A128CBC-HS256" }`,
+			header: "dir A128CBC-HS256",
+		},
+		{
+			name: "KeyWrap", key: `"0123456789abcdef0123456789abcdef"`, options: `{ alg: "A256KW", enc: "A256CBC-HS512" }`,
+			header: "A256KW A256CBC-HS512",
+		},
+		{
+			name: "RSA", key: "rsaPublicKey", decryptionKey: "rsaPrivateKey",
+			header: "RSA-OAEP-256 A256GCM",
+		},
+		{
+			name: "RSA-OAEP", key: "rsaPublicKey", decryptionKey: "rsaPrivateKey", options: `{ alg: "RSA-OAEP", enc: "A192GCM" }`,
+			header: "RSA-OAEP A192GCM",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rt := makeRuntime(t)
+			decryptionKey, options := tc.decryptionKey, tc.options
+			if decryptionKey == "" {
+				decryptionKey = tc.key
+			}
+			if options == "" {
+				options = "{}"
+			}
+
+			v, err := rt.RunString(`
+			var token = jwt.encrypt({ sub: "k6" }, ` + tc.key + `, ` + options + `);
+			var t = jwt.decrypt(token, ` + decryptionKey + `);
+			[t.header.alg, t.header.enc, t.payload.sub, jwt.decode(token).payload].join(" ");`)
+			require.NoError(t, err)
+			assert.Equal(t, tc.header+" k6 ", v.String())
+		})
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	t.Parallel()
+	rt := makeRuntime(t)
+
+	_, err := rt.RunString(`
+	var token = jwt.encrypt("hello", "0123456789abcdef");
+	var parts = token.split(".");
+	parts[3] = parts[3].slice(0, -2) + (parts[3].slice(-2) === "AA" ? "AQ" : "AA");
+	jwt.decrypt(parts.join("."), "0123456789abcdef");`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrDecryptionFailed.Error())
+
+	_, err = rt.RunString(`jwt.decrypt(jwt.encrypt("hello", "0123456789abcdef"), "fedcba9876543210")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrDecryptionFailed.Error())
+
+	_, err = rt.RunString(`jwt.decrypt(jwt.encrypt({}, "0123456789abcdef", { expiresIn: -10 }), "0123456789abcdef")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrTokenExpired.Error())
+
+	_, err = rt.RunString(`jwt.encrypt("hello", "0123456789abcdef", { enc: "A256GCM" })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the key must be 32 bytes long")
+
+	_, err = rt.RunString(`jwt.decrypt(jwt.encrypt("hello", rsaPublicKey), rsaPublicKey)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a RSA public key can't be used with RSA-OAEP-256")
+}
@@ -0,0 +1,164 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jwt
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrInvalidSignature is returned when the signature of a token doesn't match.
+var ErrInvalidSignature = errors.New("the token signature is invalid")
+
+// signingAlgorithm is a JWS algorithm from RFC 7518, or EdDSA from RFC 8037.
+type signingAlgorithm struct {
+	name  string
+	hash  gocrypto.Hash
+	curve elliptic.Curve // for the ECDSA algorithms
+}
+
+//nolint:gochecknoglobals
+var signingAlgorithms = map[string]signingAlgorithm{
+	"HS256": {name: "HS256", hash: gocrypto.SHA256},
+	"HS384": {name: "HS384", hash: gocrypto.SHA384},
+	"HS512": {name: "HS512", hash: gocrypto.SHA512},
+	"RS256": {name: "RS256", hash: gocrypto.SHA256},
+	"RS384": {name: "RS384", hash: gocrypto.SHA384},
+	"RS512": {name: "RS512", hash: gocrypto.SHA512},
+	"PS256": {name: "PS256", hash: gocrypto.SHA256},
+	"PS384": {name: "PS384", hash: gocrypto.SHA384},
+	"PS512": {name: "PS512", hash: gocrypto.SHA512},
+	"ES256": {name: "ES256", hash: gocrypto.SHA256, curve: elliptic.P256()},
+	"ES384": {name: "ES384", hash: gocrypto.SHA384, curve: elliptic.P384()},
+	"ES512": {name: "ES512", hash: gocrypto.SHA512, curve: elliptic.P521()},
+	"EdDSA": {name: "EdDSA"},
+}
+
+func getSigningAlgorithm(name string) (signingAlgorithm, error) {
+	alg, ok := signingAlgorithms[name]
+	if !ok {
+		return alg, fmt.Errorf("unsupported JWS algorithm %q", name)
+	}
+	return alg, nil
+}
+
+func (alg signingAlgorithm) digest(data []byte) []byte {
+	h := alg.hash.New()
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+func (alg signingAlgorithm) keyError(k *Key) error {
+	return fmt.Errorf("a %s %s key can't be used with %s", k.Kty, k.Type, alg.name)
+}
+
+func (alg signingAlgorithm) sign(k *Key, data []byte) ([]byte, error) {
+	switch alg.name[:2] {
+	case "HS":
+		if secret, ok := k.handle.([]byte); ok {
+			mac := hmac.New(alg.hash.New, secret)
+			_, _ = mac.Write(data)
+			return mac.Sum(nil), nil
+		}
+	case "RS":
+		if key, ok := k.handle.(*rsa.PrivateKey); ok {
+			return rsa.SignPKCS1v15(rand.Reader, key, alg.hash, alg.digest(data))
+		}
+	case "PS":
+		if key, ok := k.handle.(*rsa.PrivateKey); ok {
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash}
+			return rsa.SignPSS(rand.Reader, key, alg.hash, alg.digest(data), opts)
+		}
+	case "ES":
+		if key, ok := k.handle.(*ecdsa.PrivateKey); ok && key.Curve == alg.curve {
+			r, s, err := ecdsa.Sign(rand.Reader, key, alg.digest(data))
+			if err != nil {
+				return nil, err
+			}
+			size := (alg.curve.Params().BitSize + 7) / 8
+			sig := make([]byte, 2*size)
+			r.FillBytes(sig[:size])
+			s.FillBytes(sig[size:])
+			return sig, nil
+		}
+	case "Ed":
+		if key, ok := k.handle.(ed25519.PrivateKey); ok {
+			return ed25519.Sign(key, data), nil
+		}
+	}
+	return nil, alg.keyError(k)
+}
+
+func (alg signingAlgorithm) verify(k *Key, data, sig []byte) error {
+	valid := false
+	switch alg.name[:2] {
+	case "HS":
+		secret, ok := k.handle.([]byte)
+		if !ok {
+			return alg.keyError(k)
+		}
+		mac := hmac.New(alg.hash.New, secret)
+		_, _ = mac.Write(data)
+		valid = hmac.Equal(mac.Sum(nil), sig)
+	case "RS":
+		key, ok := k.public().(*rsa.PublicKey)
+		if !ok {
+			return alg.keyError(k)
+		}
+		valid = rsa.VerifyPKCS1v15(key, alg.hash, alg.digest(data), sig) == nil
+	case "PS":
+		key, ok := k.public().(*rsa.PublicKey)
+		if !ok {
+			return alg.keyError(k)
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: alg.hash}
+		valid = rsa.VerifyPSS(key, alg.hash, alg.digest(data), sig, opts) == nil
+	case "ES":
+		key, ok := k.public().(*ecdsa.PublicKey)
+		if !ok || key.Curve != alg.curve {
+			return alg.keyError(k)
+		}
+		size := (alg.curve.Params().BitSize + 7) / 8
+		if len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			valid = ecdsa.Verify(key, alg.digest(data), r, s)
+		}
+	case "Ed":
+		key, ok := k.public().(ed25519.PublicKey)
+		if !ok {
+			return alg.keyError(k)
+		}
+		valid = ed25519.Verify(key, data, sig)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
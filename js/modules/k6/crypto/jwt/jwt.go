@@ -0,0 +1,496 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package jwt implements the k6/crypto/jwt module, which signs and verifies
+// JWS tokens, encrypts and decrypts JWE tokens and validates their claims.
+// Only the compact serialization of the tokens is supported.
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/modules"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// ModuleInstance represents an instance of the JWT module for a VU.
+	ModuleInstance struct {
+		vu modules.VU
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+// The errors that are returned when a token is rejected.
+var (
+	ErrMalformedToken   = errors.New("the token is malformed")
+	ErrUnsecuredToken   = errors.New("unsecured tokens with the none algorithm aren't accepted")
+	ErrTokenExpired     = errors.New("the token is expired")
+	ErrTokenNotValidYet = errors.New("the token isn't valid yet")
+	ErrInvalidAudience  = errors.New("the token audience doesn't match")
+	ErrInvalidIssuer    = errors.New("the token issuer doesn't match")
+	ErrInvalidSubject   = errors.New("the token subject doesn't match")
+)
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu}
+}
+
+// Exports returns the exports of the JWT module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"parseKey": mi.parseKey,
+			"sign":     mi.sign,
+			"verify":   mi.verify,
+			"decode":   mi.decode,
+			"encrypt":  mi.encrypt,
+			"decrypt":  mi.decrypt,
+		},
+	}
+}
+
+// Token is a decoded token. The payload is the parsed JSON of the claims,
+// or a string if it isn't JSON.
+type Token struct {
+	Header  map[string]interface{} `js:"header"`
+	Payload interface{}            `js:"payload"`
+}
+
+// parseKey parses a key once, so that it doesn't need to be parsed again on
+// every sign(), verify(), encrypt() or decrypt() call.
+func (mi *ModuleInstance) parseKey(data goja.Value) (*Key, error) {
+	return toKey(data)
+}
+
+// sign returns a compact JWS token with the given payload, which is encoded
+// to JSON unless it is a string or an ArrayBuffer.
+func (mi *ModuleInstance) sign(payload, key, options goja.Value) (string, error) {
+	k, err := toKey(key)
+	if err != nil {
+		return "", err
+	}
+	opts, err := exportOptions(options)
+	if err != nil {
+		return "", err
+	}
+	header, err := makeHeader(opts)
+	if err != nil {
+		return "", err
+	}
+	if k, err = k.forKID(stringValue(header["kid"])); err != nil {
+		return "", err
+	}
+	if header["kid"] == nil && k.ID != "" {
+		header["kid"] = k.ID
+	}
+	if header["typ"] == nil {
+		header["typ"] = "JWT"
+	}
+
+	algName, err := optString(opts, "alg")
+	if err != nil {
+		return "", err
+	}
+	if algName == "" {
+		if algName, err = k.defaultSigningAlgorithm(); err != nil {
+			return "", err
+		}
+	}
+	alg, err := getSigningAlgorithm(algName)
+	if err != nil {
+		return "", err
+	}
+	header["alg"] = alg.name
+
+	body, err := encodePayload(payload, opts)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader, err := encodeHeader(header)
+	if err != nil {
+		return "", err
+	}
+	input := encodedHeader + "." + encodeSegment(body)
+	sig, err := alg.sign(k, []byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + encodeSegment(sig), nil
+}
+
+// verify checks the signature and the claims of a compact JWS token and
+// returns it decoded.
+func (mi *ModuleInstance) verify(token string, key, options goja.Value) (*Token, error) {
+	k, err := toKey(key)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := exportOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	header, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	algName := stringValue(header["alg"])
+	if err = checkAlgorithm(opts, algName); err != nil {
+		return nil, err
+	}
+	alg, err := getSigningAlgorithm(algName)
+	if err != nil {
+		return nil, err
+	}
+	if k, err = k.forKID(stringValue(header["kid"])); err != nil {
+		return nil, err
+	}
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if err = alg.verify(k, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return newToken(header, payload, opts)
+}
+
+// decode returns the header and the payload of a JWS token without checking
+// its signature or its claims. Only the header of JWE tokens is returned.
+func (mi *ModuleInstance) decode(token string) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 && len(parts) != 5 {
+		return nil, ErrMalformedToken
+	}
+	header, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	t := &Token{Header: header}
+	if len(parts) == 3 {
+		payload, err := decodeSegment(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		t.Payload = parsePayload(payload)
+	}
+	return t, nil
+}
+
+func newToken(header map[string]interface{}, payload []byte, opts map[string]interface{}) (*Token, error) {
+	t := &Token{Header: header, Payload: parsePayload(payload)}
+	if claims, ok := t.Payload.(map[string]interface{}); ok {
+		if err := validateClaims(claims, opts, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func parsePayload(payload []byte) interface{} {
+	var parsed interface{}
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return string(payload)
+	}
+	return parsed
+}
+
+// validateClaims checks the exp and nbf claims when they are present, and the
+// aud, iss and sub claims when the audience, issuer or subject options are
+// set. The clockTolerance option is the leeway for exp and nbf, in seconds.
+func validateClaims(claims map[string]interface{}, opts map[string]interface{}, now time.Time) error {
+	tolerance, err := optNumber(opts, "clockTolerance")
+	if err != nil {
+		return err
+	}
+	leeway := time.Duration(tolerance * float64(time.Second))
+
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(leeway).Before(nbf) {
+		return ErrTokenNotValidYet
+	}
+
+	audiences, err := optStrings(opts, "audience")
+	if err != nil {
+		return err
+	}
+	if len(audiences) > 0 && !audienceMatches(claims["aud"], audiences) {
+		return ErrInvalidAudience
+	}
+	for _, c := range []struct {
+		claim, option string
+		err           error
+	}{
+		{"iss", "issuer", ErrInvalidIssuer},
+		{"sub", "subject", ErrInvalidSubject},
+	} {
+		expected, err := optStrings(opts, c.option)
+		if err != nil {
+			return err
+		}
+		if len(expected) > 0 && !contains(expected, stringValue(claims[c.claim])) {
+			return c.err
+		}
+	}
+	return nil
+}
+
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("the %s claim must be a number", name)
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), true, nil
+}
+
+func audienceMatches(aud interface{}, expected []string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return contains(expected, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && contains(expected, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAlgorithm rejects unsecured tokens, and the algorithms that aren't
+// listed in the algorithms option if it's set.
+func checkAlgorithm(opts map[string]interface{}, alg string) error {
+	if alg == "none" {
+		return ErrUnsecuredToken
+	}
+	allowed, err := optStrings(opts, "algorithms")
+	if err != nil {
+		return err
+	}
+	if len(allowed) > 0 && !contains(allowed, alg) {
+		return fmt.Errorf("the %q algorithm isn't allowed", alg)
+	}
+	return nil
+}
+
+// makeHeader returns the header with the extra fields from the header option
+// and the kid, typ and cty options.
+func makeHeader(opts map[string]interface{}) (map[string]interface{}, error) {
+	header := make(map[string]interface{})
+	if extra, ok := opts["header"]; ok && extra != nil {
+		fields, ok := extra.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("the header option must be an object")
+		}
+		for k, v := range fields {
+			header[k] = v
+		}
+	}
+	for _, name := range []string{"kid", "typ", "cty"} {
+		v, err := optString(opts, name)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			header[name] = v
+		}
+	}
+	return header, nil
+}
+
+// encodePayload returns the payload of a token. When it's an object, the
+// expiresIn and notBefore options are added to it as the exp and nbf claims,
+// in seconds from now.
+func encodePayload(payload goja.Value, opts map[string]interface{}) ([]byte, error) {
+	if payload == nil || goja.IsUndefined(payload) || goja.IsNull(payload) {
+		return nil, errors.New("a payload is required")
+	}
+	switch p := payload.Export().(type) {
+	case string:
+		return []byte(p), nil
+	case goja.ArrayBuffer:
+		return p.Bytes(), nil
+	case map[string]interface{}:
+		claims := make(map[string]interface{}, len(p)+2)
+		for k, v := range p {
+			claims[k] = v
+		}
+		now := time.Now()
+		for option, claim := range map[string]string{"expiresIn": "exp", "notBefore": "nbf"} {
+			if _, ok := opts[option]; !ok {
+				continue
+			}
+			seconds, err := optNumber(opts, option)
+			if err != nil {
+				return nil, err
+			}
+			claims[claim] = now.Add(time.Duration(seconds * float64(time.Second))).Unix()
+		}
+		return json.Marshal(claims)
+	default:
+		return json.Marshal(p)
+	}
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	return b, nil
+}
+
+func encodeHeader(header map[string]interface{}) (string, error) {
+	b, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	return encodeSegment(b), nil
+}
+
+func decodeHeader(s string) (map[string]interface{}, error) {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	var header map[string]interface{}
+	if err = json.Unmarshal(b, &header); err != nil || header == nil {
+		return nil, fmt.Errorf("%w: the header isn't a JSON object", ErrMalformedToken)
+	}
+	return header, nil
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func exportOptions(options goja.Value) (map[string]interface{}, error) {
+	if options == nil || goja.IsUndefined(options) || goja.IsNull(options) {
+		return map[string]interface{}{}, nil
+	}
+	opts, ok := options.Export().(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the options must be an object")
+	}
+	return opts, nil
+}
+
+func optString(opts map[string]interface{}, name string) (string, error) {
+	switch v := opts[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("the %s option must be a string", name)
+	}
+}
+
+// optStrings returns an option that can be either a string or an array of
+// strings.
+func optStrings(opts map[string]interface{}, name string) ([]string, error) {
+	switch v := opts[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, s := range v {
+			var ok bool
+			if values[i], ok = s.(string); !ok {
+				return nil, fmt.Errorf("the %s option must be an array of strings", name)
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("the %s option must be a string or an array of strings", name)
+	}
+}
+
+func optNumber(opts map[string]interface{}, name string) (float64, error) {
+	switch v := opts[name].(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("the %s option must be a number", name)
+	}
+}
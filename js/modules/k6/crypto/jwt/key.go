@@ -0,0 +1,189 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/modules/k6/crypto"
+	"go.k6.io/k6/js/modules/k6/crypto/x509"
+)
+
+// The types of Key.
+const (
+	keyTypeSecret  = "secret"
+	keyTypePublic  = "public"
+	keyTypePrivate = "private"
+	keyTypeSet     = "set"
+)
+
+// Key is a key for signing, verifying, encrypting or decrypting tokens. It
+// can also be a JWK set, in which case the key is picked by the kid header of
+// the token.
+type Key struct {
+	Type string `js:"type"`
+	// Kty is the JWK key type of the key: oct, RSA, EC or OKP.
+	Kty string `js:"kty"`
+	ID  string `js:"kid"`
+
+	// handle is a []byte for secret keys, otherwise one of *rsa.PrivateKey,
+	// *rsa.PublicKey, *ecdsa.PrivateKey, *ecdsa.PublicKey, ed25519.PrivateKey
+	// or ed25519.PublicKey.
+	handle interface{}
+	set    []*Key
+}
+
+func newKey(handle interface{}, kid string) (*Key, error) {
+	k := &Key{ID: kid, handle: handle}
+	switch key := handle.(type) {
+	case []byte:
+		k.Type, k.Kty = keyTypeSecret, "oct"
+	case *rsa.PrivateKey:
+		k.Type, k.Kty = keyTypePrivate, "RSA"
+	case *rsa.PublicKey:
+		k.Type, k.Kty = keyTypePublic, "RSA"
+	case *ecdsa.PrivateKey:
+		k.Type, k.Kty = keyTypePrivate, "EC"
+	case *ecdsa.PublicKey:
+		k.Type, k.Kty = keyTypePublic, "EC"
+	case ed25519.PrivateKey:
+		k.Type, k.Kty = keyTypePrivate, "OKP"
+	case ed25519.PublicKey:
+		k.Type, k.Kty = keyTypePublic, "OKP"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return k, nil
+}
+
+// toKey accepts a Key, a PEM encoded key or certificate, a JWK or JWK set
+// object, or the secret as a string or an ArrayBuffer.
+func toKey(v goja.Value) (*Key, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, errors.New("a key is required")
+	}
+	switch data := v.Export().(type) {
+	case *Key:
+		return data, nil
+	case string:
+		if strings.Contains(data, "-----BEGIN ") {
+			key, err := x509.ParsePEMKey([]byte(data))
+			if err != nil {
+				return nil, err
+			}
+			return newKey(key, "")
+		}
+		return newKey([]byte(data), "")
+	case goja.ArrayBuffer:
+		return newKey(append([]byte{}, data.Bytes()...), "")
+	case map[string]interface{}:
+		return parseJWK(data)
+	default:
+		return nil, fmt.Errorf("invalid key type %T, expected a string, an ArrayBuffer or a JWK object", data)
+	}
+}
+
+func parseJWK(jwk map[string]interface{}) (*Key, error) {
+	if keys, ok := jwk["keys"].([]interface{}); ok {
+		set := &Key{Type: keyTypeSet, set: make([]*Key, 0, len(keys))}
+		for i, k := range keys {
+			m, ok := k.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the key %d of the JWK set isn't an object", i)
+			}
+			key, err := parseJWK(m)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %d of the JWK set: %w", i, err)
+			}
+			set.set = append(set.set, key)
+		}
+		return set, nil
+	}
+
+	handle, err := crypto.ParseJWK(jwk)
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := jwk["kid"].(string)
+	return newKey(handle, kid)
+}
+
+// forKID returns the key of a JWK set with the given key ID, or the key
+// itself if it isn't a set.
+func (k *Key) forKID(kid string) (*Key, error) {
+	if k.Type != keyTypeSet {
+		return k, nil
+	}
+	for _, key := range k.set {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	if kid == "" && len(k.set) == 1 {
+		return k.set[0], nil
+	}
+	return nil, fmt.Errorf("no key with the ID %q in the JWK set", kid)
+}
+
+// public returns the public key of asymmetric keys.
+func (k *Key) public() interface{} {
+	switch key := k.handle.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	case ed25519.PrivateKey:
+		return key.Public()
+	default:
+		return k.handle
+	}
+}
+
+// defaultSigningAlgorithm returns the JWS algorithm that is used with the key
+// when none is specified.
+func (k *Key) defaultSigningAlgorithm() (string, error) {
+	switch key := k.handle.(type) {
+	case []byte:
+		return "HS256", nil
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+	case ed25519.PrivateKey:
+		return "EdDSA", nil
+	}
+	return "", fmt.Errorf("a %s %s key can't be used for signing", k.Kty, k.Type)
+}
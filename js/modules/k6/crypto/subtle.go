@@ -0,0 +1,270 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/modules"
+)
+
+// maxRandomValuesLength is the biggest number of bytes that getRandomValues()
+// will fill at once, same as in browsers.
+const maxRandomValuesLength = 65536
+
+// SubtleCrypto is the crypto.subtle object of the WebCrypto API. All of its
+// methods return a Promise, the actual cryptographic work is done outside of
+// the VU goroutine and the result is delivered through the event loop.
+type SubtleCrypto struct {
+	vu modules.VU
+}
+
+// Error is the error with which the promises returned by SubtleCrypto are
+// rejected. Name is the DOMException name that browsers would use for it.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Name + ": " + e.Message
+}
+
+// The DOMException names used by the WebCrypto API.
+const (
+	notSupportedError  = "NotSupportedError"
+	syntaxError        = "SyntaxError"
+	invalidAccessError = "InvalidAccessError"
+	dataError          = "DataError"
+	operationError     = "OperationError"
+	typeError          = "TypeError"
+	typeMismatchError  = "TypeMismatchError"
+	quotaExceededError = "QuotaExceededError"
+)
+
+func newError(name, format string, args ...interface{}) *Error {
+	return &Error{Name: name, Message: fmt.Sprintf(format, args...)}
+}
+
+// job is the part of a SubtleCrypto call that runs outside of the VU
+// goroutine. It must not touch the goja runtime.
+type job func() (interface{}, error)
+
+// promise returns a Promise that is settled with the result of the job
+// returned by prepare. prepare itself is called on the VU goroutine, so it
+// is where all of the arguments need to be converted from JS values.
+func (s *SubtleCrypto) promise(prepare func() (job, error)) *goja.Promise {
+	rt := s.vu.Runtime()
+	p, resolve, reject := rt.NewPromise()
+	settle := func(result interface{}, err error) {
+		if err != nil {
+			reject(s.toJSError(err))
+			return
+		}
+		resolve(s.toJSValue(result))
+	}
+
+	work, err := prepare()
+	if err != nil {
+		settle(nil, err)
+		return p
+	}
+
+	if s.vu.State() == nil {
+		// there is no event loop in the init context, so the job is done
+		// right away instead of in the background
+		settle(work())
+		return p
+	}
+
+	callback := s.vu.RegisterCallback()
+	go func() {
+		result, err := work()
+		callback(func() error {
+			settle(result, err)
+			return nil
+		})
+	}()
+	return p
+}
+
+func (s *SubtleCrypto) toJSValue(v interface{}) interface{} {
+	rt := s.vu.Runtime()
+	switch v := v.(type) {
+	case []byte:
+		return rt.NewArrayBuffer(v)
+	case map[string]interface{}:
+		return rt.ToValue(v)
+	default:
+		return v
+	}
+}
+
+func (s *SubtleCrypto) toJSError(err error) *goja.Object {
+	rt := s.vu.Runtime()
+	var e *Error
+	if !errors.As(err, &e) {
+		e = newError(operationError, "%s", err)
+	}
+	obj := rt.NewGoError(e)
+	_ = obj.Set("name", e.Name)
+	_ = obj.Set("message", e.Message)
+	return obj
+}
+
+// Encrypt encrypts data with the given key and algorithm.
+func (s *SubtleCrypto) Encrypt(algorithm, key, data goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareCipher("encrypt", algorithm, key, data)
+	})
+}
+
+// Decrypt decrypts data with the given key and algorithm.
+func (s *SubtleCrypto) Decrypt(algorithm, key, data goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareCipher("decrypt", algorithm, key, data)
+	})
+}
+
+// Sign returns the signature of data, made with the given key and algorithm.
+func (s *SubtleCrypto) Sign(algorithm, key, data goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareSignature("sign", algorithm, key, goja.Undefined(), data)
+	})
+}
+
+// Verify resolves to whether signature is a valid signature of data for the
+// given key and algorithm.
+func (s *SubtleCrypto) Verify(algorithm, key, signature, data goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareSignature("verify", algorithm, key, signature, data)
+	})
+}
+
+// Digest returns the hash of data with the given hash algorithm.
+func (s *SubtleCrypto) Digest(algorithm, data goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		alg, err := s.normalizeAlgorithm(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		h, err := hashByName(alg.Name)
+		if err != nil {
+			return nil, err
+		}
+		d, err := bufferSource(data)
+		if err != nil {
+			return nil, err
+		}
+		return func() (interface{}, error) {
+			hasher := h.New()
+			_, _ = hasher.Write(d)
+			return hasher.Sum(nil), nil
+		}, nil
+	})
+}
+
+// GenerateKey generates a new key, or a key pair for the asymmetric
+// algorithms.
+func (s *SubtleCrypto) GenerateKey(algorithm goja.Value, extractable bool, keyUsages goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareGenerateKey(algorithm, extractable, keyUsages)
+	})
+}
+
+// ImportKey imports a key in the raw, pkcs8, spki or jwk format.
+func (s *SubtleCrypto) ImportKey(
+	format string, keyData, algorithm goja.Value, extractable bool, keyUsages goja.Value,
+) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareImportKey(format, keyData, algorithm, extractable, keyUsages)
+	})
+}
+
+// ExportKey exports an extractable key in the raw, pkcs8, spki or jwk
+// format.
+func (s *SubtleCrypto) ExportKey(format string, key goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		k, err := toCryptoKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return func() (interface{}, error) {
+			return exportKey(format, k)
+		}, nil
+	})
+}
+
+// DeriveBits derives length bits from the base key with the given
+// algorithm.
+func (s *SubtleCrypto) DeriveBits(algorithm, baseKey, length goja.Value) *goja.Promise {
+	return s.promise(func() (job, error) {
+		bits, err := s.deriveLength(length)
+		if err != nil {
+			return nil, err
+		}
+		derive, err := s.prepareDerive("deriveBits", algorithm, baseKey, bits)
+		if err != nil {
+			return nil, err
+		}
+		return func() (interface{}, error) {
+			return derive()
+		}, nil
+	})
+}
+
+// DeriveKey derives a new key for derivedKeyAlgorithm from the base key with
+// the given algorithm.
+func (s *SubtleCrypto) DeriveKey(
+	algorithm, baseKey, derivedKeyAlgorithm goja.Value, extractable bool, keyUsages goja.Value,
+) *goja.Promise {
+	return s.promise(func() (job, error) {
+		return s.prepareDeriveKey(algorithm, baseKey, derivedKeyAlgorithm, extractable, keyUsages)
+	})
+}
+
+// getRandomValues fills the given integer typed array with random values
+// and returns it.
+func (c *Crypto) getRandomValues(array goja.Value) (goja.Value, error) {
+	rt := c.vu.Runtime()
+	obj, ok := array.(*goja.Object)
+	if !ok || !isTypedArray(obj) {
+		return nil, newError(typeError, "getRandomValues() expects an integer typed array")
+	}
+	if name := obj.Get("constructor").ToObject(rt).Get("name").String(); name == "Float32Array" ||
+		name == "Float64Array" {
+		return nil, newError(typeMismatchError, "getRandomValues() can't be used with a %s", name)
+	}
+
+	b := typedArrayBytes(obj)
+	if len(b) > maxRandomValuesLength {
+		return nil, newError(quotaExceededError,
+			"getRandomValues() can fill at most %d bytes, got %d", maxRandomValuesLength, len(b))
+	}
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -0,0 +1,262 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	gocrypto "crypto"
+	"math"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// The names of the algorithms supported by SubtleCrypto, as they are
+// written in the WebCrypto specification.
+const (
+	algAESGCM         = "AES-GCM"
+	algAESCBC         = "AES-CBC"
+	algAESCTR         = "AES-CTR"
+	algHMAC           = "HMAC"
+	algRSAOAEP        = "RSA-OAEP"
+	algRSAPSS         = "RSA-PSS"
+	algRSASSAPKCS1v15 = "RSASSA-PKCS1-v1_5"
+	algECDSA          = "ECDSA"
+	algECDH           = "ECDH"
+	algEd25519        = "Ed25519"
+	algPBKDF2         = "PBKDF2"
+	algHKDF           = "HKDF"
+	algSHA1           = "SHA-1"
+	algSHA256         = "SHA-256"
+	algSHA384         = "SHA-384"
+	algSHA512         = "SHA-512"
+	curveP256         = "P-256"
+	curveP384         = "P-384"
+	curveP521         = "P-521"
+)
+
+//nolint:gochecknoglobals
+var algorithmNames = []string{
+	algAESGCM, algAESCBC, algAESCTR, algHMAC, algRSAOAEP, algRSAPSS, algRSASSAPKCS1v15,
+	algECDSA, algECDH, algEd25519, algPBKDF2, algHKDF, algSHA1, algSHA256, algSHA384, algSHA512,
+}
+
+// algorithm is a normalized WebCrypto algorithm identifier. Its parameters
+// are read lazily from the JS object it was given as, so it must only be
+// used on the VU goroutine.
+type algorithm struct {
+	Name string
+
+	rt     *goja.Runtime
+	params *goja.Object
+}
+
+func (s *SubtleCrypto) normalizeAlgorithm(v goja.Value) (*algorithm, error) {
+	return normalizeAlgorithm(s.vu.Runtime(), v)
+}
+
+// normalizeAlgorithm accepts an algorithm identifier either as a string or
+// as an object with a name property, and matches the name case-insensitively
+// against the supported algorithms.
+func normalizeAlgorithm(rt *goja.Runtime, v goja.Value) (*algorithm, error) {
+	if isNullish(v) {
+		return nil, newError(typeError, "an algorithm is required")
+	}
+	alg := &algorithm{rt: rt}
+	name := v.String()
+	if obj, ok := v.(*goja.Object); ok {
+		nameValue := obj.Get("name")
+		if isNullish(nameValue) {
+			return nil, newError(typeError, "the algorithm name is required")
+		}
+		name = nameValue.String()
+		alg.params = obj
+	}
+
+	for _, n := range algorithmNames {
+		if strings.EqualFold(n, name) {
+			alg.Name = n
+			return alg, nil
+		}
+	}
+	return nil, newError(notSupportedError, "unsupported algorithm %q", name)
+}
+
+func (a *algorithm) get(name string) goja.Value {
+	if a.params == nil {
+		return goja.Undefined()
+	}
+	v := a.params.Get(name)
+	if v == nil {
+		return goja.Undefined()
+	}
+	return v
+}
+
+// has reports whether the parameter with the given name was set.
+func (a *algorithm) has(name string) bool {
+	return !isNullish(a.get(name))
+}
+
+// bytes returns a copy of the BufferSource parameter with the given name.
+func (a *algorithm) bytes(name string) ([]byte, error) {
+	v := a.get(name)
+	if isNullish(v) {
+		return nil, newError(typeError, "%s requires the %s parameter", a.Name, name)
+	}
+	b, err := bufferSource(v)
+	if err != nil {
+		return nil, newError(typeError, "%s: invalid %s parameter: %s", a.Name, name, err)
+	}
+	return b, nil
+}
+
+// optionalBytes is like bytes, but returns nil if the parameter isn't set.
+func (a *algorithm) optionalBytes(name string) ([]byte, error) {
+	if !a.has(name) {
+		return nil, nil
+	}
+	return a.bytes(name)
+}
+
+// integer returns the non-negative integer parameter with the given name.
+func (a *algorithm) integer(name string) (int, error) {
+	v := a.get(name)
+	if isNullish(v) {
+		return 0, newError(typeError, "%s requires the %s parameter", a.Name, name)
+	}
+	f := v.ToFloat()
+	if math.IsNaN(f) || f < 0 || f > math.MaxInt32 || f != math.Trunc(f) {
+		return 0, newError(typeError, "%s: invalid %s parameter %s", a.Name, name, v)
+	}
+	return int(f), nil
+}
+
+// str returns the string parameter with the given name.
+func (a *algorithm) str(name string) (string, error) {
+	v := a.get(name)
+	if isNullish(v) {
+		return "", newError(typeError, "%s requires the %s parameter", a.Name, name)
+	}
+	return v.String(), nil
+}
+
+// hash returns the hash function that is given as the hash parameter.
+func (a *algorithm) hash() (gocrypto.Hash, error) {
+	v := a.get("hash")
+	if isNullish(v) {
+		return 0, newError(typeError, "%s requires the hash parameter", a.Name)
+	}
+	hashAlg, err := normalizeAlgorithm(a.rt, v)
+	if err != nil {
+		return 0, err
+	}
+	return hashByName(hashAlg.Name)
+}
+
+// key returns the CryptoKey parameter with the given name.
+func (a *algorithm) key(name string) (*CryptoKey, error) {
+	v := a.get(name)
+	if isNullish(v) {
+		return nil, newError(typeError, "%s requires the %s parameter", a.Name, name)
+	}
+	return toCryptoKey(v)
+}
+
+func hashByName(name string) (gocrypto.Hash, error) {
+	switch name {
+	case algSHA1:
+		return gocrypto.SHA1, nil
+	case algSHA256:
+		return gocrypto.SHA256, nil
+	case algSHA384:
+		return gocrypto.SHA384, nil
+	case algSHA512:
+		return gocrypto.SHA512, nil
+	default:
+		return 0, newError(notSupportedError, "%s isn't a supported hash algorithm", name)
+	}
+}
+
+func hashName(h gocrypto.Hash) string {
+	switch h { //nolint:exhaustive
+	case gocrypto.SHA1:
+		return algSHA1
+	case gocrypto.SHA256:
+		return algSHA256
+	case gocrypto.SHA384:
+		return algSHA384
+	case gocrypto.SHA512:
+		return algSHA512
+	default:
+		return ""
+	}
+}
+
+func isNullish(v goja.Value) bool {
+	return v == nil || goja.IsUndefined(v) || goja.IsNull(v)
+}
+
+// bufferSource returns a copy of the bytes of an ArrayBuffer, a typed array
+// or a DataView. Strings are accepted as well and are used as UTF-8.
+func bufferSource(v goja.Value) ([]byte, error) {
+	if isNullish(v) {
+		return nil, newError(typeError, "expected an ArrayBuffer, a typed array or a DataView")
+	}
+	var b []byte
+	switch exported := v.Export().(type) {
+	case goja.ArrayBuffer:
+		b = exported.Bytes()
+	case string:
+		return []byte(exported), nil
+	default:
+		obj, ok := v.(*goja.Object)
+		if !ok || !isArrayBufferView(obj) {
+			return nil, newError(typeError,
+				"expected an ArrayBuffer, a typed array or a DataView, got %T", exported)
+		}
+		b = typedArrayBytes(obj)
+	}
+	return append([]byte{}, b...), nil
+}
+
+func isArrayBufferView(obj *goja.Object) bool {
+	buffer := obj.Get("buffer")
+	if buffer == nil {
+		return false
+	}
+	_, ok := buffer.Export().(goja.ArrayBuffer)
+	return ok
+}
+
+// isTypedArray reports whether obj is a typed array, i.e. an ArrayBuffer view
+// that isn't a DataView.
+func isTypedArray(obj *goja.Object) bool {
+	return isArrayBufferView(obj) && obj.Get("BYTES_PER_ELEMENT") != nil
+}
+
+// typedArrayBytes returns the part of the underlying ArrayBuffer that an
+// ArrayBuffer view covers, without copying it.
+func typedArrayBytes(obj *goja.Object) []byte {
+	buffer, _ := obj.Get("buffer").Export().(goja.ArrayBuffer)
+	offset := obj.Get("byteOffset").ToInteger()
+	length := obj.Get("byteLength").ToInteger()
+	return buffer.Bytes()[offset : offset+length]
+}
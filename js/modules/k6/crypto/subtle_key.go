@@ -0,0 +1,938 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// The types of CryptoKey.
+const (
+	keyTypeSecret  = "secret"
+	keyTypePublic  = "public"
+	keyTypePrivate = "private"
+)
+
+// The formats that keys can be imported from and exported to.
+const (
+	formatRaw   = "raw"
+	formatPKCS8 = "pkcs8"
+	formatSPKI  = "spki"
+	formatJWK   = "jwk"
+)
+
+const rsaPublicExponent = 65537
+
+// CryptoKey is a key that can be used with the SubtleCrypto methods. The key
+// material itself isn't accessible from JS, it can only be retrieved with
+// exportKey() when the key is extractable.
+type CryptoKey struct {
+	Type        string                 `js:"type"`
+	Extractable bool                   `js:"extractable"`
+	Algorithm   map[string]interface{} `js:"algorithm"`
+	Usages      []string               `js:"usages"`
+
+	alg keyAlgorithm
+	// handle is a []byte for secret keys, otherwise one of *rsa.PrivateKey,
+	// *rsa.PublicKey, *ecdsa.PrivateKey, *ecdsa.PublicKey, ed25519.PrivateKey
+	// or ed25519.PublicKey.
+	handle interface{}
+}
+
+// CryptoKeyPair is what generateKey() returns for asymmetric algorithms.
+type CryptoKeyPair struct {
+	PublicKey  *CryptoKey `js:"publicKey"`
+	PrivateKey *CryptoKey `js:"privateKey"`
+}
+
+// keyAlgorithm describes what a key can be used for.
+type keyAlgorithm struct {
+	name       string
+	hash       gocrypto.Hash // HMAC and RSA keys
+	length     int           // AES and HMAC keys, in bits
+	namedCurve string        // ECDSA and ECDH keys
+}
+
+func newCryptoKey(alg keyAlgorithm, extractable bool, usages []string, handle interface{}) *CryptoKey {
+	keyType := keyTypeOf(handle)
+	if keyType == keyTypePublic {
+		extractable = true
+	}
+
+	algMap := map[string]interface{}{"name": alg.name}
+	if alg.hash != 0 {
+		algMap["hash"] = map[string]interface{}{"name": hashName(alg.hash)}
+	}
+	if alg.length != 0 {
+		algMap["length"] = alg.length
+	}
+	if alg.namedCurve != "" {
+		algMap["namedCurve"] = alg.namedCurve
+	}
+	var rsaKey *rsa.PublicKey
+	switch k := handle.(type) {
+	case *rsa.PrivateKey:
+		rsaKey = &k.PublicKey
+	case *rsa.PublicKey:
+		rsaKey = k
+	}
+	if rsaKey != nil {
+		algMap["modulusLength"] = rsaKey.N.BitLen()
+		algMap["publicExponent"] = big.NewInt(int64(rsaKey.E)).Bytes()
+	}
+
+	return &CryptoKey{
+		Type:        keyType,
+		Extractable: extractable,
+		Algorithm:   algMap,
+		Usages:      usages,
+		alg:         alg,
+		handle:      handle,
+	}
+}
+
+func newCryptoKeyPair(
+	alg keyAlgorithm, extractable bool, usages []string, public, private interface{},
+) *CryptoKeyPair {
+	return &CryptoKeyPair{
+		PublicKey: newCryptoKey(alg, true,
+			filterUsages(usages, supportedUsages(alg.name, keyTypePublic)), public),
+		PrivateKey: newCryptoKey(alg, extractable,
+			filterUsages(usages, supportedUsages(alg.name, keyTypePrivate)), private),
+	}
+}
+
+func keyTypeOf(handle interface{}) string {
+	switch handle.(type) {
+	case []byte:
+		return keyTypeSecret
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return keyTypePublic
+	default:
+		return keyTypePrivate
+	}
+}
+
+// toCryptoKey returns the CryptoKey that v wraps.
+func toCryptoKey(v goja.Value) (*CryptoKey, error) {
+	if !isNullish(v) {
+		if k, ok := v.Export().(*CryptoKey); ok {
+			return k, nil
+		}
+	}
+	return nil, newError(typeError, "expected a CryptoKey, got %s", v)
+}
+
+// checkKey makes sure that the key was made for the given algorithm and can
+// be used for the operation.
+func checkKey(k *CryptoKey, algorithm, usage string) error {
+	if k.alg.name != algorithm {
+		return newError(invalidAccessError, "the key is for %s, not %s", k.alg.name, algorithm)
+	}
+	for _, u := range k.Usages {
+		if u == usage {
+			return nil
+		}
+	}
+	return newError(invalidAccessError, "the key can't be used to %s", usage)
+}
+
+// supportedUsages returns the usages that keys of the given algorithm and
+// type can have.
+func supportedUsages(algorithm, keyType string) []string {
+	switch algorithm {
+	case algAESGCM, algAESCBC, algAESCTR:
+		return []string{"encrypt", "decrypt"}
+	case algHMAC:
+		return []string{"sign", "verify"}
+	case algPBKDF2, algHKDF:
+		return []string{"deriveKey", "deriveBits"}
+	case algRSAOAEP:
+		if keyType == keyTypePublic {
+			return []string{"encrypt"}
+		}
+		return []string{"decrypt"}
+	case algRSAPSS, algRSASSAPKCS1v15, algECDSA, algEd25519:
+		if keyType == keyTypePublic {
+			return []string{"verify"}
+		}
+		return []string{"sign"}
+	case algECDH:
+		if keyType == keyTypePublic {
+			return nil
+		}
+		return []string{"deriveKey", "deriveBits"}
+	default:
+		return nil
+	}
+}
+
+// checkUsages makes sure that all of the usages are supported by at least one
+// of the given key types, and that a key that must have usages has some.
+func checkUsages(algorithm string, usages []string, keyTypes ...string) error {
+	for _, u := range usages {
+		supported := false
+		for _, keyType := range keyTypes {
+			for _, s := range supportedUsages(algorithm, keyType) {
+				supported = supported || s == u
+			}
+		}
+		if !supported {
+			return newError(syntaxError, "%s keys can't be used to %s", algorithm, u)
+		}
+	}
+	for _, keyType := range keyTypes {
+		if keyType != keyTypePublic && len(filterUsages(usages, supportedUsages(algorithm, keyType))) == 0 {
+			return newError(syntaxError, "%s keys need at least one usage", keyType)
+		}
+	}
+	return nil
+}
+
+func filterUsages(usages, supported []string) []string {
+	filtered := make([]string, 0, len(usages))
+	for _, u := range usages {
+		for _, s := range supported {
+			if u == s {
+				filtered = append(filtered, u)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func (s *SubtleCrypto) keyUsages(v goja.Value) ([]string, error) {
+	var usages []string
+	if isNullish(v) {
+		return nil, newError(typeError, "the key usages are required")
+	}
+	if err := s.vu.Runtime().ExportTo(v, &usages); err != nil {
+		return nil, newError(typeError, "the key usages must be an array of strings")
+	}
+	return usages, nil
+}
+
+func curveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case curveP256:
+		return elliptic.P256(), nil
+	case curveP384:
+		return elliptic.P384(), nil
+	case curveP521:
+		return elliptic.P521(), nil
+	default:
+		return nil, newError(notSupportedError, "unsupported named curve %q", name)
+	}
+}
+
+func curveByteSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+func (s *SubtleCrypto) prepareGenerateKey(algorithm goja.Value, extractable bool, keyUsages goja.Value) (job, error) {
+	alg, err := s.normalizeAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	usages, err := s.keyUsages(keyUsages)
+	if err != nil {
+		return nil, err
+	}
+	ka := keyAlgorithm{name: alg.Name}
+
+	switch alg.Name {
+	case algAESGCM, algAESCBC, algAESCTR:
+		if ka.length, err = alg.integer("length"); err != nil {
+			return nil, err
+		}
+		if ka.length != 128 && ka.length != 192 && ka.length != 256 {
+			return nil, newError(operationError, "the AES key length must be 128, 192 or 256 bits")
+		}
+		return generateSecretKey(ka, extractable, usages)
+
+	case algHMAC:
+		if ka.hash, err = alg.hash(); err != nil {
+			return nil, err
+		}
+		ka.length = ka.hash.New().BlockSize() * 8
+		if alg.has("length") {
+			if ka.length, err = alg.integer("length"); err != nil {
+				return nil, err
+			}
+		}
+		if ka.length == 0 || ka.length%8 != 0 {
+			return nil, newError(operationError, "the HMAC key length must be a non-zero multiple of 8 bits")
+		}
+		return generateSecretKey(ka, extractable, usages)
+
+	case algRSAOAEP, algRSAPSS, algRSASSAPKCS1v15:
+		return prepareGenerateRSAKey(alg, ka, extractable, usages)
+
+	case algECDSA, algECDH:
+		if ka.namedCurve, err = alg.str("namedCurve"); err != nil {
+			return nil, err
+		}
+		curve, err := curveByName(ka.namedCurve)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkUsages(alg.Name, usages, keyTypePublic, keyTypePrivate); err != nil {
+			return nil, err
+		}
+		return func() (interface{}, error) {
+			private, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			return newCryptoKeyPair(ka, extractable, usages, &private.PublicKey, private), nil
+		}, nil
+
+	case algEd25519:
+		if err = checkUsages(alg.Name, usages, keyTypePublic, keyTypePrivate); err != nil {
+			return nil, err
+		}
+		return func() (interface{}, error) {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			return newCryptoKeyPair(ka, extractable, usages, public, private), nil
+		}, nil
+
+	default:
+		return nil, newError(notSupportedError, "%s keys can't be generated", alg.Name)
+	}
+}
+
+func generateSecretKey(ka keyAlgorithm, extractable bool, usages []string) (job, error) {
+	if err := checkUsages(ka.name, usages, keyTypeSecret); err != nil {
+		return nil, err
+	}
+	return func() (interface{}, error) {
+		key := make([]byte, ka.length/8)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return newCryptoKey(ka, extractable, usages, key), nil
+	}, nil
+}
+
+func prepareGenerateRSAKey(alg *algorithm, ka keyAlgorithm, extractable bool, usages []string) (job, error) {
+	var err error
+	if ka.hash, err = alg.hash(); err != nil {
+		return nil, err
+	}
+	modulusLength, err := alg.integer("modulusLength")
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := alg.bytes("publicExponent")
+	if err != nil {
+		return nil, err
+	}
+	if e := new(big.Int).SetBytes(exponent); !e.IsInt64() || e.Int64() != rsaPublicExponent {
+		return nil, newError(notSupportedError, "only the %d RSA public exponent is supported", rsaPublicExponent)
+	}
+	if err = checkUsages(alg.Name, usages, keyTypePublic, keyTypePrivate); err != nil {
+		return nil, err
+	}
+	return func() (interface{}, error) {
+		private, err := rsa.GenerateKey(rand.Reader, modulusLength)
+		if err != nil {
+			return nil, newError(operationError, "%s", err)
+		}
+		return newCryptoKeyPair(ka, extractable, usages, &private.PublicKey, private), nil
+	}, nil
+}
+
+// keyImport is everything that is needed to import a key, already converted
+// from JS values so that it can be done outside of the VU goroutine.
+type keyImport struct {
+	format      string
+	raw         []byte
+	jwk         map[string]interface{}
+	alg         keyAlgorithm
+	extractable bool
+	usages      []string
+}
+
+func (s *SubtleCrypto) prepareImportKey(
+	format string, keyData, algorithm goja.Value, extractable bool, keyUsages goja.Value,
+) (job, error) {
+	alg, err := s.normalizeAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	ki := &keyImport{format: format, extractable: extractable, alg: keyAlgorithm{name: alg.Name}}
+	if ki.usages, err = s.keyUsages(keyUsages); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case formatJWK:
+		obj, ok := keyData.(*goja.Object)
+		if !ok {
+			return nil, newError(typeError, "a JSON Web Key must be an object")
+		}
+		if ki.jwk, ok = obj.Export().(map[string]interface{}); !ok {
+			return nil, newError(typeError, "a JSON Web Key must be an object")
+		}
+	case formatRaw, formatPKCS8, formatSPKI:
+		if ki.raw, err = bufferSource(keyData); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, newError(notSupportedError, "unsupported key format %q", format)
+	}
+
+	switch alg.Name {
+	case algHMAC:
+		if ki.alg.hash, err = alg.hash(); err != nil {
+			return nil, err
+		}
+		if alg.has("length") {
+			if ki.alg.length, err = alg.integer("length"); err != nil {
+				return nil, err
+			}
+		}
+	case algRSAOAEP, algRSAPSS, algRSASSAPKCS1v15:
+		if ki.alg.hash, err = alg.hash(); err != nil {
+			return nil, err
+		}
+	case algECDSA, algECDH:
+		if ki.alg.namedCurve, err = alg.str("namedCurve"); err != nil {
+			return nil, err
+		}
+		if _, err = curveByName(ki.alg.namedCurve); err != nil {
+			return nil, err
+		}
+	case algSHA1, algSHA256, algSHA384, algSHA512:
+		return nil, newError(notSupportedError, "%s keys can't be imported", alg.Name)
+	}
+
+	return func() (interface{}, error) {
+		return ki.run()
+	}, nil
+}
+
+func (ki *keyImport) run() (*CryptoKey, error) {
+	var (
+		handle interface{}
+		err    error
+	)
+	switch ki.alg.name {
+	case algAESGCM, algAESCBC, algAESCTR, algHMAC, algPBKDF2, algHKDF:
+		handle, err = ki.secret()
+	case algRSAOAEP, algRSAPSS, algRSASSAPKCS1v15:
+		handle, err = ki.rsa()
+	case algECDSA, algECDH:
+		handle, err = ki.ec()
+	case algEd25519:
+		handle, err = ki.ed25519()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyType := keyTypeOf(handle)
+	if err = checkUsages(ki.alg.name, ki.usages, keyType); err != nil {
+		return nil, err
+	}
+	return newCryptoKey(ki.alg, ki.extractable, ki.usages, handle), nil
+}
+
+func (ki *keyImport) secret() (interface{}, error) {
+	var key []byte
+	switch ki.format {
+	case formatRaw:
+		key = ki.raw
+	case formatJWK:
+		if ki.alg.name == algPBKDF2 || ki.alg.name == algHKDF {
+			return nil, newError(notSupportedError, "%s keys can only be imported in the raw format", ki.alg.name)
+		}
+		if err := ki.checkJWK("oct"); err != nil {
+			return nil, err
+		}
+		var err error
+		if key, err = jwkBytes(ki.jwk, "k"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, newError(notSupportedError, "%s keys can't be imported in the %s format", ki.alg.name, ki.format)
+	}
+
+	switch ki.alg.name {
+	case algPBKDF2, algHKDF:
+		if ki.extractable {
+			return nil, newError(syntaxError, "%s keys can't be extractable", ki.alg.name)
+		}
+	case algHMAC:
+		if len(key) == 0 || (ki.alg.length != 0 && ki.alg.length != len(key)*8) {
+			return nil, newError(dataError, "invalid HMAC key length")
+		}
+		ki.alg.length = len(key) * 8
+	default:
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return nil, newError(dataError, "the AES key length must be 128, 192 or 256 bits")
+		}
+		ki.alg.length = len(key) * 8
+	}
+
+	if ki.format == formatJWK {
+		if err := ki.checkJWKAlg(jwkAlg(ki.alg)); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+func (ki *keyImport) rsa() (interface{}, error) {
+	switch ki.format {
+	case formatPKCS8:
+		key, err := x509.ParsePKCS8PrivateKey(ki.raw)
+		if err != nil {
+			return nil, newError(dataError, "%s", err)
+		}
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, newError(dataError, "expected an RSA private key, got %T", key)
+	case formatSPKI:
+		key, err := x509.ParsePKIXPublicKey(ki.raw)
+		if err != nil {
+			return nil, newError(dataError, "%s", err)
+		}
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, newError(dataError, "expected an RSA public key, got %T", key)
+	case formatJWK:
+		if err := ki.checkJWK("RSA"); err != nil {
+			return nil, err
+		}
+		if err := ki.checkJWKAlg(jwkAlg(ki.alg)); err != nil {
+			return nil, err
+		}
+		return rsaKeyFromJWK(ki.jwk)
+	default:
+		return nil, newError(notSupportedError, "%s keys can't be imported in the %s format", ki.alg.name, ki.format)
+	}
+}
+
+func rsaKeyFromJWK(jwk map[string]interface{}) (interface{}, error) {
+	n, err := jwkBigInt(jwk, "n")
+	if err != nil {
+		return nil, err
+	}
+	e, err := jwkBigInt(jwk, "e")
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, newError(dataError, "invalid RSA public exponent")
+	}
+	public := rsa.PublicKey{N: n, E: int(e.Int64())}
+	if _, ok := jwk["d"]; !ok {
+		return &public, nil
+	}
+
+	d, err := jwkBigInt(jwk, "d")
+	if err != nil {
+		return nil, err
+	}
+	p, err := jwkBigInt(jwk, "p")
+	if err != nil {
+		return nil, err
+	}
+	q, err := jwkBigInt(jwk, "q")
+	if err != nil {
+		return nil, err
+	}
+	private := &rsa.PrivateKey{PublicKey: public, D: d, Primes: []*big.Int{p, q}}
+	if err = private.Validate(); err != nil {
+		return nil, newError(dataError, "invalid RSA private key: %s", err)
+	}
+	private.Precompute()
+	return private, nil
+}
+
+func (ki *keyImport) ec() (interface{}, error) {
+	curve, err := curveByName(ki.alg.namedCurve)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch ki.format {
+	case formatRaw:
+		x, y := elliptic.Unmarshal(curve, ki.raw) //nolint:staticcheck
+		if x == nil {
+			return nil, newError(dataError, "invalid %s public key", ki.alg.namedCurve)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case formatPKCS8:
+		if key, err = x509.ParsePKCS8PrivateKey(ki.raw); err != nil {
+			return nil, newError(dataError, "%s", err)
+		}
+	case formatSPKI:
+		if key, err = x509.ParsePKIXPublicKey(ki.raw); err != nil {
+			return nil, newError(dataError, "%s", err)
+		}
+	case formatJWK:
+		if key, err = ki.ecKeyFromJWK(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, newError(notSupportedError, "%s keys can't be imported in the %s format", ki.alg.name, ki.format)
+	}
+
+	var keyCurve elliptic.Curve
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		keyCurve = k.Curve
+	case *ecdsa.PublicKey:
+		keyCurve = k.Curve
+	default:
+		return nil, newError(dataError, "expected an elliptic curve key, got %T", key)
+	}
+	if keyCurve != curve {
+		return nil, newError(dataError, "the key isn't on the %s curve", ki.alg.namedCurve)
+	}
+	return key, nil
+}
+
+func (ki *keyImport) ecKeyFromJWK() (interface{}, error) {
+	if err := ki.checkJWK("EC"); err != nil {
+		return nil, err
+	}
+	if crv, _ := ki.jwk["crv"].(string); crv != ki.alg.namedCurve {
+		return nil, newError(dataError, "expected a %s key, got %q", ki.alg.namedCurve, crv)
+	}
+	if ki.alg.name == algECDSA {
+		if err := ki.checkJWKAlg(jwkAlg(ki.alg)); err != nil {
+			return nil, err
+		}
+	}
+	return ecKeyFromJWK(ki.jwk)
+}
+
+func ecKeyFromJWK(jwk map[string]interface{}) (interface{}, error) {
+	namedCurve, _ := jwk["crv"].(string)
+	curve, err := curveByName(namedCurve)
+	if err != nil {
+		return nil, err
+	}
+	size := curveByteSize(curve)
+	coordinates := make([]*big.Int, 2)
+	for i, name := range []string{"x", "y"} {
+		b, err := jwkBytes(jwk, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != size {
+			return nil, newError(dataError, "invalid length of the %s coordinate", name)
+		}
+		coordinates[i] = new(big.Int).SetBytes(b)
+	}
+	public := ecdsa.PublicKey{Curve: curve, X: coordinates[0], Y: coordinates[1]}
+	if !curve.IsOnCurve(public.X, public.Y) {
+		return nil, newError(dataError, "the point isn't on the %s curve", namedCurve)
+	}
+	if _, ok := jwk["d"]; !ok {
+		return &public, nil
+	}
+
+	d, err := jwkBigInt(jwk, "d")
+	if err != nil {
+		return nil, err
+	}
+	if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, newError(dataError, "invalid %s private key", namedCurve)
+	}
+	return &ecdsa.PrivateKey{PublicKey: public, D: d}, nil
+}
+
+func (ki *keyImport) ed25519() (interface{}, error) {
+	switch ki.format {
+	case formatRaw:
+		if len(ki.raw) != ed25519.PublicKeySize {
+			return nil, newError(dataError, "invalid Ed25519 public key length")
+		}
+		return ed25519.PublicKey(ki.raw), nil
+	case formatPKCS8:
+		key, err := x509.ParsePKCS8PrivateKey(ki.raw)
+		if err != nil {
+			return nil, newError(dataError, "%s", err)
+		}
+		if edKey, ok := key.(ed25519.PrivateKey); ok {
+			return edKey, nil
+		}
+		return nil, newError(dataError, "expected an Ed25519 private key, got %T", key)
+	case formatSPKI:
+		key, err := x509.ParsePKIXPublicKey(ki.raw)
+		if err != nil {
+			return nil, newError(dataError, "%s", err)
+		}
+		if edKey, ok := key.(ed25519.PublicKey); ok {
+			return edKey, nil
+		}
+		return nil, newError(dataError, "expected an Ed25519 public key, got %T", key)
+	case formatJWK:
+		if err := ki.checkJWK("OKP"); err != nil {
+			return nil, err
+		}
+		return ed25519KeyFromJWK(ki.jwk)
+	default:
+		return nil, newError(notSupportedError, "%s keys can't be imported in the %s format", ki.alg.name, ki.format)
+	}
+}
+
+func ed25519KeyFromJWK(jwk map[string]interface{}) (interface{}, error) {
+	if crv, _ := jwk["crv"].(string); crv != algEd25519 {
+		return nil, newError(dataError, "expected an Ed25519 key, got %q", crv)
+	}
+	x, err := jwkBytes(jwk, "x")
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, newError(dataError, "invalid Ed25519 public key length")
+	}
+	if _, ok := jwk["d"]; !ok {
+		return ed25519.PublicKey(x), nil
+	}
+
+	d, err := jwkBytes(jwk, "d")
+	if err != nil {
+		return nil, err
+	}
+	if len(d) != ed25519.SeedSize {
+		return nil, newError(dataError, "invalid Ed25519 private key length")
+	}
+	private := ed25519.NewKeyFromSeed(d)
+	if !private.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		return nil, newError(dataError, "the Ed25519 public and private keys don't match")
+	}
+	return private, nil
+}
+
+// ParseJWK returns the key of a JSON Web Key, which is a []byte for
+// symmetric keys, otherwise one of the *rsa.PrivateKey, *rsa.PublicKey,
+// *ecdsa.PrivateKey, *ecdsa.PublicKey, ed25519.PrivateKey and
+// ed25519.PublicKey types.
+func ParseJWK(jwk map[string]interface{}) (interface{}, error) {
+	switch kty, _ := jwk["kty"].(string); kty {
+	case "oct":
+		return jwkBytes(jwk, "k")
+	case "RSA":
+		return rsaKeyFromJWK(jwk)
+	case "EC":
+		return ecKeyFromJWK(jwk)
+	case "OKP":
+		return ed25519KeyFromJWK(jwk)
+	default:
+		return nil, newError(notSupportedError, "unsupported JSON Web Key type %q", kty)
+	}
+}
+
+// checkJWK does the checks that are common to JSON Web Keys of all types.
+func (ki *keyImport) checkJWK(kty string) error {
+	if got, _ := ki.jwk["kty"].(string); got != kty {
+		return newError(dataError, "expected a JSON Web Key of type %q, got %q", kty, got)
+	}
+	if ext, ok := ki.jwk["ext"].(bool); ok && !ext && ki.extractable {
+		return newError(dataError, "the JSON Web Key isn't extractable")
+	}
+	if ops, ok := ki.jwk["key_ops"].([]interface{}); ok {
+		for _, u := range ki.usages {
+			found := false
+			for _, op := range ops {
+				found = found || op == u
+			}
+			if !found {
+				return newError(dataError, "the JSON Web Key can't be used to %s", u)
+			}
+		}
+	}
+	return nil
+}
+
+func (ki *keyImport) checkJWKAlg(expected string) error {
+	if alg, ok := ki.jwk["alg"].(string); ok && alg != expected {
+		return newError(dataError, "expected a JSON Web Key for %q, got %q", expected, alg)
+	}
+	return nil
+}
+
+func jwkBytes(jwk map[string]interface{}, name string) ([]byte, error) {
+	s, ok := jwk[name].(string)
+	if !ok {
+		return nil, newError(dataError, "the JSON Web Key is missing the %q member", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, newError(dataError, "invalid %q member of the JSON Web Key: %s", name, err)
+	}
+	return b, nil
+}
+
+func jwkBigInt(jwk map[string]interface{}, name string) (*big.Int, error) {
+	b, err := jwkBytes(jwk, name)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func jwkEncode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwkAlg returns the value of the alg member of JSON Web Keys for the given
+// algorithm, or an empty string if there is none.
+func jwkAlg(alg keyAlgorithm) string {
+	hashSize := strings.TrimPrefix(hashName(alg.hash), "SHA-")
+	switch alg.name {
+	case algAESGCM, algAESCBC, algAESCTR:
+		return "A" + strconv.Itoa(alg.length) + strings.TrimPrefix(alg.name, "AES-")
+	case algHMAC:
+		return "HS" + hashSize
+	case algRSAOAEP:
+		if alg.hash == gocrypto.SHA1 {
+			return "RSA-OAEP"
+		}
+		return "RSA-OAEP-" + hashSize
+	case algRSAPSS:
+		return "PS" + hashSize
+	case algRSASSAPKCS1v15:
+		return "RS" + hashSize
+	case algECDSA:
+		switch alg.namedCurve {
+		case curveP256:
+			return "ES256"
+		case curveP384:
+			return "ES384"
+		case curveP521:
+			return "ES512"
+		}
+	}
+	return ""
+}
+
+func exportKey(format string, k *CryptoKey) (interface{}, error) {
+	if !k.Extractable {
+		return nil, newError(invalidAccessError, "the key isn't extractable")
+	}
+
+	switch format {
+	case formatRaw:
+		switch key := k.handle.(type) {
+		case []byte:
+			return append([]byte{}, key...), nil
+		case *ecdsa.PublicKey:
+			return elliptic.Marshal(key.Curve, key.X, key.Y), nil //nolint:staticcheck
+		case ed25519.PublicKey:
+			return append([]byte{}, key...), nil
+		}
+	case formatPKCS8:
+		if k.Type == keyTypePrivate {
+			return x509.MarshalPKCS8PrivateKey(k.handle)
+		}
+	case formatSPKI:
+		if k.Type == keyTypePublic {
+			return x509.MarshalPKIXPublicKey(k.handle)
+		}
+	case formatJWK:
+		return exportJWK(k), nil
+	default:
+		return nil, newError(notSupportedError, "unsupported key format %q", format)
+	}
+	return nil, newError(invalidAccessError, "%s %s keys can't be exported in the %s format",
+		k.alg.name, k.Type, format)
+}
+
+func exportJWK(k *CryptoKey) map[string]interface{} {
+	jwk := map[string]interface{}{
+		"key_ops": append([]string{}, k.Usages...),
+		"ext":     k.Extractable,
+	}
+	if alg := jwkAlg(k.alg); alg != "" {
+		jwk["alg"] = alg
+	}
+
+	switch key := k.handle.(type) {
+	case []byte:
+		jwk["kty"] = "oct"
+		jwk["k"] = jwkEncode(key)
+	case *rsa.PublicKey:
+		addRSAPublicJWK(jwk, key)
+	case *rsa.PrivateKey:
+		addRSAPublicJWK(jwk, &key.PublicKey)
+		jwk["d"] = jwkEncode(key.D.Bytes())
+		jwk["p"] = jwkEncode(key.Primes[0].Bytes())
+		jwk["q"] = jwkEncode(key.Primes[1].Bytes())
+		jwk["dp"] = jwkEncode(key.Precomputed.Dp.Bytes())
+		jwk["dq"] = jwkEncode(key.Precomputed.Dq.Bytes())
+		jwk["qi"] = jwkEncode(key.Precomputed.Qinv.Bytes())
+	case *ecdsa.PublicKey:
+		addECPublicJWK(jwk, k.alg.namedCurve, key)
+	case *ecdsa.PrivateKey:
+		addECPublicJWK(jwk, k.alg.namedCurve, &key.PublicKey)
+		jwk["d"] = jwkEncode(key.D.FillBytes(make([]byte, curveByteSize(key.Curve))))
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = algEd25519
+		jwk["x"] = jwkEncode(key)
+	case ed25519.PrivateKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = algEd25519
+		jwk["x"] = jwkEncode(key.Public().(ed25519.PublicKey))
+		jwk["d"] = jwkEncode(key.Seed())
+	}
+	return jwk
+}
+
+func addRSAPublicJWK(jwk map[string]interface{}, key *rsa.PublicKey) {
+	jwk["kty"] = "RSA"
+	jwk["n"] = jwkEncode(key.N.Bytes())
+	jwk["e"] = jwkEncode(big.NewInt(int64(key.E)).Bytes())
+}
+
+func addECPublicJWK(jwk map[string]interface{}, namedCurve string, key *ecdsa.PublicKey) {
+	size := curveByteSize(key.Curve)
+	jwk["kty"] = "EC"
+	jwk["crv"] = namedCurve
+	jwk["x"] = jwkEncode(key.X.FillBytes(make([]byte, size)))
+	jwk["y"] = jwkEncode(key.Y.FillBytes(make([]byte, size)))
+}
@@ -0,0 +1,554 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"math/big"
+
+	"github.com/dop251/goja"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func (s *SubtleCrypto) prepareCipher(op string, algorithm, key, data goja.Value) (job, error) {
+	alg, err := s.normalizeAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k, err := toCryptoKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkKey(k, alg.Name, op); err != nil {
+		return nil, err
+	}
+	d, err := bufferSource(data)
+	if err != nil {
+		return nil, err
+	}
+	encrypt := op == "encrypt"
+
+	switch alg.Name {
+	case algAESGCM:
+		return prepareAESGCM(alg, k, d, encrypt)
+	case algAESCBC:
+		iv, err := alg.bytes("iv")
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aes.BlockSize {
+			return nil, newError(operationError, "the AES-CBC iv must be %d bytes long", aes.BlockSize)
+		}
+		return func() (interface{}, error) {
+			return aesCBC(k.handle.([]byte), iv, d, encrypt)
+		}, nil
+	case algAESCTR:
+		counter, err := alg.bytes("counter")
+		if err != nil {
+			return nil, err
+		}
+		length, err := alg.integer("length")
+		if err != nil {
+			return nil, err
+		}
+		if len(counter) != aes.BlockSize || length == 0 || length > aes.BlockSize*8 {
+			return nil, newError(operationError,
+				"the AES-CTR counter must be %d bytes long, with a length between 1 and 128 bits", aes.BlockSize)
+		}
+		return func() (interface{}, error) {
+			return aesCTR(k.handle.([]byte), counter, length, d)
+		}, nil
+	case algRSAOAEP:
+		label, err := alg.optionalBytes("label")
+		if err != nil {
+			return nil, err
+		}
+		return func() (interface{}, error) {
+			if encrypt {
+				return rsa.EncryptOAEP(k.alg.hash.New(), rand.Reader, k.handle.(*rsa.PublicKey), d, label)
+			}
+			return rsa.DecryptOAEP(k.alg.hash.New(), rand.Reader, k.handle.(*rsa.PrivateKey), d, label)
+		}, nil
+	default:
+		return nil, newError(notSupportedError, "%s can't be used to %s", alg.Name, op)
+	}
+}
+
+func prepareAESGCM(alg *algorithm, k *CryptoKey, data []byte, encrypt bool) (job, error) {
+	iv, err := alg.bytes("iv")
+	if err != nil {
+		return nil, err
+	}
+	additionalData, err := alg.optionalBytes("additionalData")
+	if err != nil {
+		return nil, err
+	}
+	tagLength := 128
+	if alg.has("tagLength") {
+		if tagLength, err = alg.integer("tagLength"); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case len(iv) == 0:
+		return nil, newError(operationError, "the AES-GCM iv can't be empty")
+	case tagLength != 96 && tagLength != 104 && tagLength != 112 && tagLength != 120 && tagLength != 128:
+		return nil, newError(notSupportedError, "unsupported AES-GCM tag length %d", tagLength)
+	case tagLength != 128 && len(iv) != 12:
+		return nil, newError(notSupportedError, "an AES-GCM tag length of %d bits needs a 12 bytes long iv", tagLength)
+	}
+
+	return func() (interface{}, error) {
+		block, err := aes.NewCipher(k.handle.([]byte))
+		if err != nil {
+			return nil, err
+		}
+		var aead cipher.AEAD
+		if tagLength == 128 {
+			aead, err = cipher.NewGCMWithNonceSize(block, len(iv))
+		} else {
+			aead, err = cipher.NewGCMWithTagSize(block, tagLength/8)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if encrypt {
+			return aead.Seal(nil, iv, data, additionalData), nil
+		}
+		plaintext, err := aead.Open(nil, iv, data, additionalData)
+		if err != nil {
+			return nil, newError(operationError, "the data couldn't be decrypted")
+		}
+		return plaintext, nil
+	}, nil
+}
+
+func aesCBC(key, iv, data []byte, encrypt bool) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if encrypt {
+		padding := aes.BlockSize - len(data)%aes.BlockSize
+		out := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+		return out, nil
+	}
+
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, newError(operationError, "the data isn't a multiple of the AES block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, newError(operationError, "the data couldn't be decrypted")
+	}
+	return out[:len(out)-padding], nil
+}
+
+// aesCTR encrypts or decrypts data in the AES-CTR mode, where only the
+// rightmost length bits of the counter block are incremented.
+func aesCTR(key, counter []byte, length int, data []byte) ([]byte, error) {
+	blocks := (len(data) + aes.BlockSize - 1) / aes.BlockSize
+	if length < 64 && uint64(blocks) > uint64(1)<<length {
+		return nil, newError(operationError, "the AES-CTR counter would wrap around")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ctr := append([]byte{}, counter...)
+	stream := make([]byte, aes.BlockSize)
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += aes.BlockSize {
+		block.Encrypt(stream, ctr)
+		for j := i; j < len(data) && j < i+aes.BlockSize; j++ {
+			out[j] = data[j] ^ stream[j-i]
+		}
+		incrementCounter(ctr, length)
+	}
+	return out, nil
+}
+
+// incrementCounter increments the rightmost bits of the counter block,
+// modulo 2^bits.
+func incrementCounter(ctr []byte, bits int) {
+	for i := len(ctr) - 1; i >= 0 && bits > 0; i-- {
+		if bits < 8 {
+			mask := byte(1<<bits) - 1
+			ctr[i] = ctr[i]&^mask | (ctr[i]+1)&mask
+			return
+		}
+		ctr[i]++
+		if ctr[i] != 0 {
+			return
+		}
+		bits -= 8
+	}
+}
+
+func (s *SubtleCrypto) prepareSignature(op string, algorithm, key, signature, data goja.Value) (job, error) {
+	alg, err := s.normalizeAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k, err := toCryptoKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkKey(k, alg.Name, op); err != nil {
+		return nil, err
+	}
+	d, err := bufferSource(data)
+	if err != nil {
+		return nil, err
+	}
+	var sig []byte
+	if op == "verify" {
+		if sig, err = bufferSource(signature); err != nil {
+			return nil, err
+		}
+	}
+
+	var signer interface {
+		sign() ([]byte, error)
+		verify(sig []byte) bool
+	}
+	switch alg.Name {
+	case algHMAC:
+		signer = hmacSigner{key: k, data: d}
+	case algRSASSAPKCS1v15:
+		signer = rsaPKCS1v15Signer{key: k, data: d}
+	case algRSAPSS:
+		saltLength, err := alg.integer("saltLength")
+		if err != nil {
+			return nil, err
+		}
+		if saltLength == 0 && op == "sign" {
+			return nil, newError(notSupportedError, "RSA-PSS signatures without a salt aren't supported")
+		}
+		signer = rsaPSSSigner{key: k, data: d, saltLength: saltLength}
+	case algECDSA:
+		h, err := alg.hash()
+		if err != nil {
+			return nil, err
+		}
+		signer = ecdsaSigner{key: k, data: d, hash: h}
+	case algEd25519:
+		signer = ed25519Signer{key: k, data: d}
+	default:
+		return nil, newError(notSupportedError, "%s can't be used to %s", alg.Name, op)
+	}
+
+	return func() (interface{}, error) {
+		if op == "verify" {
+			return signer.verify(sig), nil
+		}
+		return signer.sign()
+	}, nil
+}
+
+func digest(h gocrypto.Hash, data []byte) []byte {
+	hasher := h.New()
+	_, _ = hasher.Write(data)
+	return hasher.Sum(nil)
+}
+
+type hmacSigner struct {
+	key  *CryptoKey
+	data []byte
+}
+
+func (s hmacSigner) sign() ([]byte, error) {
+	mac := hmac.New(s.key.alg.hash.New, s.key.handle.([]byte))
+	_, _ = mac.Write(s.data)
+	return mac.Sum(nil), nil
+}
+
+func (s hmacSigner) verify(sig []byte) bool {
+	mac, _ := s.sign()
+	return hmac.Equal(mac, sig)
+}
+
+type rsaPKCS1v15Signer struct {
+	key  *CryptoKey
+	data []byte
+}
+
+func (s rsaPKCS1v15Signer) sign() ([]byte, error) {
+	h := s.key.alg.hash
+	return rsa.SignPKCS1v15(rand.Reader, s.key.handle.(*rsa.PrivateKey), h, digest(h, s.data))
+}
+
+func (s rsaPKCS1v15Signer) verify(sig []byte) bool {
+	h := s.key.alg.hash
+	return rsa.VerifyPKCS1v15(s.key.handle.(*rsa.PublicKey), h, digest(h, s.data), sig) == nil
+}
+
+type rsaPSSSigner struct {
+	key        *CryptoKey
+	data       []byte
+	saltLength int
+}
+
+func (s rsaPSSSigner) options() *rsa.PSSOptions {
+	// A zero salt length means that it is detected automatically.
+	return &rsa.PSSOptions{SaltLength: s.saltLength, Hash: s.key.alg.hash}
+}
+
+func (s rsaPSSSigner) sign() ([]byte, error) {
+	h := s.key.alg.hash
+	return rsa.SignPSS(rand.Reader, s.key.handle.(*rsa.PrivateKey), h, digest(h, s.data), s.options())
+}
+
+func (s rsaPSSSigner) verify(sig []byte) bool {
+	h := s.key.alg.hash
+	return rsa.VerifyPSS(s.key.handle.(*rsa.PublicKey), h, digest(h, s.data), sig, s.options()) == nil
+}
+
+// ecdsaSigner makes signatures in the IEEE P1363 format that WebCrypto uses,
+// i.e. the r and s values concatenated, instead of the ASN.1 one.
+type ecdsaSigner struct {
+	key  *CryptoKey
+	data []byte
+	hash gocrypto.Hash
+}
+
+func (s ecdsaSigner) sign() ([]byte, error) {
+	private := s.key.handle.(*ecdsa.PrivateKey)
+	r, ss, err := ecdsa.Sign(rand.Reader, private, digest(s.hash, s.data))
+	if err != nil {
+		return nil, err
+	}
+	size := curveByteSize(private.Curve)
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	ss.FillBytes(sig[size:])
+	return sig, nil
+}
+
+func (s ecdsaSigner) verify(sig []byte) bool {
+	public := s.key.handle.(*ecdsa.PublicKey)
+	size := curveByteSize(public.Curve)
+	if len(sig) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:size])
+	ss := new(big.Int).SetBytes(sig[size:])
+	return ecdsa.Verify(public, digest(s.hash, s.data), r, ss)
+}
+
+type ed25519Signer struct {
+	key  *CryptoKey
+	data []byte
+}
+
+func (s ed25519Signer) sign() ([]byte, error) {
+	return ed25519.Sign(s.key.handle.(ed25519.PrivateKey), s.data), nil
+}
+
+func (s ed25519Signer) verify(sig []byte) bool {
+	return ed25519.Verify(s.key.handle.(ed25519.PublicKey), s.data, sig)
+}
+
+// prepareDerive returns a function that derives the bits for deriveBits()
+// and deriveKey(). A negative length means all of the bits that the
+// algorithm can derive, which only ECDH supports.
+func (s *SubtleCrypto) prepareDerive(
+	op string, algorithm, baseKey goja.Value, length int,
+) (func() ([]byte, error), error) {
+	alg, err := s.normalizeAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k, err := toCryptoKey(baseKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkKey(k, alg.Name, op); err != nil {
+		return nil, err
+	}
+	if alg.Name != algECDH && (length <= 0 || length%8 != 0) {
+		return nil, newError(operationError, "%s can only derive a non-zero multiple of 8 bits", alg.Name)
+	}
+
+	switch alg.Name {
+	case algPBKDF2:
+		return preparePBKDF2(alg, k, length)
+	case algHKDF:
+		return prepareHKDF(alg, k, length)
+	case algECDH:
+		return prepareECDH(alg, k, length)
+	default:
+		return nil, newError(notSupportedError, "%s can't be used to %s", alg.Name, op)
+	}
+}
+
+func preparePBKDF2(alg *algorithm, k *CryptoKey, length int) (func() ([]byte, error), error) {
+	h, err := alg.hash()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := alg.bytes("salt")
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := alg.integer("iterations")
+	if err != nil {
+		return nil, err
+	}
+	if iterations == 0 {
+		return nil, newError(operationError, "PBKDF2 needs at least one iteration")
+	}
+	return func() ([]byte, error) {
+		return pbkdf2.Key(k.handle.([]byte), salt, iterations, length/8, h.New), nil
+	}, nil
+}
+
+func prepareHKDF(alg *algorithm, k *CryptoKey, length int) (func() ([]byte, error), error) {
+	h, err := alg.hash()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := alg.bytes("salt")
+	if err != nil {
+		return nil, err
+	}
+	info, err := alg.bytes("info")
+	if err != nil {
+		return nil, err
+	}
+	return func() ([]byte, error) {
+		out := make([]byte, length/8)
+		if _, err := io.ReadFull(hkdf.New(h.New, k.handle.([]byte), salt, info), out); err != nil {
+			return nil, newError(operationError, "%s", err)
+		}
+		return out, nil
+	}, nil
+}
+
+func prepareECDH(alg *algorithm, k *CryptoKey, length int) (func() ([]byte, error), error) {
+	public, err := alg.key("public")
+	if err != nil {
+		return nil, err
+	}
+	if public.Type != keyTypePublic || public.alg.name != algECDH {
+		return nil, newError(invalidAccessError, "the public parameter must be an ECDH public key")
+	}
+	if public.alg.namedCurve != k.alg.namedCurve {
+		return nil, newError(invalidAccessError, "the public and private keys must be on the same curve")
+	}
+
+	return func() ([]byte, error) {
+		private := k.handle.(*ecdsa.PrivateKey)
+		peer := public.handle.(*ecdsa.PublicKey)
+		x, _ := private.Curve.ScalarMult(peer.X, peer.Y, private.D.Bytes()) //nolint:staticcheck
+		secret := x.FillBytes(make([]byte, curveByteSize(private.Curve)))
+		if length < 0 {
+			return secret, nil
+		}
+		if length > len(secret)*8 {
+			return nil, newError(operationError, "ECDH on %s can derive at most %d bits",
+				k.alg.namedCurve, len(secret)*8)
+		}
+		secret = secret[:(length+7)/8]
+		if length%8 != 0 {
+			secret[len(secret)-1] &= byte(0xff << (8 - length%8))
+		}
+		return secret, nil
+	}, nil
+}
+
+func (s *SubtleCrypto) deriveLength(length goja.Value) (int, error) {
+	if isNullish(length) {
+		return -1, nil
+	}
+	f := length.ToFloat()
+	if f != float64(int(f)) || f < 0 {
+		return 0, newError(typeError, "invalid length %s", length)
+	}
+	return int(f), nil
+}
+
+func (s *SubtleCrypto) prepareDeriveKey(
+	algorithm, baseKey, derivedKeyAlgorithm goja.Value, extractable bool, keyUsages goja.Value,
+) (job, error) {
+	derivedAlg, err := s.normalizeAlgorithm(derivedKeyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	usages, err := s.keyUsages(keyUsages)
+	if err != nil {
+		return nil, err
+	}
+	ka := keyAlgorithm{name: derivedAlg.Name}
+
+	switch derivedAlg.Name {
+	case algAESGCM, algAESCBC, algAESCTR:
+		if ka.length, err = derivedAlg.integer("length"); err != nil {
+			return nil, err
+		}
+		if ka.length != 128 && ka.length != 192 && ka.length != 256 {
+			return nil, newError(operationError, "the AES key length must be 128, 192 or 256 bits")
+		}
+	case algHMAC:
+		if ka.hash, err = derivedAlg.hash(); err != nil {
+			return nil, err
+		}
+		ka.length = ka.hash.New().BlockSize() * 8
+		if derivedAlg.has("length") {
+			if ka.length, err = derivedAlg.integer("length"); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, newError(notSupportedError, "%s keys can't be derived", derivedAlg.Name)
+	}
+	if err = checkUsages(ka.name, usages, keyTypeSecret); err != nil {
+		return nil, err
+	}
+
+	derive, err := s.prepareDerive("deriveKey", algorithm, baseKey, ka.length)
+	if err != nil {
+		return nil, err
+	}
+	return func() (interface{}, error) {
+		raw, err := derive()
+		if err != nil {
+			return nil, err
+		}
+		ki := &keyImport{format: formatRaw, raw: raw, alg: ka, extractable: extractable, usages: usages}
+		return ki.run()
+	}, nil
+}
@@ -0,0 +1,470 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/eventloop"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+)
+
+// subtleTestHelpers are available to the scripts run by runSubtle(). Each
+// script has to pass its promise chain to check(), which records how it
+// was settled in the result variable.
+const subtleTestHelpers = `
+var subtle = crypto.subtle;
+var result;
+function check(p) {
+	p.then(function() { result = "ok"; }, function(e) { result = e.name + ": " + e.message; });
+}
+function hex(buf) {
+	return Array.prototype.map.call(new Uint8Array(buf), function(b) {
+		return ("0" + b.toString(16)).slice(-2);
+	}).join("");
+}
+function bytes(s) {
+	var b = new Uint8Array(s.length);
+	for (var i = 0; i < s.length; i++) { b[i] = s.charCodeAt(i); }
+	return b;
+}
+function assertEqual(actual, expected) {
+	if (actual !== expected) { throw new Error("expected " + expected + ", got " + actual); }
+}
+`
+
+func newSubtleTestRuntime(t *testing.T) func(script string) string {
+	t.Helper()
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	loop := eventloop.New()
+
+	m, ok := New().NewModuleInstance(&modulestest.VU{
+		RuntimeField:          rt,
+		InitEnvField:          &common.InitEnvironment{},
+		CtxField:              context.Background(),
+		StateField:            &lib.State{},
+		RegisterCallbackField: loop.RegisterCallback,
+	}).(*Crypto)
+	require.True(t, ok)
+	require.NoError(t, rt.Set("crypto", m.Exports().Named))
+	_, err := rt.RunString(subtleTestHelpers)
+	require.NoError(t, err)
+
+	return func(script string) string {
+		require.NoError(t, rt.Set("result", goja.Undefined()))
+		err := loop.Start(context.Background(), func() error {
+			_, err := rt.RunString(script)
+			return err
+		})
+		require.NoError(t, err)
+		return rt.Get("result").String()
+	}
+}
+
+func TestSubtleInitContext(t *testing.T) {
+	t.Parallel()
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	// there is no state nor an event loop in the init context
+	m, ok := New().NewModuleInstance(&modulestest.VU{
+		RuntimeField: rt,
+		InitEnvField: &common.InitEnvironment{},
+		CtxField:     context.Background(),
+	}).(*Crypto)
+	require.True(t, ok)
+	require.NoError(t, rt.Set("crypto", m.Exports().Named))
+	_, err := rt.RunString(subtleTestHelpers + `
+	check(subtle.digest("SHA-1", bytes("hello")).then(function(digest) {
+		assertEqual(hex(digest), "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d");
+	}));`)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", rt.Get("result").String())
+
+	_, err = rt.RunString(`check(subtle.digest("MD5", bytes("hello")));`)
+	require.NoError(t, err)
+	assert.Equal(t, `NotSupportedError: unsupported algorithm "MD5"`, rt.Get("result").String())
+}
+
+func TestSubtleDigest(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	assert.Equal(t, "ok", run(`
+	check(subtle.digest("SHA-256", bytes("hello")).then(function(digest) {
+		assertEqual(hex(digest), "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824");
+	}));`))
+	assert.Equal(t, "ok", run(`
+	check(subtle.digest({ name: "sha-1" }, new Uint8Array([104, 101, 108, 108, 111]).buffer).then(function(digest) {
+		assertEqual(hex(digest), "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d");
+	}));`))
+	assert.Equal(t, `NotSupportedError: unsupported algorithm "MD5"`, run(`
+	check(subtle.digest("MD5", bytes("hello")));`))
+}
+
+func TestSubtleAES(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	for _, params := range []string{
+		`{ name: "AES-GCM", iv: iv, additionalData: bytes("aad") }`,
+		`{ name: "AES-GCM", iv: iv.subarray(0, 12), tagLength: 96 }`,
+		`{ name: "AES-CBC", iv: iv }`,
+		`{ name: "AES-CTR", counter: iv, length: 8 }`,
+	} {
+		params := params
+		t.Run(params, func(t *testing.T) {
+			assert.Equal(t, "ok", run(`
+			var iv = crypto.getRandomValues(new Uint8Array(16));
+			var params = `+params+`;
+			var key;
+			check(subtle.generateKey({ name: params.name, length: 256 }, true, ["encrypt", "decrypt"]).then(function(k) {
+				key = k;
+				assertEqual(key.type, "secret");
+				assertEqual(key.algorithm.length, 256);
+				return subtle.encrypt(params, key, bytes("some secret data that is longer than a block"));
+			}).then(function(ciphertext) {
+				return subtle.decrypt(params, key, ciphertext);
+			}).then(function(plaintext) {
+				assertEqual(String.fromCharCode.apply(null, new Uint8Array(plaintext)),
+					"some secret data that is longer than a block");
+			}));`))
+		})
+	}
+
+	t.Run("KnownAnswer", func(t *testing.T) {
+		// The test case 2 of the GCM specification.
+		assert.Equal(t, "ok", run(`
+		check(subtle.importKey("raw", new Uint8Array(16), "AES-GCM", false, ["encrypt"]).then(function(k) {
+			return subtle.encrypt({ name: "AES-GCM", iv: new Uint8Array(12) }, k, new Uint8Array(16));
+		}).then(function(ciphertext) {
+			assertEqual(hex(ciphertext), "0388dace60b6a392f328c2b971b2fe78" + "ab6e47d42cec13bdf53a67b21257bddf");
+		}));`))
+	})
+
+	t.Run("TamperedCiphertext", func(t *testing.T) {
+		assert.Equal(t, "OperationError: the data couldn't be decrypted", run(`
+		var params = { name: "AES-GCM", iv: new Uint8Array(12) };
+		var key;
+		check(subtle.generateKey({ name: "AES-GCM", length: 128 }, false, ["encrypt", "decrypt"]).then(function(k) {
+			key = k;
+			return subtle.encrypt(params, key, bytes("data"));
+		}).then(function(ciphertext) {
+			new Uint8Array(ciphertext)[0] ^= 1;
+			return subtle.decrypt(params, key, ciphertext);
+		}));`))
+	})
+
+	t.Run("CTRWrapsAround", func(t *testing.T) {
+		// Only the last byte of the counter is incremented, so the first and
+		// the 257th blocks use the same key stream.
+		assert.Equal(t, "ok", run(`
+		check(subtle.generateKey({ name: "AES-CTR", length: 128 }, false, ["encrypt"]).then(function(k) {
+			return subtle.encrypt({ name: "AES-CTR", counter: new Uint8Array(16), length: 8 }, k, new Uint8Array(256 * 16));
+		}).then(function(ciphertext) {
+			var blocks = new Uint8Array(ciphertext);
+			assertEqual(blocks.length, 256 * 16);
+			assertEqual(hex(blocks.subarray(0, 16)) !== hex(blocks.subarray(16, 32)), true);
+		}));`))
+		assert.Equal(t, "OperationError: the AES-CTR counter would wrap around", run(`
+		check(subtle.generateKey({ name: "AES-CTR", length: 128 }, false, ["encrypt"]).then(function(k) {
+			return subtle.encrypt({ name: "AES-CTR", counter: new Uint8Array(16), length: 8 }, k, new Uint8Array(257 * 16));
+		}));`))
+	})
+}
+
+func TestSubtleSignatures(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	for name, test := range map[string]struct{ generate, sign string }{
+		"HMAC":     {`{ name: "HMAC", hash: "SHA-256" }`, `"HMAC"`},
+		"PKCS1":    {`{ name: "RSASSA-PKCS1-v1_5", modulusLength: 1024, publicExponent: e, hash: "SHA-256" }`, `"RSASSA-PKCS1-v1_5"`},
+		"PSS":      {`{ name: "RSA-PSS", modulusLength: 1024, publicExponent: e, hash: "SHA-384" }`, `{ name: "RSA-PSS", saltLength: 32 }`},
+		"ECDSA256": {`{ name: "ECDSA", namedCurve: "P-256" }`, `{ name: "ECDSA", hash: "SHA-256" }`},
+		"ECDSA384": {`{ name: "ECDSA", namedCurve: "P-384" }`, `{ name: "ECDSA", hash: { name: "SHA-384" } }`},
+		"Ed25519":  {`"Ed25519"`, `"Ed25519"`},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, "ok", run(`
+			var e = new Uint8Array([1, 0, 1]);
+			var signParams = `+test.sign+`;
+			var signKey, verifyKey;
+			check(subtle.generateKey(`+test.generate+`, false, ["sign", "verify"]).then(function(k) {
+				signKey = k.privateKey || k;
+				verifyKey = k.publicKey || k;
+				return subtle.sign(signParams, signKey, bytes("data"));
+			}).then(function(signature) {
+				return Promise.all([
+					subtle.verify(signParams, verifyKey, signature, bytes("data")),
+					subtle.verify(signParams, verifyKey, signature, bytes("other data")),
+				]);
+			}).then(function(valid) {
+				assertEqual(valid[0], true);
+				assertEqual(valid[1], false);
+			}));`))
+		})
+	}
+
+	t.Run("HMACKnownAnswer", func(t *testing.T) {
+		// The test case 2 of RFC 4231.
+		assert.Equal(t, "ok", run(`
+		check(subtle.importKey("raw", bytes("Jefe"), { name: "HMAC", hash: "SHA-256" }, false, ["sign"]).then(function(k) {
+			assertEqual(k.algorithm.length, 32);
+			return subtle.sign("HMAC", k, bytes("what do ya want for nothing?"));
+		}).then(function(mac) {
+			assertEqual(hex(mac), "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843");
+		}));`))
+	})
+
+	t.Run("WrongUsage", func(t *testing.T) {
+		assert.Equal(t, "InvalidAccessError: the key can't be used to sign", run(`
+		check(subtle.generateKey("Ed25519", false, ["sign", "verify"]).then(function(k) {
+			return subtle.sign("Ed25519", k.publicKey, bytes("data"));
+		}));`))
+		assert.Equal(t, "InvalidAccessError: the key is for HMAC, not ECDSA", run(`
+		check(subtle.generateKey({ name: "HMAC", hash: "SHA-1" }, false, ["sign"]).then(function(k) {
+			return subtle.sign({ name: "ECDSA", hash: "SHA-256" }, k, bytes("data"));
+		}));`))
+	})
+}
+
+func TestSubtleRSAOAEP(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	assert.Equal(t, "ok", run(`
+	var params = { name: "RSA-OAEP", label: bytes("label") };
+	var keys;
+	check(subtle.generateKey(
+		{ name: "RSA-OAEP", modulusLength: 1024, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" },
+		true, ["encrypt", "decrypt"],
+	).then(function(k) {
+		keys = k;
+		assertEqual(keys.publicKey.usages.join(), "encrypt");
+		assertEqual(keys.privateKey.usages.join(), "decrypt");
+		assertEqual(keys.publicKey.algorithm.modulusLength, 1024);
+		return subtle.encrypt(params, keys.publicKey, bytes("secret"));
+	}).then(function(ciphertext) {
+		return subtle.decrypt(params, keys.privateKey, ciphertext);
+	}).then(function(plaintext) {
+		assertEqual(hex(plaintext), hex(bytes("secret")));
+	}));`))
+}
+
+func TestSubtleImportExport(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	t.Run("JWK", func(t *testing.T) {
+		for _, generate := range []string{
+			`{ name: "ECDSA", namedCurve: "P-256" }`,
+			`{ name: "RSA-PSS", modulusLength: 1024, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" }`,
+			`"Ed25519"`,
+		} {
+			generate := generate
+			t.Run(generate, func(t *testing.T) {
+				assert.Equal(t, "ok", run(`
+				var alg = `+generate+`;
+				var signParams = { name: alg.name || alg, hash: "SHA-256", saltLength: 32 };
+				var imported;
+				check(subtle.generateKey(alg, true, ["sign", "verify"]).then(function(k) {
+					return Promise.all([subtle.exportKey("jwk", k.privateKey), subtle.exportKey("jwk", k.publicKey)]);
+				}).then(function(jwks) {
+					assertEqual(jwks[0].ext, true);
+					assertEqual(jwks[0].key_ops.join(), "sign");
+					assertEqual(jwks[1].d, undefined);
+					return Promise.all([
+						subtle.importKey("jwk", jwks[0], alg, false, ["sign"]),
+						subtle.importKey("jwk", jwks[1], alg, false, ["verify"]),
+					]);
+				}).then(function(keys) {
+					imported = keys;
+					assertEqual(keys[0].type, "private");
+					assertEqual(keys[1].extractable, true);
+					return subtle.sign(signParams, keys[0], bytes("data"));
+				}).then(function(signature) {
+					return subtle.verify(signParams, imported[1], signature, bytes("data"));
+				}).then(function(valid) {
+					assertEqual(valid, true);
+				}));`))
+			})
+		}
+	})
+
+	t.Run("PKCS8AndSPKI", func(t *testing.T) {
+		assert.Equal(t, "ok", run(`
+		var alg = { name: "ECDSA", namedCurve: "P-384" };
+		var signParams = { name: "ECDSA", hash: "SHA-384" };
+		var imported;
+		check(subtle.generateKey(alg, true, ["sign", "verify"]).then(function(k) {
+			return Promise.all([
+				subtle.exportKey("pkcs8", k.privateKey),
+				subtle.exportKey("spki", k.publicKey),
+				subtle.exportKey("raw", k.publicKey),
+			]);
+		}).then(function(exported) {
+			assertEqual(exported[2].byteLength, 97);
+			return Promise.all([
+				subtle.importKey("pkcs8", exported[0], alg, false, ["sign"]),
+				subtle.importKey("spki", exported[1], alg, false, ["verify"]),
+				subtle.importKey("raw", exported[2], alg, false, ["verify"]),
+			]);
+		}).then(function(keys) {
+			imported = keys;
+			return subtle.sign(signParams, keys[0], bytes("data"));
+		}).then(function(signature) {
+			assertEqual(signature.byteLength, 96);
+			return Promise.all([
+				subtle.verify(signParams, imported[1], signature, bytes("data")),
+				subtle.verify(signParams, imported[2], signature, bytes("data")),
+			]);
+		}).then(function(valid) {
+			assertEqual(valid.join(), "true,true");
+		}));`))
+	})
+
+	t.Run("SecretJWK", func(t *testing.T) {
+		assert.Equal(t, "ok", run(`
+		var jwk = { kty: "oct", k: "AAECAwQFBgcICQoLDA0ODw", alg: "A128CBC", ext: true };
+		check(subtle.importKey("jwk", jwk, "AES-CBC", true, ["encrypt"]).then(function(k) {
+			assertEqual(k.algorithm.length, 128);
+			return Promise.all([subtle.exportKey("jwk", k), subtle.exportKey("raw", k)]);
+		}).then(function(exported) {
+			assertEqual(exported[0].k, jwk.k);
+			assertEqual(exported[0].alg, "A128CBC");
+			assertEqual(hex(exported[1]), "000102030405060708090a0b0c0d0e0f");
+		}));`))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		assert.Equal(t, "InvalidAccessError: the key isn't extractable", run(`
+		check(subtle.generateKey({ name: "AES-GCM", length: 128 }, false, ["encrypt"]).then(function(k) {
+			return subtle.exportKey("raw", k);
+		}));`))
+		assert.Equal(t, "SyntaxError: AES-GCM keys can't be used to sign", run(`
+		check(subtle.generateKey({ name: "AES-GCM", length: 128 }, false, ["sign"]));`))
+		assert.Equal(t, "DataError: the AES key length must be 128, 192 or 256 bits", run(`
+		check(subtle.importKey("raw", new Uint8Array(10), "AES-GCM", false, ["encrypt"]));`))
+		assert.Equal(t, `DataError: expected a JSON Web Key for "A128GCM", got "A128CBC"`, run(`
+		check(subtle.importKey("jwk", { kty: "oct", k: "AAECAwQFBgcICQoLDA0ODw", alg: "A128CBC" },
+			"AES-GCM", false, ["encrypt"]));`))
+		assert.Equal(t, "SyntaxError: PBKDF2 keys can't be extractable", run(`
+		check(subtle.importKey("raw", bytes("password"), "PBKDF2", true, ["deriveBits"]));`))
+	})
+}
+
+func TestSubtleDerive(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	t.Run("PBKDF2", func(t *testing.T) {
+		// The test case 2 of RFC 6070.
+		assert.Equal(t, "ok", run(`
+		check(subtle.importKey("raw", bytes("password"), "PBKDF2", false, ["deriveBits"]).then(function(k) {
+			return subtle.deriveBits({ name: "PBKDF2", salt: bytes("salt"), iterations: 2, hash: "SHA-1" }, k, 160);
+		}).then(function(bits) {
+			assertEqual(hex(bits), "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957");
+		}));`))
+	})
+
+	t.Run("HKDF", func(t *testing.T) {
+		// The test case 3 of RFC 5869.
+		assert.Equal(t, "ok", run(`
+		var ikm = new Uint8Array(22).fill(0x0b);
+		check(subtle.importKey("raw", ikm, "HKDF", false, ["deriveKey"]).then(function(k) {
+			return subtle.deriveKey(
+				{ name: "HKDF", hash: "SHA-256", salt: new Uint8Array(0), info: new Uint8Array(0) }, k,
+				{ name: "HMAC", hash: "SHA-256", length: 336 }, true, ["sign"]);
+		}).then(function(derived) {
+			assertEqual(derived.algorithm.name, "HMAC");
+			assertEqual(derived.algorithm.length, 336);
+			return subtle.exportKey("raw", derived);
+		}).then(function(raw) {
+			assertEqual(hex(raw), "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8");
+		}));`))
+	})
+
+	t.Run("ECDH", func(t *testing.T) {
+		assert.Equal(t, "ok", run(`
+		var alg = { name: "ECDH", namedCurve: "P-256" };
+		var params = { name: "AES-GCM", iv: new Uint8Array(12) };
+		var alice, bob, aliceKey;
+		check(Promise.all([
+			subtle.generateKey(alg, false, ["deriveKey", "deriveBits"]),
+			subtle.generateKey(alg, false, ["deriveKey", "deriveBits"]),
+		]).then(function(keys) {
+			alice = keys[0];
+			bob = keys[1];
+			assertEqual(alice.publicKey.usages.length, 0);
+			return Promise.all([
+				subtle.deriveBits({ name: "ECDH", public: bob.publicKey }, alice.privateKey, null),
+				subtle.deriveBits({ name: "ECDH", public: alice.publicKey }, bob.privateKey, 128),
+			]);
+		}).then(function(bits) {
+			assertEqual(bits[0].byteLength, 32);
+			assertEqual(hex(bits[0]).slice(0, 32), hex(bits[1]));
+			return Promise.all([
+				subtle.deriveKey({ name: "ECDH", public: bob.publicKey }, alice.privateKey,
+					{ name: "AES-GCM", length: 256 }, false, ["encrypt"]),
+				subtle.deriveKey({ name: "ECDH", public: alice.publicKey }, bob.privateKey,
+					{ name: "AES-GCM", length: 256 }, false, ["decrypt"]),
+			]);
+		}).then(function(keys) {
+			aliceKey = keys[1];
+			return subtle.encrypt(params, keys[0], bytes("hi bob"));
+		}).then(function(ciphertext) {
+			return subtle.decrypt(params, aliceKey, ciphertext);
+		}).then(function(plaintext) {
+			assertEqual(hex(plaintext), hex(bytes("hi bob")));
+		}));`))
+	})
+}
+
+func TestGetRandomValues(t *testing.T) {
+	t.Parallel()
+	run := newSubtleTestRuntime(t)
+
+	assert.Equal(t, "ok", run(`
+	var array = new Uint32Array(64);
+	assertEqual(crypto.getRandomValues(array), array);
+	assertEqual(array.some(function(v) { return v !== 0; }), true);
+	var view = new Uint8Array(new ArrayBuffer(32), 8, 8);
+	crypto.getRandomValues(view);
+	assertEqual(hex(view.buffer.slice(0, 8)) + hex(view.buffer.slice(16)), hex(new Uint8Array(24)));
+	result = "ok";`))
+
+	for script, expected := range map[string]string{
+		`crypto.getRandomValues(new Float64Array(4))`:   "TypeMismatchError",
+		`crypto.getRandomValues(new Uint8Array(65537))`: "QuotaExceededError",
+		`crypto.getRandomValues([1, 2, 3])`:             "TypeError",
+	} {
+		assert.Contains(t, run(`try { `+script+` } catch (e) { result = e.message; }`), expected)
+	}
+}
@@ -297,3 +297,42 @@ func fingerPrint(parsed *x509.Certificate) []byte {
 	bytes := sha1.Sum(parsed.Raw) // #nosec G401
 	return bytes[:]
 }
+
+// ParsePEMKey returns the key in the first PEM block of encoded. Public keys
+// can also be loaded from a certificate, the private keys can be in the PKCS
+// #8 format or in the older PKCS #1 and SEC 1 ones.
+func ParsePEMKey(encoded []byte) (interface{}, error) {
+	decoded, _ := pem.Decode(encoded)
+	if decoded == nil {
+		return nil, fmt.Errorf("failed to decode key PEM file")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+	switch decoded.Type {
+	case "CERTIFICATE":
+		parsed, err := parseCertificate(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return parsed.PublicKey, nil
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(decoded.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(decoded.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(decoded.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(decoded.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(decoded.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", decoded.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return key, nil
+}
@@ -22,6 +22,8 @@ package x509
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	gox509 "crypto/x509"
 	"fmt"
 	"testing"
@@ -707,3 +709,25 @@ func TestMakeCertificate(t *testing.T) {
 		assert.EqualError(t, err, "unsupported public key algorithm")
 	})
 }
+
+func TestParsePEMKey(t *testing.T) {
+	t.Run("Certificate", func(t *testing.T) {
+		key, err := ParsePEMKey([]byte(material.ecdsaCertificate))
+		require.NoError(t, err)
+		assert.IsType(t, &ecdsa.PublicKey{}, key)
+	})
+
+	t.Run("PublicKey", func(t *testing.T) {
+		key, err := ParsePEMKey([]byte(material.publicKey))
+		require.NoError(t, err)
+		assert.IsType(t, &rsa.PublicKey{}, key)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ParsePEMKey([]byte("not a PEM file"))
+		assert.EqualError(t, err, "failed to decode key PEM file")
+
+		_, err = ParsePEMKey([]byte("-----BEGIN FOO-----\nAAAA\n-----END FOO-----\n"))
+		assert.EqualError(t, err, `unsupported PEM block type "FOO"`)
+	})
+}
@@ -0,0 +1,277 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+)
+
+type csvOptions struct {
+	header         bool
+	delimiter      rune
+	skipEmptyLines bool
+	typed          bool
+}
+
+// csvArray is the read-only array that is returned by csv.parse. The records
+// are kept in Go and their values are only created when they are accessed, so
+// a SharedArray can be made from them without a JS array in between.
+type csvArray struct {
+	rt      *goja.Runtime
+	freeze  goja.Callable
+	header  []string
+	records [][]string
+	typed   bool
+}
+
+var _ goja.DynamicArray = &csvArray{}
+
+// floatRE matches the numbers that are converted by the typed option, which is
+// the same as the dynamicTyping of papaparse.
+var floatRE = regexp.MustCompile(`^\s*-?(\d+\.?|\.\d+|\d+\.\d+)([eE][-+]?\d+)?\s*$`) //nolint:gochecknoglobals
+
+// parseCSV implements csv.parse(data, [options]), where the data is a string or
+// an ArrayBuffer, e.g. from open(), and the options are:
+//   - header: whether the first record has the names of the fields, which makes
+//     the records objects instead of arrays
+//   - delimiter: the field delimiter, "," by default
+//   - skipEmptyLines: whether empty lines are skipped instead of being records
+//     with a single empty field
+//   - typed: whether numbers and booleans are converted and empty fields are null
+func (d *Data) parseCSV(dataV goja.Value, optionsV goja.Value) *goja.Object {
+	rt := d.vu.Runtime()
+
+	var data string
+	switch v := common.ExportOrNil(dataV).(type) {
+	case string:
+		data = v
+	case goja.ArrayBuffer:
+		data = string(v.Bytes())
+	case []byte:
+		data = string(v)
+	default:
+		common.Throw(rt, errors.New("csv.parse needs a string or an ArrayBuffer with the CSV data"))
+	}
+
+	opts, err := parseCSVOptions(rt, optionsV)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	records, err := readCSV(data, opts)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	freeze, _ := goja.AssertFunction(rt.GlobalObject().Get("Object").ToObject(rt).Get("freeze"))
+	arr := &csvArray{rt: rt, freeze: freeze, records: records, typed: opts.typed}
+	if opts.header && len(records) > 0 {
+		arr.header, arr.records = records[0], records[1:]
+		for i, record := range arr.records {
+			if len(record) > len(arr.header) {
+				common.Throw(rt, fmt.Errorf("CSV record %d has %d fields, but the header only has %d",
+					i+1, len(record), len(arr.header)))
+			}
+		}
+	}
+	return rt.NewDynamicArray(arr)
+}
+
+func parseCSVOptions(rt *goja.Runtime, optionsV goja.Value) (csvOptions, error) {
+	opts := csvOptions{delimiter: ','}
+	if common.ExportOrNil(optionsV) == nil {
+		return opts, nil
+	}
+	params := optionsV.ToObject(rt)
+	for _, k := range params.Keys() {
+		v := params.Get(k)
+		switch k {
+		case "header":
+			opts.header = v.ToBoolean()
+		case "delimiter":
+			delimiter := v.String()
+			r, size := utf8.DecodeRuneInString(delimiter)
+			if size == 0 || size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+				return opts, fmt.Errorf("invalid CSV delimiter %q, it needs to be a single character", delimiter)
+			}
+			opts.delimiter = r
+		case "skipEmptyLines":
+			opts.skipEmptyLines = v.ToBoolean()
+		case "typed":
+			opts.typed = v.ToBoolean()
+		default:
+			return opts, fmt.Errorf("unknown csv.parse option: '%s'", k)
+		}
+	}
+	return opts, nil
+}
+
+// readCSV reads all the records of the data. The csv package always skips
+// empty lines, so they are found between the records when they are needed.
+func readCSV(data string, opts csvOptions) ([][]string, error) {
+	data = strings.TrimPrefix(data, "\ufeff") // the byte order mark of UTF-8
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comma = opts.delimiter
+	r.FieldsPerRecord = -1
+
+	var records [][]string
+	var offset int64
+	addEmptyLines := func(end int64) {
+		if opts.skipEmptyLines {
+			return
+		}
+		skipped := data[offset:end]
+		for {
+			switch {
+			case strings.HasPrefix(skipped, "\n"):
+				skipped = skipped[1:]
+			case strings.HasPrefix(skipped, "\r\n"):
+				skipped = skipped[2:]
+			default:
+				return
+			}
+			records = append(records, []string{""})
+		}
+	}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			addEmptyLines(int64(len(data)))
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse the CSV data: %w", err)
+		}
+		addEmptyLines(r.InputOffset())
+		offset = r.InputOffset()
+		records = append(records, record)
+	}
+}
+
+// value returns the value of a field, which is converted with the typed option.
+func (a *csvArray) value(field string) interface{} {
+	if !a.typed {
+		return field
+	}
+	switch field {
+	case "":
+		return nil
+	case "true", "TRUE":
+		return true
+	case "false", "FALSE":
+		return false
+	}
+	if floatRE.MatchString(field) {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+			return f
+		}
+	}
+	return field
+}
+
+// Get returns the record as an object if there is a header, or as an array.
+// It's frozen, as it's created again every time it's accessed.
+func (a *csvArray) Get(index int) goja.Value {
+	if index < 0 || index >= len(a.records) {
+		return goja.Undefined()
+	}
+	record := a.records[index]
+	var obj *goja.Object
+	if a.header != nil {
+		obj = a.rt.NewObject()
+		for i, field := range record {
+			_ = obj.Set(a.header[i], a.value(field))
+		}
+	} else {
+		values := make([]interface{}, len(record))
+		for i, field := range record {
+			values[i] = a.value(field)
+		}
+		obj = a.rt.NewArray(values...)
+	}
+	if _, err := a.freeze(goja.Undefined(), obj); err != nil {
+		common.Throw(a.rt, err)
+	}
+	return obj
+}
+
+// Set is not supported, as the array is read-only.
+func (a *csvArray) Set(int, goja.Value) bool {
+	panic(a.rt.NewTypeError("the array returned by csv.parse is immutable"))
+}
+
+// SetLen is not supported, as the array is read-only.
+func (a *csvArray) SetLen(int) bool {
+	panic(a.rt.NewTypeError("the array returned by csv.parse is immutable"))
+}
+
+// Len returns the number of records.
+func (a *csvArray) Len() int {
+	return len(a.records)
+}
+
+// marshalJSON returns the records as JSON, which is what a SharedArray keeps.
+// Objects are written by hand, so their fields are in the order of the header.
+func (a *csvArray) marshalJSON() ([]string, error) {
+	rows := make([]string, len(a.records))
+	var buf bytes.Buffer
+	for i, record := range a.records {
+		buf.Reset()
+		start, end := byte('['), byte(']')
+		if a.header != nil {
+			start, end = '{', '}'
+		}
+		buf.WriteByte(start)
+		for j, field := range record {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			if a.header != nil {
+				key, err := json.Marshal(a.header[j])
+				if err != nil {
+					return nil, err
+				}
+				buf.Write(key)
+				buf.WriteByte(':')
+			}
+			value, err := json.Marshal(a.value(field))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(value)
+		}
+		buf.WriteByte(end)
+		rows[i] = buf.String()
+	}
+	return rows, nil
+}
@@ -0,0 +1,136 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package data
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVParse(t *testing.T) {
+	t.Parallel()
+	rt, err := newConfiguredRuntime()
+	require.NoError(t, err)
+	require.NoError(t, rt.Set("CSV", "name,age,active\r\nalice,30,true\n\n\"bob, jr\",,FALSE\n"))
+
+	testCases := []struct {
+		options, expected string
+	}{
+		{`{}`, `[["name","age","active"],["alice","30","true"],[""],["bob, jr","","FALSE"]]`},
+		{`{skipEmptyLines: true}`, `[["name","age","active"],["alice","30","true"],["bob, jr","","FALSE"]]`},
+		{`{header: true, skipEmptyLines: true}`, `[{"name":"alice","age":"30","active":"true"},{"name":"bob, jr","age":"","active":"FALSE"}]`},
+		{`{header: true, skipEmptyLines: true, typed: true}`, `[{"name":"alice","age":30,"active":true},{"name":"bob, jr","age":null,"active":false}]`},
+		{`{header: true}`, `[{"name":"alice","age":"30","active":"true"},{"name":""},{"name":"bob, jr","age":"","active":"FALSE"}]`},
+	}
+	for _, tc := range testCases {
+		v, err := rt.RunString(`JSON.stringify(data.csv.parse(CSV, ` + tc.options + `))`)
+		require.NoError(t, err, tc.options)
+		assert.Equal(t, tc.expected, v.String(), tc.options)
+	}
+
+	v, err := rt.RunString(`
+		var records = data.csv.parse(new Uint8Array([0xEF, 0xBB, 0xBF, 0x61, 0x3B, 0x2D, 0x31, 0x2E, 0x35, 0x65, 0x32]).buffer,
+			{delimiter: ";", typed: true});
+		JSON.stringify(records) + " " + Array.isArray(records) + " " + Object.isFrozen(records[0]);
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, `[["a",-150]] true true`, v.String())
+
+	_, err = rt.RunString(`data.csv.parse(CSV).push([])`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TypeError: the array returned by csv.parse is immutable")
+}
+
+func TestCSVParseErrors(t *testing.T) {
+	t.Parallel()
+	rt, err := newConfiguredRuntime()
+	require.NoError(t, err)
+
+	testCases := map[string]string{
+		`data.csv.parse(null)`:                         "csv.parse needs a string or an ArrayBuffer",
+		`data.csv.parse("a", {nope: true})`:            "unknown csv.parse option: 'nope'",
+		`data.csv.parse("a", {delimiter: ";;"})`:       `invalid CSV delimiter ";;"`,
+		`data.csv.parse("a,\"b\n")`:                    `extraneous or missing " in quoted-field`,
+		`data.csv.parse("a,b\n1,2,3", {header: true})`: "CSV record 1 has 3 fields, but the header only has 2",
+	}
+	for script, expected := range testCases {
+		_, err := rt.RunString(script)
+		require.Error(t, err, script)
+		assert.Contains(t, err.Error(), expected, script)
+	}
+}
+
+func TestCSVSharedArray(t *testing.T) {
+	t.Parallel()
+	var csvData strings.Builder
+	csvData.WriteString("id,user\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&csvData, "%d,\"user %d\"\n", i, i)
+	}
+
+	rt, err := newConfiguredRuntime()
+	require.NoError(t, err)
+	require.NoError(t, rt.Set("CSV", csvData.String()))
+	_, err = rt.RunString(`
+		var calls = 0;
+		var users = new SharedArray("users", function() {
+			calls++;
+			return data.csv.parse(CSV, {header: true, typed: true});
+		});
+		if (users.length !== 1000) { throw new Error("wrong length " + users.length); }
+		if (users[999].id !== 999 || users[999].user !== "user 999") {
+			throw new Error("wrong record " + JSON.stringify(users[999]));
+		}
+		if (Object.keys(users[0]).join() !== "id,user") { throw new Error("wrong order of the fields"); }
+	`)
+	require.NoError(t, err)
+
+	// the records are kept as JSON, without a JS array in between
+	records, err := rt.RunString(`data.csv.parse(CSV, {header: true, typed: true})`)
+	require.NoError(t, err)
+	arr, ok := records.Export().(*csvArray)
+	require.True(t, ok)
+	rows, err := arr.marshalJSON()
+	require.NoError(t, err)
+	require.Len(t, rows, 1000)
+	assert.Equal(t, `{"id":0,"user":"user 0"}`, rows[0])
+
+	v, err := rt.RunString(`
+		var again = new SharedArray("users", function() { calls++; return []; });
+		calls + " " + again.length;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "1 1000", v.String())
+
+	// the records can be changed in the callback, the result is then a normal JS array
+	v, err = rt.RunString(`
+		var filtered = new SharedArray("filtered", function() {
+			return data.csv.parse(CSV, {header: true}).filter(function(r) { return r.id.length === 1; });
+		});
+		filtered.length;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), v.Export())
+}
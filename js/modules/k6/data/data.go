@@ -34,13 +34,15 @@ type (
 	// RootModule is the global module instance that will create module
 	// instances for each VU.
 	RootModule struct {
-		shared sharedArrays
+		shared  sharedArrays
+		sources dataSources
 	}
 
 	// Data represents an instance of the data module.
 	Data struct {
-		vu     modules.VU
-		shared *sharedArrays
+		vu      modules.VU
+		shared  *sharedArrays
+		sources *dataSources
 	}
 
 	sharedArrays struct {
@@ -60,6 +62,9 @@ func New() *RootModule {
 		shared: sharedArrays{
 			data: make(map[string]sharedArray),
 		},
+		sources: dataSources{
+			data: make(map[string]*dataSource),
+		},
 	}
 }
 
@@ -67,8 +72,9 @@ func New() *RootModule {
 // a new instance for each VU.
 func (rm *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
 	return &Data{
-		vu:     vu,
-		shared: &rm.shared,
+		vu:      vu,
+		shared:  &rm.shared,
+		sources: &rm.sources,
 	}
 }
 
@@ -77,6 +83,10 @@ func (d *Data) Exports() modules.Exports {
 	return modules.Exports{
 		Named: map[string]interface{}{
 			"SharedArray": d.sharedArray,
+			"DataSource":  d.newDataSource,
+			"csv": map[string]interface{}{
+				"parse": d.parseCSV,
+			},
 		},
 	}
 }
@@ -126,6 +136,14 @@ func getShareArrayFromCall(rt *goja.Runtime, call goja.Callable) sharedArray {
 	if err != nil {
 		common.Throw(rt, err)
 	}
+	// the records of csv.parse are made into JSON directly
+	if records, ok := gojaValue.Export().(*csvArray); ok {
+		arr, err := records.marshalJSON() //nolint:govet // we shadow err on purpose
+		if err != nil {
+			common.Throw(rt, err)
+		}
+		return sharedArray{arr: arr}
+	}
 	obj := gojaValue.ToObject(rt)
 	if obj.ClassName() != "Array" {
 		common.Throw(rt, errors.New("only arrays can be made into SharedArray")) // TODO better error
@@ -0,0 +1,234 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib"
+)
+
+// The modes of a DataSource, which decide the rows that are returned by next().
+const (
+	// modeSequential makes every VU go through all the rows in order.
+	modeSequential = "sequential"
+	// modeUnique gives every row to only one VU, across all the VUs of all
+	// the instances, as each instance only gets the rows of its execution
+	// segment.
+	modeUnique = "unique"
+	// modeRandom returns random rows, so the data is never exhausted.
+	modeRandom = "random"
+)
+
+// What a DataSource does when its rows are exhausted.
+const (
+	// exhaustedStop stops the test, like exec.test.abort().
+	exhaustedStop = "stop"
+	// exhaustedWrap starts again from the first row.
+	exhaustedWrap = "wrap"
+	// exhaustedFail throws an error, which fails the iteration.
+	exhaustedFail = "fail"
+)
+
+type (
+	dataSources struct {
+		data map[string]*dataSource
+		mu   sync.Mutex
+	}
+
+	// dataSource is the state of a DataSource that is shared by all the VUs.
+	dataSource struct {
+		mode, onExhausted string
+		// index is for the unique mode, it's created with the first row, as
+		// the execution segment isn't known in the init context
+		index *lib.SegmentedIndex
+		mu    sync.Mutex
+	}
+
+	// DataSource returns the rows of an array, like a SharedArray, in the
+	// order of its mode.
+	DataSource struct {
+		d      *Data
+		name   string
+		shared *dataSource
+		data   *goja.Object
+		length int64
+		// next is the index of the next row of the VU in the sequential mode
+		next int64
+		rand goja.RandSource
+	}
+)
+
+// newDataSource is the constructor of DataSource, which takes a name that is
+// shared by the VUs, an array and the options with the mode and what happens
+// when the rows are exhausted, e.g.
+// new DataSource("users", users, {mode: "unique", onExhausted: "stop"})
+func (d *Data) newDataSource(call goja.ConstructorCall) *goja.Object {
+	rt := d.vu.Runtime()
+
+	name := call.Argument(0).String()
+	if name == "" {
+		common.Throw(rt, errors.New("empty name provided to DataSource's constructor"))
+	}
+	dataV := call.Argument(1)
+	if common.ExportOrNil(dataV) == nil {
+		common.Throw(rt, errors.New("an array is expected as the second argument of DataSource's constructor"))
+	}
+	data := dataV.ToObject(rt)
+	if data.ClassName() != "Array" {
+		common.Throw(rt, errors.New("an array is expected as the second argument of DataSource's constructor"))
+	}
+	mode, onExhausted, err := parseDataSourceOptions(rt, call.Argument(2))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	shared, err := d.sources.get(name, mode, onExhausted)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	ds := &DataSource{
+		d:      d,
+		name:   name,
+		shared: shared,
+		data:   data,
+		length: data.Get("length").ToInteger(),
+		rand:   common.NewRandSource(),
+	}
+	return rt.ToValue(ds).ToObject(rt)
+}
+
+func parseDataSourceOptions(rt *goja.Runtime, optionsV goja.Value) (mode, onExhausted string, err error) {
+	mode = modeSequential
+	if common.ExportOrNil(optionsV) != nil {
+		params := optionsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			v := params.Get(k).String()
+			switch k {
+			case "mode":
+				if v != modeSequential && v != modeUnique && v != modeRandom {
+					return "", "", fmt.Errorf("invalid DataSource mode '%s', it needs to be one of %s, %s or %s",
+						v, modeSequential, modeUnique, modeRandom)
+				}
+				mode = v
+			case "onExhausted":
+				if v != exhaustedStop && v != exhaustedWrap && v != exhaustedFail {
+					return "", "", fmt.Errorf("invalid DataSource onExhausted '%s', it needs to be one of %s, %s or %s",
+						v, exhaustedStop, exhaustedWrap, exhaustedFail)
+				}
+				onExhausted = v
+			default:
+				return "", "", fmt.Errorf("unknown DataSource option: '%s'", k)
+			}
+		}
+	}
+	if mode == modeUnique && onExhausted == exhaustedWrap {
+		// reusing the rows would defeat its purpose
+		return "", "", fmt.Errorf("the DataSource onExhausted '%s' can't be used with the mode '%s'",
+			exhaustedWrap, modeUnique)
+	}
+	if onExhausted == "" {
+		onExhausted = exhaustedWrap
+		if mode == modeUnique {
+			onExhausted = exhaustedFail
+		}
+	}
+	return mode, onExhausted, nil
+}
+
+// get returns the shared state of the data source with the name, which needs
+// to have the same options in all the VUs.
+func (s *dataSources) get(name, mode, onExhausted string) (*dataSource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, ok := s.data[name]
+	if !ok {
+		ds = &dataSource{mode: mode, onExhausted: onExhausted}
+		s.data[name] = ds
+	}
+	if ds.mode != mode || ds.onExhausted != onExhausted {
+		return nil, fmt.Errorf("the DataSource '%s' was already created with different options", name)
+	}
+	return ds, nil
+}
+
+// nextUnique returns the global index of the next row of this instance, which
+// is based on the execution segment and its sequence.
+func (ds *dataSource) nextUnique(state *lib.State) (int64, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.index == nil {
+		et, err := lib.NewExecutionTuple(state.Options.ExecutionSegment, state.Options.ExecutionSegmentSequence)
+		if err != nil {
+			return 0, err
+		}
+		ds.index = lib.NewSegmentedIndex(et)
+	}
+	_, unscaled := ds.index.Next()
+	return unscaled - 1, nil
+}
+
+// Next returns the next row, according to the mode of the data source.
+func (s *DataSource) Next() (goja.Value, error) {
+	state := s.d.vu.State()
+	if state == nil {
+		return nil, errors.New("getting rows from a DataSource in the init context is not supported")
+	}
+	if s.length == 0 {
+		return nil, fmt.Errorf("the DataSource '%s' has no rows", s.name)
+	}
+
+	var i int64
+	switch s.shared.mode {
+	case modeRandom:
+		i = int64(s.rand() * float64(s.length))
+	case modeUnique:
+		var err error
+		if i, err = s.shared.nextUnique(state); err != nil {
+			return nil, err
+		}
+	default:
+		i = s.next
+		s.next++
+	}
+
+	if i >= s.length {
+		switch s.shared.onExhausted {
+		case exhaustedWrap:
+			i %= s.length
+		case exhaustedStop:
+			rt := s.d.vu.Runtime()
+			rt.Interrupt(&common.InterruptError{
+				Reason: fmt.Sprintf("%s: the rows of the DataSource '%s' were exhausted", common.AbortTest, s.name),
+			})
+			return goja.Undefined(), nil
+		default:
+			return nil, fmt.Errorf("the rows of the DataSource '%s' were exhausted", s.name)
+		}
+	}
+	return s.data.Get(strconv.FormatInt(i, 10)), nil
+}
@@ -0,0 +1,190 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package data
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+)
+
+const makeUsersScript = `
+var users = new data.SharedArray("users", function() {
+	var arr = [];
+	for (var i = 0; i < 10; i++) { arr.push("user" + i); }
+	return arr;
+});
+`
+
+// newDataSourceVU returns the runtime of a VU of the instance with the root
+// module. The VU is in the init context until its state is set.
+func newDataSourceVU(t testing.TB, rm *RootModule) (*goja.Runtime, *modulestest.VU) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	vu := &modulestest.VU{
+		RuntimeField: rt,
+		InitEnvField: &common.InitEnvironment{},
+		CtxField:     context.Background(),
+	}
+	require.NoError(t, rt.Set("data", rm.NewModuleInstance(vu).Exports().Named))
+	return rt, vu
+}
+
+func segmentState(t testing.TB, segment, sequence string) *lib.State {
+	var (
+		es  lib.ExecutionSegment
+		ess lib.ExecutionSegmentSequence
+	)
+	require.NoError(t, es.UnmarshalText([]byte(segment)))
+	require.NoError(t, ess.UnmarshalText([]byte(sequence)))
+	return &lib.State{Options: lib.Options{ExecutionSegment: &es, ExecutionSegmentSequence: &ess}}
+}
+
+func TestDataSourceUnique(t *testing.T) {
+	t.Parallel()
+	sequence := "0,1/3,1"
+	var rows []string
+	for _, segment := range []string{"0:1/3", "1/3:1"} {
+		rm := New()
+		state := segmentState(t, segment, sequence)
+		var instanceRows []string
+		// two VUs of the same instance share the rows of its segment
+		for vuID := 0; vuID < 2; vuID++ {
+			rt, vu := newDataSourceVU(t, rm)
+			_, err := rt.RunString(makeUsersScript + `
+				var source = new data.DataSource("users", users, {mode: "unique"});
+			`)
+			require.NoError(t, err)
+			vu.StateField = state
+
+			for {
+				v, err := rt.RunString(`source.next()`)
+				if err != nil {
+					assert.Contains(t, err.Error(), "the rows of the DataSource 'users' were exhausted")
+					break
+				}
+				instanceRows = append(instanceRows, v.String())
+			}
+		}
+		if segment == "0:1/3" {
+			assert.Equal(t, []string{"user1", "user4", "user7"}, instanceRows)
+		}
+		rows = append(rows, instanceRows...)
+	}
+
+	// every row was used exactly once across all the instances
+	sort.Strings(rows)
+	assert.Equal(t, []string{
+		"user0", "user1", "user2", "user3", "user4", "user5", "user6", "user7", "user8", "user9",
+	}, rows)
+}
+
+func TestDataSourceModes(t *testing.T) {
+	t.Parallel()
+	rm := New()
+	rt, vu := newDataSourceVU(t, rm)
+	_, err := rt.RunString(makeUsersScript + `
+		var sequential = new data.DataSource("sequential", users);
+		var random = new data.DataSource("random", users, {mode: "random", onExhausted: "fail"});
+		var unique = new data.DataSource("unique", users, {mode: "unique"});
+		var fail = new data.DataSource("fail", users, {onExhausted: "fail"});
+		var stop = new data.DataSource("stop", ["a"], {onExhausted: "stop"});
+	`)
+	require.NoError(t, err)
+
+	_, err = rt.RunString(`sequential.next()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "getting rows from a DataSource in the init context is not supported")
+
+	vu.StateField = &lib.State{}
+	_, err = rt.RunString(`
+		for (var i = 0; i < 25; i++) {
+			var row = sequential.next();
+			if (row !== "user" + (i % 10)) { throw new Error("wrong sequential row " + row + " at " + i); }
+			if (i < 10 && (row = unique.next()) !== "user" + i) {
+				throw new Error("wrong unique row " + row + " at " + i);
+			}
+			if (users.indexOf(random.next()) < 0) { throw new Error("wrong random row"); }
+		}
+		for (var i = 0; i < 10; i++) { fail.next(); }
+	`)
+	require.NoError(t, err)
+
+	// every VU goes through the rows in the sequential mode
+	rt2, vu2 := newDataSourceVU(t, rm)
+	_, err = rt2.RunString(makeUsersScript + `var sequential = new data.DataSource("sequential", users);`)
+	require.NoError(t, err)
+	vu2.StateField = &lib.State{}
+	v, err := rt2.RunString(`sequential.next()`)
+	require.NoError(t, err)
+	assert.Equal(t, "user0", v.String())
+
+	_, err = rt.RunString(`fail.next()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the rows of the DataSource 'fail' were exhausted")
+
+	// the unique mode fails by default, so the rows aren't reused
+	_, err = rt.RunString(`unique.next()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the rows of the DataSource 'unique' were exhausted")
+
+	_, err = rt.RunString(`
+		stop.next();
+		stop.next();
+		throw new Error("the test wasn't stopped");
+	`)
+	require.Error(t, err)
+	var interruptErr *goja.InterruptedError
+	require.ErrorAs(t, err, &interruptErr)
+	assert.Contains(t, interruptErr.Value().(*common.InterruptError).Reason,
+		"test aborted: the rows of the DataSource 'stop' were exhausted")
+}
+
+func TestDataSourceConstructorExceptions(t *testing.T) {
+	t.Parallel()
+	rt, err := newConfiguredRuntime()
+	require.NoError(t, err)
+	_, err = rt.RunString(`var source = new data.DataSource("source", [1, 2]);`)
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		`new data.DataSource("", [])`:                                         "empty name provided to DataSource's constructor",
+		`new data.DataSource("a", "nope")`:                                    "an array is expected as the second argument",
+		`new data.DataSource("a", [], {mode: "nope"})`:                        "invalid DataSource mode 'nope'",
+		`new data.DataSource("a", [], {onExhausted: "nope"})`:                 "invalid DataSource onExhausted 'nope'",
+		`new data.DataSource("a", [], {nope: 1})`:                             "unknown DataSource option: 'nope'",
+		`new data.DataSource("a", [], {mode: "unique", onExhausted: "wrap"})`: "the DataSource onExhausted 'wrap' can't be used with the mode 'unique'",
+		`new data.DataSource("source", [1, 2], {mode: "random"})`:             "the DataSource 'source' was already created with different options",
+	}
+	for script, expected := range cases {
+		_, err := rt.RunString(script)
+		require.Error(t, err, script)
+		assert.Contains(t, err.Error(), expected, script)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package dns implements the k6/net/dns module, which sends DNS queries to a
+// specific server in order to load test it.
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/netext/dnsext"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// ModuleInstance represents an instance of the DNS module for a VU.
+	ModuleInstance struct {
+		vu modules.VU
+		// clients are reused for the same server, so DNS-over-HTTPS
+		// connections can be kept alive
+		clients map[dnsext.Server]*dnsext.Client
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+// ErrDNSInInitContext is returned when DNS queries are sent in the init context.
+var ErrDNSInInitContext = common.NewInitContextError("sending DNS queries in the init context is not supported")
+
+//nolint:gochecknoglobals
+var queryTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"TXT":   dnsmessage.TypeTXT,
+	"SRV":   dnsmessage.TypeSRV,
+	"MX":    dnsmessage.TypeMX,
+}
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu, clients: make(map[dnsext.Server]*dnsext.Client)}
+}
+
+// Exports returns the exports of the dns module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"query": mi.Query,
+		},
+	}
+}
+
+// Response is the result of a DNS query.
+type Response struct {
+	Name   string
+	Type   string
+	Server string
+	// RCode is the response code, e.g. NOERROR or NXDOMAIN, and is empty if
+	// no response was received.
+	RCode         string `js:"rcode"`
+	Authoritative bool
+	Truncated     bool
+	Answers       []Answer
+	// Duration is the query time in milliseconds.
+	Duration float64
+	Error    string
+}
+
+// Answer is a resource record from the answer section of a response. Data
+// is the record data in the presentation format, the other fields are only
+// set for the record types they apply to.
+type Answer struct {
+	Name string
+	Type string
+	TTL  uint32
+	Data string
+
+	Address    string
+	Target     string
+	Texts      []string
+	Priority   uint16
+	Weight     uint16
+	Port       uint16
+	Preference uint16
+}
+
+// Query sends a query for the name and record type to the server from the
+// params, which is required. Failed queries don't throw, the error is in the
+// response instead.
+//
+//nolint:funlen,cyclop
+func (mi *ModuleInstance) Query(name, qtypeName string, paramsV goja.Value) (*Response, error) {
+	ctx := mi.vu.Context()
+	rt := mi.vu.Runtime()
+	state := mi.vu.State()
+	if state == nil {
+		return nil, ErrDNSInInitContext
+	}
+
+	qtypeName = strings.ToUpper(qtypeName)
+	qtype, ok := queryTypes[qtypeName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported DNS record type '%s'", qtypeName)
+	}
+	question, err := dnsext.NewQuestion(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := state.CloneTags()
+	timeout := dnsext.DefaultTimeout
+	var server dnsext.Server
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			switch k {
+			case "server":
+				if server, err = dnsext.ParseServer(params.Get(k).String()); err != nil {
+					return nil, err
+				}
+			case "timeout":
+				if timeout, err = types.GetDurationValue(params.Get(k).Export()); err != nil {
+					return nil, fmt.Errorf("invalid timeout value: %w", err)
+				}
+			case "tags":
+				tagsV := params.Get(k)
+				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+					continue
+				}
+				tagObj := tagsV.ToObject(rt)
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			default:
+				return nil, fmt.Errorf("unknown DNS query param: '%s'", k)
+			}
+		}
+	}
+	if server.Address == "" {
+		return nil, errors.New("the server param is required for DNS queries")
+	}
+
+	client, ok := mi.clients[server]
+	if !ok {
+		client = dnsext.NewClient([]dnsext.Server{server}, state.TLSConfig)
+		client.Dialer = state.Dialer
+		mi.clients[server] = client
+	}
+	client.Timeout = timeout
+
+	start := time.Now()
+	msg, err := client.Exchange(ctx, server, question)
+	duration := time.Since(start)
+
+	response := &Response{
+		Name:     name,
+		Type:     qtypeName,
+		Server:   server.String(),
+		Duration: stats.D(duration),
+	}
+	failed := true
+	if err != nil {
+		response.Error = err.Error()
+	} else {
+		response.RCode = dnsext.RCodeName(msg.RCode)
+		response.Authoritative = msg.Authoritative
+		response.Truncated = msg.Truncated
+		response.Answers = make([]Answer, 0, len(msg.Answers))
+		for _, r := range msg.Answers {
+			response.Answers = append(response.Answers, newAnswer(r))
+		}
+		failed = msg.RCode != dnsmessage.RCodeSuccess && msg.RCode != dnsmessage.RCodeNameError
+	}
+
+	tags["type"] = qtypeName
+	tags["server"] = response.Server
+	if response.RCode != "" {
+		tags["rcode"] = response.RCode
+	}
+	sampleTags := stats.IntoSampleTags(&tags)
+	failedValue := 0.0
+	if failed {
+		failedValue = 1
+	}
+	stats.PushIfNotDone(ctx, state.Samples, stats.ConnectedSamples{
+		Samples: []stats.Sample{
+			{Metric: state.BuiltinMetrics.DNSQueries, Time: start, Tags: sampleTags, Value: 1},
+			{Metric: state.BuiltinMetrics.DNSQueryDuration, Time: start, Tags: sampleTags, Value: stats.D(duration)},
+			{Metric: state.BuiltinMetrics.DNSFailed, Time: start, Tags: sampleTags, Value: failedValue},
+		},
+		Tags: sampleTags,
+		Time: start,
+	})
+
+	return response, nil
+}
+
+func newAnswer(r dnsmessage.Resource) Answer {
+	a := Answer{
+		Name: r.Header.Name.String(),
+		Type: strings.TrimPrefix(r.Header.Type.String(), "Type"),
+		TTL:  r.Header.TTL,
+	}
+	switch body := r.Body.(type) {
+	case *dnsmessage.AResource:
+		a.Address = net.IP(body.A[:]).String()
+		a.Data = a.Address
+	case *dnsmessage.AAAAResource:
+		a.Address = net.IP(body.AAAA[:]).String()
+		a.Data = a.Address
+	case *dnsmessage.CNAMEResource:
+		a.Target = body.CNAME.String()
+		a.Data = a.Target
+	case *dnsmessage.TXTResource:
+		a.Texts = body.TXT
+		a.Data = strings.Join(body.TXT, "")
+	case *dnsmessage.SRVResource:
+		a.Priority, a.Weight, a.Port = body.Priority, body.Weight, body.Port
+		a.Target = body.Target.String()
+		a.Data = fmt.Sprintf("%d %d %d %s", body.Priority, body.Weight, body.Port, a.Target)
+	case *dnsmessage.MXResource:
+		a.Preference = body.Pref
+		a.Target = body.MX.String()
+		a.Data = strconv.Itoa(int(body.Pref)) + " " + a.Target
+	}
+	return a
+}
@@ -0,0 +1,211 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package dns
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext"
+	"go.k6.io/k6/lib/testutils/dnstest"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type testState struct {
+	rt      *goja.Runtime
+	state   *lib.State
+	dialer  *netext.Dialer
+	samples chan stats.SampleContainer
+}
+
+func newTestState(t testing.TB) testState {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+
+	samples := make(chan stats.SampleContainer, 1000)
+	dialer := netext.NewDialer(net.Dialer{}, netext.NewResolver(net.LookupIP, 0, types.DNSfirst, types.DNSpreferIPv4))
+	state := &lib.State{
+		Dialer:         dialer,
+		Samples:        samples,
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+		Tags:           lib.NewTagMap(nil),
+	}
+
+	m := New().NewModuleInstance(&modulestest.VU{
+		CtxField:     context.Background(),
+		InitEnvField: &common.InitEnvironment{},
+		RuntimeField: rt,
+		StateField:   state,
+	})
+	require.NoError(t, rt.Set("dns", m.Exports().Named))
+
+	return testState{
+		rt:      rt,
+		state:   state,
+		dialer:  dialer,
+		samples: samples,
+	}
+}
+
+func newDNSServer(t testing.TB) *dnstest.Server {
+	s := dnstest.NewServer(t)
+	s.AddIP("k6.test", net.ParseIP("10.0.0.1"))
+	s.AddIP("k6.test", net.ParseIP("fd00::1"))
+	s.AddRecord("www.k6.test", dnsmessage.TypeCNAME,
+		&dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("k6.test.")})
+	s.AddRecord("k6.test", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}})
+	s.AddRecord("_sip._udp.k6.test", dnsmessage.TypeSRV, &dnsmessage.SRVResource{
+		Priority: 10, Weight: 20, Port: 5060, Target: dnsmessage.MustNewName("sip.k6.test."),
+	})
+	s.AddRecord("k6.test", dnsmessage.TypeMX, &dnsmessage.MXResource{
+		Pref: 10, MX: dnsmessage.MustNewName("mail.k6.test."),
+	})
+	return s
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	dns := newDNSServer(t)
+	doh := httptest.NewTLSServer(dns)
+	t.Cleanup(doh.Close)
+
+	servers := map[string]string{
+		"udp":   "udp://" + dns.Addr,
+		"tcp":   "tcp://" + dns.Addr,
+		"https": doh.URL + "/dns-query",
+	}
+	for name, server := range servers {
+		server := server
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ts := newTestState(t)
+			ts.state.TLSConfig = doh.Client().Transport.(*http.Transport).TLSClientConfig
+			require.NoError(t, ts.rt.Set("SERVER", server))
+
+			_, err := ts.rt.RunString(`
+			function check(name, type, expected) {
+				var res = dns.query(name, type, {server: SERVER, tags: {tag: "value"}});
+				if (res.error) { throw new Error(res.error); }
+				if (res.rcode !== "NOERROR") { throw new Error("wrong rcode: " + res.rcode); }
+				var data = res.answers.map(function(a) { return a.data; }).sort().join(", ");
+				if (data !== expected) { throw new Error(type + ": wrong answers: " + data); }
+				return res;
+			}
+			check("k6.test", "A", "10.0.0.1");
+			check("k6.test", "aaaa", "fd00::1");
+			check("www.k6.test", "CNAME", "k6.test.");
+			check("k6.test", "TXT", "v=spf1 -all");
+			var srv = check("_sip._udp.k6.test", "SRV", "10 20 5060 sip.k6.test.");
+			if (srv.answers[0].port !== 5060) { throw new Error("wrong port: " + srv.answers[0].port); }
+			var mx = check("k6.test", "MX", "10 mail.k6.test.");
+			if (mx.answers[0].ttl !== 60) { throw new Error("wrong ttl: " + mx.answers[0].ttl); }
+
+			var res = dns.query("missing.k6.test", "A", {server: SERVER});
+			if (res.rcode !== "NXDOMAIN" || res.answers.length !== 0) {
+				throw new Error("unexpected response: " + JSON.stringify(res));
+			}
+			`)
+			require.NoError(t, err)
+
+			var queries, failed int
+			for _, sc := range stats.GetBufferedSamples(ts.samples) {
+				for _, s := range sc.GetSamples() {
+					tags := s.Tags.CloneTags()
+					assert.Equal(t, server, tags["server"])
+					switch s.Metric.Name {
+					case metrics.DNSQueriesName:
+						queries++
+					case metrics.DNSFailedName:
+						failed += int(s.Value)
+					case metrics.DNSQueryDurationName:
+					default:
+						continue
+					}
+					if tags["type"] == "A" && tags["rcode"] == "NXDOMAIN" {
+						continue
+					}
+					assert.Equal(t, "value", tags["tag"])
+					assert.Equal(t, "NOERROR", tags["rcode"])
+				}
+			}
+			assert.Equal(t, 7, queries)
+			assert.Equal(t, 0, failed)
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	dns := newDNSServer(t)
+	require.NoError(t, ts.rt.Set("SERVER", dns.Addr))
+
+	testCases := []struct {
+		name, script, expErr string
+	}{
+		{"type", `dns.query("k6.test", "PTR", {server: SERVER})`, "unsupported DNS record type 'PTR'"},
+		{"no server", `dns.query("k6.test", "A")`, "the server param is required for DNS queries"},
+		{"server", `dns.query("k6.test", "A", {server: "quic://" + SERVER})`, "unsupported protocol 'quic'"},
+		{"param", `dns.query("k6.test", "A", {server: SERVER, nope: 1})`, "unknown DNS query param: 'nope'"},
+		{"name", `dns.query("a".repeat(300), "A", {server: SERVER})`, "invalid DNS name"},
+	}
+	for _, tc := range testCases {
+		_, err := ts.rt.RunString(tc.script)
+		require.Error(t, err, tc.name)
+		assert.Contains(t, err.Error(), tc.expErr, tc.name)
+	}
+
+	// the dialer of the VU is used for the queries
+	_, blocked, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	ts.dialer.Blacklist = []*lib.IPNet{{IPNet: *blocked}}
+	v, err := ts.rt.RunString(`dns.query("k6.test", "A", {server: SERVER, timeout: "1s"})`)
+	require.NoError(t, err)
+	res, ok := v.Export().(*Response)
+	require.True(t, ok)
+	assert.Contains(t, res.Error, "is in a blacklisted range")
+	assert.Empty(t, res.RCode)
+
+	var failed float64
+	for _, sc := range stats.GetBufferedSamples(ts.samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name == metrics.DNSFailedName {
+				failed += s.Value
+				_, hasRCode := s.Tags.Get("rcode")
+				assert.False(t, hasRCode)
+			}
+		}
+	}
+	assert.Equal(t, 1.0, failed)
+}
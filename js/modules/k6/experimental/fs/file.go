@@ -0,0 +1,188 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/spf13/afero"
+)
+
+// File is a file opened for reading. Its reads are buffered, so that read()
+// and readLine() can be mixed.
+type File struct {
+	Path string `js:"path"`
+
+	rt     *goja.Runtime
+	file   afero.File
+	reader *bufio.Reader
+	closed bool
+}
+
+func newFile(rt *goja.Runtime, path string, f afero.File) *File {
+	return &File{Path: path, rt: rt, file: f, reader: bufio.NewReader(f)}
+}
+
+func (f *File) check() error {
+	if f.closed {
+		return fmt.Errorf("the file %q is closed", f.Path)
+	}
+	return nil
+}
+
+// Stat returns the information of the file.
+func (f *File) Stat() (*FileInfo, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(f.Path, info), nil
+}
+
+// Read reads up to the length of the given ArrayBuffer or typed array into it
+// and returns the number of bytes read, or null at the end of the file.
+func (f *File) Read(buffer goja.Value) (goja.Value, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	p, err := bufferBytes(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return f.rt.ToValue(0), nil
+	}
+	n, err := f.reader.Read(p)
+	if isEOF(err) {
+		return goja.Null(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.rt.ToValue(n), nil
+}
+
+// Seek sets the offset of the next read, relative to the start of the file,
+// the current offset or the end of the file depending on whence, which is
+// one of the SeekMode values. It returns the new offset.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	if whence < io.SeekStart || whence > io.SeekEnd {
+		return 0, fmt.Errorf("invalid seek mode %d", whence)
+	}
+	if whence == io.SeekCurrent {
+		// the file offset is ahead of the reads by what is buffered
+		offset -= int64(f.reader.Buffered())
+	}
+	pos, err := f.file.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	if pos < 0 {
+		return 0, errors.New("the offset can't be negative")
+	}
+	f.reader.Reset(f.file)
+	return pos, nil
+}
+
+// ReadLine returns the next line without its line ending, or null at the end
+// of the file.
+func (f *File) ReadLine() (goja.Value, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	line, err := f.reader.ReadString('\n')
+	if isEOF(err) {
+		if line == "" {
+			return goja.Null(), nil
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	return f.rt.ToValue(line), nil
+}
+
+// Lines returns an iterator over the remaining lines of the file, so that it
+// can be read with a for...of loop.
+func (f *File) Lines() *goja.Object {
+	it := f.rt.NewObject()
+	next := func() (map[string]interface{}, error) {
+		line, err := f.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if goja.IsNull(line) {
+			return map[string]interface{}{"done": true}, nil
+		}
+		return map[string]interface{}{"value": line, "done": false}, nil
+	}
+	_ = it.Set("next", next)
+	_ = it.SetSymbol(goja.SymIterator, func(goja.FunctionCall) goja.Value { return it })
+	return it
+}
+
+// Close closes the file, after which it can't be read anymore.
+func (f *File) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.file.Close()
+}
+
+// isEOF reports whether a read ended at the end of the file. Some afero
+// files return io.ErrUnexpectedEOF when they are read past their end.
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// bufferBytes returns the bytes of an ArrayBuffer or of the part of it that an
+// ArrayBuffer view covers, without copying them.
+func bufferBytes(v goja.Value) ([]byte, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, errors.New("an ArrayBuffer or a typed array to read into is required")
+	}
+	if ab, ok := v.Export().(goja.ArrayBuffer); ok {
+		return ab.Bytes(), nil
+	}
+	obj, ok := v.(*goja.Object)
+	if ok {
+		if buffer := obj.Get("buffer"); buffer != nil {
+			if ab, ok := buffer.Export().(goja.ArrayBuffer); ok {
+				offset := obj.Get("byteOffset").ToInteger()
+				length := obj.Get("byteLength").ToInteger()
+				return ab.Bytes()[offset : offset+length], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("expected an ArrayBuffer or a typed array, got %T", v.Export())
+}
@@ -0,0 +1,170 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package fs implements the k6/experimental/fs module, which reads files
+// without loading them into JS values at once, unlike open(). Files can be
+// read in chunks into an ArrayBuffer, line by line, and from any offset.
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/fsext"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// ModuleInstance represents an instance of the fs module for a VU.
+	ModuleInstance struct {
+		vu modules.VU
+		// initEnv is kept from the init context, so that files can still be
+		// opened and stat-ed in the VU context.
+		initEnv *common.InitEnvironment
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu, initEnv: vu.InitEnv()}
+}
+
+// SeekMode is the origin of the offset of File.seek().
+type SeekMode struct {
+	Start   int `js:"Start"`
+	Current int `js:"Current"`
+	End     int `js:"End"`
+}
+
+// Exports returns the exports of the fs module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"open":     mi.open,
+			"stat":     mi.stat,
+			"SeekMode": SeekMode{Start: 0, Current: 1, End: 2},
+		},
+	}
+}
+
+// FileInfo describes a file.
+type FileInfo struct {
+	Name        string `js:"name"`
+	Path        string `js:"path"`
+	Size        int64  `js:"size"`
+	IsDirectory bool   `js:"isDirectory"`
+	// ModifiedTime is in milliseconds since the Unix epoch, like Date.now().
+	ModifiedTime int64 `js:"modifiedTime"`
+}
+
+func newFileInfo(path string, info os.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:         info.Name(),
+		Path:         path,
+		Size:         info.Size(),
+		IsDirectory:  info.IsDir(),
+		ModifiedTime: info.ModTime().UnixNano() / 1e6,
+	}
+}
+
+// open opens a file for reading. Files have to be opened during the init
+// context first, as with open(), so that they are added to archives. Local
+// files are read straight from the disk, without copying them in memory; they
+// are only cached when an archive is made. Files in archives are already in
+// memory, and every VU reads them through its own File.
+func (mi *ModuleInstance) open(path string) (*File, error) {
+	fs, path, err := mi.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(path)
+	if err != nil {
+		return nil, wrapError(path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("fs.open() can't be used with directories, path: %q", path)
+	}
+	var f afero.File
+	if opener, ok := fs.(fsext.UncachedOpener); ok {
+		f, err = opener.OpenUncached(path)
+	} else {
+		f, err = fs.Open(path)
+	}
+	if err != nil {
+		return nil, wrapError(path, err)
+	}
+	return newFile(mi.vu.Runtime(), path, f), nil
+}
+
+// stat returns the information of a file without opening it.
+func (mi *ModuleInstance) stat(path string) (*FileInfo, error) {
+	fs, path, err := mi.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(path)
+	if err != nil {
+		return nil, wrapError(path, err)
+	}
+	return newFileInfo(path, info), nil
+}
+
+func (mi *ModuleInstance) resolve(path string) (afero.Fs, string, error) {
+	if mi.initEnv == nil {
+		return nil, "", errors.New("the fs module has to be imported in the init context")
+	}
+	if path == "" {
+		return nil, "", errors.New("a path is required")
+	}
+	fs, ok := mi.initEnv.FileSystems["file"]
+	if !ok {
+		return nil, "", errors.New("the local filesystem isn't available")
+	}
+	return fs, mi.initEnv.GetAbsFilePath(path), nil
+}
+
+func wrapError(path string, err error) error {
+	if errors.Is(err, fsext.ErrPathNeverRequestedBefore) {
+		return fmt.Errorf(
+			"fs.open() can't be used with files that weren't previously opened during initialization (__VU==0), path: %q",
+			path,
+		)
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib/fsext"
+)
+
+func makeRuntime(t *testing.T, fs afero.Fs) *goja.Runtime {
+	t.Helper()
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	m, ok := New().NewModuleInstance(&modulestest.VU{
+		RuntimeField: rt,
+		InitEnvField: &common.InitEnvironment{
+			FileSystems: map[string]afero.Fs{"file": fs},
+			CWD:         &url.URL{Scheme: "file", Path: "/data/"},
+		},
+		CtxField: context.Background(),
+	}).(*ModuleInstance)
+	require.True(t, ok)
+	require.NoError(t, rt.Set("fs", m.Exports().Named))
+	return rt
+}
+
+func newTestFs(t *testing.T) afero.Fs {
+	t.Helper()
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/data/lines.txt", []byte("first\r\nsecond\n\nlast"), 0o644))
+	require.NoError(t, fs.MkdirAll("/data/dir", 0o755))
+	return fs
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	rt := makeRuntime(t, newTestFs(t))
+
+	v, err := rt.RunString(`
+	var f = fs.open("lines.txt");
+	var buf = new Uint8Array(4);
+	var out = [];
+	var n;
+	while ((n = f.read(buf)) !== null) {
+		out.push(n + ":" + String.fromCharCode.apply(null, buf.subarray(0, n)));
+	}
+	out.join("|");`)
+	require.NoError(t, err)
+	assert.Equal(t, "4:firs|4:t\r\ns|4:econ|4:d\n\nl|3:ast", v.String())
+
+	v, err = rt.RunString(`
+	var ab = new ArrayBuffer(6);
+	f.seek(-4, fs.SeekMode.End);
+	[f.read(ab), String.fromCharCode.apply(null, new Uint8Array(ab, 0, 4)), f.read(ab)].join(" ");`)
+	require.NoError(t, err)
+	assert.Equal(t, "4 last ", v.String())
+}
+
+func TestLines(t *testing.T) {
+	t.Parallel()
+	rt := makeRuntime(t, newTestFs(t))
+
+	v, err := rt.RunString(`
+	var f = fs.open("/data/lines.txt");
+	var lines = [];
+	for (var line of f.lines()) {
+		lines.push(line);
+	}
+	JSON.stringify(lines);`)
+	require.NoError(t, err)
+	assert.Equal(t, `["first","second","","last"]`, v.String())
+
+	v, err = rt.RunString(`
+	f.seek(0, fs.SeekMode.Start);
+	var first = f.readLine();
+	var buf = new Uint8Array(3);
+	f.read(buf);
+	var pos = f.seek(0, fs.SeekMode.Current);
+	[first, String.fromCharCode.apply(null, buf), pos, f.readLine()].join(" ");`)
+	require.NoError(t, err)
+	assert.Equal(t, "first sec 10 ond", v.String())
+}
+
+func TestStat(t *testing.T) {
+	t.Parallel()
+	rt := makeRuntime(t, newTestFs(t))
+
+	v, err := rt.RunString(`
+	var info = fs.stat("lines.txt");
+	var dir = fs.stat("dir");
+	[info.name, info.path, info.size, info.isDirectory, dir.isDirectory, fs.open("lines.txt").stat().size].join(" ");`)
+	require.NoError(t, err)
+	assert.Equal(t, "lines.txt /data/lines.txt 19 false true 19", v.String())
+
+	_, err = rt.RunString(`fs.open("dir")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `fs.open() can't be used with directories, path: "/data/dir"`)
+
+	_, err = rt.RunString(`fs.stat("missing.txt")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file does not exist")
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+	rt := makeRuntime(t, newTestFs(t))
+
+	_, err := rt.RunString(`
+	var f = fs.open("lines.txt");
+	f.close();
+	f.readLine();`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `the file "/data/lines.txt" is closed`)
+}
+
+func TestOnlyCachedFiles(t *testing.T) {
+	t.Parallel()
+	fs := fsext.NewCacheOnReadFs(newTestFs(t), afero.NewMemMapFs(), time.Hour)
+	initRuntime := makeRuntime(t, fs)
+	_, err := initRuntime.RunString(`fs.open("lines.txt")`)
+	require.NoError(t, err)
+
+	fs.(fsext.OnlyCachedEnabler).AllowOnlyCached()
+
+	// another VU can open the files that were opened during the initialization
+	rt := makeRuntime(t, fs)
+	v, err := rt.RunString(`fs.open("lines.txt").readLine()`)
+	require.NoError(t, err)
+	assert.Equal(t, "first", v.String())
+
+	_, err = rt.RunString(`fs.open("other.txt")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fs.open() can't be used with files that weren't previously opened")
+}
+
+func TestStreamLargeFiles(t *testing.T) {
+	t.Parallel()
+	base := newTestFs(t)
+	// larger than the buffer of the bufio.Reader, so it's read in several chunks
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	require.NoError(t, afero.WriteFile(base, "/data/large.bin", data, 0o644))
+	cache := afero.NewMemMapFs()
+	rt := makeRuntime(t, fsext.NewCacheOnReadFs(base, cache, 0))
+
+	v, err := rt.RunString(`
+	var f = fs.open("large.bin");
+	var buf = new Uint8Array(100000);
+	var total = 0;
+	var n;
+	while ((n = f.read(buf)) !== null) {
+		total += n;
+	}
+	total;`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), v.ToInteger())
+
+	// the file is read from the base filesystem, without copying it in memory
+	_, err = cache.Stat("/data/large.bin")
+	assert.True(t, errors.Is(err, os.ErrNotExist), err)
+}
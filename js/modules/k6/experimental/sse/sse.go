@@ -0,0 +1,583 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package sse implements a Server-Sent Events (EventSource) client for k6.
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// SSE represents a module instance of the Server-Sent Events module.
+	SSE struct {
+		vu  modules.VU
+		obj *goja.Object
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &SSE{}
+)
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(m modules.VU) modules.Instance {
+	rt := m.Runtime()
+	mi := &SSE{
+		vu: m,
+	}
+	obj := rt.NewObject()
+	if err := obj.Set("open", mi.Open); err != nil {
+		common.Throw(rt, err)
+	}
+
+	mi.obj = obj
+	return mi
+}
+
+// Exports returns the exports of the sse module.
+func (mi *SSE) Exports() modules.Exports {
+	return modules.Exports{Default: mi.obj}
+}
+
+// ErrSSEInInitContext is returned when server-sent events are used in the init context
+var ErrSSEInInitContext = common.NewInitContextError("using server-sent events in the init context is not supported")
+
+const (
+	// defaultRetry is the reconnection delay used until the server sends a
+	// `retry` field, browsers use a value of a few seconds as well.
+	defaultRetry = 3 * time.Second
+
+	// maxLineSize limits the size of a single line of the event stream.
+	maxLineSize = 1024 * 1024
+)
+
+// Client is the EventSource connection that is passed to the sse.open()
+// setup function. It will (re)connect to the server until it's closed.
+type Client struct {
+	rt            *goja.Runtime
+	ctx           context.Context
+	cancel        context.CancelFunc
+	eventHandlers map[string][]goja.Callable
+	scheduled     chan goja.Callable
+	done          chan struct{}
+	shutdownOnce  sync.Once
+
+	url        string
+	header     http.Header
+	httpClient *http.Client
+	reconnect  bool
+	parser     *eventParser
+
+	connStart     time.Time
+	lastEventTime time.Time
+
+	sampleTags     *stats.SampleTags
+	samplesOutput  chan<- stats.SampleContainer
+	builtinMetrics *metrics.BuiltinMetrics
+	statusTag      bool
+}
+
+// Event is a single server-sent event, as dispatched to the "message" handlers.
+type Event struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  string `json:"data"`
+	// Retry is the reconnection time in milliseconds sent along with the
+	// event, or 0 if the event didn't have a `retry` field.
+	Retry int64 `json:"retry"`
+
+	received time.Time
+}
+
+// HTTPResponse is returned from sse.open() and describes the last
+// connection attempt that was made.
+type HTTPResponse struct {
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Error   string            `json:"error"`
+}
+
+// Open establishes an EventSource connection based on the parameters provided
+// and blocks until the client is closed, reconnecting when the stream ends.
+//
+//nolint:funlen,gocognit,cyclop
+func (mi *SSE) Open(url string, args ...goja.Value) (*HTTPResponse, error) {
+	ctx := mi.vu.Context()
+	rt := mi.vu.Runtime()
+	state := mi.vu.State()
+	if state == nil {
+		return nil, ErrSSEInInitContext
+	}
+
+	// The params argument is optional
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV = args[0]
+		callableV = args[1]
+	case 1:
+		paramsV = goja.Undefined()
+		callableV = args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to sse.open")
+	}
+	// Get the callable (required)
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("last argument to sse.open must be a function")
+	}
+
+	header := make(http.Header)
+	header.Set("User-Agent", state.Options.UserAgent.String)
+	header.Set("Accept", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+
+	tags := state.CloneTags()
+	reconnect := true
+	retry := defaultRetry
+
+	// Parse the optional second argument (params)
+	if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			switch k {
+			case "headers":
+				headersV := params.Get(k)
+				if goja.IsUndefined(headersV) || goja.IsNull(headersV) {
+					continue
+				}
+				headersObj := headersV.ToObject(rt)
+				if headersObj == nil {
+					continue
+				}
+				for _, key := range headersObj.Keys() {
+					header.Set(key, headersObj.Get(key).String())
+				}
+			case "tags":
+				tagsV := params.Get(k)
+				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+					continue
+				}
+				tagObj := tagsV.ToObject(rt)
+				if tagObj == nil {
+					continue
+				}
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			case "reconnect":
+				reconnect = params.Get(k).ToBoolean()
+			case "retry":
+				d, err := types.GetDurationValue(params.Get(k).Export())
+				if err != nil {
+					return nil, fmt.Errorf("invalid retry value: %w", err)
+				}
+				retry = d
+			}
+		}
+	}
+
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		tags["url"] = url
+	}
+
+	httpClient := &http.Client{Transport: state.Transport}
+	if state.CookieJar != nil { // this is needed because of how interfaces work and that Jar is http.Cookiejar
+		httpClient.Jar = state.CookieJar
+	}
+
+	clientCtx, cancel := context.WithCancel(ctx)
+	client := &Client{
+		rt:             rt,
+		ctx:            clientCtx,
+		cancel:         cancel,
+		eventHandlers:  make(map[string][]goja.Callable),
+		scheduled:      make(chan goja.Callable),
+		done:           make(chan struct{}),
+		url:            url,
+		header:         header,
+		httpClient:     httpClient,
+		reconnect:      reconnect,
+		parser:         &eventParser{retry: retry},
+		sampleTags:     stats.IntoSampleTags(&tags),
+		samplesOutput:  state.Samples,
+		builtinMetrics: state.BuiltinMetrics,
+		statusTag:      state.Options.SystemTags.Has(stats.TagStatus),
+	}
+	defer client.close()
+
+	// Run the user-provided set up function
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(client)); err != nil {
+		return nil, err
+	}
+
+	response := &HTTPResponse{URL: url}
+	readEventChan := make(chan *Event)
+	readEndChan := make(chan error)
+	var reconnectChan <-chan time.Time
+
+	// connect makes a single connection attempt and starts reading the
+	// stream on success. It returns false when the client should give up.
+	connect := func() bool {
+		body, retryable, err := client.connect(response)
+		if err != nil {
+			client.handleEvent("error", rt.ToValue(err))
+			if !retryable || !client.reconnect {
+				return false
+			}
+			reconnectChan = time.After(client.parser.retry)
+			return true
+		}
+		if body == nil { // the server asked us to stop reconnecting
+			return false
+		}
+		client.handleEvent("open")
+		go client.readPump(body, readEventChan, readEndChan)
+		return true
+	}
+
+	if !connect() {
+		return response, nil
+	}
+
+	// This is the main control loop. All JS code (including error handlers)
+	// should only be executed by this thread to avoid race conditions
+	for {
+		select {
+		case event := <-readEventChan:
+			client.pushEventMetrics(event)
+			client.handleEvent("message", rt.ToValue(event))
+
+		case readErr := <-readEndChan:
+			if readErr != nil {
+				client.handleEvent("error", rt.ToValue(readErr))
+			}
+			if !client.reconnect {
+				return response, nil
+			}
+			reconnectChan = time.After(client.parser.retry)
+
+		case <-reconnectChan:
+			reconnectChan = nil
+			if !connect() {
+				return response, nil
+			}
+
+		case scheduledFn := <-client.scheduled:
+			if _, err := scheduledFn(goja.Undefined()); err != nil {
+				return nil, err
+			}
+
+		case <-ctx.Done():
+			// VU is shutting down during an interrupt
+			// events will not be forwarded to the VU
+			return response, nil
+
+		case <-client.done:
+			// This is the final exit point normally triggered by close
+			return response, nil
+		}
+	}
+}
+
+// connect sends the request for the event stream and validates the response.
+// A nil body and error means that the server doesn't want the client to
+// reconnect, while the returned bool tells if a failed attempt can be retried.
+func (c *Client) connect(response *HTTPResponse) (io.ReadCloser, bool, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header = c.header.Clone()
+	if c.parser.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", c.parser.lastEventID)
+	}
+
+	c.connStart = time.Now()
+	c.lastEventTime = time.Time{}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		response.Error = err.Error()
+		return nil, true, err
+	}
+
+	response.Status = res.StatusCode
+	response.Headers = make(map[string]string, len(res.Header))
+	for k, vs := range res.Header {
+		response.Headers[k] = strings.Join(vs, ", ")
+	}
+	response.Error = ""
+	if c.statusTag {
+		tags := c.sampleTags.CloneTags()
+		tags["status"] = strconv.Itoa(res.StatusCode)
+		c.sampleTags = stats.IntoSampleTags(&tags)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNoContent:
+		_ = res.Body.Close()
+		return nil, false, nil
+	case res.StatusCode != http.StatusOK:
+		_ = res.Body.Close()
+		err = fmt.Errorf("unexpected response status: %s", res.Status)
+	default:
+		mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		if mediaType == "text/event-stream" {
+			return res.Body, false, nil
+		}
+		_ = res.Body.Close()
+		err = fmt.Errorf("unexpected response content type: %q", res.Header.Get("Content-Type"))
+	}
+	response.Error = err.Error()
+	return nil, false, err
+}
+
+func (c *Client) pushEventMetrics(event *Event) {
+	samples := []stats.Sample{
+		{Metric: c.builtinMetrics.SSEEventsReceived, Time: event.received, Tags: c.sampleTags, Value: 1},
+	}
+	if c.lastEventTime.IsZero() {
+		samples = append(samples, stats.Sample{
+			Metric: c.builtinMetrics.SSETimeToFirstEvent, Time: event.received, Tags: c.sampleTags,
+			Value: stats.D(event.received.Sub(c.connStart)),
+		})
+	} else {
+		samples = append(samples, stats.Sample{
+			Metric: c.builtinMetrics.SSEInterEventLatency, Time: event.received, Tags: c.sampleTags,
+			Value: stats.D(event.received.Sub(c.lastEventTime)),
+		})
+	}
+	c.lastEventTime = event.received
+
+	stats.PushIfNotDone(c.ctx, c.samplesOutput, stats.ConnectedSamples{
+		Samples: samples,
+		Tags:    c.sampleTags,
+		Time:    event.received,
+	})
+}
+
+// On registers a handler for the "open", "message" or "error" events.
+func (c *Client) On(event string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		c.eventHandlers[event] = append(c.eventHandlers[event], handler)
+	}
+}
+
+func (c *Client) handleEvent(event string, args ...goja.Value) {
+	if handlers, ok := c.eventHandlers[event]; ok {
+		for _, handler := range handlers {
+			if _, err := handler(goja.Undefined(), args...); err != nil {
+				common.Throw(c.rt, err)
+			}
+		}
+	}
+}
+
+// SetTimeout executes the provided function inside the client's event loop after at least the provided
+// timeout, which is in ms, has elapsed
+func (c *Client) SetTimeout(fn goja.Callable, timeoutMs float64) error {
+	d := time.Duration(timeoutMs * float64(time.Millisecond))
+	if d <= 0 {
+		return fmt.Errorf("setTimeout requires a >0 timeout parameter, received %.2f", timeoutMs)
+	}
+	go func() {
+		select {
+		case <-time.After(d):
+			select {
+			case c.scheduled <- fn:
+			case <-c.done:
+				return
+			}
+
+		case <-c.done:
+			return
+		}
+	}()
+
+	return nil
+}
+
+// Close closes the connection and stops any further reconnection attempts.
+func (c *Client) Close() {
+	c.close()
+}
+
+func (c *Client) close() {
+	c.shutdownOnce.Do(func() {
+		c.cancel()
+		close(c.done)
+	})
+}
+
+// readPump parses the event stream and passes the events to the main loop
+func (c *Client) readPump(body io.ReadCloser, eventChan chan<- *Event, endChan chan<- error) {
+	defer func() { _ = body.Close() }()
+
+	err := c.parser.parse(body, func(event *Event) bool {
+		select {
+		case eventChan <- event:
+			return true
+		case <-c.done:
+			return false
+		}
+	})
+	if errors.Is(err, io.EOF) || c.ctx.Err() != nil {
+		err = nil
+	}
+
+	select {
+	case endChan <- err:
+	case <-c.done:
+	}
+}
+
+// eventParser implements the event stream interpretation from
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+// It keeps the last event ID and the reconnection time between connections.
+type eventParser struct {
+	lastEventID string
+	retry       time.Duration
+}
+
+// parse reads the stream until it ends, calling dispatch for each complete
+// event. An incomplete event at the end of the stream is discarded.
+func (p *eventParser) parse(r io.Reader, dispatch func(*Event) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	scanner.Split(scanLines)
+
+	var (
+		data      bytes.Buffer
+		eventType string
+		retry     int64
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				event := &Event{
+					ID:       p.lastEventID,
+					Event:    eventType,
+					Data:     strings.TrimSuffix(data.String(), "\n"),
+					Retry:    retry,
+					received: time.Now(),
+				}
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				if !dispatch(event) {
+					return nil
+				}
+			}
+			data.Reset()
+			eventType = ""
+			retry = 0
+			continue
+		}
+		if line[0] == ':' { // a comment
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				p.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				retry = int64(ms)
+				p.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// scanLines is a bufio.SplitFunc that splits on any of the CRLF, LF or CR
+// line endings that are allowed in an event stream.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// a CR, which may be followed by a LF that we don't have yet
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,211 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sse
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/lib/testutils/httpmultibin"
+	"go.k6.io/k6/stats"
+)
+
+type testState struct {
+	rt      *goja.Runtime
+	tb      *httpmultibin.HTTPMultiBin
+	state   *lib.State
+	samples chan stats.SampleContainer
+}
+
+func newTestState(t testing.TB) testState {
+	tb := httpmultibin.NewHTTPMultiBin(t)
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+
+	samples := make(chan stats.SampleContainer, 1000)
+
+	state := &lib.State{
+		Group:     root,
+		Dialer:    tb.Dialer,
+		Transport: tb.HTTPTransport,
+		Options: lib.Options{
+			SystemTags: stats.NewSystemTagSet(
+				stats.TagURL,
+				stats.TagStatus,
+			),
+			UserAgent: null.StringFrom("TestUserAgent"),
+		},
+		Samples:        samples,
+		TLSConfig:      tb.TLSClientConfig,
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+		Tags:           lib.NewTagMap(nil),
+	}
+
+	m := New().NewModuleInstance(&modulestest.VU{
+		CtxField:     tb.Context,
+		InitEnvField: &common.InitEnvironment{},
+		RuntimeField: rt,
+		StateField:   state,
+	})
+	require.NoError(t, rt.Set("sse", m.Exports().Default))
+
+	return testState{
+		rt:      rt,
+		tb:      tb,
+		state:   state,
+		samples: samples,
+	}
+}
+
+func TestOpenReconnect(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	_, err := ts.rt.RunString(sr(`
+	var opened = 0;
+	var events = [];
+	var res = sse.open("HTTPBIN_URL/sse", function(client) {
+		client.on("open", function() { opened++; });
+		client.on("message", function(e) {
+			events.push(e);
+			if (e.id === "3") {
+				client.close();
+			}
+		});
+		client.on("error", function(e) { throw new Error("unexpected error: " + e); });
+	});
+	if (res.status !== 200) { throw new Error("unexpected status: " + res.status); }
+	if (opened !== 2) { throw new Error("expected to connect twice, got " + opened); }
+	if (events.length !== 3) { throw new Error("unexpected number of events: " + events.length); }
+	if (events[0].event !== "greeting" || events[0].data !== "hello" || events[0].id !== "1") {
+		throw new Error("unexpected first event: " + JSON.stringify(events[0]));
+	}
+	if (events[1].event !== "message" || events[1].data !== "line1\nline2" || events[1].retry !== 0) {
+		throw new Error("unexpected second event: " + JSON.stringify(events[1]));
+	}
+	if (events[2].data !== "resumed after 2") {
+		throw new Error("Last-Event-ID wasn't sent on reconnect: " + JSON.stringify(events[2]));
+	}
+	`))
+	require.NoError(t, err)
+
+	samples := stats.GetBufferedSamples(ts.samples)
+	assert.Equal(t, 3, testutils.CountMetric(samples, metrics.SSEEventsReceivedName, nil))
+	assert.Equal(t, 2, testutils.CountMetric(samples, metrics.SSETimeToFirstEventName, nil))
+	assert.Equal(t, 1, testutils.CountMetric(samples, metrics.SSEInterEventLatencyName, nil))
+	for _, sampleContainer := range samples {
+		for _, sample := range sampleContainer.GetSamples() {
+			tags := sample.Tags.CloneTags()
+			assert.Equal(t, sr("HTTPBIN_URL/sse"), tags["url"])
+			assert.Equal(t, "200", tags["status"])
+		}
+	}
+}
+
+func TestOpenNoReconnect(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	_, err := ts.rt.RunString(sr(`
+	var count = 0;
+	sse.open("HTTPBIN_URL/sse", { reconnect: false, tags: { name: "stream" } }, function(client) {
+		client.on("message", function(e) { count++; });
+	});
+	if (count !== 2) { throw new Error("unexpected number of events: " + count); }
+	`))
+	require.NoError(t, err)
+}
+
+func TestOpenInvalidResponse(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	_, err := ts.rt.RunString(sr(`
+	var errors = [];
+	var res = sse.open("HTTPBIN_URL/get", function(client) {
+		client.on("open", function() { throw new Error("unexpected open"); });
+		client.on("error", function(e) { errors.push(e); });
+	});
+	if (errors.length !== 1) { throw new Error("unexpected number of errors: " + errors.length); }
+	if (res.status !== 200 || res.error.indexOf("content type") < 0) {
+		throw new Error("unexpected response: " + JSON.stringify(res));
+	}
+	`))
+	require.NoError(t, err)
+}
+
+func TestOpenInInitContext(t *testing.T) {
+	t.Parallel()
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	m := New().NewModuleInstance(&modulestest.VU{
+		CtxField:     context.Background(),
+		InitEnvField: &common.InitEnvironment{},
+		RuntimeField: rt,
+	})
+	require.NoError(t, rt.Set("sse", m.Exports().Default))
+
+	_, err := rt.RunString(`sse.open("http://localhost/sse", function(client) {})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "init context")
+}
+
+func TestParser(t *testing.T) {
+	t.Parallel()
+	stream := "data: a\r\ndata:b\r\rid: 7\revent: custom\ndata\n\nretry: 250\nretry: nope\n\ndata: incomplete"
+	parser := &eventParser{retry: defaultRetry}
+	var events []*Event
+	err := parser.parse(strings.NewReader(stream), func(e *Event) bool {
+		events = append(events, e)
+		return true
+	})
+	require.Error(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "message", events[0].Event)
+	assert.Equal(t, "a\nb", events[0].Data)
+	assert.Equal(t, "", events[0].ID)
+
+	assert.Equal(t, "custom", events[1].Event)
+	assert.Equal(t, "", events[1].Data)
+	assert.Equal(t, "7", events[1].ID)
+
+	assert.Equal(t, "7", parser.lastEventID)
+	assert.Equal(t, int64(250), parser.retry.Milliseconds())
+}
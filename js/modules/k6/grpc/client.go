@@ -22,6 +22,7 @@ package grpc
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -38,6 +39,8 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	grpcstats "google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
@@ -46,14 +49,19 @@ import (
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
 
+	// registers the google.rpc error details types, like BadRequest, so they can be decoded
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+
 	//nolint: staticcheck
 	protoV1 "github.com/golang/protobuf/proto"
 
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/netext"
 	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/stats"
 	reflectpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
@@ -67,8 +75,14 @@ var (
 
 // Client represents a gRPC client that can be used to make RPC requests
 type Client struct {
-	mds  map[string]protoreflect.MethodDescriptor
-	conn *grpc.ClientConn
+	mds map[string]protoreflect.MethodDescriptor
+	// msgTypes has the message types loaded from the files or by reflection,
+	// so the error details using them can be decoded
+	msgTypes *protoregistry.Types
+	conn     *grpc.ClientConn
+	// web is used instead of conn for the protocols other than grpc
+	web      *webClient
+	protocol string
 
 	vu modules.VU
 }
@@ -85,8 +99,8 @@ type MethodInfo struct {
 type Response struct {
 	Status   codes.Code
 	Message  interface{}
-	Headers  map[string][]string
-	Trailers map[string][]string
+	Headers  map[string][]interface{}
+	Trailers map[string][]interface{}
 	Error    interface{}
 }
 
@@ -156,6 +170,7 @@ func (c *Client) convertToMethodInfo(fdset *descriptorpb.FileDescriptorSet) ([]M
 		// This allows us to call load() multiple times, without overwriting the
 		// previously loaded definitions.
 		c.mds = make(map[string]protoreflect.MethodDescriptor)
+		c.msgTypes = new(protoregistry.Types)
 	}
 	appendMethodInfo := func(
 		fd protoreflect.FileDescriptor,
@@ -176,6 +191,7 @@ func (c *Client) convertToMethodInfo(fdset *descriptorpb.FileDescriptorSet) ([]M
 		})
 	}
 	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		registerMessageTypes(c.msgTypes, fd.Messages())
 		sds := fd.Services()
 		for i := 0; i < sds.Len(); i++ {
 			sd := sds.Get(i)
@@ -190,6 +206,52 @@ func (c *Client) convertToMethodInfo(fdset *descriptorpb.FileDescriptorSet) ([]M
 	return rtn, nil
 }
 
+// typeResolver resolves the loaded types first, and then the ones linked in
+// the binary, like the well known types.
+type typeResolver struct {
+	loaded *protoregistry.Types
+}
+
+func (r typeResolver) FindMessageByName(message protoreflect.FullName) (protoreflect.MessageType, error) {
+	if r.loaded != nil {
+		if mt, err := r.loaded.FindMessageByName(message); err == nil {
+			return mt, nil
+		}
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(message)
+}
+
+func (r typeResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if r.loaded != nil {
+		if mt, err := r.loaded.FindMessageByURL(url); err == nil {
+			return mt, nil
+		}
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
+
+func (typeResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (typeResolver) FindExtensionByNumber(
+	message protoreflect.FullName, field protoreflect.FieldNumber,
+) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// registerMessageTypes registers the messages and their nested messages,
+// ignoring the ones that were already registered by a previous load.
+func registerMessageTypes(registry *protoregistry.Types, messages protoreflect.MessageDescriptors) {
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if _, err := registry.FindMessageByName(md.FullName()); errors.Is(err, protoregistry.NotFound) {
+			_ = registry.RegisterMessage(dynamicpb.NewMessageType(md))
+		}
+		registerMessageTypes(registry, md.Messages())
+	}
+}
+
 type transportCreds struct {
 	credentials.TransportCredentials
 	errc chan<- error
@@ -217,6 +279,24 @@ func (c *Client) Connect(addr string, params map[string]interface{}) (bool, erro
 		return false, err
 	}
 
+	if p.Protocol != protocolGRPC {
+		if p.UseReflectionProtocol {
+			return false, errReflectionUnsupported
+		}
+		// the connections are only established with the first requests, by
+		// the HTTP transport of the VU
+		web, err := newWebClient(state, addr, p)
+		if err != nil {
+			return false, err
+		}
+		if err = c.Close(); err != nil {
+			return false, err
+		}
+		c.web, c.protocol = web, p.Protocol
+		return true, nil
+	}
+	c.web, c.protocol = nil, protocolGRPC
+
 	// (rogchap) Even with FailOnNonTempDialError, if there is a TLS error this will timeout
 	// rather than report the error, so we can't rely on WithBlock. By running in a goroutine
 	// we can then wait on the error channel instead, which could happen before the Dial
@@ -254,6 +334,10 @@ func (c *Client) Connect(addr string, params map[string]interface{}) (bool, erro
 		}
 
 		dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+			if p.Network.IsSet() {
+				emulator := netext.NewClientNetworkEmulator(state.Dialer, p.Network)
+				ctx = netext.WithNetworkEmulator(ctx, emulator)
+			}
 			return state.Dialer.DialContext(ctx, "tcp", addr)
 		}
 		opts = append(opts, grpc.WithContextDialer(dialer))
@@ -386,11 +470,15 @@ func sendReceive(
 }
 
 type params struct {
-	Metadata map[string]string
-	Tags     map[string]string
-	Timeout  time.Duration
+	Metadata     map[string]string
+	Tags         map[string]string
+	Timeout      time.Duration
+	Deadline     time.Time
+	Compression  string
+	WaitForReady bool
 }
 
+//nolint:funlen,gocognit,cyclop
 func (c *Client) parseParams(raw map[string]interface{}) (params, error) {
 	p := params{
 		Timeout: 1 * time.Minute,
@@ -409,11 +497,18 @@ func (c *Client) parseParams(raw map[string]interface{}) (params, error) {
 			}
 			for hk, kv := range rawHeaders {
 				// TODO(rogchap): Should we manage a string slice?
-				strval, ok := kv.(string)
-				if !ok {
+				switch val := kv.(type) {
+				case string:
+					p.Metadata[hk] = val
+				case goja.ArrayBuffer:
+					if !strings.HasSuffix(strings.ToLower(hk), "-bin") {
+						return p, fmt.Errorf("metadata %q value must be a string, only binary (-bin) metadata "+
+							"can be an ArrayBuffer", hk)
+					}
+					p.Metadata[hk] = string(val.Bytes())
+				default:
 					return p, fmt.Errorf("metadata %q value must be a string", hk)
 				}
-				p.Metadata[hk] = strval
 			}
 		case "tags":
 			p.Tags = make(map[string]string)
@@ -435,6 +530,28 @@ func (c *Client) parseParams(raw map[string]interface{}) (params, error) {
 			if err != nil {
 				return p, fmt.Errorf("invalid timeout value: %w", err)
 			}
+		case "deadline":
+			// either a Date or a duration from now
+			if t, ok := v.(time.Time); ok {
+				p.Deadline = t
+				continue
+			}
+			d, err := types.GetDurationValue(v)
+			if err != nil {
+				return p, fmt.Errorf("invalid deadline value: %w", err)
+			}
+			p.Deadline = time.Now().Add(d)
+		case "compression":
+			p.Compression, _ = v.(string)
+			if p.Compression != "" && p.Compression != gzip.Name {
+				return p, fmt.Errorf("unsupported compression '%v', the only supported one is %s", v, gzip.Name)
+			}
+		case "waitForReady":
+			var ok bool
+			p.WaitForReady, ok = v.(bool)
+			if !ok {
+				return p, fmt.Errorf("invalid waitForReady value: '%#v', it needs to be boolean", v)
+			}
 		default:
 			return p, fmt.Errorf("unknown param: %q", k)
 		}
@@ -453,7 +570,7 @@ func (c *Client) Invoke(
 	if state == nil {
 		return nil, errInvokeRPCInInitContext
 	}
-	if c.conn == nil {
+	if c.conn == nil && c.web == nil {
 		return nil, errors.New("no gRPC connection, you must call connect first")
 	}
 	if method == "" {
@@ -472,6 +589,45 @@ func (c *Client) Invoke(
 		return nil, err
 	}
 
+	reqdm := dynamicpb.NewMessage(md.Input())
+	{
+		b, err := req.ToObject(rt).MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("unable to serialise request object: %w", err)
+		}
+		if err := protojson.Unmarshal(b, reqdm); err != nil {
+			return nil, fmt.Errorf("unable to serialise request object to protocol buffer: %w", err)
+		}
+	}
+
+	return c.invoke(method, md, reqdm, p), nil
+}
+
+// HealthCheck calls the standard grpc.health.v1.Health/Check method for the
+// service, or for the whole server if it's empty, so its proto file doesn't
+// need to be loaded. The status in the response message can be compared with
+// the grpc.HealthCheck* constants.
+func (c *Client) HealthCheck(service string, params map[string]interface{}) (*Response, error) {
+	if c.vu.State() == nil {
+		return nil, errInvokeRPCInInitContext
+	}
+	if c.conn == nil && c.web == nil {
+		return nil, errors.New("no gRPC connection, you must call connect first")
+	}
+	p, err := c.parseParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	md := grpc_health_v1.File_grpc_health_v1_health_proto.Services().ByName("Health").Methods().ByName("Check")
+	req := dynamicpb.NewMessage(md.Input())
+	req.Set(md.Input().Fields().ByName("service"), protoreflect.ValueOfString(service))
+	return c.invoke("/grpc.health.v1.Health/Check", md, req, p), nil
+}
+
+//nolint:funlen
+func (c *Client) invoke(method string, md protoreflect.MethodDescriptor, reqdm proto.Message, p params) *Response {
+	state := c.vu.State()
 	ctx := metadata.NewOutgoingContext(c.vu.Context(), metadata.New(nil))
 	for param, strval := range p.Metadata {
 		ctx = metadata.AppendToOutgoingContext(ctx, param, strval)
@@ -483,8 +639,15 @@ func (c *Client) Invoke(
 	}
 
 	if state.Options.SystemTags.Has(stats.TagURL) {
-		tags["url"] = fmt.Sprintf("%s%s", c.conn.Target(), method)
+		var target string
+		if c.web != nil {
+			target = c.web.target()
+		} else {
+			target = c.conn.Target()
+		}
+		tags["url"] = fmt.Sprintf("%s%s", target, method)
 	}
+	tags["protocol"] = c.protocol
 	parts := strings.Split(method[1:], "/")
 	if state.Options.SystemTags.Has(stats.TagService) {
 		tags["service"] = parts[0]
@@ -500,44 +663,43 @@ func (c *Client) Invoke(
 
 	ctx = withTags(ctx, tags)
 
-	reqdm := dynamicpb.NewMessage(md.Input())
-	{
-		b, err := req.ToObject(rt).MarshalJSON()
-		if err != nil {
-			return nil, fmt.Errorf("unable to serialise request object: %w", err)
-		}
-		if err := protojson.Unmarshal(b, reqdm); err != nil {
-			return nil, fmt.Errorf("unable to serialise request object to protocol buffer: %w", err)
-		}
-	}
-
 	reqCtx, cancel := context.WithTimeout(ctx, p.Timeout)
 	defer cancel()
+	if !p.Deadline.IsZero() {
+		var cancelDeadline context.CancelFunc
+		reqCtx, cancelDeadline = context.WithDeadline(reqCtx, p.Deadline)
+		defer cancelDeadline()
+	}
 
 	resp := dynamicpb.NewMessage(md.Output())
 	header, trailer := metadata.New(nil), metadata.New(nil)
-	err = c.conn.Invoke(reqCtx, method, reqdm, resp, grpc.Header(&header), grpc.Trailer(&trailer))
+	var err error
+	if c.web != nil {
+		outgoing, _ := metadata.FromOutgoingContext(reqCtx)
+		start := time.Now()
+		header, trailer, err = c.web.invoke(reqCtx, method, outgoing, p.Compression, reqdm, resp)
+		pushDuration(reqCtx, state, start, err)
+	} else {
+		opts := []grpc.CallOption{grpc.Header(&header), grpc.Trailer(&trailer)}
+		if p.Compression != "" {
+			opts = append(opts, grpc.UseCompressor(p.Compression))
+		}
+		if p.WaitForReady {
+			opts = append(opts, grpc.WaitForReady(true))
+		}
+		err = c.conn.Invoke(reqCtx, method, reqdm, resp, opts...)
+	}
 
 	var response Response
-	response.Headers = header
-	response.Trailers = trailer
+	response.Headers = c.metadataToJS(header)
+	response.Trailers = c.metadataToJS(trailer)
 
 	marshaler := protojson.MarshalOptions{EmitUnpopulated: true}
 
 	if err != nil {
 		sterr := status.Convert(err)
 		response.Status = sterr.Code()
-
-		// (rogchap) when you access a JSON property in goja, you are actually accessing the underling
-		// Go type (struct, map, slice etc); because these are dynamic messages the Unmarshaled JSON does
-		// not map back to a "real" field or value (as a normal Go type would). If we don't marshal and then
-		// unmarshal back to a map, you will get "undefined" when accessing JSON properties, even when
-		// JSON.Stringify() shows the object to be correctly present.
-
-		raw, _ := marshaler.Marshal(sterr.Proto())
-		errMsg := make(map[string]interface{})
-		_ = json.Unmarshal(raw, &errMsg)
-		response.Error = errMsg
+		response.Error = c.statusToJS(sterr)
 	}
 
 	if resp != nil {
@@ -560,12 +722,69 @@ func (c *Client) Invoke(
 		_ = json.Unmarshal(raw, &msg)
 		response.Message = msg
 	}
-	return &response, nil
+	return &response
+}
+
+// metadataToJS converts the values of binary (-bin) metadata to ArrayBuffers.
+func (c *Client) metadataToJS(md metadata.MD) map[string][]interface{} {
+	rt := c.vu.Runtime()
+	result := make(map[string][]interface{}, len(md))
+	for k, vs := range md {
+		values := make([]interface{}, len(vs))
+		for i, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				values[i] = rt.NewArrayBuffer([]byte(v))
+			} else {
+				values[i] = v
+			}
+		}
+		result[k] = values
+	}
+	return result
+}
+
+// statusToJS converts the status to an object with its code, message and
+// details. The details are decoded if their types are either well known, like
+// the ones from google/rpc/error_details.proto, or loaded by the client. Any
+// other details only have their type and the encoded value.
+func (c *Client) statusToJS(st *status.Status) map[string]interface{} {
+	// (rogchap) when you access a JSON property in goja, you are actually accessing the underling
+	// Go type (struct, map, slice etc); because these are dynamic messages the Unmarshaled JSON does
+	// not map back to a "real" field or value (as a normal Go type would). If we don't marshal and then
+	// unmarshal back to a map, you will get "undefined" when accessing JSON properties, even when
+	// JSON.Stringify() shows the object to be correctly present.
+	marshaler := protojson.MarshalOptions{EmitUnpopulated: true, Resolver: typeResolver{c.msgTypes}}
+	result := map[string]interface{}{
+		"code":    int(st.Code()),
+		"message": st.Message(),
+	}
+	details := st.Proto().GetDetails()
+	decoded := make([]interface{}, 0, len(details))
+	for _, detail := range details {
+		detailJSON := map[string]interface{}{}
+		raw, err := marshaler.Marshal(detail)
+		if err == nil {
+			err = json.Unmarshal(raw, &detailJSON)
+		}
+		if err != nil {
+			detailJSON = map[string]interface{}{
+				"@type": detail.GetTypeUrl(),
+				"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+			}
+		}
+		decoded = append(decoded, detailJSON)
+	}
+	result["details"] = decoded
+	return result
 }
 
 // Close will close the client gRPC connection
 func (c *Client) Close() error {
-	if c == nil || c.conn == nil {
+	if c == nil {
+		return nil
+	}
+	c.web = nil
+	if c.conn == nil {
 		return nil
 	}
 	err := c.conn.Close()
@@ -630,13 +849,16 @@ func (c *Client) HandleRPC(ctx context.Context, stat grpcstats.RPCStats) {
 }
 
 type connectParams struct {
+	Protocol              string
 	IsPlaintext           bool
 	UseReflectionProtocol bool
 	Timeout               time.Duration
+	Network               types.NetworkConditions
 }
 
 func (c *Client) parseConnectParams(raw map[string]interface{}) (connectParams, error) {
 	params := connectParams{
+		Protocol:              protocolGRPC,
 		IsPlaintext:           false,
 		UseReflectionProtocol: false,
 		Timeout:               time.Minute,
@@ -661,6 +883,20 @@ func (c *Client) parseConnectParams(raw map[string]interface{}) (connectParams,
 			if !ok {
 				return params, fmt.Errorf("invalid reflect value: '%#v', it needs to be boolean", v)
 			}
+		case "protocol":
+			switch v {
+			case protocolGRPC, protocolGRPCWeb, protocolGRPCWebText, protocolConnect:
+				params.Protocol, _ = v.(string)
+			default:
+				return params, fmt.Errorf("unsupported protocol '%v', it needs to be one of %s, %s, %s or %s",
+					v, protocolGRPC, protocolGRPCWeb, protocolGRPCWebText, protocolConnect)
+			}
+		case "network":
+			var err error
+			params.Network, err = types.GetNetworkConditions(v)
+			if err != nil {
+				return params, fmt.Errorf("invalid network value: %w", err)
+			}
 
 		default:
 			return params, fmt.Errorf("unknown connect param: %q", k)
@@ -33,6 +33,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc/reflection"
 	reflectpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
@@ -44,12 +45,17 @@ import (
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	grpcstats "google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/grpc_testing"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"gopkg.in/guregu/null.v3"
 
 	"go.k6.io/k6/js/common"
@@ -263,6 +269,23 @@ func TestClient(t *testing.T) {
 				err:  "invalid duration",
 			},
 		},
+		{
+			name: "ConnectInvalidNetwork",
+			initString: codeBlock{code: `
+				var client = new grpc.Client();
+				client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");`},
+			vuString: codeBlock{
+				code: `client.connect("GRPCBIN_ADDR", { network: { packetLoss: 200 } });`,
+				err:  "invalid network value: network packet loss should be a percentage between 0 and 100",
+			},
+		},
+		{
+			name: "ConnectNetwork",
+			initString: codeBlock{code: `
+				var client = new grpc.Client();
+				client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");`},
+			vuString: codeBlock{code: `client.connect("GRPCBIN_ADDR", { network: { latency: "10ms", download: 10000 } });`},
+		},
 		{
 			name: "ConnectStringTimeout",
 			initString: codeBlock{code: `
@@ -499,6 +522,149 @@ func TestClient(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ResponseErrorDetails",
+			initString: codeBlock{
+				code: `
+				var client = new grpc.Client();
+				client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");`,
+			},
+			setup: func(tb *httpmultibin.HTTPMultiBin) {
+				tb.GRPCStub.EmptyCallFunc = func(context.Context, *grpc_testing.Empty) (*grpc_testing.Empty, error) {
+					details := []*anypb.Any{{TypeUrl: "type.googleapis.com/k6.Unknown", Value: []byte("k6")}}
+					for _, detail := range []proto.Message{
+						&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+							{Field: "name", Description: "too long"},
+						}},
+						&errdetails.RetryInfo{RetryDelay: durationpb.New(2 * time.Second)},
+						&errdetails.ErrorInfo{Reason: "TOO_LONG", Domain: "k6.io"},
+					} {
+						packed, err := anypb.New(detail)
+						if err != nil {
+							return nil, err
+						}
+						details = append(details, packed)
+					}
+					st := status.FromProto(&spb.Status{
+						Code: int32(codes.InvalidArgument), Message: "invalid", Details: details,
+					})
+					return nil, st.Err()
+				}
+			},
+			vuString: codeBlock{
+				code: `
+				client.connect("GRPCBIN_ADDR");
+				var resp = client.invoke("grpc.testing.TestService/EmptyCall", {})
+				if (resp.status !== grpc.StatusInvalidArgument || resp.error.details.length !== 4) {
+					throw new Error("unexpected error: " + JSON.stringify(resp.error))
+				}
+				var details = resp.error.details;
+				if (details[0]["@type"] !== "type.googleapis.com/k6.Unknown" || details[0].value !== "azY=") {
+					throw new Error("unexpected unknown details: " + JSON.stringify(details[0]))
+				}
+				if (details[1]["@type"] !== "type.googleapis.com/google.rpc.BadRequest" ||
+					details[1].fieldViolations[0].field !== "name") {
+					throw new Error("unexpected bad request: " + JSON.stringify(details[1]))
+				}
+				if (details[2].retryDelay !== "2s" || details[3].reason !== "TOO_LONG") {
+					throw new Error("unexpected details: " + JSON.stringify(details))
+				}`,
+			},
+		},
+		{
+			name: "BinaryMetadata",
+			initString: codeBlock{
+				code: `
+				var client = new grpc.Client();
+				client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");`,
+			},
+			setup: func(tb *httpmultibin.HTTPMultiBin) {
+				tb.GRPCStub.EmptyCallFunc = func(ctx context.Context, _ *grpc_testing.Empty) (*grpc_testing.Empty, error) {
+					md, _ := metadata.FromIncomingContext(ctx)
+					if len(md["x-data-bin"]) != 1 || md["x-data-bin"][0] != "\x00\x01\xff" {
+						return nil, status.Errorf(codes.InvalidArgument, "unexpected metadata %q", md["x-data-bin"])
+					}
+					_ = grpc.SetHeader(ctx, metadata.Pairs("x-echo-bin", md["x-data-bin"][0], "x-text", "text"))
+					return &grpc_testing.Empty{}, nil
+				}
+			},
+			vuString: codeBlock{
+				code: `
+				client.connect("GRPCBIN_ADDR");
+				var resp = client.invoke("grpc.testing.TestService/EmptyCall", {},
+					{ metadata: { "x-data-bin": new Uint8Array([0, 1, 255]).buffer } })
+				if (resp.status !== grpc.StatusOK) {
+					throw new Error("unexpected error: " + JSON.stringify(resp.error))
+				}
+				var echo = new Uint8Array(resp.headers["x-echo-bin"][0]);
+				if (echo.length !== 3 || echo[0] !== 0 || echo[1] !== 1 || echo[2] !== 255) {
+					throw new Error("unexpected binary header: " + echo)
+				}
+				if (resp.headers["x-text"][0] !== "text") {
+					throw new Error("unexpected text header: " + resp.headers["x-text"][0])
+				}
+				client.invoke("grpc.testing.TestService/EmptyCall", {}, { metadata: { "x-data": new ArrayBuffer(1) } })`,
+				err: `metadata "x-data" value must be a string, only binary (-bin) metadata can be an ArrayBuffer`,
+			},
+		},
+		{
+			name: "InvokeCallOptions",
+			initString: codeBlock{
+				code: `
+				var client = new grpc.Client();
+				client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");`,
+			},
+			setup: func(tb *httpmultibin.HTTPMultiBin) {
+				tb.GRPCStub.UnaryCallFunc = func(_ context.Context, req *grpc_testing.SimpleRequest) (*grpc_testing.SimpleResponse, error) {
+					return &grpc_testing.SimpleResponse{Username: string(req.Payload.Body)}, nil
+				}
+			},
+			vuString: codeBlock{
+				code: `
+				client.connect("GRPCBIN_ADDR");
+				var req = { payload: { body: "azY=" } };
+				var resp = client.invoke("grpc.testing.TestService/UnaryCall", req,
+					{ compression: "gzip", waitForReady: true, deadline: new Date(Date.now() + 60000) })
+				if (resp.status !== grpc.StatusOK || resp.message.username !== "k6") {
+					throw new Error("unexpected response: " + JSON.stringify(resp))
+				}
+				resp = client.invoke("grpc.testing.TestService/UnaryCall", req, { deadline: new Date(Date.now() - 1000) })
+				if (resp.status !== grpc.StatusDeadlineExceeded) {
+					throw new Error("unexpected status: " + resp.status)
+				}
+				client.invoke("grpc.testing.TestService/UnaryCall", req, { compression: "br" })`,
+				err: `unsupported compression 'br', the only supported one is gzip`,
+			},
+		},
+		{
+			name: "HealthCheck",
+			initString: codeBlock{
+				code: `var client = new grpc.Client();`,
+			},
+			setup: func(tb *httpmultibin.HTTPMultiBin) {
+				grpc_health_v1.RegisterHealthServer(tb.ServerGRPC, healthStub{"k6": grpc_health_v1.HealthCheckResponse_NOT_SERVING})
+			},
+			vuString: codeBlock{
+				code: `
+				client.connect("GRPCBIN_ADDR");
+				var resp = client.healthCheck("");
+				if (resp.status !== grpc.StatusOK || resp.message.status !== grpc.HealthCheckServing) {
+					throw new Error("unexpected server health: " + JSON.stringify(resp))
+				}
+				resp = client.healthCheck("k6");
+				if (resp.message.status !== grpc.HealthCheckNotServing) {
+					throw new Error("unexpected service health: " + JSON.stringify(resp))
+				}
+				resp = client.healthCheck("unknown");
+				if (resp.status !== grpc.StatusNotFound) {
+					throw new Error("unexpected unknown service status: " + resp.status)
+				}`,
+				asserts: func(t *testing.T, rb *httpmultibin.HTTPMultiBin, samples chan stats.SampleContainer, _ error) {
+					samplesBuf := stats.GetBufferedSamples(samples)
+					assertMetricEmitted(t, metrics.GRPCReqDurationName, samplesBuf, rb.Replacer.Replace("GRPCBIN_ADDR/grpc.health.v1.Health/Check"))
+				},
+			},
+		},
 		{
 			name: "ResponseHeaders",
 			initString: codeBlock{
@@ -924,3 +1090,24 @@ func (m *getServiceFileDescriptorMock) Recv() (*reflectpb.ServerReflectionRespon
 	}
 	return srr, nil
 }
+
+// healthStub is a grpc.health.v1.Health server that returns the status of the
+// services in the map, or SERVING for the whole server.
+type healthStub map[string]grpc_health_v1.HealthCheckResponse_ServingStatus
+
+func (s healthStub) Check(
+	_ context.Context, req *grpc_health_v1.HealthCheckRequest,
+) (*grpc_health_v1.HealthCheckResponse, error) {
+	if req.Service == "" {
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+	}
+	st, ok := s[req.Service]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: st}, nil
+}
+
+func (healthStub) Watch(*grpc_health_v1.HealthCheckRequest, grpc_health_v1.Health_WatchServer) error {
+	return status.Error(codes.Unimplemented, "unimplemented")
+}
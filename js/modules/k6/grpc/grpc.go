@@ -24,6 +24,7 @@ import (
 	"github.com/dop251/goja"
 	"go.k6.io/k6/js/modules"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type (
@@ -91,6 +92,12 @@ func (mi *ModuleInstance) defineConstants() {
 	mustAddCode("StatusUnavailable", codes.Unavailable)
 	mustAddCode("StatusDataLoss", codes.DataLoss)
 	mustAddCode("StatusUnauthenticated", codes.Unauthenticated)
+
+	// the statuses of health checks, as in the status field of their response messages
+	mi.exports["HealthCheckUnknown"] = grpc_health_v1.HealthCheckResponse_UNKNOWN.String()
+	mi.exports["HealthCheckServing"] = grpc_health_v1.HealthCheckResponse_SERVING.String()
+	mi.exports["HealthCheckNotServing"] = grpc_health_v1.HealthCheckResponse_NOT_SERVING.String()
+	mi.exports["HealthCheckServiceUnknown"] = grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN.String()
 }
 
 // Exports returns the exports of the grpc module.
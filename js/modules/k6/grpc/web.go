@@ -0,0 +1,519 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"bytes"
+	stdgzip "compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/netext"
+	"go.k6.io/k6/stats"
+)
+
+// The protocols that RPCs can be invoked with.
+const (
+	protocolGRPC        = "grpc"
+	protocolGRPCWeb     = "grpc-web"
+	protocolGRPCWebText = "grpc-web-text"
+	protocolConnect     = "connect"
+)
+
+// The flag of gRPC-Web frames that contain the trailers instead of a message.
+const grpcWebTrailerFlag = 0x80
+
+// webClient invokes unary RPCs with the protocols that are based on plain
+// HTTP requests, gRPC-Web and Connect, instead of native gRPC. The requests
+// are sent with the HTTP transport of the VU, so they can be proxied and use
+// either HTTP/1.1 or HTTP/2.
+type webClient struct {
+	protocol  string
+	baseURL   string
+	userAgent string
+	tagIP     bool
+	network   *netext.NetworkEmulator
+	client    *http.Client
+}
+
+func newWebClient(state *lib.State, addr string, p connectParams) (*webClient, error) {
+	baseURL := addr
+	if !strings.Contains(addr, "://") {
+		scheme := "https"
+		if p.IsPlaintext {
+			scheme = "http"
+		}
+		baseURL = scheme + "://" + addr
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s address %q", p.Protocol, addr)
+	}
+
+	c := &webClient{
+		protocol: p.Protocol,
+		baseURL:  strings.TrimSuffix(u.String(), "/"),
+		client: &http.Client{
+			Transport: state.Transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	if ua := state.Options.UserAgent; ua.Valid {
+		c.userAgent = ua.String
+	}
+	c.tagIP = state.Options.SystemTags.Has(stats.TagIP)
+	if p.Network.IsSet() {
+		c.network = netext.NewClientNetworkEmulator(state.Dialer, p.Network)
+	}
+	return c, nil
+}
+
+// target returns the base URL the methods are appended to.
+func (c *webClient) target() string {
+	return c.baseURL
+}
+
+// invoke calls the method with the request message and unmarshals the
+// response message into resp. RPC errors are returned as gRPC statuses, same
+// as the native gRPC client does.
+//nolint:funlen
+func (c *webClient) invoke(
+	ctx context.Context, method string, md metadata.MD, compression string, req, resp proto.Message,
+) (metadata.MD, metadata.MD, error) {
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "can't marshal the request message: %s", err)
+	}
+	var flag byte
+	if compression != "" {
+		if payload, err = gzipBytes(payload); err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "can't compress the request message: %s", err)
+		}
+		flag = 1
+	}
+
+	var body []byte
+	var contentType string
+	switch c.protocol {
+	case protocolConnect:
+		body, contentType = payload, "application/proto"
+	case protocolGRPCWebText:
+		body = []byte(base64.StdEncoding.EncodeToString(grpcWebFrame(flag, payload)))
+		contentType = "application/grpc-web-text+proto"
+	default:
+		body, contentType = grpcWebFrame(flag, payload), "application/grpc-web+proto"
+	}
+
+	if c.network != nil {
+		ctx = netext.WithNetworkEmulator(ctx, c.network)
+	}
+	if c.tagIP {
+		tags := getTags(ctx)
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if ip, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+					tags["ip"] = ip
+				}
+			},
+		})
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, err.Error())
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if c.userAgent != "" {
+		httpReq.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.protocol == protocolConnect {
+		httpReq.Header.Set("Connect-Protocol-Version", "1")
+		if compression != "" {
+			httpReq.Header.Set("Content-Encoding", compression)
+			httpReq.Header.Set("Accept-Encoding", compression)
+		}
+	} else {
+		httpReq.Header.Set("Accept", contentType)
+		httpReq.Header.Set("X-Grpc-Web", "1")
+		if compression != "" {
+			httpReq.Header.Set("Grpc-Encoding", compression)
+			httpReq.Header.Set("Grpc-Accept-Encoding", compression)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline).Milliseconds()
+		if c.protocol == protocolConnect {
+			httpReq.Header.Set("Connect-Timeout-Ms", strconv.FormatInt(timeout, 10))
+		} else {
+			httpReq.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout, 10)+"m")
+		}
+	}
+	for k, vs := range md {
+		for _, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+			httpReq.Header.Add(k, v)
+		}
+	}
+
+	res, err := c.client.Do(httpReq)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, status.FromContextError(ctxErr).Err()
+		}
+		return nil, nil, status.Error(codes.Unavailable, err.Error())
+	}
+	defer func() { _ = res.Body.Close() }()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, status.FromContextError(ctxErr).Err()
+		}
+		return nil, nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	header := headerToMetadata(res.Header)
+	if c.protocol == protocolConnect {
+		// the transport only decompresses the body on its own when it set
+		// Accept-Encoding itself
+		if strings.EqualFold(res.Header.Get("Content-Encoding"), gzip.Name) {
+			if data, err = gunzipBytes(data); err != nil {
+				return header, nil, status.Errorf(codes.Internal, "can't decompress the response: %s", err)
+			}
+		}
+		return parseConnectResponse(res, header, data, resp)
+	}
+	return parseGRPCWebResponse(res, header, data, c.protocol == protocolGRPCWebText, resp)
+}
+
+func grpcWebFrame(flag byte, payload []byte) []byte {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	return frame
+}
+
+//nolint:cyclop
+func parseGRPCWebResponse(
+	res *http.Response, header metadata.MD, data []byte, text bool, resp proto.Message,
+) (metadata.MD, metadata.MD, error) {
+	if text {
+		var err error
+		if data, err = decodeBase64Chunks(data); err != nil {
+			return header, nil, status.Errorf(codes.Internal, "invalid grpc-web-text response: %s", err)
+		}
+	}
+
+	var trailer metadata.MD
+	var msg []byte
+	for len(data) > 0 {
+		if len(data) < 5 || uint64(len(data)-5) < uint64(binary.BigEndian.Uint32(data[1:5])) {
+			return header, trailer, status.Error(codes.Internal, "malformed grpc-web response frame")
+		}
+		flag, n := data[0], binary.BigEndian.Uint32(data[1:5])
+		frame := data[5 : 5+n]
+		data = data[5+n:]
+		switch {
+		case flag&grpcWebTrailerFlag != 0:
+			trailer = parseGRPCWebTrailer(frame)
+		case flag != 0:
+			if encoding := header.Get("grpc-encoding"); len(encoding) == 0 || encoding[0] != gzip.Name {
+				return header, trailer, status.Errorf(codes.Internal,
+					"unsupported grpc-web message compression %q", encoding)
+			}
+			var err error
+			if msg, err = gunzipBytes(frame); err != nil {
+				return header, trailer, status.Errorf(codes.Internal, "can't decompress the response message: %s", err)
+			}
+		default:
+			msg = frame
+		}
+	}
+
+	// the status is in the headers of trailers-only responses
+	st := statusFromMetadata(header)
+	if trailerStatus := statusFromMetadata(trailer); trailerStatus != nil {
+		st = trailerStatus
+	}
+	if st == nil {
+		code := codes.Internal
+		if res.StatusCode != http.StatusOK {
+			code = codeFromHTTPStatus(res.StatusCode)
+		}
+		st = status.Newf(code, "the response didn't contain a grpc-status, HTTP status: %s", res.Status)
+	}
+	if st.Code() != codes.OK {
+		return header, trailer, st.Err()
+	}
+	if msg == nil {
+		return header, trailer, status.Error(codes.Internal, "the response didn't contain a message")
+	}
+	if err := proto.Unmarshal(msg, resp); err != nil {
+		return header, trailer, status.Errorf(codes.Internal, "can't unmarshal the response message: %s", err)
+	}
+	return header, trailer, nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := stdgzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	r, err := stdgzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	return ioutil.ReadAll(r)
+}
+
+// decodeBase64Chunks decodes grpc-web-text bodies, which can be made of
+// several separately padded base64 chunks.
+func decodeBase64Chunks(data []byte) ([]byte, error) {
+	var result []byte
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '=')
+		if end < 0 {
+			end = len(data)
+		}
+		for end < len(data) && data[end] == '=' {
+			end++
+		}
+		chunk := make([]byte, base64.StdEncoding.DecodedLen(end))
+		n, err := base64.StdEncoding.Decode(chunk, data[:end])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, chunk[:n]...)
+		data = data[end:]
+	}
+	return result, nil
+}
+
+// parseGRPCWebTrailer parses the HTTP/1-style header block of trailer frames.
+func parseGRPCWebTrailer(frame []byte) metadata.MD {
+	header := make(http.Header)
+	for _, line := range strings.Split(string(frame), "\r\n") {
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			header.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+		}
+	}
+	return headerToMetadata(header)
+}
+
+// headerToMetadata converts HTTP headers to metadata with lower case keys,
+// decoding binary values.
+func headerToMetadata(header http.Header) metadata.MD {
+	md := make(metadata.MD, len(header))
+	for k, vs := range header {
+		k = strings.ToLower(k)
+		for _, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				if b, err := decodeBinaryHeader(v); err == nil {
+					v = string(b)
+				}
+			}
+			md[k] = append(md[k], v)
+		}
+	}
+	return md
+}
+
+func decodeBinaryHeader(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
+
+// statusFromMetadata returns the status from the grpc-status, grpc-message
+// and grpc-status-details-bin keys, which are removed from md, or nil if
+// there isn't a status in it.
+func statusFromMetadata(md metadata.MD) *status.Status {
+	codeValues := md["grpc-status"]
+	if len(codeValues) == 0 {
+		return nil
+	}
+	message := strings.Join(md["grpc-message"], "")
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	details := md["grpc-status-details-bin"]
+	delete(md, "grpc-status")
+	delete(md, "grpc-message")
+	delete(md, "grpc-status-details-bin")
+
+	code, err := strconv.Atoi(codeValues[0])
+	if err != nil {
+		return status.Newf(codes.Internal, "invalid grpc-status %q", codeValues[0])
+	}
+	if len(details) > 0 {
+		st := &spb.Status{}
+		if err := proto.Unmarshal([]byte(details[0]), st); err == nil {
+			return status.FromProto(st)
+		}
+	}
+	return status.New(codes.Code(code), message)
+}
+
+func parseConnectResponse(
+	res *http.Response, header metadata.MD, data []byte, resp proto.Message,
+) (metadata.MD, metadata.MD, error) {
+	trailer := make(metadata.MD)
+	for k, vs := range header {
+		if strings.HasPrefix(k, "trailer-") {
+			trailer[strings.TrimPrefix(k, "trailer-")] = vs
+			delete(header, k)
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return header, trailer, connectError(res, data).Err()
+	}
+	if err := proto.Unmarshal(data, resp); err != nil {
+		return header, trailer, status.Errorf(codes.Internal, "can't unmarshal the response message: %s", err)
+	}
+	return header, trailer, nil
+}
+
+// connectError converts the JSON error of a Connect response to a status.
+func connectError(res *http.Response, data []byte) *status.Status {
+	var connectErr struct {
+		Code    string
+		Message string
+		Details []struct {
+			Type  string
+			Value string
+		}
+	}
+	if err := json.Unmarshal(data, &connectErr); err != nil || connectErr.Code == "" {
+		return status.Newf(codeFromHTTPStatus(res.StatusCode), "unexpected HTTP status: %s", res.Status)
+	}
+
+	code, ok := connectCodes()[connectErr.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+	st := &spb.Status{Code: int32(code), Message: connectErr.Message}
+	for _, d := range connectErr.Details {
+		value, err := decodeBinaryHeader(d.Value)
+		if err != nil {
+			continue
+		}
+		st.Details = append(st.Details, &anypb.Any{TypeUrl: "type.googleapis.com/" + d.Type, Value: value})
+	}
+	return status.FromProto(st)
+}
+
+// connectCodes maps the codes of Connect errors, which are the gRPC codes in
+// snake case, to the gRPC codes.
+func connectCodes() map[string]codes.Code {
+	m := make(map[string]codes.Code, 17)
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		var b strings.Builder
+		for i, r := range code.String() {
+			if unicode.IsUpper(r) && i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+		m[b.String()] = code
+	}
+	return m
+}
+
+// codeFromHTTPStatus is the mapping of HTTP statuses to gRPC codes from
+// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+func codeFromHTTPStatus(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// pushDuration emits the grpc_req_duration sample of an RPC that wasn't
+// made with the native gRPC client, for which the stats handler does it.
+func pushDuration(ctx context.Context, state *lib.State, start time.Time, err error) {
+	end := time.Now()
+	tags := getTags(ctx)
+	if state.Options.SystemTags.Has(stats.TagStatus) {
+		tags["status"] = strconv.Itoa(int(status.Code(err)))
+	}
+	mTags := map[string]string(tags)
+	sampleTags := stats.IntoSampleTags(&mTags)
+	stats.PushIfNotDone(ctx, state.Samples, stats.ConnectedSamples{
+		Samples: []stats.Sample{
+			{
+				Metric: state.BuiltinMetrics.GRPCReqDuration,
+				Tags:   sampleTags,
+				Value:  stats.D(end.Sub(start)),
+				Time:   end,
+			},
+		},
+	})
+}
+
+var errReflectionUnsupported = errors.New("the reflection protocol is only supported with the grpc protocol, " +
+	"load the proto files instead")
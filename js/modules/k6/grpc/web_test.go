@@ -0,0 +1,283 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/grpc_testing"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/guregu/null.v3"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/testutils/httpmultibin"
+	"go.k6.io/k6/stats"
+)
+
+// webTestService implements UnaryCall and EmptyCall of grpc.testing.TestService
+// over gRPC-Web and Connect. UnaryCall echoes the x-user metadata as the
+// username, EmptyCall always fails.
+func webTestService(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		contentType := r.Header.Get("Content-Type")
+		connect := contentType == "application/proto"
+		text := contentType == "application/grpc-web-text+proto"
+		if text {
+			body, err = base64.StdEncoding.DecodeString(string(body))
+			require.NoError(t, err)
+		}
+		var compressed bool
+		if !connect {
+			require.Equal(t, "1", r.Header.Get("X-Grpc-Web"))
+			require.NotEmpty(t, r.Header.Get("Grpc-Timeout"))
+			compressed = body[0] == 1
+			body = body[5:]
+		} else {
+			require.Equal(t, "1", r.Header.Get("Connect-Protocol-Version"))
+			require.NotEmpty(t, r.Header.Get("Connect-Timeout-Ms"))
+			compressed = r.Header.Get("Content-Encoding") == "gzip"
+		}
+		if compressed {
+			body, err = gunzipBytes(body)
+			require.NoError(t, err)
+		}
+
+		var resp proto.Message
+		var st *status.Status
+		switch r.URL.Path {
+		case "/grpc.testing.TestService/UnaryCall":
+			req := &grpc_testing.SimpleRequest{}
+			require.NoError(t, proto.Unmarshal(body, req))
+			resp = &grpc_testing.SimpleResponse{Username: r.Header.Get("X-User"), OauthScope: string(req.Payload.Body)}
+		case "/grpc.testing.TestService/EmptyCall":
+			st, err = status.New(codes.NotFound, "nothing here: 100%").
+				WithDetails(&grpc_testing.Payload{Body: []byte("details")})
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Header", "value")
+		if connect {
+			if st != nil {
+				details := st.Proto().Details[0]
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+					"code": "not_found", "message": st.Message(), "details": []map[string]string{{
+						"type":  "grpc.testing.Payload",
+						"value": base64.RawStdEncoding.EncodeToString(details.Value),
+					}},
+				}))
+				return
+			}
+			w.Header().Set("Trailer-X-Trailer", "trailer value")
+			data, err := proto.Marshal(resp)
+			require.NoError(t, err)
+			if compressed {
+				w.Header().Set("Content-Encoding", "gzip")
+				data, err = gzipBytes(data)
+				require.NoError(t, err)
+			}
+			_, _ = w.Write(data)
+			return
+		}
+
+		if st != nil {
+			// a trailers-only response
+			details, err := proto.Marshal(st.Proto())
+			require.NoError(t, err)
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", url.PathEscape(st.Message()))
+			w.Header().Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(details))
+			return
+		}
+		data, err := proto.Marshal(resp)
+		require.NoError(t, err)
+		var flag byte
+		if compressed {
+			w.Header().Set("Grpc-Encoding", "gzip")
+			flag = 1
+			data, err = gzipBytes(data)
+			require.NoError(t, err)
+		}
+		frames := [][]byte{
+			grpcWebFrame(flag, data),
+			grpcWebFrame(grpcWebTrailerFlag, []byte("grpc-status: 0\r\nx-trailer: trailer value\r\n")),
+		}
+		for _, frame := range frames {
+			if text {
+				frame = []byte(base64.StdEncoding.EncodeToString(frame))
+			}
+			_, _ = w.Write(frame)
+		}
+	}
+}
+
+func TestClientWebProtocols(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		protocol, url string
+	}{
+		{"grpc-web", "HTTPSBIN_URL/prefix"},
+		{"grpc-web-text", "HTTPBIN_URL/prefix"},
+		{"connect", "HTTPBIN_URL/prefix"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.protocol, func(t *testing.T) {
+			t.Parallel()
+			tb := httpmultibin.NewHTTPMultiBin(t)
+			tb.Mux.Handle("/prefix/", http.StripPrefix("/prefix", webTestService(t)))
+
+			samples := make(chan stats.SampleContainer, 1000)
+			state := &lib.State{
+				Dialer:    tb.Dialer,
+				Transport: tb.HTTPTransport,
+				TLSConfig: tb.TLSClientConfig,
+				Samples:   samples,
+				Options: lib.Options{
+					SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagStatus, stats.TagIP),
+					UserAgent:  null.StringFrom("k6-test"),
+				},
+				BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+				Tags:           lib.NewTagMap(nil),
+			}
+			cwd, err := os.Getwd()
+			require.NoError(t, err)
+			rt := goja.New()
+			rt.SetFieldNameMapper(common.FieldNameMapper{})
+			vu := &modulestest.VU{
+				RuntimeField: rt,
+				CtxField:     context.Background(),
+				InitEnvField: &common.InitEnvironment{
+					Logger:      logrus.New(),
+					CWD:         &url.URL{Path: cwd},
+					FileSystems: map[string]afero.Fs{"file": afero.NewOsFs()},
+				},
+			}
+			require.NoError(t, rt.Set("grpc", New().NewModuleInstance(vu).Exports().Named))
+			require.NoError(t, rt.Set("PROTOCOL", tc.protocol))
+			require.NoError(t, rt.Set("URL", tb.Replacer.Replace(tc.url)))
+
+			_, err = rt.RunString(`
+				var client = new grpc.Client();
+				client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");`)
+			require.NoError(t, err)
+			vu.StateField = state
+
+			_, err = rt.RunString(`
+			client.connect(URL, {protocol: PROTOCOL});
+			var resp = client.invoke("grpc.testing.TestService/UnaryCall", {payload: {body: "azY="}},
+				{metadata: {"x-user": "k6"}});
+			if (resp.status !== grpc.StatusOK) { throw new Error("unexpected status: " + JSON.stringify(resp.error)); }
+			if (resp.message.username !== "k6" || resp.message.oauthScope !== "k6") {
+				throw new Error("unexpected message: " + JSON.stringify(resp.message));
+			}
+			if (resp.headers["x-header"][0] !== "value" || resp.trailers["x-trailer"][0] !== "trailer value") {
+				throw new Error("unexpected metadata: " + JSON.stringify([resp.headers, resp.trailers]));
+			}
+			resp = client.invoke("grpc.testing.TestService/UnaryCall", {payload: {body: "Z3ppcA=="}},
+				{compression: "gzip"});
+			if (resp.status !== grpc.StatusOK || resp.message.oauthScope !== "gzip") {
+				throw new Error("unexpected compressed response: " + JSON.stringify(resp));
+			}
+
+			resp = client.invoke("grpc.testing.TestService/EmptyCall", {});
+			if (resp.status !== grpc.StatusNotFound || resp.error.message !== "nothing here: 100%") {
+				throw new Error("unexpected error: " + JSON.stringify(resp.error));
+			}
+			if (resp.error.details[0].body !== "ZGV0YWlscw==") {
+				throw new Error("unexpected error details: " + JSON.stringify(resp.error));
+			}
+
+			resp = client.invoke("grpc.testing.TestService/StreamingInputCall", {});
+			if (resp.status !== grpc.StatusUnimplemented) { throw new Error("unexpected status: " + resp.status); }
+			client.close();
+			`)
+			require.NoError(t, err)
+
+			var statuses []string
+			for _, sc := range stats.GetBufferedSamples(samples) {
+				for _, s := range sc.GetSamples() {
+					require.Equal(t, metrics.GRPCReqDurationName, s.Metric.Name)
+					tags := s.Tags.CloneTags()
+					assert.Equal(t, tc.protocol, tags["protocol"])
+					assert.Equal(t, "127.0.0.1", tags["ip"])
+					assert.Contains(t, tags["url"], tb.Replacer.Replace(tc.url)+"/grpc.testing.TestService/")
+					statuses = append(statuses, tags["status"])
+				}
+			}
+			assert.Equal(t, []string{"0", "0", "5", "12"}, statuses)
+		})
+	}
+}
+
+func TestClientWebProtocolErrors(t *testing.T) {
+	t.Parallel()
+
+	header := make(http.Header)
+	header.Set("Grpc-Status", "0")
+	_, _, err := parseGRPCWebResponse(&http.Response{StatusCode: http.StatusOK, Header: header},
+		headerToMetadata(header), []byte{0, 0, 0, 0, 10, 1}, false, &grpc_testing.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "malformed grpc-web response frame")
+
+	_, _, err = parseGRPCWebResponse(&http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503"},
+		nil, nil, false, &grpc_testing.Empty{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	decoded, err := decodeBase64Chunks([]byte(base64.StdEncoding.EncodeToString([]byte("a")) +
+		base64.StdEncoding.EncodeToString([]byte("bc"))))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(decoded))
+
+	assert.Equal(t, codes.InvalidArgument, connectCodes()["invalid_argument"])
+	assert.Equal(t, codes.Canceled, connectCodes()["canceled"])
+	assert.Equal(t, codes.Unauthenticated, connectCodes()["unauthenticated"])
+
+	_, err = (&Client{}).parseConnectParams(map[string]interface{}{"protocol": "http3"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported protocol 'http3'")
+}
@@ -0,0 +1,116 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/lib/netext/httpext"
+)
+
+// ParseGraphQLRequest parses the GraphQL request argument of http.graphql(),
+// which is either the query or an object with the query, variables,
+// operationName and extensions.
+func ParseGraphQLRequest(rt *goja.Runtime, v goja.Value) (*httpext.GraphQLRequest, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, errors.New("a GraphQL query is required")
+	}
+	if _, ok := v.Export().(string); ok {
+		return &httpext.GraphQLRequest{Query: v.String()}, nil
+	}
+
+	req := &httpext.GraphQLRequest{}
+	obj := v.ToObject(rt)
+	for _, k := range obj.Keys() {
+		val := obj.Get(k)
+		if goja.IsUndefined(val) || goja.IsNull(val) {
+			continue
+		}
+		switch k {
+		case "query":
+			req.Query = val.String()
+		case "operationName":
+			req.OperationName = val.String()
+		case "variables", "extensions":
+			m, ok := val.Export().(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the GraphQL %s should be an object", k)
+			}
+			if k == "variables" {
+				req.Variables = m
+			} else {
+				req.Extensions = m
+			}
+		default:
+			return nil, fmt.Errorf("unknown GraphQL request field: '%s'", k)
+		}
+	}
+	if req.Query == "" {
+		return nil, errors.New("a GraphQL query is required")
+	}
+	return req, nil
+}
+
+// GraphQL POSTs the GraphQL request to the URL. The samples are tagged with
+// the name and type of the operation and, since GraphQL servers usually
+// respond with 200 OK even when the operation failed, the request is also
+// considered failed when the errors in the response body aren't empty.
+func (c *Client) GraphQL(url, request, params goja.Value) (*Response, error) {
+	state := c.moduleInstance.vu.State()
+	if state == nil {
+		return nil, ErrHTTPForbiddenInInitContext
+	}
+	return c.makeRequest(c.parseGraphQLRequest(url, request, params))
+}
+
+func (c *Client) parseGraphQLRequest(url, request, params goja.Value) (*httpext.ParsedHTTPRequest, error) {
+	gqlReq, err := ParseGraphQLRequest(c.moduleInstance.vu.Runtime(), request)
+	if err != nil {
+		return nil, err
+	}
+	op, err := gqlReq.Operation()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(gqlReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.parseRequest(http.MethodPost, url, body, params)
+	if err != nil {
+		return nil, err
+	}
+	req.GraphQL = true
+	op.Tags(req.Tags)
+	if req.Req.Header.Get("Content-Type") == "" {
+		req.Req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Req.Header.Get("Accept") == "" {
+		req.Req.Header.Set("Accept", "application/graphql-response+json, application/json")
+	}
+	return req, nil
+}
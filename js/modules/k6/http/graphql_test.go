@@ -0,0 +1,106 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext/httpext"
+	"go.k6.io/k6/stats"
+)
+
+func TestGraphQL(t *testing.T) {
+	t.Parallel()
+	tb, _, samples, rt, _ := newRuntime(t)
+	sr := tb.Replacer.Replace
+
+	var requests []httpext.GraphQLRequest
+	tb.Mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req httpext.GraphQLRequest
+		if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		if req.OperationName == "UpdateUser" {
+			_, _ = w.Write([]byte(`{"data": null, "errors": [{"message": "forbidden"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"user": {"id": "1"}}}`))
+	})
+
+	_, err := rt.RunString(sr(`
+	var query = "query GetUser($id: ID!) { user(id: $id) { id } } mutation UpdateUser { updateUser { id } }";
+	var res = http.graphql("HTTPBIN_URL/graphql", {query: query, operationName: "GetUser", variables: {id: "1"}});
+	if (res.status != 200 || res.json("data.user.id") != "1") { throw new Error("wrong response: " + res.body); }
+	res = http.graphql("HTTPBIN_URL/graphql", {query: query, operationName: "UpdateUser"},
+		{tags: {graphql_operation: "custom"}});
+	if (res.json("errors.0.message") != "forbidden") { throw new Error("wrong response: " + res.body); }
+	http.graphql("HTTPBIN_URL/graphql", "{ users { id } }");
+	res = http.graphql("HTTPBIN_URL/graphql", {query: query, operationName: "UpdateUser"}, {responseType: "none"});
+	if (res.body !== null) { throw new Error("the body wasn't discarded: " + res.body); }
+	`))
+	require.NoError(t, err)
+
+	require.Len(t, requests, 4)
+	assert.Equal(t, map[string]interface{}{"id": "1"}, requests[0].Variables)
+	assert.Equal(t, "{ users { id } }", requests[2].Query)
+	assert.Empty(t, requests[2].OperationName)
+
+	type result struct {
+		operation, operationType, expectedResponse string
+		failed                                     float64
+	}
+	var results []result
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name != metrics.HTTPReqFailedName {
+				continue
+			}
+			tags := s.Tags.CloneTags()
+			results = append(results, result{
+				tags[httpext.GraphQLOperationTag], tags[httpext.GraphQLOperationTypeTag],
+				tags["expected_response"], s.Value,
+			})
+		}
+	}
+	assert.Equal(t, []result{
+		{"GetUser", "query", "true", 0},
+		{"custom", "mutation", "false", 1},
+		{"", "query", "true", 0},
+		{"UpdateUser", "mutation", "false", 1},
+	}, results)
+
+	_, err = rt.RunString(sr(`http.graphql("HTTPBIN_URL/graphql", {query: "query A { a } query B { b }"})`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the operationName is required")
+
+	_, err = rt.RunString(sr(`http.graphql("HTTPBIN_URL/graphql", {query: "{ a }", nope: 1})`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown GraphQL request field: 'nope'")
+}
@@ -27,8 +27,10 @@ import (
 	"github.com/dop251/goja"
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/netext"
 	"go.k6.io/k6/lib/netext/httpext"
+	"go.k6.io/k6/lib/types"
 )
 
 // RootModule is the global module object type. It is instantiated once per test
@@ -36,7 +38,9 @@ import (
 //
 // TODO: add sync.Once for all of the deprecation warnings we might want to do
 // for the old k6/http APIs here, so they are shown only once in a test run.
-type RootModule struct{}
+type RootModule struct {
+	oauth2 oauth2Sources
+}
 
 // ModuleInstance represents an instance of the HTTP module for every VU.
 type ModuleInstance struct {
@@ -44,6 +48,12 @@ type ModuleInstance struct {
 	rootModule    *RootModule
 	defaultClient *Client
 	exports       *goja.Object
+
+	// networkTransports are the transports of the network param by the
+	// conditions, so the requests with the same ones reuse the connections.
+	// They're only kept while the conditions of the VU are networkBase.
+	networkTransports map[string]http.RoundTripper
+	networkBase       types.NetworkConditions
 }
 
 var (
@@ -53,16 +63,21 @@ var (
 
 // New returns a pointer to a new HTTP RootModule.
 func New() *RootModule {
-	return &RootModule{}
+	return &RootModule{
+		oauth2: oauth2Sources{
+			data: make(map[string]*oauth2Source),
+		},
+	}
 }
 
 // NewModuleInstance returns an HTTP module instance for each VU.
 func (r *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
 	rt := vu.Runtime()
 	mi := &ModuleInstance{
-		vu:         vu,
-		rootModule: r,
-		exports:    rt.NewObject(),
+		vu:                vu,
+		rootModule:        r,
+		exports:           rt.NewObject(),
+		networkTransports: make(map[string]http.RoundTripper),
 	}
 	mi.defineConstants()
 
@@ -84,23 +99,9 @@ func (r *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
 	mustExport("CookieJar", mi.newCookieJar)
 	mustExport("cookieJar", mi.getVUCookieJar)
 	mustExport("file", mi.file) // TODO: deprecate or refactor?
+	mustExport("OAuth2Client", mi.newOAuth2Client)
 
-	// TODO: refactor so the Client actually has better APIs and these are
-	// wrappers (facades) that convert the old k6 idiosyncratic APIs to the new
-	// proper Client ones that accept Request objects and don't suck
-	mustExport("get", func(url goja.Value, args ...goja.Value) (*Response, error) {
-		args = append([]goja.Value{goja.Undefined()}, args...) // sigh
-		return mi.defaultClient.Request(http.MethodGet, url, args...)
-	})
-	mustExport("head", mi.defaultClient.getMethodClosure(http.MethodHead))
-	mustExport("post", mi.defaultClient.getMethodClosure(http.MethodPost))
-	mustExport("put", mi.defaultClient.getMethodClosure(http.MethodPut))
-	mustExport("patch", mi.defaultClient.getMethodClosure(http.MethodPatch))
-	mustExport("del", mi.defaultClient.getMethodClosure(http.MethodDelete))
-	mustExport("options", mi.defaultClient.getMethodClosure(http.MethodOptions))
-	mustExport("request", mi.defaultClient.Request)
-	mustExport("batch", mi.defaultClient.Batch)
-	mustExport("setResponseCallback", mi.defaultClient.SetResponseCallback)
+	mi.defineClientMethods(mi.exports, mi.defaultClient)
 
 	mustExport("expectedStatuses", mi.expectedStatuses) // TODO: refactor?
 
@@ -114,6 +115,34 @@ func (r *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
 	return mi
 }
 
+// defineClientMethods sets the request methods of the provided client on obj.
+//
+// TODO: refactor so the Client actually has better APIs and these are
+// wrappers (facades) that convert the old k6 idiosyncratic APIs to the new
+// proper Client ones that accept Request objects and don't suck
+func (mi *ModuleInstance) defineClientMethods(obj *goja.Object, client *Client) {
+	mustExport := func(name string, value interface{}) {
+		if err := obj.Set(name, value); err != nil {
+			common.Throw(mi.vu.Runtime(), err)
+		}
+	}
+
+	mustExport("get", func(url goja.Value, args ...goja.Value) (*Response, error) {
+		args = append([]goja.Value{goja.Undefined()}, args...) // sigh
+		return client.Request(http.MethodGet, url, args...)
+	})
+	mustExport("head", client.getMethodClosure(http.MethodHead))
+	mustExport("post", client.getMethodClosure(http.MethodPost))
+	mustExport("put", client.getMethodClosure(http.MethodPut))
+	mustExport("patch", client.getMethodClosure(http.MethodPatch))
+	mustExport("del", client.getMethodClosure(http.MethodDelete))
+	mustExport("options", client.getMethodClosure(http.MethodOptions))
+	mustExport("request", client.Request)
+	mustExport("batch", client.Batch)
+	mustExport("graphql", client.GraphQL)
+	mustExport("setResponseCallback", client.SetResponseCallback)
+}
+
 // Exports returns the JS values this module exports.
 func (mi *ModuleInstance) Exports() modules.Exports {
 	return modules.Exports{
@@ -172,6 +201,39 @@ func (mi *ModuleInstance) getVUCookieJar(call goja.FunctionCall) goja.Value {
 	return nil
 }
 
+// networkTransport returns the transport for the requests with the network
+// param, the conditions are applied on top of the ones of the VU.
+func (mi *ModuleInstance) networkTransport(
+	state *lib.State, network types.NetworkConditions,
+) (http.RoundTripper, error) {
+	if base := netext.DialerNetworkConditions(state.Dialer); base != mi.networkBase {
+		mi.closeNetworkTransports()
+		mi.networkBase = base
+	}
+	emulator := netext.NewClientNetworkEmulator(state.Dialer, network)
+	key := emulator.Conditions().String()
+	if transport, ok := mi.networkTransports[key]; ok {
+		return transport, nil
+	}
+	transport, err := httpext.NewNetworkTransport(state.Transport, emulator)
+	if err != nil {
+		return nil, err
+	}
+	mi.networkTransports[key] = transport
+	return transport, nil
+}
+
+// closeNetworkTransports closes the idle connections of the cached network
+// transports and drops them, since they were made for other VU conditions.
+func (mi *ModuleInstance) closeNetworkTransports() {
+	for key, transport := range mi.networkTransports {
+		if t, ok := transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+		delete(mi.networkTransports, key)
+	}
+}
+
 // URL creates a new URL wrapper from the provided parts.
 func (mi *ModuleInstance) URL(parts []string, pieces ...string) (httpext.URL, error) {
 	var name, urlstr string
@@ -192,4 +254,5 @@ func (mi *ModuleInstance) URL(parts []string, pieces ...string) (httpext.URL, er
 type Client struct {
 	moduleInstance   *ModuleInstance
 	responseCallback func(int) bool
+	oauth2           *oauth2Source
 }
@@ -0,0 +1,367 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/netext/httpext"
+	"go.k6.io/k6/lib/types"
+)
+
+const (
+	oauth2GrantClientCredentials = "client_credentials"
+	oauth2GrantRefreshToken      = "refresh_token"
+
+	oauth2DefaultRefreshBefore = 30 * time.Second
+)
+
+// oauth2Config is the configuration of a named OAuth2 token source, as passed
+// to the http.OAuth2Client constructor.
+type oauth2Config struct {
+	tokenURL      string
+	clientID      string
+	clientSecret  string
+	grantType     string
+	refreshToken  string
+	scopes        []string
+	params        map[string]string
+	authInParams  bool
+	refreshBefore time.Duration
+	tags          map[string]string
+}
+
+// oauth2Source holds the tokens for a single OAuth2 client. It's shared
+// between all VUs, so only one of them fetches a new token at a time.
+type oauth2Source struct {
+	name   string
+	config oauth2Config
+
+	fetchMu sync.Mutex // held while a token is being fetched
+
+	mu           sync.Mutex // guards the fields below
+	accessToken  string
+	tokenType    string
+	refreshToken string
+	expiry       time.Time
+	refreshing   bool
+}
+
+type oauth2Sources struct {
+	data map[string]*oauth2Source
+	mu   sync.Mutex
+}
+
+// get returns the shared token source of the client with the name, which
+// needs to have the same configuration in all the VUs.
+func (s *oauth2Sources) get(name string, config oauth2Config) (*oauth2Source, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, ok := s.data[name]
+	if !ok {
+		source = &oauth2Source{name: name, config: config, refreshToken: config.refreshToken}
+		s.data[name] = source
+	}
+	if !reflect.DeepEqual(source.config, config) {
+		return nil, fmt.Errorf("the OAuth2Client '%s' was already created with a different configuration", name)
+	}
+	return source, nil
+}
+
+// newOAuth2Client is the constructor for http.OAuth2Client objects. Clients
+// with the same name share their tokens across all VUs, so they need to have
+// the same configuration.
+func (mi *ModuleInstance) newOAuth2Client(call goja.ConstructorCall) *goja.Object {
+	rt := mi.vu.Runtime()
+
+	name := call.Argument(0).String()
+	if name == "" {
+		common.Throw(rt, errors.New("empty name provided to OAuth2Client's constructor"))
+	}
+	config, err := parseOAuth2Config(rt, call.Argument(1))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	source, err := mi.rootModule.oauth2.get(name, config)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	client := &Client{
+		moduleInstance:   mi,
+		responseCallback: defaultExpectedStatuses.match,
+		oauth2:           source,
+	}
+
+	obj := rt.NewObject()
+	mi.defineClientMethods(obj, client)
+	if err = obj.Set("token", client.oauth2Token); err != nil {
+		common.Throw(rt, err)
+	}
+	return obj
+}
+
+//nolint:funlen,cyclop
+func parseOAuth2Config(rt *goja.Runtime, configV goja.Value) (oauth2Config, error) {
+	config := oauth2Config{
+		grantType:     oauth2GrantClientCredentials,
+		refreshBefore: oauth2DefaultRefreshBefore,
+		params:        make(map[string]string),
+		tags:          make(map[string]string),
+	}
+	if goja.IsUndefined(configV) || goja.IsNull(configV) {
+		return config, errors.New("OAuth2Client requires a configuration object")
+	}
+
+	obj := configV.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		switch k {
+		case "tokenUrl":
+			config.tokenURL = v.String()
+		case "clientId":
+			config.clientID = v.String()
+		case "clientSecret":
+			config.clientSecret = v.String()
+		case "grantType":
+			config.grantType = v.String()
+		case "refreshToken":
+			config.refreshToken = v.String()
+		case "scopes":
+			switch scopes := v.Export().(type) {
+			case string:
+				config.scopes = strings.Fields(scopes)
+			case []interface{}:
+				for _, scope := range scopes {
+					config.scopes = append(config.scopes, fmt.Sprint(scope))
+				}
+			}
+		case "params":
+			paramsObj := v.ToObject(rt)
+			for _, key := range paramsObj.Keys() {
+				config.params[key] = paramsObj.Get(key).String()
+			}
+		case "authStyle":
+			switch authStyle := v.String(); authStyle {
+			case "header":
+				config.authInParams = false
+			case "params":
+				config.authInParams = true
+			default:
+				return config, fmt.Errorf("unsupported OAuth2 authStyle %q, supported styles are header and params", authStyle)
+			}
+		case "refreshBefore":
+			d, err := types.GetDurationValue(v.Export())
+			if err != nil {
+				return config, fmt.Errorf("invalid refreshBefore value: %w", err)
+			}
+			config.refreshBefore = d
+		case "tags":
+			tagsObj := v.ToObject(rt)
+			for _, key := range tagsObj.Keys() {
+				config.tags[key] = tagsObj.Get(key).String()
+			}
+		case "group":
+			if group := v.String(); group != "" {
+				config.tags["group"] = lib.GroupSeparator + group
+			}
+		}
+	}
+
+	switch {
+	case config.tokenURL == "":
+		return config, errors.New("OAuth2Client requires a tokenUrl")
+	case config.grantType != oauth2GrantClientCredentials && config.grantType != oauth2GrantRefreshToken:
+		return config, fmt.Errorf("unsupported OAuth2 grantType %q, supported grant types are %s and %s",
+			config.grantType, oauth2GrantClientCredentials, oauth2GrantRefreshToken)
+	case config.grantType == oauth2GrantRefreshToken && config.refreshToken == "":
+		return config, errors.New("the refresh_token OAuth2 grantType requires a refreshToken")
+	}
+	return config, nil
+}
+
+// oauth2Token returns the current access token, fetching a new one if needed.
+func (c *Client) oauth2Token() (string, error) {
+	state := c.moduleInstance.vu.State()
+	if state == nil {
+		return "", ErrHTTPForbiddenInInitContext
+	}
+	_, token, err := c.oauth2.token(c, state)
+	return token, err
+}
+
+// token returns the token type and a valid access token. Tokens are refreshed
+// refreshBefore their expiry by a single VU while the rest keep using the old
+// one, and only when there's no valid token at all do all VUs wait for it.
+func (s *oauth2Source) token(c *Client, state *lib.State) (string, string, error) {
+	s.mu.Lock()
+	now := time.Now()
+	if s.isValid(now) && (!s.needsRefresh(now) || s.refreshing) {
+		defer s.mu.Unlock()
+		return s.tokenType, s.accessToken, nil
+	}
+	s.mu.Unlock()
+
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	// another VU could have fetched a new token while we were waiting
+	s.mu.Lock()
+	now = time.Now()
+	if s.isValid(now) && !s.needsRefresh(now) {
+		defer s.mu.Unlock()
+		return s.tokenType, s.accessToken, nil
+	}
+	s.refreshing = true
+	refreshToken := s.refreshToken
+	s.mu.Unlock()
+
+	tokenResp, err := s.fetch(c, state, refreshToken)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshing = false
+	if err != nil {
+		return "", "", err
+	}
+
+	s.accessToken = tokenResp.AccessToken
+	s.tokenType = tokenResp.TokenType
+	if s.tokenType == "" || strings.EqualFold(s.tokenType, "bearer") {
+		s.tokenType = "Bearer"
+	}
+	if tokenResp.RefreshToken != "" {
+		s.refreshToken = tokenResp.RefreshToken
+	}
+	s.expiry = time.Time{}
+	if tokenResp.ExpiresIn > 0 {
+		s.expiry = now.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return s.tokenType, s.accessToken, nil
+}
+
+func (s *oauth2Source) isValid(now time.Time) bool {
+	return s.accessToken != "" && (s.expiry.IsZero() || now.Before(s.expiry))
+}
+
+func (s *oauth2Source) needsRefresh(now time.Time) bool {
+	return !s.expiry.IsZero() && !now.Add(s.config.refreshBefore).Before(s.expiry)
+}
+
+type oauth2TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// fetch requests a new token from the token endpoint with the state of the
+// VU that needed it, so the request is measured like any other one. It's
+// tagged with oauth2 and the name of the client, so it can be told apart from
+// the requests of the test, and with the tags (or group) from the OAuth2 client
+// configuration, which can override it.
+func (s *oauth2Source) fetch(c *Client, state *lib.State, refreshToken string) (*oauth2TokenResponse, error) {
+	form := make(url.Values, len(s.config.params)+4)
+	for k, v := range s.config.params {
+		form.Set(k, v)
+	}
+	if refreshToken != "" {
+		form.Set("grant_type", oauth2GrantRefreshToken)
+		form.Set("refresh_token", refreshToken)
+	} else {
+		form.Set("grant_type", s.config.grantType)
+	}
+	if len(s.config.scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.scopes, " "))
+	}
+	if s.config.authInParams {
+		form.Set("client_id", s.config.clientID)
+		if s.config.clientSecret != "" {
+			form.Set("client_secret", s.config.clientSecret)
+		}
+	}
+
+	u, err := httpext.NewURL(s.config.tokenURL, s.config.tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(s.config.tags)+1)
+	tags["oauth2"] = s.name
+	for k, v := range s.config.tags {
+		tags[k] = v
+	}
+	preq := &httpext.ParsedHTTPRequest{
+		URL: &u,
+		Req: &http.Request{
+			Method: http.MethodPost,
+			URL:    u.GetURL(),
+			Header: make(http.Header),
+		},
+		Body:             bytes.NewBufferString(form.Encode()),
+		Timeout:          60 * time.Second,
+		Redirects:        state.Options.MaxRedirects,
+		ResponseType:     httpext.ResponseTypeText,
+		ResponseCallback: defaultExpectedStatuses.match,
+		Cookies:          make(map[string]*httpext.HTTPRequestCookie),
+		Tags:             tags,
+	}
+	preq.Req.Header.Set("User-Agent", state.Options.UserAgent.String)
+	preq.Req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	preq.Req.Header.Set("Accept", "application/json")
+	if !s.config.authInParams && s.config.clientID != "" {
+		preq.Req.SetBasicAuth(url.QueryEscape(s.config.clientID), url.QueryEscape(s.config.clientSecret))
+	}
+
+	resp, err := httpext.MakeRequest(c.moduleInstance.vu.Context(), state, preq)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch an OAuth2 token: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("couldn't fetch an OAuth2 token: %s", resp.Error)
+	}
+	body, _ := resp.Body.(string)
+	if resp.Status < 200 || resp.Status > 299 {
+		return nil, fmt.Errorf("couldn't fetch an OAuth2 token, the token endpoint returned %d: %s", resp.Status, body)
+	}
+
+	tokenResp := &oauth2TokenResponse{}
+	if err = json.Unmarshal([]byte(body), tokenResp); err != nil {
+		return nil, fmt.Errorf("couldn't parse the OAuth2 token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("the OAuth2 token response didn't contain an access_token")
+	}
+	return tokenResp, nil
+}
@@ -0,0 +1,207 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/stats"
+)
+
+type oauth2TestServer struct {
+	mu         sync.Mutex
+	calls      int
+	grantTypes []string
+	scopes     []string
+	expiresIn  int
+}
+
+func (s *oauth2TestServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, pass, ok := req.BasicAuth(); !ok || user != "client" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = fmt.Fprint(w, `{"error": "invalid_client"}`)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.calls++
+	s.grantTypes = append(s.grantTypes, req.PostForm.Get("grant_type")+":"+req.PostForm.Get("refresh_token"))
+	s.scopes = append(s.scopes, req.PostForm.Get("scope"))
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %d, "refresh_token": "refresh-%d"}`,
+		s.calls, s.expiresIn, s.calls)
+}
+
+func TestOAuth2Client(t *testing.T) {
+	t.Parallel()
+	tb, state, samples, rt, mi := newRuntime(t)
+	sr := tb.Replacer.Replace
+
+	server := &oauth2TestServer{expiresIn: 3600}
+	tb.Mux.Handle("/oauth2/token", server)
+
+	// a second VU that shares the root module with the first one
+	rt2 := goja.New()
+	rt2.SetFieldNameMapper(common.FieldNameMapper{})
+	mi2 := mi.rootModule.NewModuleInstance(&modulestest.VU{
+		RuntimeField: rt2,
+		InitEnvField: &common.InitEnvironment{Registry: metrics.NewRegistry()},
+		CtxField:     tb.Context,
+		StateField:   state,
+	})
+	require.NoError(t, rt2.Set("http", mi2.Exports().Default))
+
+	script := sr(`
+	var client = new http.OAuth2Client("idp", {
+		tokenUrl: "HTTPBIN_URL/oauth2/token",
+		clientId: "client",
+		clientSecret: "secret",
+		scopes: ["read", "write"],
+		tags: { oauth2: "token" },
+	});
+	var res = client.get("HTTPBIN_URL/headers");
+	if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+	if (res.json().headers["Authorization"] != "Bearer token-1") {
+		throw new Error("wrong Authorization header: " + res.json().headers["Authorization"]);
+	}
+	if (client.token() != "token-1") { throw new Error("wrong token: " + client.token()); }
+	res = client.get("HTTPBIN_URL/headers", { headers: { Authorization: "Basic Zm9vOmJhcg==" } });
+	if (res.json().headers["Authorization"] != "Basic Zm9vOmJhcg==") {
+		throw new Error("the Authorization header was overwritten: " + res.json().headers["Authorization"]);
+	}
+	`)
+	_, err := rt.RunString(script)
+	require.NoError(t, err)
+	_, err = rt2.RunString(script)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, server.calls)
+	assert.Equal(t, []string{"read write"}, server.scopes)
+
+	tokenRequests := 0
+	for _, container := range stats.GetBufferedSamples(samples) {
+		for _, sample := range container.GetSamples() {
+			if sample.Metric.Name != metrics.HTTPReqsName {
+				continue
+			}
+			url, _ := sample.Tags.Get("url")
+			oauth2Tag, _ := sample.Tags.Get("oauth2")
+			if url == sr("HTTPBIN_URL/oauth2/token") {
+				tokenRequests++
+				assert.Equal(t, "token", oauth2Tag)
+			} else {
+				assert.Empty(t, oauth2Tag)
+			}
+		}
+	}
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestOAuth2ClientRefresh(t *testing.T) {
+	t.Parallel()
+	tb, _, _, rt, _ := newRuntime(t)
+	sr := tb.Replacer.Replace
+
+	server := &oauth2TestServer{expiresIn: 60}
+	tb.Mux.Handle("/oauth2/token", server)
+
+	_, err := rt.RunString(sr(`
+	var client = new http.OAuth2Client("idp", {
+		tokenUrl: "HTTPBIN_URL/oauth2/token",
+		clientId: "client",
+		clientSecret: "secret",
+		refreshBefore: "2m",
+		group: "oauth2",
+	});
+	var tokens = [client.token(), client.token()];
+	if (tokens.join() != "token-1,token-2") { throw new Error("wrong tokens: " + tokens.join()); }
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"client_credentials:", "refresh_token:refresh-1"}, server.grantTypes)
+}
+
+func TestOAuth2ClientDefaultTag(t *testing.T) {
+	t.Parallel()
+	tb, _, samples, rt, _ := newRuntime(t)
+	sr := tb.Replacer.Replace
+	tb.Mux.Handle("/oauth2/token", &oauth2TestServer{expiresIn: 3600})
+
+	_, err := rt.RunString(sr(`
+	var client = new http.OAuth2Client("idp", {
+		tokenUrl: "HTTPBIN_URL/oauth2/token",
+		clientId: "client",
+		clientSecret: "secret",
+	});
+	client.get("HTTPBIN_URL/get");
+	`))
+	require.NoError(t, err)
+
+	bufSamples := stats.GetBufferedSamples(samples)
+	assert.Equal(t, 1, testutils.CountMetric(bufSamples, metrics.HTTPReqsName, map[string]string{
+		"url": sr("HTTPBIN_URL/oauth2/token"), "oauth2": "idp",
+	}))
+	assert.Equal(t, 1, testutils.CountMetric(bufSamples, metrics.HTTPReqsName, map[string]string{
+		"url": sr("HTTPBIN_URL/get"),
+	}))
+	assert.Equal(t, 0, testutils.CountMetric(bufSamples, metrics.HTTPReqsName, map[string]string{
+		"url": sr("HTTPBIN_URL/get"), "oauth2": "idp",
+	}))
+}
+
+func TestOAuth2ClientErrors(t *testing.T) {
+	t.Parallel()
+	tb, _, _, rt, _ := newRuntime(t)
+	sr := tb.Replacer.Replace
+	tb.Mux.Handle("/oauth2/token", &oauth2TestServer{expiresIn: 60})
+
+	testCases := map[string]string{
+		`new http.OAuth2Client("", {})`:                                             "empty name provided",
+		`new http.OAuth2Client("idp")`:                                              "requires a configuration object",
+		`new http.OAuth2Client("idp", {})`:                                          "requires a tokenUrl",
+		`new http.OAuth2Client("idp", {tokenUrl: "x", grantType: "x"})`:             `unsupported OAuth2 grantType "x"`,
+		`new http.OAuth2Client("idp", {tokenUrl: "x", authStyle: "x"})`:             `unsupported OAuth2 authStyle "x"`,
+		`new http.OAuth2Client("idp", {tokenUrl: "x", grantType: "refresh_token"})`: "requires a refreshToken",
+		`new http.OAuth2Client("bad-secret", {tokenUrl: "HTTPBIN_URL/oauth2/token", clientId: "client"}).get("HTTPBIN_URL/get")`: "the token endpoint returned 401",
+		`new http.OAuth2Client("twice", {tokenUrl: "x"}); new http.OAuth2Client("twice", {tokenUrl: "y"})`:                       "the OAuth2Client 'twice' was already created with a different configuration",
+	}
+	for script, expErr := range testCases {
+		_, err := rt.RunString(sr(script))
+		require.Error(t, err, script)
+		assert.Contains(t, err.Error(), expErr, script)
+	}
+}
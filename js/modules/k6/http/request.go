@@ -71,6 +71,13 @@ func (c *Client) Request(method string, url goja.Value, args ...goja.Value) (*Re
 	}
 
 	req, err := c.parseRequest(method, url, body, params)
+	return c.makeRequest(req, err)
+}
+
+// makeRequest makes the parsed request, or handles the error from parsing it
+// according to the throw option.
+func (c *Client) makeRequest(req *httpext.ParsedHTTPRequest, err error) (*Response, error) {
+	state := c.moduleInstance.vu.State()
 	if err != nil {
 		if state.Options.Throw.Bool {
 			return nil, err
@@ -340,7 +347,23 @@ func (c *Client) parseRequest(
 					result.Tags[key] = tagObj.Get(key).String()
 				}
 			case "auth":
-				result.Auth = params.Get(k).String()
+				authV := params.Get(k)
+				if goja.IsUndefined(authV) || goja.IsNull(authV) {
+					continue
+				}
+				if authObj, ok := authV.Export().(map[string]interface{}); ok {
+					authType, _ := authObj["type"].(string)
+					if result.Signer, err = httpext.NewRequestSigner(authType, authObj); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				result.Auth = authV.String()
+				if httpext.HasRequestSigner(result.Auth) {
+					if result.Signer, err = httpext.NewRequestSigner(result.Auth, nil); err != nil {
+						return nil, err
+					}
+				}
 			case "timeout":
 				t, err := types.GetDurationValue(params.Get(k).Export())
 				if err != nil {
@@ -349,6 +372,28 @@ func (c *Client) parseRequest(
 				result.Timeout = t
 			case "throw":
 				result.Throw = params.Get(k).ToBoolean()
+			case "network":
+				v := params.Get(k)
+				if goja.IsUndefined(v) || goja.IsNull(v) {
+					continue
+				}
+				network, err := types.GetNetworkConditions(v.Export())
+				if err != nil {
+					return nil, err
+				}
+				if result.Transport, err = c.moduleInstance.networkTransport(state, network); err != nil {
+					return nil, err
+				}
+			case "signal":
+				v := params.Get(k)
+				if goja.IsUndefined(v) || goja.IsNull(v) {
+					continue
+				}
+				signal := common.GetAbortSignal(v)
+				if signal == nil {
+					return nil, errors.New("the signal param needs to be an AbortSignal")
+				}
+				result.Abort = signal
 			case "responseType":
 				responseType, err := httpext.ResponseTypeString(params.Get(k).String())
 				if err != nil {
@@ -368,6 +413,14 @@ func (c *Client) parseRequest(
 		}
 	}
 
+	if c.oauth2 != nil && result.Req.Header.Get("Authorization") == "" && result.Signer == nil {
+		tokenType, token, err := c.oauth2.token(c, state)
+		if err != nil {
+			return nil, err
+		}
+		result.Req.Header.Set("Authorization", tokenType+" "+token)
+	}
+
 	if result.ActiveJar != nil {
 		httpext.SetRequestCookies(result.Req, result.ActiveJar, result.Cookies)
 	}
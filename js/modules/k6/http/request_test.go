@@ -48,11 +48,15 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
 
+	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modulestest"
 	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext"
+	"go.k6.io/k6/lib/netext/httpext"
 	"go.k6.io/k6/lib/testutils"
 	"go.k6.io/k6/lib/testutils/httpmultibin"
+	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/stats"
 )
 
@@ -170,9 +174,28 @@ func newRuntime(t testing.TB) (
 	return tb, state, samples, rt, mi
 }
 
+type testSigner struct {
+	secret string
+}
+
+func newTestSigner(params map[string]interface{}) (httpext.RequestSigner, error) {
+	secret, _ := params["secret"].(string)
+	return testSigner{secret: secret}, nil
+}
+
+// SignRequest checks that the signer sees the final (compressed) body and headers
+func (s testSigner) SignRequest(req *http.Request, body []byte) error {
+	state := "plain"
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		state = "gzipped"
+	}
+	req.Header.Set("X-Test-Signature", s.secret+"/"+req.Header.Get("Content-Encoding")+"/"+state)
+	return nil
+}
+
 func TestRequestAndBatch(t *testing.T) {
 	t.Parallel()
-	tb, state, samples, rt, _ := newRuntime(t)
+	tb, state, samples, rt, mi := newRuntime(t)
 	sr := tb.Replacer.Replace
 
 	// Handle paths with custom logic
@@ -277,6 +300,87 @@ func TestRequestAndBatch(t *testing.T) {
 			assert.NoError(t, err)
 		})
 	})
+	t.Run("Network", func(t *testing.T) {
+		_, err := rt.RunString(sr(`
+			http.get("HTTPBIN_URL/get");
+			var res = http.get("HTTPBIN_URL/get", { network: { latency: "100ms" } });
+			if (res.status !== 200) { throw new Error("wrong status: " + res.status) }
+			if (res.timings.connecting < 100 || res.timings.waiting < 100) {
+				throw new Error("the latency wasn't emulated: " + JSON.stringify(res.timings))
+			}
+			res = http.get("HTTPBIN_URL/get");
+			if (res.timings.waiting >= 100) { throw new Error("the latency was emulated without the param") }
+		`))
+		assert.NoError(t, err)
+
+		_, err = rt.RunString(sr(`http.get("HTTPBIN_URL/get", { network: "5g" })`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown network preset '5g'")
+	})
+	t.Run("NetworkTransportsEviction", func(t *testing.T) {
+		_, err := rt.RunString(sr(`http.get("HTTPBIN_URL/get", { network: { latency: "10ms" } })`))
+		require.NoError(t, err)
+		assert.Contains(t, mi.networkTransports, "latency=10ms")
+
+		tb.Dialer.NetworkEmulator = netext.NewNetworkEmulator(types.NetworkConditions{
+			Jitter: types.NullDurationFrom(5 * time.Millisecond),
+		})
+		state.Dialer = tb.Dialer
+		defer func() {
+			tb.Dialer.NetworkEmulator = nil
+			state.Dialer = nil
+		}()
+
+		_, err = rt.RunString(sr(`http.get("HTTPBIN_URL/get", { network: { latency: "20ms" } })`))
+		require.NoError(t, err)
+		assert.Len(t, mi.networkTransports, 1)
+		assert.Contains(t, mi.networkTransports, "latency=20ms,jitter=5ms")
+	})
+	t.Run("Signal", func(t *testing.T) {
+		require.NoError(t, common.RegisterWebAPIs(rt))
+		t.Run("aborted", func(t *testing.T) {
+			hook := logtest.NewLocal(state.Logger)
+			defer hook.Reset()
+
+			_, err := rt.RunString(sr(`
+				var ac = new AbortController();
+				ac.abort("stop");
+				var res = http.get("HTTPBIN_URL/delay/10", { signal: ac.signal, throw: false });
+				if (res.error !== "aborted: stop" || res.error_code !== 1060) { throw new Error("wrong error: " + res.error) }
+				http.get("HTTPBIN_URL/delay/10", { signal: AbortSignal.abort(), throw: true });
+			`))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "aborted: AbortError: The operation was aborted.")
+			assert.Nil(t, hook.LastEntry())
+		})
+		t.Run("in flight", func(t *testing.T) {
+			hook := logtest.NewLocal(state.Logger)
+			defer hook.Reset()
+
+			start := time.Now()
+			_, err := rt.RunString(sr(`
+				var res = http.get("HTTPBIN_URL/delay/10", { signal: AbortSignal.timeout(100), throw: false });
+				if (res.error !== "aborted: the operation timed out" || res.error_code !== 1060) {
+					throw new Error("wrong error: " + res.error)
+				}
+			`))
+			require.NoError(t, err)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Nil(t, hook.LastEntry())
+		})
+		t.Run("not aborted", func(t *testing.T) {
+			_, err := rt.RunString(sr(`
+				var res = http.get("HTTPBIN_URL/get", { signal: new AbortController().signal });
+				if (res.status !== 200) { throw new Error("wrong status: " + res.status) }
+			`))
+			assert.NoError(t, err)
+		})
+		t.Run("invalid", func(t *testing.T) {
+			_, err := rt.RunString(sr(`http.get("HTTPBIN_URL/get", { signal: {} })`))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "the signal param needs to be an AbortSignal")
+		})
+	})
 	t.Run("Timeout", func(t *testing.T) {
 		t.Run("10s", func(t *testing.T) {
 			_, err := rt.RunString(sr(`
@@ -950,6 +1054,52 @@ func TestRequestAndBatch(t *testing.T) {
 					assert.NoError(t, err)
 				})
 			})
+			t.Run("aws-sigv4", func(t *testing.T) {
+				_, err := rt.RunString(sr(`
+				var res = http.request("POST", "HTTPBIN_URL/post?b=2&a=1", "payload", {
+					auth: {
+						type: "aws-sigv4",
+						region: "us-east-1",
+						service: "execute-api",
+						accessKeyId: "AKID",
+						secretAccessKey: "secret",
+						sessionToken: "token",
+					},
+					headers: { "X-Custom": "value" },
+				});
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				var headers = res.json().headers;
+				var auth = String(headers["Authorization"]);
+				if (!/^AWS4-HMAC-SHA256 Credential=AKID\/\d{8}\/us-east-1\/execute-api\/aws4_request, SignedHeaders=host;x-amz-date;x-amz-security-token;x-custom, Signature=[0-9a-f]{64}$/.test(auth)) {
+					throw new Error("wrong Authorization header: " + auth);
+				}
+				if (headers["X-Amz-Security-Token"] != "token") { throw new Error("wrong security token"); }
+				`))
+				assert.NoError(t, err)
+				assertRequestMetricsEmitted(t, stats.GetBufferedSamples(samples), "POST",
+					sr("HTTPBIN_URL/post?b=2&a=1"), "", 200, "")
+
+				_, err = rt.RunString(sr(`http.request("GET", "HTTPBIN_URL/get", null, { auth: "aws-sigv4" });`))
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), `aws-sigv4: the auth param needs to be an object with the params, like `+
+					`{ type: "aws-sigv4", region:`)
+			})
+			t.Run("custom signer", func(t *testing.T) {
+				if !httpext.HasRequestSigner("test-signer") {
+					httpext.RegisterRequestSigner("test-signer", newTestSigner)
+				}
+				_, err := rt.RunString(sr(`
+				var res = http.request("POST", "HTTPBIN_URL/post", "payload", {
+					auth: { type: "test-signer", secret: "s3cr3t" },
+					compression: "gzip",
+				});
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				var signature = res.json().headers["X-Test-Signature"];
+				if (signature != "s3cr3t/gzip/gzipped") { throw new Error("wrong signature: " + signature); }
+				`))
+				assert.NoError(t, err)
+				assertRequestMetricsEmitted(t, stats.GetBufferedSamples(samples), "POST", sr("HTTPBIN_URL/post"), "", 200, "")
+			})
 		})
 
 		t.Run("headers", func(t *testing.T) {
@@ -0,0 +1,542 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package mqtt implements the k6/net/mqtt module, an MQTT 3.1.1 and 5 client
+// that connects through the dialer of the VU.
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext/mqttext"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// ModuleInstance represents an instance of the MQTT module.
+	ModuleInstance struct {
+		vu modules.VU
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+const defaultTimeout = 60 * time.Second
+
+// ErrMQTTInInitContext is returned when MQTT is used in the init context.
+var ErrMQTTInInitContext = common.NewInitContextError("using MQTT in the init context is not supported")
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu}
+}
+
+// Exports returns the exports of the module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"connect": mi.Connect,
+		},
+	}
+}
+
+type connectParams struct {
+	opts       mqttext.Options
+	tags       map[string]string
+	timeout    time.Duration
+	useTLS     bool
+	serverName string
+}
+
+//nolint:funlen,cyclop
+func (mi *ModuleInstance) parseConnectParams(state *lib.State, paramsV goja.Value) (connectParams, error) {
+	rt := mi.vu.Runtime()
+	p := connectParams{
+		opts:    mqttext.Options{Version: mqttext.Version311, CleanStart: true},
+		tags:    state.CloneTags(),
+		timeout: defaultTimeout,
+	}
+	if paramsV == nil || goja.IsUndefined(paramsV) || goja.IsNull(paramsV) {
+		return p, nil
+	}
+
+	params := paramsV.ToObject(rt)
+	for _, k := range params.Keys() {
+		v := params.Get(k)
+		switch k {
+		case "clientId":
+			p.opts.ClientID = v.String()
+		case "username":
+			p.opts.Username = v.String()
+		case "password":
+			p.opts.Password = v.String()
+		case "version":
+			switch v.String() {
+			case "3.1.1":
+				p.opts.Version = mqttext.Version311
+			case "5":
+				p.opts.Version = mqttext.Version5
+			default:
+				return p, fmt.Errorf("unsupported MQTT version '%s', it needs to be either \"3.1.1\" or \"5\"", v)
+			}
+		case "cleanSession":
+			p.opts.CleanStart = v.ToBoolean()
+		case "keepAlive":
+			d, err := types.GetDurationValue(v.Export())
+			if err != nil {
+				return p, fmt.Errorf("invalid keepAlive value: %w", err)
+			}
+			p.opts.KeepAlive = d
+		case "sessionExpiry":
+			d, err := types.GetDurationValue(v.Export())
+			if err != nil {
+				return p, fmt.Errorf("invalid sessionExpiry value: %w", err)
+			}
+			p.opts.SessionExpiry = d
+		case "will":
+			will, err := mi.parseWill(v)
+			if err != nil {
+				return p, err
+			}
+			p.opts.Will = will
+		case "tags":
+			if goja.IsUndefined(v) || goja.IsNull(v) {
+				continue
+			}
+			tagObj := v.ToObject(rt)
+			for _, key := range tagObj.Keys() {
+				p.tags[key] = tagObj.Get(key).String()
+			}
+		case "timeout":
+			d, err := types.GetDurationValue(v.Export())
+			if err != nil {
+				return p, fmt.Errorf("invalid timeout value: %w", err)
+			}
+			p.timeout = d
+		case "tls":
+			p.useTLS = v.ToBoolean()
+		case "serverName":
+			p.serverName = v.String()
+		default:
+			return p, fmt.Errorf("unknown connect param: '%s'", k)
+		}
+	}
+	return p, nil
+}
+
+func (mi *ModuleInstance) parseWill(v goja.Value) (*mqttext.Message, error) {
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, nil //nolint:nilnil
+	}
+	obj := v.ToObject(mi.vu.Runtime())
+	will := &mqttext.Message{}
+	for _, k := range obj.Keys() {
+		var err error
+		switch k {
+		case "topic":
+			will.Topic = obj.Get(k).String()
+		case "payload":
+			will.Payload, err = common.ToBytes(obj.Get(k).Export())
+		case "qos":
+			will.QoS, err = toQoS(obj.Get(k))
+		case "retain":
+			will.Retain = obj.Get(k).ToBoolean()
+		default:
+			err = fmt.Errorf("unknown will param: '%s'", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if will.Topic == "" {
+		return nil, errors.New("the will message needs a topic")
+	}
+	return will, nil
+}
+
+func toQoS(v goja.Value) (byte, error) {
+	qos := v.ToInteger()
+	if qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("invalid QoS %s, it needs to be 0, 1 or 2", v)
+	}
+	return byte(qos), nil
+}
+
+// Connect opens an MQTT session with the broker at the given host:port
+// address. The session is closed at the latest when the VU finishes.
+//
+//nolint:funlen
+func (mi *ModuleInstance) Connect(address string, paramsV goja.Value) (*Client, error) {
+	ctx := mi.vu.Context()
+	state := mi.vu.State()
+	if state == nil {
+		return nil, ErrMQTTInInitContext
+	}
+	p, err := mi.parseConnectParams(state, paramsV)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		scheme := "mqtt://"
+		if p.useTLS {
+			scheme = "mqtts://"
+		}
+		p.tags["url"] = scheme + address
+	}
+	if state.Options.SystemTags.Has(stats.TagProto) {
+		p.tags["proto"] = "MQTT/3.1.1"
+		if p.opts.Version == mqttext.Version5 {
+			p.tags["proto"] = "MQTT/5"
+		}
+	}
+
+	c := &Client{
+		vu:      mi.vu,
+		ctx:     ctx,
+		timeout: p.timeout,
+		tags:    p.tags,
+		samples: state.Samples,
+		metrics: state.BuiltinMetrics,
+		done:    make(chan struct{}),
+	}
+	p.opts.OnMessage = c.onMessage
+
+	start := time.Now()
+	dialCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	conn, err := state.Dialer.DialContext(dialCtx, "tcp", address)
+	if err != nil {
+		c.pushError("connect")
+		return nil, err
+	}
+	if p.useTLS {
+		if conn, err = handshake(dialCtx, state, conn, address, p.serverName); err != nil {
+			c.pushError("tls")
+			return nil, err
+		}
+	}
+	if c.client, err = mqttext.NewClient(dialCtx, conn, p.opts); err != nil {
+		c.pushError("connect")
+		return nil, err
+	}
+	c.ClientID, c.SessionPresent = c.client.ClientID, c.client.SessionPresent
+
+	tags := c.cloneTags()
+	stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+		Metric: state.BuiltinMetrics.MQTTConnecting,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   start,
+		Value:  stats.D(time.Since(start)),
+	})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.client.Close(false)
+		case <-c.done:
+		}
+	}()
+	return c, nil
+}
+
+// handshake upgrades the connection to TLS, with the TLS config of the VU.
+func handshake(ctx context.Context, state *lib.State, conn net.Conn, address, serverName string) (net.Conn, error) {
+	config := &tls.Config{} //nolint:gosec
+	if state.TLSConfig != nil {
+		config = state.TLSConfig.Clone()
+	}
+	config.NextProtos = nil
+	if serverName != "" {
+		config.ServerName = serverName
+	} else if host, _, err := net.SplitHostPort(address); err == nil {
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Client is an MQTT session.
+type Client struct {
+	vu      modules.VU
+	client  *mqttext.Client
+	timeout time.Duration
+	tags    map[string]string
+	// the context, samples and metrics are also used by the read loop of
+	// the client, which can't access the VU
+	ctx       context.Context
+	samples   chan<- stats.SampleContainer
+	metrics   *metrics.BuiltinMetrics
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// ClientID is the client identifier, which is assigned by the broker
+	// if it was empty with MQTT 5.
+	ClientID string `js:"clientId"`
+	// SessionPresent is whether the broker resumed a previous session.
+	SessionPresent bool `js:"sessionPresent"`
+}
+
+// Publish sends a string or ArrayBuffer payload to the topic. With QoS 1 and
+// 2, it waits until the broker acknowledged the message.
+func (c *Client) Publish(topic string, payloadV goja.Value, paramsV goja.Value) error {
+	msg := &mqttext.Message{Topic: topic}
+	if payloadV != nil && !goja.IsUndefined(payloadV) && !goja.IsNull(payloadV) {
+		var err error
+		if msg.Payload, err = common.ToBytes(payloadV.Export()); err != nil {
+			return err
+		}
+	}
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(c.vu.Runtime())
+		for _, k := range params.Keys() {
+			switch k {
+			case "qos":
+				qos, err := toQoS(params.Get(k))
+				if err != nil {
+					return err
+				}
+				msg.QoS = qos
+			case "retain":
+				msg.Retain = params.Get(k).ToBoolean()
+			default:
+				return fmt.Errorf("unknown publish param: '%s'", k)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.vu.Context(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	if err := c.client.Publish(ctx, msg); err != nil {
+		c.pushError("publish")
+		return err
+	}
+	now := time.Now()
+	tags := c.cloneTags()
+	samples := stats.Samples{{
+		Metric: c.metrics.MQTTMessagesSent,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   now,
+		Value:  1,
+	}}
+	if msg.QoS > 0 {
+		durationTags := c.cloneTags()
+		durationTags["qos"] = strconv.Itoa(int(msg.QoS))
+		samples = append(samples, stats.Sample{
+			Metric: c.metrics.MQTTPublishDuration,
+			Tags:   stats.IntoSampleTags(&durationTags),
+			Time:   now,
+			Value:  stats.D(now.Sub(start)),
+		})
+	}
+	stats.PushIfNotDone(c.vu.Context(), c.samples, samples)
+	return nil
+}
+
+// Subscribe subscribes to one or more topic filters and returns the QoS that
+// was granted for each of them. It fails if the broker rejected any of them.
+func (c *Client) Subscribe(filtersV goja.Value, paramsV goja.Value) ([]int, error) {
+	filters, err := c.toFilters(filtersV)
+	if err != nil {
+		return nil, err
+	}
+	var qos byte
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(c.vu.Runtime())
+		for _, k := range params.Keys() {
+			switch k {
+			case "qos":
+				if qos, err = toQoS(params.Get(k)); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("unknown subscribe param: '%s'", k)
+			}
+		}
+	}
+
+	subscriptions := make([]mqttext.Subscription, len(filters))
+	for i, filter := range filters {
+		subscriptions[i] = mqttext.Subscription{Filter: filter, QoS: qos}
+	}
+	ctx, cancel := context.WithTimeout(c.vu.Context(), c.timeout)
+	defer cancel()
+	codes, err := c.client.Subscribe(ctx, subscriptions)
+	if err != nil {
+		c.pushError("subscribe")
+		return nil, err
+	}
+	granted := make([]int, len(codes))
+	for i, code := range codes {
+		granted[i] = int(code)
+	}
+	return granted, nil
+}
+
+// Unsubscribe removes the subscriptions to one or more topic filters.
+func (c *Client) Unsubscribe(filtersV goja.Value) error {
+	filters, err := c.toFilters(filtersV)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.vu.Context(), c.timeout)
+	defer cancel()
+	if err = c.client.Unsubscribe(ctx, filters); err != nil {
+		c.pushError("unsubscribe")
+	}
+	return err
+}
+
+func (c *Client) toFilters(v goja.Value) ([]string, error) {
+	var filters []string
+	switch exported := common.ExportOrNil(v).(type) {
+	case string:
+		filters = []string{exported}
+	case []interface{}:
+		for _, f := range exported {
+			filter, ok := f.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid topic filter %v, it needs to be a string", f)
+			}
+			filters = append(filters, filter)
+		}
+	default:
+		return nil, errors.New("the topic filters need to be either a string or an array of strings")
+	}
+	if len(filters) == 0 {
+		return nil, errors.New("at least one topic filter is required")
+	}
+	return filters, nil
+}
+
+// Receive returns the next message that was received for the subscriptions,
+// or null if none was received until the timeout. The optional timeout
+// overrides the one of the client.
+func (c *Client) Receive(timeoutV goja.Value) (goja.Value, error) {
+	rt := c.vu.Runtime()
+	timeout := c.timeout
+	if timeoutV != nil && !goja.IsUndefined(timeoutV) && !goja.IsNull(timeoutV) {
+		d, err := types.GetDurationValue(timeoutV.Export())
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout value: %w", err)
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(c.vu.Context(), timeout)
+	defer cancel()
+	msg, err := c.client.Receive(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && c.vu.Context().Err() == nil {
+			return goja.Null(), nil
+		}
+		c.pushError("receive")
+		return nil, err
+	}
+	return rt.ToValue(map[string]interface{}{
+		"topic":   msg.Topic,
+		"payload": string(msg.Payload),
+		"data":    rt.NewArrayBuffer(msg.Payload),
+		"qos":     int(msg.QoS),
+		"retain":  msg.Retain,
+	}), nil
+}
+
+// Close ends the session. With sendWill, the broker publishes the will
+// message, as if the connection was lost.
+func (c *Client) Close(paramsV goja.Value) error {
+	sendWill := false
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(c.vu.Runtime())
+		for _, k := range params.Keys() {
+			switch k {
+			case "sendWill":
+				sendWill = params.Get(k).ToBoolean()
+			default:
+				return fmt.Errorf("unknown close param: '%s'", k)
+			}
+		}
+	}
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.client.Close(sendWill)
+}
+
+// onMessage is called by the read loop of the client for every message.
+func (c *Client) onMessage(*mqttext.Message) {
+	tags := c.cloneTags()
+	stats.PushIfNotDone(c.ctx, c.samples, stats.Sample{
+		Metric: c.metrics.MQTTMessagesReceived,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   time.Now(),
+		Value:  1,
+	})
+}
+
+func (c *Client) pushError(op string) {
+	tags := c.cloneTags()
+	tags["op"] = op
+	stats.PushIfNotDone(c.vu.Context(), c.samples, stats.Sample{
+		Metric: c.metrics.MQTTErrors,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   time.Now(),
+		Value:  1,
+	})
+}
+
+func (c *Client) cloneTags() map[string]string {
+	tags := make(map[string]string, len(c.tags)+1)
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	return tags
+}
@@ -0,0 +1,280 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext/mqttext"
+	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/lib/testutils/httpmultibin"
+	"go.k6.io/k6/lib/testutils/mqtttest"
+	"go.k6.io/k6/stats"
+)
+
+type testState struct {
+	rt      *goja.Runtime
+	tb      *httpmultibin.HTTPMultiBin
+	state   *lib.State
+	samples chan stats.SampleContainer
+	broker  *mqtttest.Broker
+}
+
+func newTestState(t testing.TB) testState {
+	tb := httpmultibin.NewHTTPMultiBin(t)
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+
+	samples := make(chan stats.SampleContainer, 1000)
+
+	state := &lib.State{
+		Group:  root,
+		Dialer: tb.Dialer,
+		Options: lib.Options{
+			SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagProto),
+		},
+		Samples:        samples,
+		TLSConfig:      tb.TLSClientConfig,
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+		Tags:           lib.NewTagMap(nil),
+	}
+
+	mi := New().NewModuleInstance(&modulestest.VU{
+		CtxField:     tb.Context,
+		InitEnvField: &common.InitEnvironment{},
+		RuntimeField: rt,
+		StateField:   state,
+	})
+	require.NoError(t, rt.Set("mqtt", mi.Exports().Named))
+
+	broker := mqtttest.NewBroker(t)
+	require.NoError(t, rt.Set("ADDR", broker.Addr))
+
+	return testState{
+		rt:      rt,
+		tb:      tb,
+		state:   state,
+		samples: samples,
+		broker:  broker,
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	t.Parallel()
+	for _, version := range []string{"3.1.1", "5"} {
+		version := version
+		t.Run(version, func(t *testing.T) {
+			t.Parallel()
+			ts := newTestState(t)
+			require.NoError(t, ts.rt.Set("VERSION", version))
+
+			_, err := ts.rt.RunString(`
+			var sub = mqtt.connect(ADDR, {version: VERSION, clientId: "sub", tags: {device: "sensor"}});
+			var pub = mqtt.connect(ADDR, {version: VERSION, clientId: "pub", keepAlive: "1s"});
+			var granted = sub.subscribe(["sensors/+/temperature", "sensors/#"], {qos: 2});
+			if (granted.length !== 2 || granted[0] !== 2) { throw new Error("wrong granted QoS: " + granted); }
+
+			for (var qos = 0; qos <= 2; qos++) {
+				pub.publish("sensors/kitchen/temperature", "" + (20 + qos), {qos: qos});
+				var msg = sub.receive("1s");
+				if (msg === null) { throw new Error("no message with QoS " + qos); }
+				if (msg.topic !== "sensors/kitchen/temperature") { throw new Error("wrong topic: " + msg.topic); }
+				if (msg.payload !== "" + (20 + qos)) { throw new Error("wrong payload: " + msg.payload); }
+				if (msg.qos !== qos) { throw new Error("wrong QoS: " + msg.qos); }
+				if (msg.retain) { throw new Error("unexpected retain flag"); }
+			}
+
+			pub.publish("sensors/raw", new Uint8Array([1, 2, 3]).buffer);
+			var data = new Uint8Array(sub.receive("1s").data);
+			if (data.length !== 3 || data[2] !== 3) { throw new Error("wrong data: " + data); }
+
+			sub.unsubscribe(["sensors/+/temperature", "sensors/#"]);
+			pub.publish("sensors/kitchen/temperature", "ignored", {qos: 1});
+			if (sub.receive("100ms") !== null) { throw new Error("unexpected message after unsubscribing"); }
+			pub.close();
+			sub.close();
+			`)
+			require.NoError(t, err)
+
+			samples := stats.GetBufferedSamples(ts.samples)
+			proto := "MQTT/" + version
+			tags := map[string]string{"url": "mqtt://" + ts.broker.Addr, "proto": proto}
+			assert.Equal(t, 2, testutils.CountMetric(samples, metrics.MQTTConnectingName, tags))
+			assert.Equal(t, 5, testutils.CountMetric(samples, metrics.MQTTMessagesSentName, tags))
+			assert.Equal(t, 4, testutils.CountMetric(samples, metrics.MQTTMessagesReceivedName,
+				map[string]string{"proto": proto, "device": "sensor"}))
+			assert.Equal(t, 2, testutils.CountMetric(samples, metrics.MQTTPublishDurationName, map[string]string{"qos": "1"}))
+			assert.Equal(t, 1, testutils.CountMetric(samples, metrics.MQTTPublishDurationName, map[string]string{"qos": "2"}))
+			assert.Equal(t, 3, testutils.CountMetric(samples, metrics.MQTTPublishDurationName, nil))
+			assert.Equal(t, 0, testutils.CountMetric(samples, metrics.MQTTErrorsName, nil))
+		})
+	}
+}
+
+func TestRetained(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	ts.broker.Publish(mqttext.Message{Topic: "config/mode", Payload: []byte("eco"), Retain: true})
+
+	_, err := ts.rt.RunString(`
+		var client = mqtt.connect(ADDR);
+		client.publish("config/interval", "10s", {qos: 1, retain: true});
+		client.subscribe("config/+", {qos: 1});
+		var got = {};
+		for (var i = 0; i < 2; i++) {
+			var msg = client.receive("1s");
+			if (!msg.retain) { throw new Error("missing retain flag: " + msg.topic); }
+			got[msg.topic] = msg.payload;
+		}
+		if (got["config/mode"] !== "eco" || got["config/interval"] !== "10s") {
+			throw new Error("wrong retained messages: " + JSON.stringify(got));
+		}
+
+		// an empty retained message clears the retained one
+		client.publish("config/mode", "", {retain: true});
+		if (client.receive("1s").payload !== "") { throw new Error("expected an empty message"); }
+		client.unsubscribe("config/+");
+		client.subscribe("config/+");
+		if (client.receive("1s").topic !== "config/interval") { throw new Error("wrong retained message"); }
+		if (client.receive("100ms") !== null) { throw new Error("unexpected retained message"); }
+		client.close();
+	`)
+	require.NoError(t, err)
+}
+
+func TestWill(t *testing.T) {
+	t.Parallel()
+	for _, version := range []string{"3.1.1", "5"} {
+		version := version
+		t.Run(version, func(t *testing.T) {
+			t.Parallel()
+			ts := newTestState(t)
+			require.NoError(t, ts.rt.Set("VERSION", version))
+
+			_, err := ts.rt.RunString(`
+			var will = {topic: "status/device", payload: "offline", qos: 1};
+			var watcher = mqtt.connect(ADDR, {version: VERSION});
+			watcher.subscribe("status/#", {qos: 1});
+
+			mqtt.connect(ADDR, {version: VERSION, will: will}).close();
+			if (watcher.receive("100ms") !== null) { throw new Error("will published after a normal close"); }
+
+			mqtt.connect(ADDR, {version: VERSION, will: will}).close({sendWill: true});
+			var msg = watcher.receive("1s");
+			if (msg === null || msg.payload !== "offline" || msg.qos !== 1) {
+				throw new Error("wrong will message: " + JSON.stringify(msg));
+			}
+			watcher.close();
+			`)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestVersion5(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	_, err := ts.rt.RunString(`
+		var client = mqtt.connect(ADDR, {version: "5", sessionExpiry: "1m", cleanSession: false});
+		if (!client.clientId.startsWith("mqtttest-")) { throw new Error("wrong client id: " + client.clientId); }
+		if (client.sessionPresent) { throw new Error("unexpected session"); }
+		client.close();
+	`)
+	require.NoError(t, err)
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	broker := mqtttest.NewTLSBroker(t, ts.tb.ServerHTTPS.TLS)
+	require.NoError(t, ts.rt.Set("TLS_ADDR", broker.Addr))
+
+	_, err := ts.rt.RunString(`
+		var client = mqtt.connect(TLS_ADDR, {tls: true});
+		client.subscribe("secure");
+		client.publish("secure", "hello", {qos: 1});
+		if (client.receive("1s").payload !== "hello") { throw new Error("wrong message"); }
+		client.close();
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.MQTTConnectingName,
+		map[string]string{"url": "mqtts://" + broker.Addr}))
+
+	ts.state.TLSConfig = nil
+	_, err = ts.rt.RunString(`mqtt.connect(TLS_ADDR, {tls: true})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+	assert.Equal(t, 1, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.MQTTErrorsName,
+		map[string]string{"op": "tls"}))
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	ts.broker.AddUser("k6", "secret")
+
+	_, err := ts.rt.RunString(`mqtt.connect(ADDR, {username: "k6", password: "wrong"})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CONNECT failed with reason code 0x05: not authorized")
+
+	_, err = ts.rt.RunString(`mqtt.connect(ADDR, {version: "5", username: "k6"})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CONNECT failed with reason code 0x87")
+	assert.Equal(t, 2, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.MQTTErrorsName,
+		map[string]string{"op": "connect"}))
+
+	_, err = ts.rt.RunString(`
+		var client = mqtt.connect(ADDR, {username: "k6", password: "secret"});
+		client.subscribe(["ok", "invalid/#/filter"]);
+	`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `SUBSCRIBE to "invalid/#/filter" failed with reason code 0x80`)
+	assert.Equal(t, 1, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.MQTTErrorsName,
+		map[string]string{"op": "subscribe"}))
+
+	for _, script := range []string{
+		`mqtt.connect(ADDR, {nope: 1})`,
+		`mqtt.connect(ADDR, {version: "4"})`,
+		`mqtt.connect(ADDR, {will: {payload: "no topic"}})`,
+		`client.publish("topic", "payload", {qos: 3})`,
+		`client.subscribe([])`,
+	} {
+		_, err = ts.rt.RunString(script)
+		assert.Error(t, err, script)
+	}
+
+	_, err = ts.rt.RunString(`client.close(); client.publish("topic", "payload")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the MQTT connection is closed")
+}
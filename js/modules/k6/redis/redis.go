@@ -0,0 +1,627 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package redis implements the k6/redis module, a Redis client with a pool of
+// connections that are opened through the dialer of the VU.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/netext/redisext"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// ModuleInstance represents an instance of the Redis module for a VU.
+	ModuleInstance struct {
+		vu modules.VU
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+const (
+	defaultAddr    = "localhost:6379"
+	defaultTimeout = 60 * time.Second
+)
+
+// ErrRedisInInitContext is returned when Redis commands are sent in the init context.
+var ErrRedisInInitContext = common.NewInitContextError("sending Redis commands in the init context is not supported")
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu}
+}
+
+// Exports returns the exports of the redis module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"Client": mi.NewClient,
+		},
+	}
+}
+
+type clientOptions struct {
+	addr       string
+	useTLS     bool
+	serverName string
+	timeout    time.Duration
+	tags       map[string]string
+	redis      redisext.Options
+}
+
+// NewClient is the JS constructor for Redis clients, which takes either a
+// redis:// or rediss:// URL or an object with the options. Clients are usually
+// created in the init context, the connections are opened by the commands.
+func (mi *ModuleInstance) NewClient(call goja.ConstructorCall) *goja.Object {
+	rt := mi.vu.Runtime()
+	var (
+		opts clientOptions
+		err  error
+	)
+	switch arg := common.ExportOrNil(call.Argument(0)).(type) {
+	case string:
+		opts, err = parseURL(arg)
+	case nil:
+		opts, err = mi.parseOptions(nil)
+	default:
+		opts, err = mi.parseOptions(call.Argument(0).ToObject(rt))
+	}
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	c := &Client{vu: mi.vu, timeout: opts.timeout, tags: opts.tags, addr: opts.addr, useTLS: opts.useTLS}
+	opts.redis.Dial = func(ctx context.Context) (net.Conn, error) {
+		return c.dial(ctx, opts.serverName)
+	}
+	c.client = redisext.NewClient(opts.redis)
+	return rt.ToValue(c).ToObject(rt)
+}
+
+// parseURL parses redis://[[username]:password@]host[:port][/db] URLs, the
+// rediss scheme is for TLS.
+func parseURL(rawURL string) (clientOptions, error) {
+	opts := clientOptions{addr: defaultAddr, timeout: defaultTimeout, tags: make(map[string]string)}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return opts, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		opts.useTLS = true
+	default:
+		return opts, fmt.Errorf("invalid Redis URL scheme '%s', it needs to be either redis or rediss", u.Scheme)
+	}
+	if u.Host != "" {
+		opts.addr = u.Host
+		if u.Port() == "" {
+			opts.addr = net.JoinHostPort(u.Hostname(), "6379")
+		}
+	}
+	if u.User != nil {
+		opts.redis.Username = u.User.Username()
+		opts.redis.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.redis.DB, err = strconv.Atoi(db); err != nil {
+			return opts, fmt.Errorf("invalid Redis database '%s' in the URL", db)
+		}
+	}
+	return opts, nil
+}
+
+//nolint:cyclop
+func (mi *ModuleInstance) parseOptions(params *goja.Object) (clientOptions, error) {
+	opts := clientOptions{addr: defaultAddr, timeout: defaultTimeout, tags: make(map[string]string)}
+	if params == nil {
+		return opts, nil
+	}
+	for _, k := range params.Keys() {
+		v := params.Get(k)
+		switch k {
+		case "addr":
+			opts.addr = v.String()
+		case "username":
+			opts.redis.Username = v.String()
+		case "password":
+			opts.redis.Password = v.String()
+		case "db":
+			opts.redis.DB = int(v.ToInteger())
+		case "poolSize":
+			opts.redis.PoolSize = int(v.ToInteger())
+		case "tls":
+			opts.useTLS = v.ToBoolean()
+		case "serverName":
+			opts.serverName = v.String()
+		case "timeout":
+			d, err := types.GetDurationValue(v.Export())
+			if err != nil {
+				return opts, fmt.Errorf("invalid timeout value: %w", err)
+			}
+			opts.timeout = d
+		case "tags":
+			tagObj := v.ToObject(mi.vu.Runtime())
+			for _, key := range tagObj.Keys() {
+				opts.tags[key] = tagObj.Get(key).String()
+			}
+		default:
+			return opts, fmt.Errorf("unknown Redis client option: '%s'", k)
+		}
+	}
+	return opts, nil
+}
+
+// Client is a Redis client with a pool of connections for the VU.
+type Client struct {
+	vu      modules.VU
+	client  *redisext.Client
+	addr    string
+	useTLS  bool
+	timeout time.Duration
+	tags    map[string]string
+}
+
+// dial opens a connection with the dialer and the TLS config of the VU, so
+// the client certificates of the tlsAuth option are used too.
+func (c *Client) dial(ctx context.Context, serverName string) (net.Conn, error) {
+	state := c.vu.State()
+	conn, err := state.Dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil || !c.useTLS {
+		return conn, err
+	}
+
+	config := &tls.Config{} //nolint:gosec
+	if state.TLSConfig != nil {
+		config = state.TLSConfig.Clone()
+	}
+	config.NextProtos = nil
+	if serverName != "" {
+		config.ServerName = serverName
+	} else if host, _, err := net.SplitHostPort(c.addr); err == nil {
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// do sends the commands and pushes their duration, which is tagged with the
+// command name, or PIPELINE for many commands.
+func (c *Client) do(commands [][]string) ([]interface{}, error) {
+	state := c.vu.State()
+	if state == nil {
+		return nil, ErrRedisInInitContext
+	}
+	ctx, cancel := context.WithTimeout(c.vu.Context(), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	replies, err := c.client.Pipeline(ctx, commands)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	tags := state.CloneTags()
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		scheme := "redis://"
+		if c.useTLS {
+			scheme = "rediss://"
+		}
+		tags["url"] = scheme + c.addr
+	}
+	tags["command"] = "PIPELINE"
+	if len(commands) == 1 {
+		tags["command"] = strings.ToUpper(commands[0][0])
+	}
+	stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+		Metric: state.BuiltinMetrics.RedisCmdDuration,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   now,
+		Value:  stats.D(now.Sub(start)),
+	})
+	return replies, nil
+}
+
+// command sends a command and returns its reply, error replies are thrown.
+func (c *Client) command(args ...string) (interface{}, error) {
+	replies, err := c.do([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(redisext.Error); ok {
+		return nil, replyErr
+	}
+	return toJS(replies[0]), nil
+}
+
+func (c *Client) intCommand(args ...string) (int64, error) {
+	reply, err := c.command(args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply %v for %s", reply, args[0])
+	}
+	return n, nil
+}
+
+// toJS converts simple strings to strings, the other replies are already
+// strings, numbers, arrays or nil.
+func toJS(reply interface{}) interface{} {
+	switch v := reply.(type) {
+	case redisext.SimpleString:
+		return string(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = toJS(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+// toArgs converts the values to command arguments, numbers are formatted
+// like in JS and ArrayBuffers are sent as binary strings.
+func toArgs(values []goja.Value) ([]string, error) {
+	args := make([]string, len(values))
+	for i, v := range values {
+		switch exported := common.ExportOrNil(v).(type) {
+		case nil:
+			return nil, errors.New("Redis command arguments can't be null or undefined")
+		case goja.ArrayBuffer:
+			args[i] = string(exported.Bytes())
+		case []interface{}, map[string]interface{}:
+			return nil, fmt.Errorf("invalid Redis command argument %v, it needs to be a string or a number", exported)
+		default:
+			args[i] = v.String()
+		}
+	}
+	return args, nil
+}
+
+// SendCommand sends any command with the arguments and returns its reply.
+func (c *Client) SendCommand(name string, values ...goja.Value) (interface{}, error) {
+	args, err := toArgs(values)
+	if err != nil {
+		return nil, err
+	}
+	return c.command(append([]string{name}, args...)...)
+}
+
+// Pipeline sends many commands at once, each of them as an array with its name
+// and arguments, and returns their replies. It throws if any of them failed.
+func (c *Client) Pipeline(commandsV goja.Value) ([]interface{}, error) {
+	rt := c.vu.Runtime()
+	var commandValues []goja.Value
+	if err := rt.ExportTo(commandsV, &commandValues); err != nil || len(commandValues) == 0 {
+		return nil, errors.New("the pipeline needs an array of commands")
+	}
+	commands := make([][]string, len(commandValues))
+	for i, commandV := range commandValues {
+		var values []goja.Value
+		if err := rt.ExportTo(commandV, &values); err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("invalid pipeline command %v, it needs to be an array with its name and arguments",
+				commandV)
+		}
+		args, err := toArgs(values)
+		if err != nil {
+			return nil, err
+		}
+		commands[i] = args
+	}
+
+	replies, err := c.do(commands)
+	if err != nil {
+		return nil, err
+	}
+	for i, reply := range replies {
+		if replyErr, ok := reply.(redisext.Error); ok {
+			return nil, fmt.Errorf("pipeline command %d (%s) failed: %w", i, commands[i][0], replyErr)
+		}
+		replies[i] = toJS(reply)
+	}
+	return replies, nil
+}
+
+// Get returns the value of the key, or null if it doesn't exist.
+func (c *Client) Get(key string) (interface{}, error) {
+	return c.command("GET", key)
+}
+
+// Set sets the value of the key, with the optional expiration in seconds.
+// It returns false if the value wasn't set because of the nx or xx options.
+func (c *Client) Set(key string, value goja.Value, paramsV goja.Value) (bool, error) {
+	args, err := toArgs([]goja.Value{value})
+	if err != nil {
+		return false, err
+	}
+	args = append([]string{"SET", key}, args...)
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(c.vu.Runtime())
+		for _, k := range params.Keys() {
+			v := params.Get(k)
+			switch k {
+			case "ex", "px":
+				args = append(args, strings.ToUpper(k), strconv.FormatInt(v.ToInteger(), 10))
+			case "nx", "xx":
+				if v.ToBoolean() {
+					args = append(args, strings.ToUpper(k))
+				}
+			default:
+				return false, fmt.Errorf("unknown set param: '%s'", k)
+			}
+		}
+	}
+	reply, err := c.command(args...)
+	return reply != nil, err
+}
+
+// Del deletes the keys and returns the number of deleted ones.
+func (c *Client) Del(keys ...string) (int64, error) {
+	return c.intCommand(append([]string{"DEL"}, keys...)...)
+}
+
+// Exists returns the number of the keys that exist.
+func (c *Client) Exists(keys ...string) (int64, error) {
+	return c.intCommand(append([]string{"EXISTS"}, keys...)...)
+}
+
+// Expire sets the expiration of the key in seconds and returns whether it exists.
+func (c *Client) Expire(key string, seconds int64) (bool, error) {
+	n, err := c.intCommand("EXPIRE", key, strconv.FormatInt(seconds, 10))
+	return n == 1, err
+}
+
+// Ttl returns the remaining time to live of the key in seconds, -1 if it
+// doesn't expire or -2 if it doesn't exist.
+func (c *Client) Ttl(key string) (int64, error) { //nolint:revive,stylecheck
+	return c.intCommand("TTL", key)
+}
+
+// Incr increments the number of the key and returns the new value.
+func (c *Client) Incr(key string) (int64, error) {
+	return c.intCommand("INCR", key)
+}
+
+// IncrBy increments the number of the key by the amount and returns the new value.
+func (c *Client) IncrBy(key string, amount int64) (int64, error) {
+	return c.intCommand("INCRBY", key, strconv.FormatInt(amount, 10))
+}
+
+// Decr decrements the number of the key and returns the new value.
+func (c *Client) Decr(key string) (int64, error) {
+	return c.intCommand("DECR", key)
+}
+
+// DecrBy decrements the number of the key by the amount and returns the new value.
+func (c *Client) DecrBy(key string, amount int64) (int64, error) {
+	return c.intCommand("DECRBY", key, strconv.FormatInt(amount, 10))
+}
+
+// Hset sets the field of the hash and returns 1 if it's a new field.
+func (c *Client) Hset(key, field string, value goja.Value) (int64, error) {
+	args, err := toArgs([]goja.Value{value})
+	if err != nil {
+		return 0, err
+	}
+	return c.intCommand("HSET", key, field, args[0])
+}
+
+// Hget returns the value of the field of the hash, or null if it doesn't exist.
+func (c *Client) Hget(key, field string) (interface{}, error) {
+	return c.command("HGET", key, field)
+}
+
+// Hgetall returns the fields of the hash as an object.
+func (c *Client) Hgetall(key string) (map[string]interface{}, error) {
+	reply, err := c.command("HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]interface{})
+	hash := make(map[string]interface{}, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		field, _ := items[i].(string)
+		hash[field] = items[i+1]
+	}
+	return hash, nil
+}
+
+// Hdel deletes the fields of the hash and returns the number of deleted ones.
+func (c *Client) Hdel(key string, fields ...string) (int64, error) {
+	return c.intCommand(append([]string{"HDEL", key}, fields...)...)
+}
+
+// Lpush prepends the values to the list and returns its new length.
+func (c *Client) Lpush(key string, values ...goja.Value) (int64, error) {
+	return c.push("LPUSH", key, values)
+}
+
+// Rpush appends the values to the list and returns its new length.
+func (c *Client) Rpush(key string, values ...goja.Value) (int64, error) {
+	return c.push("RPUSH", key, values)
+}
+
+func (c *Client) push(command, key string, values []goja.Value) (int64, error) {
+	args, err := toArgs(values)
+	if err != nil {
+		return 0, err
+	}
+	return c.intCommand(append([]string{command, key}, args...)...)
+}
+
+// Lpop removes and returns the first value of the list, or null if it's empty.
+func (c *Client) Lpop(key string) (interface{}, error) {
+	return c.command("LPOP", key)
+}
+
+// Rpop removes and returns the last value of the list, or null if it's empty.
+func (c *Client) Rpop(key string) (interface{}, error) {
+	return c.command("RPOP", key)
+}
+
+// Lrange returns the values of the list between the start and stop indexes,
+// which can be negative to count from the end.
+func (c *Client) Lrange(key string, start, stop int64) (interface{}, error) {
+	return c.command("LRANGE", key, strconv.FormatInt(start, 10), strconv.FormatInt(stop, 10))
+}
+
+// Llen returns the length of the list.
+func (c *Client) Llen(key string) (int64, error) {
+	return c.intCommand("LLEN", key)
+}
+
+// Publish publishes the message to the channel and returns the number of
+// subscribers that received it.
+func (c *Client) Publish(channel string, message goja.Value) (int64, error) {
+	args, err := toArgs([]goja.Value{message})
+	if err != nil {
+		return 0, err
+	}
+	return c.intCommand("PUBLISH", channel, args[0])
+}
+
+// Subscribe subscribes to one or more channels with a new connection.
+func (c *Client) Subscribe(channels goja.Value) (*Subscription, error) {
+	return c.subscribe(false, channels)
+}
+
+// Psubscribe subscribes to one or more channel patterns, like news.*, with a
+// new connection.
+func (c *Client) Psubscribe(patterns goja.Value) (*Subscription, error) {
+	return c.subscribe(true, patterns)
+}
+
+func (c *Client) subscribe(patterns bool, channelsV goja.Value) (*Subscription, error) {
+	if c.vu.State() == nil {
+		return nil, ErrRedisInInitContext
+	}
+	var channels []string
+	switch exported := common.ExportOrNil(channelsV).(type) {
+	case string:
+		channels = []string{exported}
+	case []interface{}:
+		for _, channel := range exported {
+			channels = append(channels, fmt.Sprint(channel))
+		}
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("at least one channel is required")
+	}
+
+	ctx, cancel := context.WithTimeout(c.vu.Context(), c.timeout)
+	defer cancel()
+	sub, err := c.client.Subscribe(ctx, patterns, channels...)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-c.vu.Context().Done()
+		_ = sub.Close()
+	}()
+	return &Subscription{vu: c.vu, sub: sub, timeout: c.timeout}, nil
+}
+
+// Close closes the connections of the client.
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+// Subscription receives the messages of channels.
+type Subscription struct {
+	vu      modules.VU
+	sub     *redisext.Subscription
+	timeout time.Duration
+}
+
+// Receive returns the next message as an object with its channel, pattern and
+// message, or null if none was received until the timeout. The optional
+// timeout overrides the one of the client.
+func (s *Subscription) Receive(timeoutV goja.Value) (goja.Value, error) {
+	rt := s.vu.Runtime()
+	timeout := s.timeout
+	if timeoutV != nil && !goja.IsUndefined(timeoutV) && !goja.IsNull(timeoutV) {
+		d, err := types.GetDurationValue(timeoutV.Export())
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout value: %w", err)
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(s.vu.Context(), timeout)
+	defer cancel()
+	msg, err := s.sub.Receive(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && s.vu.Context().Err() == nil {
+			return goja.Null(), nil
+		}
+		return nil, err
+	}
+	return rt.ToValue(map[string]interface{}{
+		"channel": msg.Channel,
+		"pattern": msg.Pattern,
+		"message": msg.Payload,
+	}), nil
+}
+
+// Close closes the connection of the subscription.
+func (s *Subscription) Close() error {
+	return s.sub.Close()
+}
@@ -0,0 +1,457 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package socket implements the k6/net/tcp and k6/net/udp modules, which
+// open raw TCP and UDP connections through the dialer of the VU.
+package socket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct {
+		network string
+	}
+
+	// ModuleInstance represents an instance of the TCP or UDP module.
+	ModuleInstance struct {
+		vu      modules.VU
+		network string
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+const (
+	networkTCP = "tcp"
+	networkUDP = "udp"
+
+	defaultTimeout = 60 * time.Second
+	// maxDatagramSize is the largest possible UDP payload.
+	maxDatagramSize = 65535
+)
+
+// ErrSocketInInitContext is returned when sockets are used in the init context.
+var ErrSocketInInitContext = common.NewInitContextError("using sockets in the init context is not supported")
+
+// NewTCP returns a new RootModule for the k6/net/tcp module.
+func NewTCP() *RootModule {
+	return &RootModule{network: networkTCP}
+}
+
+// NewUDP returns a new RootModule for the k6/net/udp module.
+func NewUDP() *RootModule {
+	return &RootModule{network: networkUDP}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (r *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu, network: r.network}
+}
+
+// Exports returns the exports of the module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"connect": mi.Connect,
+		},
+	}
+}
+
+// Connect opens a connection to the given host:port address. The connection
+// is closed at the latest when the VU finishes.
+//
+//nolint:funlen,cyclop
+func (mi *ModuleInstance) Connect(address string, paramsV goja.Value) (*Conn, error) {
+	ctx := mi.vu.Context()
+	rt := mi.vu.Runtime()
+	state := mi.vu.State()
+	if state == nil {
+		return nil, ErrSocketInInitContext
+	}
+
+	tags := state.CloneTags()
+	timeout := defaultTimeout
+	useTLS := false
+	var serverName string
+
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			switch k {
+			case "tags":
+				tagsV := params.Get(k)
+				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+					continue
+				}
+				tagObj := tagsV.ToObject(rt)
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			case "timeout":
+				d, err := types.GetDurationValue(params.Get(k).Export())
+				if err != nil {
+					return nil, fmt.Errorf("invalid timeout value: %w", err)
+				}
+				timeout = d
+			case "tls":
+				if mi.network != networkTCP {
+					return nil, fmt.Errorf("TLS isn't supported over %s", mi.network)
+				}
+				useTLS = params.Get(k).ToBoolean()
+			case "serverName":
+				serverName = params.Get(k).String()
+			default:
+				return nil, fmt.Errorf("unknown connect param: '%s'", k)
+			}
+		}
+	}
+
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		tags["url"] = mi.network + "://" + address
+	}
+	if state.Options.SystemTags.Has(stats.TagProto) {
+		tags["proto"] = mi.network
+	}
+
+	c := &Conn{
+		vu:      mi.vu,
+		network: mi.network,
+		address: address,
+		timeout: timeout,
+		tags:    tags,
+		done:    make(chan struct{}),
+	}
+	if mi.network == networkTCP {
+		c.roundTripMetric, c.errorsMetric = state.BuiltinMetrics.TCPRoundTrip, state.BuiltinMetrics.TCPErrors
+	} else {
+		c.roundTripMetric, c.errorsMetric = state.BuiltinMetrics.UDPRoundTrip, state.BuiltinMetrics.UDPErrors
+	}
+
+	start := time.Now()
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := state.Dialer.DialContext(dialCtx, mi.network, address)
+	if err != nil {
+		c.pushError("connect")
+		return nil, err
+	}
+	c.setConn(conn)
+
+	if useTLS {
+		if err = c.handshake(dialCtx, state, serverName); err != nil {
+			return nil, err
+		}
+	}
+
+	if mi.network == networkTCP {
+		connectingTags := c.cloneTags()
+		stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+			Metric: state.BuiltinMetrics.TCPConnecting,
+			Tags:   stats.IntoSampleTags(&connectingTags),
+			Time:   start,
+			Value:  stats.D(time.Since(start)),
+		})
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-c.done:
+		}
+	}()
+	return c, nil
+}
+
+// Conn is a TCP or UDP connection.
+type Conn struct {
+	vu      modules.VU
+	network string
+	address string
+	timeout time.Duration
+	tags    map[string]string
+
+	conn      net.Conn
+	reader    *bufio.Reader
+	done      chan struct{}
+	closeOnce sync.Once
+
+	roundTripMetric, errorsMetric *stats.Metric
+	// writtenAt is the time of the first write since the last read, which
+	// is the start of the next round trip.
+	writtenAt time.Time
+}
+
+func (c *Conn) setConn(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+}
+
+// handshake upgrades the connection to TLS.
+func (c *Conn) handshake(ctx context.Context, state *lib.State, serverName string) error {
+	config := &tls.Config{} //nolint:gosec
+	if state.TLSConfig != nil {
+		config = state.TLSConfig.Clone()
+	}
+	config.NextProtos = nil
+	if serverName != "" {
+		config.ServerName = serverName
+	} else if host, _, err := net.SplitHostPort(c.address); err == nil {
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		c.pushError("tls")
+		_ = c.conn.Close()
+		return err
+	}
+	c.setConn(tlsConn)
+	return nil
+}
+
+// StartTLS upgrades the connection to TLS, e.g. after a STARTTLS command.
+// The optional server name is used to verify the certificate, by default
+// it's the host of the address.
+func (c *Conn) StartTLS(serverName string) error {
+	if c.network != networkTCP {
+		return fmt.Errorf("TLS isn't supported over %s", c.network)
+	}
+	if c.reader.Buffered() > 0 {
+		return errors.New("can't start TLS while there is unread data")
+	}
+	ctx, cancel := context.WithTimeout(c.vu.Context(), c.timeout)
+	defer cancel()
+	return c.handshake(ctx, c.vu.State(), serverName)
+}
+
+// Write writes a string or an ArrayBuffer to the connection and returns the
+// number of written bytes. For UDP, every write is sent as a datagram.
+func (c *Conn) Write(data goja.Value) (int, error) {
+	if data == nil || goja.IsUndefined(data) || goja.IsNull(data) {
+		return 0, errors.New("missing data to write")
+	}
+	b, err := common.ToBytes(data.Export())
+	if err != nil {
+		return 0, err
+	}
+
+	if err = c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	if c.writtenAt.IsZero() {
+		c.writtenAt = time.Now()
+	}
+	n, err := c.conn.Write(b)
+	if err != nil {
+		c.pushError("write")
+	}
+	return n, err
+}
+
+// Read reads from the connection, until the given number of bytes was read
+// or until and including the given delimiter. The result is a string for
+// string delimiters and an ArrayBuffer otherwise. For UDP, it returns the next
+// datagram, truncated to the given number of bytes. The optional timeout
+// overrides the one of the connection.
+//
+//nolint:cyclop
+func (c *Conn) Read(what goja.Value, timeoutV goja.Value) (goja.Value, error) {
+	rt := c.vu.Runtime()
+	timeout := c.timeout
+	if timeoutV != nil && !goja.IsUndefined(timeoutV) && !goja.IsNull(timeoutV) {
+		d, err := types.GetDurationValue(timeoutV.Export())
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout value: %w", err)
+		}
+		timeout = d
+	}
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	switch v := common.ExportOrNil(what).(type) {
+	case string:
+		if c.network == networkUDP {
+			return nil, errors.New("UDP reads return whole datagrams, delimiters aren't supported")
+		}
+		if v == "" {
+			return nil, errors.New("empty delimiter")
+		}
+		data, err = c.readUntil([]byte(v))
+		if err == nil {
+			return rt.ToValue(string(data)), nil
+		}
+	case goja.ArrayBuffer:
+		if c.network == networkUDP {
+			return nil, errors.New("UDP reads return whole datagrams, delimiters aren't supported")
+		}
+		if len(v.Bytes()) == 0 {
+			return nil, errors.New("empty delimiter")
+		}
+		data, err = c.readUntil(v.Bytes())
+	case int64, float64, nil:
+		var n int
+		if v != nil {
+			n = int(what.ToInteger())
+		}
+		if c.network == networkUDP {
+			data, err = c.readDatagram(n)
+			break
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid number of bytes to read: %d", n)
+		}
+		data = make([]byte, n)
+		_, err = c.readFull(data)
+	default:
+		return nil, fmt.Errorf("invalid read argument %T, expected a number of bytes or a delimiter", v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ab := rt.NewArrayBuffer(data)
+	return rt.ToValue(&ab), nil
+}
+
+func (c *Conn) readFull(data []byte) (int, error) {
+	var n int
+	for n < len(data) {
+		m, err := c.reader.Read(data[n:])
+		c.trackRoundTrip(m)
+		n += m
+		if err != nil {
+			c.pushError("read")
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *Conn) readUntil(delimiter []byte) ([]byte, error) {
+	var data []byte
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			c.pushError("read")
+			return data, err
+		}
+		c.trackRoundTrip(1)
+		data = append(data, b)
+		if len(data) >= len(delimiter) && string(data[len(data)-len(delimiter):]) == string(delimiter) {
+			return data, nil
+		}
+	}
+}
+
+func (c *Conn) readDatagram(maxSize int) ([]byte, error) {
+	if maxSize <= 0 || maxSize > maxDatagramSize {
+		maxSize = maxDatagramSize
+	}
+	data := make([]byte, maxDatagramSize)
+	n, err := c.conn.Read(data)
+	if err != nil {
+		c.pushError("read")
+		return nil, err
+	}
+	c.trackRoundTrip(n)
+	if n > maxSize {
+		n = maxSize
+	}
+	return data[:n], nil
+}
+
+// trackRoundTrip measures the time from the first write since the last read
+// until the first bytes of the response were read.
+func (c *Conn) trackRoundTrip(n int) {
+	if n <= 0 || c.writtenAt.IsZero() {
+		return
+	}
+	now := time.Now()
+	tags := c.cloneTags()
+	state := c.vu.State()
+	stats.PushIfNotDone(c.vu.Context(), state.Samples, stats.Sample{
+		Metric: c.roundTripMetric,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   now,
+		Value:  stats.D(now.Sub(c.writtenAt)),
+	})
+	c.writtenAt = time.Time{}
+}
+
+func (c *Conn) pushError(op string) {
+	state := c.vu.State()
+	if state == nil {
+		return
+	}
+	tags := c.cloneTags()
+	tags["op"] = op
+	stats.PushIfNotDone(c.vu.Context(), state.Samples, stats.Sample{
+		Metric: c.errorsMetric,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   time.Now(),
+		Value:  1,
+	})
+}
+
+func (c *Conn) cloneTags() map[string]string {
+	tags := make(map[string]string, len(c.tags)+1)
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	err := c.conn.Close()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
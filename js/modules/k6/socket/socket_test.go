@@ -0,0 +1,255 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package socket
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/lib/testutils/httpmultibin"
+	"go.k6.io/k6/stats"
+)
+
+type testState struct {
+	rt      *goja.Runtime
+	tb      *httpmultibin.HTTPMultiBin
+	state   *lib.State
+	samples chan stats.SampleContainer
+}
+
+func newTestState(t testing.TB) testState {
+	tb := httpmultibin.NewHTTPMultiBin(t)
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+
+	samples := make(chan stats.SampleContainer, 1000)
+
+	state := &lib.State{
+		Group:  root,
+		Dialer: tb.Dialer,
+		Options: lib.Options{
+			SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagProto),
+		},
+		Samples:        samples,
+		TLSConfig:      tb.TLSClientConfig,
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+		Tags:           lib.NewTagMap(nil),
+	}
+
+	for name, m := range map[string]*RootModule{"tcp": NewTCP(), "udp": NewUDP()} {
+		mi := m.NewModuleInstance(&modulestest.VU{
+			CtxField:     tb.Context,
+			InitEnvField: &common.InitEnvironment{},
+			RuntimeField: rt,
+			StateField:   state,
+		})
+		require.NoError(t, rt.Set(name, mi.Exports().Named))
+	}
+
+	return testState{
+		rt:      rt,
+		tb:      tb,
+		state:   state,
+		samples: samples,
+	}
+}
+
+// serveTCP serves a line protocol that echoes every line in upper case and
+// upgrades the connection to TLS after a STARTTLS line.
+func serveTCP(t *testing.T, l net.Listener, tlsConfig *tls.Config) {
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if _, err = conn.Write([]byte(strings.ToUpper(line))); err != nil {
+						return
+					}
+					if line == "starttls\n" {
+						tlsConn := tls.Server(conn, tlsConfig)
+						conn, r = tlsConn, bufio.NewReader(tlsConn)
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func TestTCP(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveTCP(t, l, ts.tb.ServerHTTPS.TLS)
+	require.NoError(t, ts.rt.Set("ADDR", l.Addr().String()))
+
+	_, err = ts.rt.RunString(`
+		var conn = tcp.connect(ADDR, {tags: {service: "upper"}});
+		if (conn.write("hello\nworld\n") !== 12) { throw new Error("wrong number of written bytes"); }
+		var line = conn.read("\n");
+		if (line !== "HELLO\n") { throw new Error("wrong line: " + line); }
+		var data = new Uint8Array(conn.read(6, "1s"));
+		if (String.fromCharCode.apply(null, data) !== "WORLD\n") { throw new Error("wrong data: " + data); }
+
+		conn.write("starttls\n");
+		conn.read("\n");
+		conn.startTLS();
+		conn.write("secure\n");
+		line = conn.read("\n");
+		if (line !== "SECURE\n") { throw new Error("wrong line: " + line); }
+		conn.close();
+	`)
+	require.NoError(t, err)
+
+	samples := stats.GetBufferedSamples(ts.samples)
+	tags := map[string]string{"url": "tcp://" + l.Addr().String(), "proto": "tcp", "service": "upper"}
+	assert.Equal(t, 1, testutils.CountMetric(samples, metrics.TCPConnectingName, tags))
+	assert.Equal(t, 3, testutils.CountMetric(samples, metrics.TCPRoundTripName, tags))
+	assert.Equal(t, 0, testutils.CountMetric(samples, metrics.TCPErrorsName, nil))
+}
+
+func TestTCPTLS(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", ts.tb.ServerHTTPS.TLS)
+	require.NoError(t, err)
+	serveTCP(t, l, nil)
+	require.NoError(t, ts.rt.Set("ADDR", l.Addr().String()))
+
+	_, err = ts.rt.RunString(`
+		var conn = tcp.connect(ADDR, {tls: true});
+		conn.write("hello\n");
+		var line = conn.read("\n");
+		if (line !== "HELLO\n") { throw new Error("wrong line: " + line); }
+		conn.close();
+	`)
+	require.NoError(t, err)
+
+	ts.state.TLSConfig = nil
+	_, err = ts.rt.RunString(`tcp.connect(ADDR, {tls: true})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+	assert.Equal(t, 1, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.TCPErrorsName,
+		map[string]string{"op": "tls"}))
+}
+
+func TestTCPErrors(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveTCP(t, l, nil)
+	require.NoError(t, ts.rt.Set("ADDR", l.Addr().String()))
+
+	_, err = ts.rt.RunString(`
+		var conn = tcp.connect(ADDR);
+		conn.write("no newline");
+		conn.read("\n", "100ms");
+	`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "i/o timeout")
+	assert.Equal(t, 1, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.TCPErrorsName,
+		map[string]string{"op": "read"}))
+
+	_, err = ts.rt.RunString(`tcp.connect(ADDR, {tls: true, nope: 1})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown connect param: 'nope'")
+
+	_, blocked, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	ts.tb.Dialer.Blacklist = []*lib.IPNet{{IPNet: *blocked}}
+	_, err = ts.rt.RunString(`tcp.connect(ADDR)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "IP (127.0.0.1) is in a blacklisted range")
+	assert.Equal(t, 1, testutils.CountMetric(stats.GetBufferedSamples(ts.samples), metrics.TCPErrorsName,
+		map[string]string{"op": "connect"}))
+}
+
+func TestUDP(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo([]byte(strings.ToUpper(string(buf[:n]))), addr)
+		}
+	}()
+	require.NoError(t, ts.rt.Set("ADDR", pc.LocalAddr().String()))
+
+	_, err = ts.rt.RunString(`
+		var conn = udp.connect(ADDR, {timeout: "1s"});
+		conn.write("<34>1 syslog message");
+		var data = new Uint8Array(conn.read());
+		if (String.fromCharCode.apply(null, data) !== "<34>1 SYSLOG MESSAGE") { throw new Error("wrong data: " + data); }
+		conn.write("truncated");
+		data = new Uint8Array(conn.read(5));
+		if (String.fromCharCode.apply(null, data) !== "TRUNC") { throw new Error("wrong data: " + data); }
+		conn.close();
+	`)
+	require.NoError(t, err)
+	samples := stats.GetBufferedSamples(ts.samples)
+	assert.Equal(t, 2, testutils.CountMetric(samples, metrics.UDPRoundTripName, map[string]string{"proto": "udp"}))
+
+	_, err = ts.rt.RunString(`udp.connect(ADDR).read("\n")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "delimiters aren't supported")
+
+	_, err = ts.rt.RunString(`udp.connect(ADDR, {tls: true})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS isn't supported over udp")
+}
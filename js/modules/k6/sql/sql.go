@@ -0,0 +1,398 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package sql implements the k6/sql module, which runs queries directly
+// against a database. Any database/sql driver that is registered in the
+// binary can be used, e.g. by xk6 extensions. No driver is bundled, as the
+// SQLite ones need cgo or are huge and the release builds don't have cgo.
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/stats"
+)
+
+type (
+	// RootModule is the global module instance that will create module
+	// instances for each VU.
+	RootModule struct{}
+
+	// ModuleInstance represents an instance of the SQL module for a VU.
+	ModuleInstance struct {
+		vu modules.VU
+		// the connection pools of the VU, by driver and data source name
+		pools map[poolKey]*dbsql.DB
+	}
+
+	poolKey struct {
+		driver, dsn string
+	}
+)
+
+var (
+	_ modules.Module   = &RootModule{}
+	_ modules.Instance = &ModuleInstance{}
+)
+
+// ErrSQLInInitContext is returned when queries are run in the init context.
+var ErrSQLInInitContext = common.NewInitContextError("running SQL queries in the init context is not supported")
+
+// New returns a pointer to a new RootModule instance.
+func New() *RootModule {
+	return &RootModule{}
+}
+
+// NewModuleInstance implements the modules.Module interface to return
+// a new instance for each VU.
+func (*RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
+	return &ModuleInstance{vu: vu, pools: make(map[poolKey]*dbsql.DB)}
+}
+
+// Exports returns the exports of the sql module.
+func (mi *ModuleInstance) Exports() modules.Exports {
+	return modules.Exports{
+		Named: map[string]interface{}{
+			"open":    mi.Open,
+			"drivers": dbsql.Drivers,
+		},
+	}
+}
+
+// Open returns a database for the driver and data source name. The databases
+// that are opened with the same driver and data source name in a VU share a
+// connection pool, whose options are the ones from the first call. Connections
+// are only opened by the first query, so databases can be opened in the init
+// context.
+func (mi *ModuleInstance) Open(driver, dsn string, paramsV goja.Value) (*DB, error) {
+	if !isRegistered(driver) {
+		drivers := dbsql.Drivers()
+		sort.Strings(drivers)
+		return nil, fmt.Errorf("unknown SQL driver '%s', the registered ones are: [%s]; "+
+			"drivers need to be added to k6 with an extension", driver, strings.Join(drivers, ", "))
+	}
+	p, err := mi.parseOpenParams(paramsV)
+	if err != nil {
+		return nil, err
+	}
+
+	key := poolKey{driver, dsn}
+	pool := mi.pools[key]
+	if pool == nil {
+		if pool, err = dbsql.Open(driver, dsn); err != nil {
+			return nil, err
+		}
+		if p.maxOpenConns != nil {
+			pool.SetMaxOpenConns(*p.maxOpenConns)
+		}
+		if p.maxIdleConns != nil {
+			pool.SetMaxIdleConns(*p.maxIdleConns)
+		}
+		pool.SetConnMaxLifetime(p.connMaxLifetime)
+		pool.SetConnMaxIdleTime(p.connMaxIdleTime)
+		mi.pools[key] = pool
+	}
+
+	return &DB{
+		vu:   mi.vu,
+		pool: pool,
+		tags: p.tags,
+		closePool: func() error {
+			if mi.pools[key] == pool {
+				delete(mi.pools, key)
+			}
+			return pool.Close()
+		},
+	}, nil
+}
+
+type openParams struct {
+	tags                             map[string]string
+	maxOpenConns, maxIdleConns       *int
+	connMaxLifetime, connMaxIdleTime time.Duration
+}
+
+func (mi *ModuleInstance) parseOpenParams(paramsV goja.Value) (openParams, error) {
+	p := openParams{tags: make(map[string]string)}
+	if paramsV == nil || goja.IsUndefined(paramsV) || goja.IsNull(paramsV) {
+		return p, nil
+	}
+	rt := mi.vu.Runtime()
+	params := paramsV.ToObject(rt)
+	for _, k := range params.Keys() {
+		v := params.Get(k)
+		var err error
+		switch k {
+		case "tags":
+			tagObj := v.ToObject(rt)
+			for _, key := range tagObj.Keys() {
+				p.tags[key] = tagObj.Get(key).String()
+			}
+		case "maxOpenConns":
+			n := int(v.ToInteger())
+			p.maxOpenConns = &n
+		case "maxIdleConns":
+			n := int(v.ToInteger())
+			p.maxIdleConns = &n
+		case "connMaxLifetime":
+			p.connMaxLifetime, err = types.GetDurationValue(v.Export())
+		case "connMaxIdleTime":
+			p.connMaxIdleTime, err = types.GetDurationValue(v.Export())
+		default:
+			return p, fmt.Errorf("unknown open param: '%s'", k)
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid %s value: %w", k, err)
+		}
+	}
+	return p, nil
+}
+
+func isRegistered(driver string) bool {
+	for _, d := range dbsql.Drivers() {
+		if d == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// DB is a database with the connection pool of a VU.
+type DB struct {
+	vu        modules.VU
+	pool      *dbsql.DB
+	tags      map[string]string
+	closePool func() error
+}
+
+// ExecResult is the result of a statement that doesn't return rows.
+type ExecResult struct {
+	RowsAffected int64 `js:"rowsAffected"`
+	// LastInsertID is 0 for drivers that don't support it.
+	LastInsertID int64 `js:"lastInsertId"`
+}
+
+// Query runs a query and returns its rows as objects with a property for
+// each column.
+func (db *DB) Query(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return db.query(db.pool, query, args)
+}
+
+// Exec runs a statement that doesn't return rows, like INSERT or UPDATE.
+func (db *DB) Exec(query string, args ...interface{}) (*ExecResult, error) {
+	return db.exec(db.pool, query, args)
+}
+
+// Prepare creates a prepared statement for repeated queries or statements.
+func (db *DB) Prepare(query string) (*Stmt, error) {
+	ctx := db.vu.Context()
+	if db.vu.State() == nil {
+		return nil, ErrSQLInInitContext
+	}
+	stmt, err := db.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{db: db, stmt: stmt, query: query}, nil
+}
+
+// Close closes the connection pool of the database, also for the other
+// databases of the VU with the same driver and data source name.
+func (db *DB) Close() error {
+	return db.closePool()
+}
+
+// Stmt is a prepared statement.
+type Stmt struct {
+	db    *DB
+	stmt  *dbsql.Stmt
+	query string
+}
+
+// Query runs the prepared query with the arguments.
+func (s *Stmt) Query(args ...interface{}) ([]map[string]interface{}, error) {
+	return s.db.query(preparedQuerier{s.stmt}, s.query, args)
+}
+
+// Exec runs the prepared statement with the arguments.
+func (s *Stmt) Exec(args ...interface{}) (*ExecResult, error) {
+	return s.db.exec(preparedQuerier{s.stmt}, s.query, args)
+}
+
+// Close closes the prepared statement.
+func (s *Stmt) Close() error {
+	return s.stmt.Close()
+}
+
+// querier is implemented by both connection pools and prepared statements,
+// whose query is ignored.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*dbsql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (dbsql.Result, error)
+}
+
+type preparedQuerier struct {
+	stmt *dbsql.Stmt
+}
+
+func (p preparedQuerier) QueryContext(ctx context.Context, _ string, args ...interface{}) (*dbsql.Rows, error) {
+	return p.stmt.QueryContext(ctx, args...)
+}
+
+func (p preparedQuerier) ExecContext(ctx context.Context, _ string, args ...interface{}) (dbsql.Result, error) {
+	return p.stmt.ExecContext(ctx, args...)
+}
+
+func (db *DB) query(q querier, query string, args []interface{}) ([]map[string]interface{}, error) {
+	ctx := db.vu.Context()
+	if db.vu.State() == nil {
+		return nil, ErrSQLInInitContext
+	}
+
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		db.pushDuration(query, start, err)
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	result, err := scanRows(rows)
+	db.pushDuration(query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (db *DB) exec(q querier, query string, args []interface{}) (*ExecResult, error) {
+	ctx := db.vu.Context()
+	if db.vu.State() == nil {
+		return nil, ErrSQLInInitContext
+	}
+
+	start := time.Now()
+	res, err := q.ExecContext(ctx, query, args...)
+	db.pushDuration(query, start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExecResult{}
+	if result.RowsAffected, err = res.RowsAffected(); err != nil {
+		return nil, err
+	}
+	if id, err := res.LastInsertId(); err == nil {
+		result.LastInsertID = id
+	}
+	return result, nil
+}
+
+// scanRows converts the rows to objects. Text that the driver returns as
+// bytes is converted to strings.
+func scanRows(rows *dbsql.Rows) ([]map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, 0)
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// pushDuration pushes the sql_query_duration sample of the query, the failed
+// ones are tagged with expected_response:false and the error, so thresholds
+// can be set for them.
+func (db *DB) pushDuration(query string, start time.Time, err error) {
+	state := db.vu.State()
+	now := time.Now()
+	tags := state.CloneTags()
+	for k, v := range db.tags {
+		tags[k] = v
+	}
+	operation, table := parseStatement(query)
+	tags["operation"] = operation
+	if table != "" {
+		tags["table"] = table
+	}
+	tags["expected_response"] = strconv.FormatBool(err == nil)
+	stats.PushIfNotDone(db.vu.Context(), state.Samples, stats.Sample{
+		Metric: state.BuiltinMetrics.SQLQueryDuration,
+		Tags:   stats.IntoSampleTags(&tags),
+		Time:   now,
+		Value:  stats.D(now.Sub(start)),
+	})
+}
+
+// parseStatement returns the operation of the statement, which is its first
+// keyword in lower case, and its table. The table is only guessed from the
+// keywords before it and is the first one for statements with many tables.
+func parseStatement(query string) (operation, table string) {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' || r == ')' || r == ',' || r == ';'
+	})
+	if len(words) == 0 {
+		return "", ""
+	}
+	operation = strings.ToLower(words[0])
+	for i := 0; i < len(words)-1; i++ {
+		switch strings.ToLower(words[i]) {
+		case "from", "into", "update", "table", "join":
+		default:
+			continue
+		}
+		for _, word := range words[i+1:] {
+			switch strings.ToLower(word) {
+			case "if", "not", "exists", "only":
+				continue
+			}
+			return operation, strings.Trim(word, "`\"[]")
+		}
+	}
+	return operation, ""
+}
@@ -0,0 +1,270 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modulestest"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/stats"
+)
+
+type testState struct {
+	rt      *goja.Runtime
+	vu      *modulestest.VU
+	state   *lib.State
+	samples chan stats.SampleContainer
+}
+
+func newTestState(t testing.TB) testState {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:          root,
+		Samples:        samples,
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+		Tags:           lib.NewTagMap(map[string]string{"scenario": "db"}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	vu := &modulestest.VU{
+		CtxField:     ctx,
+		InitEnvField: &common.InitEnvironment{},
+		RuntimeField: rt,
+	}
+	mi := New().NewModuleInstance(vu)
+	require.NoError(t, rt.Set("sql", mi.Exports().Named))
+
+	return testState{
+		rt:      rt,
+		vu:      vu,
+		state:   state,
+		samples: samples,
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		query, operation, table string
+	}{
+		{"SELECT * FROM users WHERE id = ?", "select", "users"},
+		{"select count(*) from `orders`;", "select", "orders"},
+		{"INSERT INTO users(name, age) VALUES (?, ?)", "insert", "users"},
+		{"UPDATE \"users\" SET age = age + 1", "update", "users"},
+		{"DELETE FROM sessions", "delete", "sessions"},
+		{"CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY)", "create", "users"},
+		{"SELECT 1", "select", ""},
+		{"  \n", "", ""},
+	}
+	for _, tc := range testCases {
+		operation, table := parseStatement(tc.query)
+		assert.Equal(t, tc.operation, operation, tc.query)
+		assert.Equal(t, tc.table, table, tc.query)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	_, err := ts.rt.RunString(`sql.open("nope", "dsn")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown SQL driver 'nope'")
+	assert.Contains(t, err.Error(), "drivers need to be added to k6 with an extension")
+
+	_, err = ts.rt.RunString(`sql.open("k6test", "db", {nope: 1})`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown open param: 'nope'")
+
+	_, err = ts.rt.RunString(`sql.open("k6test", "db").query("SELECT 1")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "running SQL queries in the init context is not supported")
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	// databases are opened in the init context and used in the VU context
+	_, err := ts.rt.RunString(`
+		var db = sql.open("k6test", "users", {tags: {db: "users"}, maxOpenConns: 2});
+		var sameDB = sql.open("k6test", "users");
+	`)
+	require.NoError(t, err)
+	ts.vu.StateField = ts.state
+
+	_, err = ts.rt.RunString(`
+		if (sql.drivers().indexOf("k6test") < 0) { throw new Error("k6test isn't registered"); }
+
+		var res = db.exec("INSERT INTO users (name, age) VALUES (?, ?)", "alice", 30);
+		if (res.rowsAffected !== 2 || res.lastInsertId !== 0) { throw new Error("wrong result: " + JSON.stringify(res)); }
+
+		var insert = db.prepare("INSERT INTO users (name) VALUES (?)");
+		for (var i = 0; i < 3; i++) { insert.exec("user" + i); }
+		insert.close();
+
+		var rows = sameDB.query("SELECT value FROM users WHERE name = ?", "alice", 30, 1.5, null);
+		if (JSON.stringify(rows) !== '[{"value":"alice"},{"value":30},{"value":1.5},{"value":null}]') {
+			throw new Error("wrong rows: " + JSON.stringify(rows));
+		}
+		if (db.query("SELECT value FROM users").length !== 0) { throw new Error("expected no rows"); }
+		db.prepare("UPDATE users SET age = ?").exec(31);
+	`)
+	require.NoError(t, err)
+
+	_, err = ts.rt.RunString(`db.query("SELECT * FROM missing")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such table: missing")
+
+	_, err = ts.rt.RunString(`db.exec("DELETE FROM missing")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such table: missing")
+
+	samples := stats.GetBufferedSamples(ts.samples)
+	assert.Equal(t, 4, testutils.CountMetric(samples, metrics.SQLQueryDurationName, map[string]string{
+		"operation": "insert", "table": "users", "db": "users", "scenario": "db", "expected_response": "true",
+	}))
+	assert.Equal(t, 2, testutils.CountMetric(samples, metrics.SQLQueryDurationName,
+		map[string]string{"operation": "select", "table": "users"}))
+	assert.Equal(t, 1, testutils.CountMetric(samples, metrics.SQLQueryDurationName, map[string]string{"operation": "update"}))
+	assert.Equal(t, 1, testutils.CountMetric(samples, metrics.SQLQueryDurationName, map[string]string{
+		"operation": "select", "table": "missing", "expected_response": "false",
+	}))
+	for _, sample := range samples {
+		for _, s := range sample.GetSamples() {
+			_, hasError := s.Tags.Get("error")
+			assert.False(t, hasError, "the error tag would make the series unbounded")
+		}
+	}
+	assert.Equal(t, 1, testutils.CountMetric(samples, metrics.SQLQueryDurationName, map[string]string{
+		"operation": "delete", "table": "missing", "expected_response": "false",
+	}))
+
+	_, err = ts.rt.RunString(`
+		db.close();
+		sameDB.query("SELECT 1");
+	`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sql: database is closed")
+
+	// a closed pool is replaced by a new one
+	_, err = ts.rt.RunString(`
+		db = sql.open("k6test", "users");
+		if (db.query("SELECT value", 1).length !== 1) { throw new Error("wrong rows"); }
+		db.close();
+	`)
+	require.NoError(t, err)
+}
+
+func init() { //nolint:gochecknoinits
+	dbsql.Register("k6test", testDriver{})
+}
+
+// testDriver is a database/sql driver for the tests. Its queries return a
+// row for each of their arguments, with the argument as the value column,
+// and its statements affect as many rows as they have arguments. Everything
+// with the table "missing" fails.
+type testDriver struct{}
+
+func (testDriver) Open(string) (driver.Conn, error) {
+	return testConn{}, nil
+}
+
+type testConn struct{}
+
+func (testConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(query, "missing") {
+		return nil, errors.New("no such table: missing")
+	}
+	return testStmt{}, nil
+}
+
+func (testConn) Close() error {
+	return nil
+}
+
+func (testConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+type testStmt struct{}
+
+func (testStmt) Close() error {
+	return nil
+}
+
+func (testStmt) NumInput() int {
+	return -1
+}
+
+func (testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &testRows{values: args}, nil
+}
+
+type testRows struct {
+	values []driver.Value
+}
+
+func (*testRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (*testRows) Close() error {
+	return nil
+}
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	if s, ok := dest[0].(string); ok {
+		// text is usually returned as bytes
+		dest[0] = []byte(s)
+	}
+	r.values = r.values[1:]
+	return nil
+}
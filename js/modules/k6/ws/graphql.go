@@ -0,0 +1,199 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dop251/goja"
+
+	"go.k6.io/k6/js/common"
+	httpModule "go.k6.io/k6/js/modules/k6/http"
+	"go.k6.io/k6/lib/netext/httpext"
+)
+
+// graphQLWSProtocol is the subprotocol of https://github.com/enisdenjo/graphql-ws.
+const graphQLWSProtocol = "graphql-transport-ws"
+
+// graphQLSubscriptionID is the id of the only operation of a subscription's
+// connection.
+const graphQLSubscriptionID = "1"
+
+type graphQLMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// graphQLSubscription runs a single GraphQL operation over its own WebSocket
+// with the graphql-ws protocol. The onnext, onerror and oncomplete handlers
+// are called with the payloads of the respective messages, connection errors
+// are reported to onerror in the same format as GraphQL errors.
+type graphQLSubscription struct {
+	ws  *webSocket
+	obj *goja.Object
+
+	request          *httpext.GraphQLRequest
+	connectionParams interface{}
+	acknowledged     bool
+	done             bool
+}
+
+// GraphQLSubscribe executes the GraphQL request, usually a subscription, over
+// a WebSocket to url. The params are the same as the ones of ws.connect, with
+// the addition of connectionParams, which are the payload of the
+// connection_init message.
+func (mi *WS) GraphQLSubscribe(url string, request, paramsV goja.Value) (*goja.Object, error) {
+	rt := mi.vu.Runtime()
+	state := mi.vu.State()
+	if state == nil {
+		return nil, ErrWSInInitContext
+	}
+
+	gqlReq, err := httpModule.ParseGraphQLRequest(rt, request)
+	if err != nil {
+		return nil, err
+	}
+	op, err := gqlReq.Operation()
+	if err != nil {
+		return nil, err
+	}
+	params, err := parseConnectParams(rt, state, url, paramsV)
+	if err != nil {
+		return nil, err
+	}
+	params.subprotocols = []string{graphQLWSProtocol}
+	op.Tags(params.tags)
+
+	sub := &graphQLSubscription{obj: rt.NewObject(), request: gqlReq}
+	if paramsV != nil && !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		if v := paramsV.ToObject(rt).Get("connectionParams"); v != nil && !goja.IsUndefined(v) {
+			sub.connectionParams = v.Export()
+		}
+	}
+	for _, event := range []string{"next", "error", "complete"} {
+		if err = sub.obj.Set("on"+event, goja.Null()); err != nil {
+			return nil, err
+		}
+	}
+	if err = sub.obj.Set("unsubscribe", sub.unsubscribe); err != nil {
+		return nil, err
+	}
+
+	sub.ws = mi.openWebSocket(state, url, params)
+	sub.ws.addEventListener("open", rt.ToValue(sub.onOpen))
+	sub.ws.addEventListener("message", rt.ToValue(sub.onMessage))
+	sub.ws.addEventListener("error", rt.ToValue(sub.onError))
+	sub.ws.addEventListener("close", rt.ToValue(sub.onClose))
+	return sub.obj, nil
+}
+
+func (sub *graphQLSubscription) send(msg graphQLMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return sub.ws.send(sub.ws.vu.Runtime().ToValue(string(data)))
+}
+
+// call calls the on<event> handler of the subscription, if it's set.
+func (sub *graphQLSubscription) call(event string, args ...interface{}) error {
+	handler, ok := goja.AssertFunction(sub.obj.Get("on" + event))
+	if !ok {
+		return nil
+	}
+	rt := sub.ws.vu.Runtime()
+	values := make([]goja.Value, len(args))
+	for i, arg := range args {
+		values[i] = rt.ToValue(arg)
+	}
+	_, err := handler(sub.obj, values...)
+	return err
+}
+
+// fail finishes the subscription with an error that didn't come from the
+// server, e.g. a connection error.
+func (sub *graphQLSubscription) fail(message string) error {
+	if sub.done {
+		return nil
+	}
+	sub.done = true
+	return sub.call("error", []interface{}{map[string]interface{}{"message": message}})
+}
+
+func (sub *graphQLSubscription) onOpen() error {
+	return sub.send(graphQLMessage{Type: "connection_init", Payload: sub.connectionParams})
+}
+
+func (sub *graphQLSubscription) onMessage(event *goja.Object) error {
+	var msg graphQLMessage
+	if err := json.Unmarshal([]byte(event.Get("data").String()), &msg); err != nil {
+		return sub.fail(fmt.Sprintf("invalid graphql-ws message: %s", err))
+	}
+	if sub.done {
+		return nil
+	}
+
+	switch msg.Type {
+	case "connection_ack":
+		sub.acknowledged = true
+		return sub.send(graphQLMessage{ID: graphQLSubscriptionID, Type: "subscribe", Payload: sub.request})
+	case "ping":
+		return sub.send(graphQLMessage{Type: "pong"})
+	case "next":
+		return sub.call("next", msg.Payload)
+	case "error":
+		sub.done = true
+		err := sub.call("error", msg.Payload)
+		_ = sub.ws.close(goja.Undefined(), "")
+		return err
+	case "complete":
+		sub.done = true
+		err := sub.call("complete")
+		_ = sub.ws.close(goja.Undefined(), "")
+		return err
+	}
+	return nil
+}
+
+func (sub *graphQLSubscription) onError(event *goja.Object) error {
+	return sub.fail(event.Get("error").String())
+}
+
+func (sub *graphQLSubscription) onClose(event *goja.Object) error {
+	return sub.fail(fmt.Sprintf("the connection was closed with code %s before the subscription completed: %s",
+		event.Get("code"), event.Get("reason")))
+}
+
+// unsubscribe stops the operation and closes the connection.
+func (sub *graphQLSubscription) unsubscribe() {
+	if sub.done {
+		return
+	}
+	sub.done = true
+	if sub.acknowledged {
+		_ = sub.send(graphQLMessage{ID: graphQLSubscriptionID, Type: "complete"})
+	}
+	if err := sub.ws.close(goja.Undefined(), ""); err != nil {
+		common.Throw(sub.ws.vu.Runtime(), err)
+	}
+}
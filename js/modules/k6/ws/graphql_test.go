@@ -0,0 +1,164 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext/httpext"
+	"go.k6.io/k6/stats"
+)
+
+// serveGraphQLWS is a graphql-ws server that sends as many counter values as
+// the count variable says and then completes, or errors for a negative count.
+// The Idle operation never completes after its first value.
+func serveGraphQLWS(w http.ResponseWriter, req *http.Request) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{graphQLWSProtocol}}
+	conn, err := upgrader.Upgrade(w, req, w.Header())
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	for {
+		var msg struct {
+			ID      string
+			Type    string
+			Payload struct {
+				OperationName string
+				Variables     struct{ Count int }
+				Token         string
+			}
+		}
+		if conn.ReadJSON(&msg) != nil {
+			return
+		}
+		switch msg.Type {
+		case "connection_init":
+			if msg.Payload.Token != "secret" {
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(4403, "Forbidden"),
+					time.Now().Add(time.Second))
+				return
+			}
+			_ = conn.WriteJSON(graphQLMessage{Type: "ping"})
+			_ = conn.WriteJSON(graphQLMessage{Type: "connection_ack"})
+		case "subscribe":
+			count := msg.Payload.Variables.Count
+			if msg.Payload.OperationName == "Idle" {
+				_ = conn.WriteJSON(graphQLMessage{ID: msg.ID, Type: "next", Payload: map[string]interface{}{
+					"data": map[string]int{"counter": 0},
+				}})
+				continue
+			}
+			if count < 0 {
+				_ = conn.WriteJSON(graphQLMessage{ID: msg.ID, Type: "error", Payload: []map[string]string{
+					{"message": "invalid count"},
+				}})
+				continue
+			}
+			for i := 1; i <= count; i++ {
+				_ = conn.WriteJSON(graphQLMessage{ID: msg.ID, Type: "next", Payload: map[string]interface{}{
+					"data": map[string]int{"counter": i},
+				}})
+			}
+			_ = conn.WriteJSON(graphQLMessage{ID: msg.ID, Type: "complete"})
+		}
+	}
+}
+
+func TestGraphQLSubscribe(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+	ts.tb.Mux.HandleFunc("/graphql", serveGraphQLWS)
+
+	err := ts.runLoop(context.Background(), `
+		var events = [];
+		function subscribe(name, count) {
+			var query = "subscription Counter($count: Int!) { counter(to: $count) } subscription Idle { idle }";
+			var sub = ws.graphqlSubscribe("WSBIN_URL/graphql",
+				{query: query, operationName: name, variables: {count: count}},
+				{connectionParams: {token: "secret"}});
+			sub.onnext = function(payload) {
+				events.push(name + count + " next " + payload.data.counter);
+				if (name == "Idle") { sub.unsubscribe(); }
+			};
+			sub.onerror = function(errors) { events.push(name + count + " error " + errors[0].message); };
+			sub.oncomplete = function() { events.push(name + count + " complete"); };
+			return sub;
+		}
+		subscribe("Counter", 2);
+		subscribe("Counter", -1);
+		subscribe("Idle", 0);
+	`)
+	require.NoError(t, err)
+
+	events, err := ts.rt.RunString(`events`)
+	require.NoError(t, err)
+	var got []string
+	require.NoError(t, ts.rt.ExportTo(events, &got))
+	assert.ElementsMatch(t, []string{
+		"Counter2 next 1", "Counter2 next 2", "Counter2 complete", "Counter-1 error invalid count", "Idle0 next 0",
+	}, got)
+
+	sessions := 0
+	for _, sc := range stats.GetBufferedSamples(ts.samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name != metrics.WSSessionsName {
+				continue
+			}
+			sessions++
+			tags := s.Tags.CloneTags()
+			assert.Equal(t, "subscription", tags[httpext.GraphQLOperationTypeTag])
+			assert.Contains(t, []string{"Counter", "Idle"}, tags[httpext.GraphQLOperationTag])
+			assert.Equal(t, sr("WSBIN_URL/graphql"), tags["url"])
+		}
+	}
+	assert.Equal(t, 3, sessions)
+
+	t.Run("rejected", func(t *testing.T) {
+		err := ts.runLoop(context.Background(), `
+			var failure;
+			var sub = ws.graphqlSubscribe("WSBIN_URL/graphql", "subscription { counter }");
+			sub.onerror = function(errors) { failure = errors[0].message; };
+		`)
+		require.NoError(t, err)
+		failure, err := ts.rt.RunString(`failure`)
+		require.NoError(t, err)
+		assert.Equal(t, "the connection was closed with code 4403 before the subscription completed: Forbidden",
+			failure.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := ts.runLoop(context.Background(),
+			`ws.graphqlSubscribe("WSBIN_URL/graphql", "subscription A { a } subscription B { b }")`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the operationName is required")
+	})
+}
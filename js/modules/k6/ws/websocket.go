@@ -0,0 +1,410 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/stats"
+)
+
+// The ready states of a WebSocket, same as in browsers.
+const (
+	stateConnecting = iota
+	stateOpen
+	stateClosing
+	stateClosed
+)
+
+// webSocket is a browser-style WebSocket. Unlike ws.connect, it doesn't block
+// the VU: the connection is handled by its own goroutine and the event
+// handlers are run by the VU's event loop, so the iteration only ends once
+// all of the sockets it opened are closed.
+type webSocket struct {
+	vu     modules.VU
+	obj    *goja.Object
+	url    string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// only accessed on the event loop
+	readyState int
+	protocol   string
+	extensions string
+	conn       *websocket.Conn
+	listeners  map[string][]goja.Callable
+
+	// only accessed by the goroutine of the connection
+	enqueue func(func() error) bool
+
+	pingMu             sync.Mutex
+	pingSendTimestamps map[string]time.Time
+	pingSendCounter    int
+
+	sampleTags  *stats.SampleTags
+	messageTags messageTags
+}
+
+// newWebSocket is the JS constructor of WebSocket objects, which accepts the
+// same params as ws.connect.
+func (mi *WS) newWebSocket(call goja.ConstructorCall) *goja.Object {
+	rt := mi.vu.Runtime()
+	state := mi.vu.State()
+	if state == nil {
+		common.Throw(rt, ErrWSInInitContext)
+	}
+
+	url := call.Argument(0).String()
+	params, err := parseConnectParams(rt, state, url, call.Argument(1))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	return mi.openWebSocket(state, url, params).obj
+}
+
+// openWebSocket starts connecting to url in the background.
+func (mi *WS) openWebSocket(state *lib.State, url string, params *connectParams) *webSocket {
+	rt := mi.vu.Runtime()
+	ctx, cancel := context.WithCancel(params.withNetwork(mi.vu.Context()))
+	ws := &webSocket{
+		vu:                 mi.vu,
+		obj:                rt.NewObject(),
+		url:                url,
+		ctx:                ctx,
+		cancel:             cancel,
+		readyState:         stateConnecting,
+		listeners:          make(map[string][]goja.Callable),
+		pingSendTimestamps: make(map[string]time.Time),
+	}
+	ws.defineProperties(rt)
+
+	ws.enqueue = mi.vu.RegisterCallback()
+	go ws.run(state, params)
+
+	return ws
+}
+
+func (ws *webSocket) defineProperties(rt *goja.Runtime) {
+	must := func(err error) {
+		if err != nil {
+			common.Throw(rt, err)
+		}
+	}
+	getter := func(name string, fn func() goja.Value) {
+		must(ws.obj.DefineAccessorProperty(name, rt.ToValue(fn), nil, goja.FLAG_FALSE, goja.FLAG_TRUE))
+	}
+
+	must(ws.obj.DefineDataProperty("url", rt.ToValue(ws.url), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE))
+	getter("readyState", func() goja.Value { return rt.ToValue(ws.readyState) })
+	getter("protocol", func() goja.Value { return rt.ToValue(ws.protocol) })
+	getter("extensions", func() goja.Value { return rt.ToValue(ws.extensions) })
+	for name, value := range map[string]int{
+		"CONNECTING": stateConnecting, "OPEN": stateOpen, "CLOSING": stateClosing, "CLOSED": stateClosed,
+	} {
+		must(ws.obj.DefineDataProperty(name, rt.ToValue(value), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE))
+	}
+	for _, event := range []string{"open", "message", "error", "close"} {
+		must(ws.obj.Set("on"+event, goja.Null()))
+	}
+
+	must(ws.obj.Set("send", ws.send))
+	must(ws.obj.Set("ping", ws.ping))
+	must(ws.obj.Set("close", ws.close))
+	must(ws.obj.Set("addEventListener", ws.addEventListener))
+}
+
+// run connects and then reads from the connection until it's closed, queuing
+// an event on the event loop for everything that happens.
+//nolint:funlen
+func (ws *webSocket) run(state *lib.State, params *connectParams) {
+	defer ws.cancel()
+
+	wsd := params.dialer(state)
+	start := time.Now()
+	conn, httpResponse, connErr := wsd.DialContext(ws.ctx, ws.url, params.header)
+	connectionDuration := stats.D(time.Since(start))
+	if httpResponse != nil {
+		_ = httpResponse.Body.Close()
+	}
+
+	tags := params.tags
+	addResponseTags(state, tags, conn, httpResponse)
+	ws.messageTags = newMessageTags(tags)
+	ws.sampleTags = stats.IntoSampleTags(&tags)
+
+	stats.PushIfNotDone(ws.ctx, state.Samples, stats.ConnectedSamples{
+		Samples: []stats.Sample{
+			{Metric: state.BuiltinMetrics.WSSessions, Time: start, Tags: ws.sampleTags, Value: 1},
+			{Metric: state.BuiltinMetrics.WSConnecting, Time: start, Tags: ws.sampleTags, Value: connectionDuration},
+		},
+		Tags: ws.sampleTags,
+		Time: start,
+	})
+
+	if connErr != nil {
+		ws.queue(false, func() error {
+			ws.readyState = stateClosed
+			if err := ws.dispatch("error", map[string]interface{}{"error": connErr.Error()}); err != nil {
+				return err
+			}
+			return ws.dispatch("close", closeEvent(websocket.CloseAbnormalClosure, "", false))
+		})
+		return
+	}
+
+	go func() {
+		<-ws.ctx.Done()
+		_ = conn.Close()
+	}()
+	defer func() {
+		stats.PushIfNotDone(ws.ctx, state.Samples, stats.Sample{
+			Metric: state.BuiltinMetrics.WSSessionDuration,
+			Tags:   ws.sampleTags,
+			Time:   start,
+			Value:  stats.D(time.Since(start)),
+		})
+	}()
+
+	conn.SetPongHandler(func(pingID string) error {
+		ws.trackPong(state, pingID)
+		return nil
+	})
+
+	protocol, extensions := negotiatedProtocol(conn), negotiatedExtensions(httpResponse)
+	if !ws.queue(true, func() error {
+		if ws.readyState != stateConnecting {
+			// closed before the connection was established
+			return nil
+		}
+		ws.conn = conn
+		ws.protocol, ws.extensions = protocol, extensions
+		ws.readyState = stateOpen
+		return ws.dispatch("open", nil)
+	}) {
+		return
+	}
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			ws.queueClose(err)
+			return
+		}
+
+		pushMessageSamples(ws.ctx, state.Samples, state.BuiltinMetrics.WSMessagesReceived,
+			state.BuiltinMetrics.WSMessagesReceivedBytes, ws.messageTags.of(messageType), len(data))
+
+		if !ws.queue(true, func() error {
+			if messageType == websocket.BinaryMessage {
+				ab := ws.vu.Runtime().NewArrayBuffer(data)
+				return ws.dispatch("message", map[string]interface{}{"data": &ab})
+			}
+			return ws.dispatch("message", map[string]interface{}{"data": string(data)})
+		}) {
+			return
+		}
+	}
+}
+
+// queue queues f on the event loop and, if more events are expected, keeps
+// the socket registered with it. It returns false if the event loop run the
+// socket was created in has already finished.
+func (ws *webSocket) queue(more bool, f func() error) bool {
+	var next func(func() error) bool
+	if more {
+		next = ws.vu.RegisterCallback()
+	}
+	if !ws.enqueue(f) {
+		if next != nil {
+			next(func() error { return nil })
+		}
+		return false
+	}
+	ws.enqueue = next
+	return true
+}
+
+// queueClose queues the close event after reading from the connection failed.
+func (ws *webSocket) queueClose(readErr error) {
+	code, reason, wasClean := websocket.CloseAbnormalClosure, "", false
+	var closeErr *websocket.CloseError
+	if errors.As(readErr, &closeErr) {
+		code, reason, wasClean = closeErr.Code, closeErr.Text, true
+	}
+
+	ws.queue(false, func() error {
+		unexpected := !wasClean && ws.readyState != stateClosing
+		ws.readyState = stateClosed
+		if unexpected {
+			if err := ws.dispatch("error", map[string]interface{}{"error": readErr.Error()}); err != nil {
+				return err
+			}
+		}
+		return ws.dispatch("close", closeEvent(code, reason, wasClean))
+	})
+}
+
+func closeEvent(code int, reason string, wasClean bool) map[string]interface{} {
+	return map[string]interface{}{"code": code, "reason": reason, "wasClean": wasClean}
+}
+
+// dispatch calls the on<event> handler and all of the event listeners with
+// an event object with the given fields. If any of them throws, the socket
+// is closed, since the iteration is going to be interrupted.
+func (ws *webSocket) dispatch(event string, fields map[string]interface{}) error {
+	rt := ws.vu.Runtime()
+	ev := rt.NewObject()
+	for k, v := range fields {
+		if err := ev.Set(k, v); err != nil {
+			return err
+		}
+	}
+	if err := ev.Set("type", event); err != nil {
+		return err
+	}
+	if err := ev.Set("target", ws.obj); err != nil {
+		return err
+	}
+
+	handlers := ws.listeners[event]
+	if handler, ok := goja.AssertFunction(ws.obj.Get("on" + event)); ok {
+		handlers = append([]goja.Callable{handler}, handlers...)
+	}
+	for _, handler := range handlers {
+		if _, err := handler(ws.obj, ev); err != nil {
+			ws.cancel()
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws *webSocket) addEventListener(event string, handler goja.Value) {
+	if fn, ok := goja.AssertFunction(handler); ok {
+		ws.listeners[event] = append(ws.listeners[event], fn)
+	}
+}
+
+// send sends a text message for strings and a binary one for ArrayBuffers.
+func (ws *webSocket) send(data goja.Value) error {
+	switch ws.readyState {
+	case stateConnecting:
+		return errors.New("can't send a message before the WebSocket is open")
+	case stateClosing, stateClosed:
+		return nil
+	}
+
+	messageType, msg := websocket.TextMessage, []byte(data.String())
+	if ab, ok := data.Export().(goja.ArrayBuffer); ok {
+		messageType, msg = websocket.BinaryMessage, ab.Bytes()
+	}
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := ws.conn.WriteMessage(messageType, msg); err != nil {
+		return ws.dispatch("error", map[string]interface{}{"error": err.Error()})
+	}
+
+	state := ws.vu.State()
+	pushMessageSamples(ws.ctx, state.Samples, state.BuiltinMetrics.WSMessagesSent,
+		state.BuiltinMetrics.WSMessagesSentBytes, ws.messageTags.of(messageType), len(msg))
+	return nil
+}
+
+// ping sends a ping, the round trip time is measured by the ws_ping metric.
+func (ws *webSocket) ping() error {
+	if ws.readyState != stateOpen {
+		return nil
+	}
+
+	ws.pingMu.Lock()
+	pingID := strconv.Itoa(ws.pingSendCounter)
+	ws.pingSendCounter++
+	ws.pingSendTimestamps[pingID] = time.Now()
+	ws.pingMu.Unlock()
+
+	if err := ws.conn.WriteControl(websocket.PingMessage, []byte(pingID), time.Now().Add(writeWait)); err != nil {
+		return ws.dispatch("error", map[string]interface{}{"error": err.Error()})
+	}
+	return nil
+}
+
+func (ws *webSocket) trackPong(state *lib.State, pingID string) {
+	pongTimestamp := time.Now()
+
+	ws.pingMu.Lock()
+	pingTimestamp, ok := ws.pingSendTimestamps[pingID]
+	delete(ws.pingSendTimestamps, pingID)
+	ws.pingMu.Unlock()
+	if !ok {
+		// We received a pong for a ping we didn't send; ignore
+		return
+	}
+
+	stats.PushIfNotDone(ws.ctx, state.Samples, stats.Sample{
+		Metric: state.BuiltinMetrics.WSPing,
+		Time:   pongTimestamp,
+		Tags:   ws.sampleTags,
+		Value:  stats.D(pongTimestamp.Sub(pingTimestamp)),
+	})
+}
+
+// close starts the closing handshake, the close event is emitted once the
+// server responds or after a timeout.
+func (ws *webSocket) close(code goja.Value, reason string) error {
+	switch ws.readyState {
+	case stateClosing, stateClosed:
+		return nil
+	case stateConnecting:
+		ws.readyState = stateClosing
+		ws.cancel()
+		return nil
+	}
+
+	closeCode := websocket.CloseNormalClosure
+	if code != nil && !goja.IsUndefined(code) && !goja.IsNull(code) {
+		closeCode = int(code.ToInteger())
+		if closeCode != websocket.CloseNormalClosure && (closeCode < 3000 || closeCode > 4999) {
+			return fmt.Errorf("invalid close code %d, it should be 1000 or between 3000 and 4999", closeCode)
+		}
+	}
+
+	ws.readyState = stateClosing
+	err := ws.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(writeWait))
+	if err != nil {
+		_ = ws.conn.Close()
+		return nil
+	}
+	// don't wait for the server's response forever
+	_ = ws.conn.SetReadDeadline(time.Now().Add(writeWait))
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ws
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/stats"
+)
+
+func (ts testState) runLoop(ctx context.Context, script string) error {
+	return ts.loop.Start(ctx, func() error {
+		_, err := ts.rt.RunString(ts.tb.Replacer.Replace(script))
+		return err
+	})
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	err := ts.runLoop(context.Background(), `
+		var events = [];
+		function open(name) {
+			var socket = new ws.WebSocket("WSBIN_URL/ws-echo");
+			if (socket.readyState !== socket.CONNECTING) { throw new Error("unexpected state " + socket.readyState); }
+			socket.onopen = function() {
+				events.push(name + " open");
+				socket.send(name);
+			};
+			socket.onmessage = function(e) {
+				events.push(name + " message " + e.data);
+			};
+			socket.addEventListener("close", function(e) {
+				if (socket.readyState !== socket.CLOSED) { throw new Error("unexpected state " + socket.readyState); }
+				events.push(name + " close " + e.code + " " + e.wasClean);
+			});
+		}
+		open("first");
+		open("second");
+		events.push("end of the script");
+	`)
+	require.NoError(t, err)
+
+	events, err := ts.rt.RunString(`events`)
+	require.NoError(t, err)
+	var got []string
+	require.NoError(t, ts.rt.ExportTo(events, &got))
+	assert.Equal(t, "end of the script", got[0])
+	assert.ElementsMatch(t, []string{
+		"end of the script",
+		"first open", "first message first", "first close 1000 true",
+		"second open", "second message second", "second close 1000 true",
+	}, got)
+
+	samples := stats.GetBufferedSamples(ts.samples)
+	assertSessionMetricsEmitted(t, samples, "", sr("WSBIN_URL/ws-echo"), statusProtocolSwitch, "")
+	assertMetricEmittedCount(t, metrics.WSSessionsName, samples, sr("WSBIN_URL/ws-echo"), 2)
+	assertMetricEmittedCount(t, metrics.WSMessagesSentName, samples, sr("WSBIN_URL/ws-echo"), 2)
+	assertMetricEmittedCount(t, metrics.WSMessagesReceivedName, samples, sr("WSBIN_URL/ws-echo"), 2)
+}
+
+func TestWebSocketClose(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	ts.tb.Mux.HandleFunc("/ws-idle", func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, w.Header())
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	err := ts.runLoop(context.Background(), `
+		var closed = null;
+		var socket = new ws.WebSocket("WSBIN_URL/ws-idle");
+		socket.onopen = function() {
+			socket.ping();
+			socket.close(4000, "bye");
+			if (socket.readyState !== socket.CLOSING) { throw new Error("unexpected state " + socket.readyState); }
+		};
+		socket.onclose = function(e) { closed = e.code + " " + e.wasClean; };
+	`)
+	require.NoError(t, err)
+	closed, err := ts.rt.RunString(`closed`)
+	require.NoError(t, err)
+	assert.Equal(t, "4000 true", closed.String())
+	samples := stats.GetBufferedSamples(ts.samples)
+	assertSessionMetricsEmitted(t, samples, "", sr("WSBIN_URL/ws-idle"), statusProtocolSwitch, "")
+	assertMetricEmittedCount(t, metrics.WSPingName, samples, sr("WSBIN_URL/ws-idle"), 1)
+
+	t.Run("context done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := ts.runLoop(ctx, `new ws.WebSocket("WSBIN_URL/ws-idle")`)
+		require.NoError(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		err := ts.runLoop(context.Background(), `
+			var socket = new ws.WebSocket("WSBIN_URL/ws-idle");
+			socket.onopen = function() { socket.close(1001); };
+		`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid close code 1001")
+	})
+}
+
+func TestWebSocketErrors(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+
+	t.Run("connection error", func(t *testing.T) {
+		err := ts.runLoop(context.Background(), `
+			var events = [];
+			var socket = new ws.WebSocket("ws://127.0.0.1:1/nothing");
+			socket.onerror = function(e) { events.push("error"); };
+			socket.onclose = function(e) { events.push("close " + e.code + " " + e.wasClean); };
+		`)
+		require.NoError(t, err)
+		events, err := ts.rt.RunString(`events.join(", ")`)
+		require.NoError(t, err)
+		assert.Equal(t, "error, close 1006 false", events.String())
+	})
+
+	t.Run("send before open", func(t *testing.T) {
+		err := ts.runLoop(context.Background(), `
+			var socket = new ws.WebSocket("WSBIN_URL/ws-echo");
+			socket.send("too early");
+		`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't send a message before the WebSocket is open")
+	})
+
+	t.Run("exception in a handler", func(t *testing.T) {
+		err := ts.runLoop(context.Background(), `
+			var socket = new ws.WebSocket("WSBIN_URL/ws-echo");
+			socket.onopen = function() { throw new Error("oops"); };
+		`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "oops")
+	})
+}
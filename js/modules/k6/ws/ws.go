@@ -28,6 +28,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"strconv"
 	"strings"
 	"sync"
@@ -39,7 +40,10 @@ import (
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
 	httpModule "go.k6.io/k6/js/modules/k6/http"
+	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext"
+	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/stats"
 )
 
@@ -76,6 +80,12 @@ func (*RootModule) NewModuleInstance(m modules.VU) modules.Instance {
 	if err := obj.Set("connect", mi.Connect); err != nil {
 		common.Throw(rt, err)
 	}
+	if err := obj.Set("WebSocket", mi.newWebSocket); err != nil {
+		common.Throw(rt, err)
+	}
+	if err := obj.Set("graphqlSubscribe", mi.GraphQLSubscribe); err != nil {
+		common.Throw(rt, err)
+	}
 
 	mi.obj = obj
 	return mi
@@ -85,6 +95,11 @@ func (*RootModule) NewModuleInstance(m modules.VU) modules.Instance {
 var ErrWSInInitContext = common.NewInitContextError("using websockets in the init context is not supported")
 
 type Socket struct {
+	// Protocol is the subprotocol and Extensions are the extensions that were
+	// negotiated with the server during the handshake.
+	Protocol   string `js:"protocol"`
+	Extensions string `js:"extensions"`
+
 	rt            *goja.Runtime
 	ctx           context.Context
 	conn          *websocket.Conn
@@ -97,6 +112,7 @@ type Socket struct {
 	pingSendCounter    int
 
 	sampleTags     *stats.SampleTags
+	messageTags    messageTags
 	samplesOutput  chan<- stats.SampleContainer
 	builtinMetrics *metrics.BuiltinMetrics
 }
@@ -118,7 +134,14 @@ const writeWait = 10 * time.Second
 
 // Exports returns the exports of the ws module.
 func (mi *WS) Exports() modules.Exports {
-	return modules.Exports{Default: mi.obj}
+	return modules.Exports{
+		Default: mi.obj,
+		Named: map[string]interface{}{
+			"connect":          mi.Connect,
+			"WebSocket":        mi.newWebSocket,
+			"graphqlSubscribe": mi.GraphQLSubscribe,
+		},
+	}
 }
 
 // Connect establishes a WebSocket connection based on the parameters provided.
@@ -150,119 +173,24 @@ func (mi *WS) Connect(url string, args ...goja.Value) (*WSHTTPResponse, error) {
 		return nil, errors.New("last argument to ws.connect must be a function")
 	}
 
-	header := make(http.Header)
-	header.Set("User-Agent", state.Options.UserAgent.String)
-
-	enableCompression := false
-
-	tags := state.CloneTags()
-	jar := state.CookieJar
-
-	// Parse the optional second argument (params)
-	if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
-		params := paramsV.ToObject(rt)
-		for _, k := range params.Keys() {
-			switch k {
-			case "headers":
-				headersV := params.Get(k)
-				if goja.IsUndefined(headersV) || goja.IsNull(headersV) {
-					continue
-				}
-				headersObj := headersV.ToObject(rt)
-				if headersObj == nil {
-					continue
-				}
-				for _, key := range headersObj.Keys() {
-					header.Set(key, headersObj.Get(key).String())
-				}
-			case "tags":
-				tagsV := params.Get(k)
-				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
-					continue
-				}
-				tagObj := tagsV.ToObject(rt)
-				if tagObj == nil {
-					continue
-				}
-				for _, key := range tagObj.Keys() {
-					tags[key] = tagObj.Get(key).String()
-				}
-			case "jar":
-				jarV := params.Get(k)
-				if goja.IsUndefined(jarV) || goja.IsNull(jarV) {
-					continue
-				}
-				if v, ok := jarV.Export().(*httpModule.CookieJar); ok {
-					jar = v.Jar
-				}
-			case "compression":
-				// deflate compression algorithm is supported - as defined in RFC7692
-				// compression here relies on the implementation in gorilla/websocket package, usage is
-				// experimental and may result in decreased performance. package supports
-				// only "no context takeover" scenario
-
-				algoString := strings.TrimSpace(params.Get(k).ToString().String())
-				if algoString == "" {
-					continue
-				}
-
-				if algoString != "deflate" {
-					return nil, fmt.Errorf("unsupported compression algorithm '%s', supported algorithm is 'deflate'", algoString)
-				}
-
-				enableCompression = true
-			}
-		}
-
-	}
-
-	if state.Options.SystemTags.Has(stats.TagURL) {
-		tags["url"] = url
-	}
-
-	// Overriding the NextProtos to avoid talking http2
-	var tlsConfig *tls.Config
-	if state.TLSConfig != nil {
-		tlsConfig = state.TLSConfig.Clone()
-		tlsConfig.NextProtos = []string{"http/1.1"}
-	}
-
-	wsd := websocket.Dialer{
-		HandshakeTimeout: time.Second * 60, // TODO configurable
-		// Pass a custom net.DialContext function to websocket.Dialer that will substitute
-		// the underlying net.Conn with our own tracked netext.Conn
-		NetDialContext:    state.Dialer.DialContext,
-		Proxy:             http.ProxyFromEnvironment,
-		TLSClientConfig:   tlsConfig,
-		EnableCompression: enableCompression,
-		Jar:               jar,
-	}
-	if jar == nil { // this is needed because of how interfaces work and that wsd.Jar is http.Cookiejar
-		wsd.Jar = nil
+	params, err := parseConnectParams(rt, state, url, paramsV)
+	if err != nil {
+		return nil, err
 	}
+	ctx = params.withNetwork(ctx)
+	tags, header := params.tags, params.header
+	wsd := params.dialer(state)
 
 	start := time.Now()
 	conn, httpResponse, connErr := wsd.DialContext(ctx, url, header)
 	connectionEnd := time.Now()
 	connectionDuration := stats.D(connectionEnd.Sub(start))
 
-	if state.Options.SystemTags.Has(stats.TagIP) && conn.RemoteAddr() != nil {
-		if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
-			tags["ip"] = ip
-		}
-	}
-
-	if httpResponse != nil {
-		if state.Options.SystemTags.Has(stats.TagStatus) {
-			tags["status"] = strconv.Itoa(httpResponse.StatusCode)
-		}
-
-		if state.Options.SystemTags.Has(stats.TagSubproto) {
-			tags["subproto"] = httpResponse.Header.Get("Sec-WebSocket-Protocol")
-		}
-	}
+	addResponseTags(state, tags, conn, httpResponse)
 
 	socket := Socket{
+		Protocol:           negotiatedProtocol(conn),
+		Extensions:         negotiatedExtensions(httpResponse),
 		ctx:                ctx,
 		rt:                 rt,
 		conn:               conn,
@@ -271,6 +199,7 @@ func (mi *WS) Connect(url string, args ...goja.Value) (*WSHTTPResponse, error) {
 		scheduled:          make(chan goja.Callable),
 		done:               make(chan struct{}),
 		samplesOutput:      state.Samples,
+		messageTags:        newMessageTags(tags),
 		sampleTags:         stats.IntoSampleTags(&tags),
 		builtinMetrics:     state.BuiltinMetrics,
 	}
@@ -361,12 +290,8 @@ func (mi *WS) Connect(url string, args ...goja.Value) (*WSHTTPResponse, error) {
 			socket.handleEvent("pong")
 
 		case msg := <-readDataChan:
-			stats.PushIfNotDone(ctx, socket.samplesOutput, stats.Sample{
-				Metric: socket.builtinMetrics.WSMessagesReceived,
-				Time:   time.Now(),
-				Tags:   socket.sampleTags,
-				Value:  1,
-			})
+			pushMessageSamples(ctx, socket.samplesOutput, socket.builtinMetrics.WSMessagesReceived,
+				socket.builtinMetrics.WSMessagesReceivedBytes, socket.messageTags.of(msg.mtype), len(msg.data))
 
 			if msg.mtype == websocket.BinaryMessage {
 				ab := rt.NewArrayBuffer(msg.data)
@@ -399,6 +324,238 @@ func (mi *WS) Connect(url string, args ...goja.Value) (*WSHTTPResponse, error) {
 	}
 }
 
+// connectParams are the parsed params of ws.connect and the WebSocket constructor.
+type connectParams struct {
+	header            http.Header
+	tags              map[string]string
+	jar               *cookiejar.Jar
+	enableCompression bool
+	subprotocols      []string
+	fragmentSize      int
+	network           *netext.NetworkEmulator
+	hasNetwork        bool
+}
+
+//nolint:funlen,gocognit,cyclop
+func parseConnectParams(rt *goja.Runtime, state *lib.State, url string, paramsV goja.Value) (*connectParams, error) {
+	header := make(http.Header)
+	header.Set("User-Agent", state.Options.UserAgent.String)
+
+	params := &connectParams{
+		header: header,
+		tags:   state.CloneTags(),
+		jar:    state.CookieJar,
+	}
+
+	if !goja.IsUndefined(paramsV) && paramsV != nil && !goja.IsNull(paramsV) {
+		paramsObj := paramsV.ToObject(rt)
+		for _, k := range paramsObj.Keys() {
+			switch k {
+			case "headers":
+				headersV := paramsObj.Get(k)
+				if goja.IsUndefined(headersV) || goja.IsNull(headersV) {
+					continue
+				}
+				headersObj := headersV.ToObject(rt)
+				if headersObj == nil {
+					continue
+				}
+				for _, key := range headersObj.Keys() {
+					header.Set(key, headersObj.Get(key).String())
+				}
+			case "tags":
+				tagsV := paramsObj.Get(k)
+				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+					continue
+				}
+				tagObj := tagsV.ToObject(rt)
+				if tagObj == nil {
+					continue
+				}
+				for _, key := range tagObj.Keys() {
+					params.tags[key] = tagObj.Get(key).String()
+				}
+			case "jar":
+				jarV := paramsObj.Get(k)
+				if goja.IsUndefined(jarV) || goja.IsNull(jarV) {
+					continue
+				}
+				if v, ok := jarV.Export().(*httpModule.CookieJar); ok {
+					params.jar = v.Jar
+				}
+			case "compression":
+				// deflate compression algorithm is supported - as defined in RFC7692
+				// compression here relies on the implementation in gorilla/websocket package, usage is
+				// experimental and may result in decreased performance. package supports
+				// only "no context takeover" scenario
+
+				algoString := strings.TrimSpace(paramsObj.Get(k).ToString().String())
+				if algoString == "" {
+					continue
+				}
+
+				if algoString != "deflate" {
+					return nil, fmt.Errorf("unsupported compression algorithm '%s', supported algorithm is 'deflate'", algoString)
+				}
+
+				params.enableCompression = true
+			case "subprotocols":
+				subprotocolsV := paramsObj.Get(k)
+				if goja.IsUndefined(subprotocolsV) || goja.IsNull(subprotocolsV) {
+					continue
+				}
+				var subprotocols []interface{}
+				if err := rt.ExportTo(subprotocolsV, &subprotocols); err != nil {
+					return nil, fmt.Errorf("subprotocols must be an array of strings: %w", err)
+				}
+				for _, subprotocol := range subprotocols {
+					str, ok := subprotocol.(string)
+					if !ok || str == "" {
+						return nil, fmt.Errorf("invalid subprotocol '%v', it needs to be a non-empty string", subprotocol)
+					}
+					params.subprotocols = append(params.subprotocols, str)
+				}
+			case "fragmentSize":
+				// messages larger than the fragment size are sent in several
+				// frames, gorilla/websocket fragments them at its default
+				// write buffer size (4096 bytes) otherwise
+				size := paramsObj.Get(k).ToInteger()
+				if size <= 0 {
+					return nil, fmt.Errorf("invalid fragmentSize %d, it needs to be a positive number of bytes", size)
+				}
+				params.fragmentSize = int(size)
+			case "network":
+				networkV := paramsObj.Get(k)
+				if goja.IsUndefined(networkV) || goja.IsNull(networkV) {
+					continue
+				}
+				network, err := types.GetNetworkConditions(networkV.Export())
+				if err != nil {
+					return nil, err
+				}
+				params.network = netext.NewClientNetworkEmulator(state.Dialer, network)
+				params.hasNetwork = true
+			}
+		}
+	}
+
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		params.tags["url"] = url
+	}
+
+	return params, nil
+}
+
+// addResponseTags adds the system tags that depend on the handshake response.
+func addResponseTags(state *lib.State, tags map[string]string, conn *websocket.Conn, httpResponse *http.Response) {
+	if state.Options.SystemTags.Has(stats.TagIP) && conn != nil && conn.RemoteAddr() != nil {
+		if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			tags["ip"] = ip
+		}
+	}
+
+	if httpResponse != nil {
+		if state.Options.SystemTags.Has(stats.TagStatus) {
+			tags["status"] = strconv.Itoa(httpResponse.StatusCode)
+		}
+
+		if state.Options.SystemTags.Has(stats.TagSubproto) {
+			tags["subproto"] = httpResponse.Header.Get("Sec-WebSocket-Protocol")
+		}
+	}
+}
+
+// negotiatedProtocol returns the subprotocol that the server selected.
+func negotiatedProtocol(conn *websocket.Conn) string {
+	if conn == nil {
+		return ""
+	}
+	return conn.Subprotocol()
+}
+
+// negotiatedExtensions returns the extensions, like permessage-deflate, that
+// the server accepted.
+func negotiatedExtensions(httpResponse *http.Response) string {
+	if httpResponse == nil {
+		return ""
+	}
+	return strings.Join(httpResponse.Header.Values("Sec-WebSocket-Extensions"), ", ")
+}
+
+// messageTags are the tags of the message metrics, which have the type of the
+// messages too, unless the user set a type tag.
+type messageTags struct {
+	text, binary *stats.SampleTags
+}
+
+func newMessageTags(tags map[string]string) messageTags {
+	withType := func(messageType string) *stats.SampleTags {
+		result := make(map[string]string, len(tags)+1)
+		result["type"] = messageType
+		for k, v := range tags {
+			result[k] = v
+		}
+		return stats.IntoSampleTags(&result)
+	}
+	return messageTags{text: withType("text"), binary: withType("binary")}
+}
+
+// of returns the tags for the message type consts in gorilla/websocket/conn.go.
+func (t messageTags) of(messageType int) *stats.SampleTags {
+	if messageType == websocket.BinaryMessage {
+		return t.binary
+	}
+	return t.text
+}
+
+// pushMessageSamples emits the count and the size of a sent or received message.
+func pushMessageSamples(
+	ctx context.Context, output chan<- stats.SampleContainer,
+	count, size *stats.Metric, tags *stats.SampleTags, length int,
+) {
+	now := time.Now()
+	stats.PushIfNotDone(ctx, output, stats.Samples{
+		{Metric: count, Time: now, Tags: tags, Value: 1},
+		{Metric: size, Time: now, Tags: tags, Value: float64(length)},
+	})
+}
+
+// withNetwork returns a context that makes the dialer use the network
+// conditions from the params, if there were any.
+func (p *connectParams) withNetwork(ctx context.Context) context.Context {
+	if !p.hasNetwork {
+		return ctx
+	}
+	return netext.WithNetworkEmulator(ctx, p.network)
+}
+
+// dialer returns the websocket.Dialer for the params.
+func (p *connectParams) dialer(state *lib.State) websocket.Dialer {
+	// Overriding the NextProtos to avoid talking http2
+	var tlsConfig *tls.Config
+	if state.TLSConfig != nil {
+		tlsConfig = state.TLSConfig.Clone()
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	wsd := websocket.Dialer{
+		HandshakeTimeout: time.Second * 60, // TODO configurable
+		// Pass a custom net.DialContext function to websocket.Dialer that will substitute
+		// the underlying net.Conn with our own tracked netext.Conn
+		NetDialContext:    state.Dialer.DialContext,
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   tlsConfig,
+		EnableCompression: p.enableCompression,
+		Subprotocols:      p.subprotocols,
+		WriteBufferSize:   p.fragmentSize,
+		Jar:               p.jar,
+	}
+	if p.jar == nil { // this is needed because of how interfaces work and that wsd.Jar is http.Cookiejar
+		wsd.Jar = nil
+	}
+	return wsd
+}
+
 func (s *Socket) On(event string, handler goja.Value) {
 	if handler, ok := goja.AssertFunction(handler); ok {
 		s.eventHandlers[event] = append(s.eventHandlers[event], handler)
@@ -421,12 +578,8 @@ func (s *Socket) Send(message string) {
 		s.handleEvent("error", s.rt.ToValue(err))
 	}
 
-	stats.PushIfNotDone(s.ctx, s.samplesOutput, stats.Sample{
-		Metric: s.builtinMetrics.WSMessagesSent,
-		Time:   time.Now(),
-		Tags:   s.sampleTags,
-		Value:  1,
-	})
+	pushMessageSamples(s.ctx, s.samplesOutput, s.builtinMetrics.WSMessagesSent,
+		s.builtinMetrics.WSMessagesSentBytes, s.messageTags.text, len(message))
 }
 
 // SendBinary writes the given ArrayBuffer message to the connection.
@@ -436,7 +589,9 @@ func (s *Socket) SendBinary(message goja.Value) {
 	}
 
 	msg := message.Export()
+	var length int
 	if ab, ok := msg.(goja.ArrayBuffer); ok {
+		length = len(ab.Bytes())
 		if err := s.conn.WriteMessage(websocket.BinaryMessage, ab.Bytes()); err != nil {
 			s.handleEvent("error", s.rt.ToValue(err))
 		}
@@ -451,12 +606,8 @@ func (s *Socket) SendBinary(message goja.Value) {
 		common.Throw(s.rt, fmt.Errorf("expected ArrayBuffer as argument, received: %s", jsType))
 	}
 
-	stats.PushIfNotDone(s.ctx, s.samplesOutput, stats.Sample{
-		Metric: s.builtinMetrics.WSMessagesSent,
-		Time:   time.Now(),
-		Tags:   s.sampleTags,
-		Value:  1,
-	})
+	pushMessageSamples(s.ctx, s.samplesOutput, s.builtinMetrics.WSMessagesSent,
+		s.builtinMetrics.WSMessagesSentBytes, s.messageTags.binary, length)
 }
 
 func (s *Socket) Ping() {
@@ -39,6 +39,7 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/eventloop"
 	httpModule "go.k6.io/k6/js/modules/k6/http"
 	"go.k6.io/k6/js/modulestest"
 	"go.k6.io/k6/lib"
@@ -97,6 +98,7 @@ func assertMetricEmittedCount(t *testing.T, metricName string, sampleContainers
 
 type testState struct {
 	ctxPtr  *context.Context
+	loop    *eventloop.EventLoop
 	rt      *goja.Runtime
 	tb      *httpmultibin.HTTPMultiBin
 	state   *lib.State
@@ -132,15 +134,18 @@ func newTestState(t testing.TB) testState {
 		Tags:           lib.NewTagMap(nil),
 	}
 
+	loop := eventloop.New()
 	m := New().NewModuleInstance(&modulestest.VU{
-		CtxField:     tb.Context,
-		InitEnvField: &common.InitEnvironment{},
-		RuntimeField: rt,
-		StateField:   state,
+		CtxField:              tb.Context,
+		InitEnvField:          &common.InitEnvironment{},
+		RuntimeField:          rt,
+		StateField:            state,
+		RegisterCallbackField: loop.RegisterCallback,
 	})
 	require.NoError(t, rt.Set("ws", m.Exports().Default))
 
 	return testState{
+		loop:    loop,
 		rt:      rt,
 		tb:      tb,
 		state:   state,
@@ -808,6 +813,9 @@ func TestSystemTags(t *testing.T) {
 			for _, sampleContainer := range stats.GetBufferedSamples(samples) {
 				for _, sample := range sampleContainer.GetSamples() {
 					for emittedTag := range sample.Tags.CloneTags() {
+						if emittedTag == "type" {
+							continue // the message type is a plain tag, not a system one
+						}
 						assert.Equal(t, expectedTag, emittedTag)
 					}
 				}
@@ -1290,3 +1298,215 @@ func TestCookieJar(t *testing.T) {
 
 	assertSessionMetricsEmitted(t, stats.GetBufferedSamples(ts.samples), "", sr("WSBIN_URL/ws-echo-someheader"), statusProtocolSwitch, "")
 }
+
+func TestNetworkConditions(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	_, err := ts.rt.RunString(sr(`
+		var res = ws.connect("WSBIN_URL/ws-echo", {network: {latency: "100ms"}}, function(socket){
+			socket.close()
+		});
+		if (res.status != 101) { throw new Error("connection failed with status: " + res.status); }
+		`))
+	require.NoError(t, err)
+
+	var connecting []float64
+	for _, sc := range stats.GetBufferedSamples(ts.samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name == metrics.WSConnectingName {
+				connecting = append(connecting, s.Value)
+			}
+		}
+	}
+	require.Len(t, connecting, 1)
+	// the connection setup and the handshake are a round trip each
+	assert.GreaterOrEqual(t, connecting[0], 200.0)
+
+	_, err = ts.rt.RunString(sr(`ws.connect("WSBIN_URL/ws-echo", {network: "5g"}, function(socket){})`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown network preset '5g'")
+}
+
+// echoAll echoes all of the messages it receives, with the same type.
+func echoAll(upgrader websocket.Upgrader) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, w.Header())
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestSubprotocols(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+	ts.tb.Mux.HandleFunc("/ws-chat", echoAll(websocket.Upgrader{
+		Subprotocols:      []string{"chat.v2", "chat.v1"},
+		EnableCompression: true,
+	}))
+
+	_, err := ts.rt.RunString(sr(`
+	var protocols = [];
+	ws.connect("WSBIN_URL/ws-chat", {subprotocols: ["chat.v1", "chat.v2"], compression: "deflate"}, function(socket) {
+		protocols.push(socket.protocol, socket.extensions);
+		socket.close();
+	});
+	ws.connect("WSBIN_URL/ws-chat?unsupported", {subprotocols: ["chat.v3"]}, function(socket) {
+		protocols.push(socket.protocol, socket.extensions);
+		socket.close();
+	});
+	protocols;
+	`))
+	require.NoError(t, err)
+	protocols, err := ts.rt.RunString(`protocols`)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		"chat.v2", "permessage-deflate; server_no_context_takeover; client_no_context_takeover", "", "",
+	}, protocols.Export())
+	assertSessionMetricsEmitted(t, stats.GetBufferedSamples(ts.samples), "chat.v2", sr("WSBIN_URL/ws-chat"),
+		statusProtocolSwitch, "")
+
+	t.Run("WebSocket", func(t *testing.T) {
+		err := ts.runLoop(context.Background(), `
+			var protocol;
+			var socket = new ws.WebSocket("WSBIN_URL/ws-chat", {subprotocols: ["chat.v1"]});
+			socket.onopen = function() {
+				protocol = socket.protocol + " " + socket.extensions;
+				socket.close();
+			};
+		`)
+		require.NoError(t, err)
+		protocol, err := ts.rt.RunString(`protocol`)
+		require.NoError(t, err)
+		assert.Equal(t, "chat.v1 ", protocol.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ts.rt.RunString(sr(`ws.connect("WSBIN_URL/ws-chat", {subprotocols: ["chat", 1]}, function() {})`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid subprotocol '1', it needs to be a non-empty string")
+	})
+}
+
+func TestMessageMetrics(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+	ts.tb.Mux.HandleFunc("/ws-echo-all", echoAll(websocket.Upgrader{}))
+
+	_, err := ts.rt.RunString(sr(`
+	ws.connect("WSBIN_URL/ws-echo-all", function(socket) {
+		var received = 0;
+		socket.on("open", function() {
+			socket.send("hello");
+			socket.sendBinary(new Uint8Array(10).buffer);
+		});
+		function onReceived() {
+			if (++received == 2) { socket.close(); }
+		}
+		socket.on("message", onReceived);
+		socket.on("binaryMessage", onReceived);
+	});
+	`))
+	require.NoError(t, err)
+
+	type message struct {
+		metric, messageType string
+		value               float64
+	}
+	var messages []message
+	for _, sc := range stats.GetBufferedSamples(ts.samples) {
+		for _, s := range sc.GetSamples() {
+			switch s.Metric.Name {
+			case metrics.WSMessagesSentName, metrics.WSMessagesReceivedName,
+				metrics.WSMessagesSentBytesName, metrics.WSMessagesReceivedBytesName:
+				messageType, _ := s.Tags.Get("type")
+				messages = append(messages, message{s.Metric.Name, messageType, s.Value})
+			}
+		}
+	}
+	assert.ElementsMatch(t, []message{
+		{metrics.WSMessagesSentName, "text", 1},
+		{metrics.WSMessagesSentBytesName, "text", 5},
+		{metrics.WSMessagesSentName, "binary", 1},
+		{metrics.WSMessagesSentBytesName, "binary", 10},
+		{metrics.WSMessagesReceivedName, "text", 1},
+		{metrics.WSMessagesReceivedBytesName, "text", 5},
+		{metrics.WSMessagesReceivedName, "binary", 1},
+		{metrics.WSMessagesReceivedBytesName, "binary", 10},
+	}, messages)
+}
+
+func TestMessageTagsUserType(t *testing.T) {
+	t.Parallel()
+	tags := newMessageTags(map[string]string{"type": "chat", "url": "ws://k6.test"})
+	for _, messageType := range []int{websocket.TextMessage, websocket.BinaryMessage} {
+		assert.Equal(t, map[string]string{"type": "chat", "url": "ws://k6.test"}, tags.of(messageType).CloneTags())
+	}
+	assert.Equal(t, map[string]string{"type": "binary"}, newMessageTags(nil).of(websocket.BinaryMessage).CloneTags())
+}
+
+func TestFragmentSize(t *testing.T) {
+	t.Parallel()
+	ts := newTestState(t)
+	sr := ts.tb.Replacer.Replace
+
+	// the payload sizes of the frames of the first message, which is read
+	// from the raw connection, since gorilla/websocket hides the frames
+	frames := make(chan []int, 1)
+	ts.tb.Mux.HandleFunc("/ws-frames", func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, w.Header())
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		var sizes []int
+		raw := conn.UnderlyingConn()
+		for {
+			header := make([]byte, 2)
+			if _, err = io.ReadFull(raw, header); err != nil {
+				return
+			}
+			// client frames are always masked and these are short enough
+			// to have their length in the first header byte
+			size := int(header[1] & 0x7f)
+			if _, err = io.ReadFull(raw, make([]byte, 4+size)); err != nil {
+				return
+			}
+			sizes = append(sizes, size)
+			if header[0]&0x80 != 0 { // the final frame
+				break
+			}
+		}
+		frames <- sizes
+	})
+
+	_, err := ts.rt.RunString(sr(`
+	ws.connect("WSBIN_URL/ws-frames", {fragmentSize: 16}, function(socket) {
+		socket.on("open", function() {
+			socket.sendBinary(new Uint8Array(40).buffer);
+			socket.close();
+		});
+	});
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, []int{16, 16, 8}, <-frames)
+
+	_, err = ts.rt.RunString(sr(`ws.connect("WSBIN_URL/ws-frames", {fragmentSize: 0}, function() {})`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid fragmentSize 0, it needs to be a positive number of bytes")
+}
@@ -107,6 +107,11 @@ type VU interface {
 
 	// Runtime returns the goja.Runtime for the current VU
 	Runtime() *goja.Runtime
+
+	// RegisterCallback signals that the module started some asynchronous work
+	// and returns a function that queues a callback to be run on the VU's
+	// event loop once it's done, see eventloop.EventLoop.RegisterCallback
+	RegisterCallback() func(func() error) bool
 }
 
 // Exports is representation of ESM exports of a module
@@ -37,6 +37,8 @@ type VU struct {
 	InitEnvField *common.InitEnvironment
 	StateField   *lib.State
 	RuntimeField *goja.Runtime
+
+	RegisterCallbackField func() func(func() error) bool
 }
 
 // Context returns internally set field to conform to modules.VU interface
@@ -58,3 +60,13 @@ func (m *VU) State() *lib.State {
 func (m *VU) Runtime() *goja.Runtime {
 	return m.RuntimeField
 }
+
+// RegisterCallback calls the internally set field to conform to modules.VU interface.
+// Without the field there is no event loop, so the callbacks are discarded like
+// the ones of an event loop that has already finished.
+func (m *VU) RegisterCallback() func(func() error) bool {
+	if m.RegisterCallbackField == nil {
+		return func(func() error) bool { return false }
+	}
+	return m.RegisterCallbackField()
+}
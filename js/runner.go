@@ -51,6 +51,7 @@ import (
 	"go.k6.io/k6/lib/consts"
 	"go.k6.io/k6/lib/metrics"
 	"go.k6.io/k6/lib/netext"
+	"go.k6.io/k6/lib/netext/dnsext"
 	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/loader"
 	"go.k6.io/k6/stats"
@@ -150,7 +151,7 @@ func (r *Runner) NewVU(idLocal, idGlobal uint64, samplesOut chan<- stats.SampleC
 // nolint:funlen
 func (r *Runner) newVU(idLocal, idGlobal uint64, samplesOut chan<- stats.SampleContainer) (*VU, error) {
 	// Instantiate a new bundle, make a VU out of it.
-	moduleVUImpl := &moduleVUImpl{ctxPtr: new(context.Context)}
+	moduleVUImpl := newModuleVUImpl()
 	bi, err := r.Bundle.Instantiate(r.Logger, idLocal, moduleVUImpl)
 	if err != nil {
 		return nil, err
@@ -186,6 +187,7 @@ func (r *Runner) newVU(idLocal, idGlobal uint64, samplesOut chan<- stats.SampleC
 		Blacklist:        r.Bundle.Options.BlacklistIPs,
 		BlockedHostnames: r.Bundle.Options.BlockedHostnames.Trie,
 		Hosts:            r.Bundle.Options.Hosts,
+		NetworkEmulator:  netext.NewNetworkEmulator(r.Bundle.Options.Network),
 	}
 	if r.Bundle.Options.LocalIPs.Valid {
 		var ipIndex uint64
@@ -451,14 +453,14 @@ func (r *Runner) SetOptions(opts lib.Options) error {
 	// (it needs the actual resolver, not the config), and it would
 	// require an additional field on Bundle to pass the config through,
 	// which is arguably worse than this.
-	if err := r.setResolver(opts.DNS); err != nil {
+	if err := r.setResolver(opts.DNS, opts.InsecureSkipTLSVerify.Bool); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (r *Runner) setResolver(dns types.DNSConfig) error {
+func (r *Runner) setResolver(dns types.DNSConfig, insecureSkipTLSVerify bool) error {
 	ttl, err := parseTTL(dns.TTL.String)
 	if err != nil {
 		return err
@@ -472,8 +474,24 @@ func (r *Runner) setResolver(dns types.DNSConfig) error {
 	if !dnsPol.Valid {
 		dnsPol = types.DefaultDNSConfig().Policy
 	}
-	r.Resolver = netext.NewResolver(
-		r.ActualResolver, ttl, dnsSel.DNSSelect, dnsPol.DNSPolicy)
+	if len(dns.Servers) == 0 {
+		r.Resolver = netext.NewResolver(
+			r.ActualResolver, ttl, dnsSel.DNSSelect, dnsPol.DNSPolicy)
+		return nil
+	}
+
+	servers := make([]dnsext.Server, len(dns.Servers))
+	for i, s := range dns.Servers {
+		if servers[i], err = dnsext.ParseServer(s); err != nil {
+			return err
+		}
+	}
+	client := dnsext.NewClient(servers, &tls.Config{
+		InsecureSkipVerify: insecureSkipTLSVerify, //nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+	})
+	r.Resolver = netext.NewNamedResolver(
+		client.LookupHost, ttl, dnsSel.DNSSelect, dnsPol.DNSPolicy)
 
 	return nil
 }
@@ -649,6 +667,13 @@ func (u *VU) Activate(params *lib.VUActivationParams) lib.ActiveVU {
 		u.state.Tags.Set("scenario", params.Scenario)
 	}
 
+	// Scenarios can override the global network conditions, and since the
+	// idle connections were made with the previous ones, they're dropped.
+	if network := opts.Network.Apply(params.Network); network != u.Dialer.NetworkEmulator.Conditions() {
+		u.Dialer.NetworkEmulator = netext.NewNetworkEmulator(network)
+		u.Transport.CloseIdleConnections()
+	}
+
 	ctx := common.WithRuntime(params.RunContext, u.Runtime)
 	ctx = lib.WithState(ctx, u.state)
 	params.RunContext = ctx
@@ -788,7 +813,10 @@ func (u *VU) runFn(
 	}()
 
 	startTime := time.Now()
-	v, err = fn(goja.Undefined(), args...) // Actually run the JS script
+	err = u.moduleVUImpl.eventLoop.Start(ctx, func() error {
+		v, err = fn(goja.Undefined(), args...) // Actually run the JS script
+		return err
+	})
 	endTime := time.Now()
 	var exception *goja.Exception
 	if errors.As(err, &exception) {
@@ -1286,6 +1286,41 @@ func TestVUIntegrationCookiesReset(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationWebSocket(t *testing.T) {
+	t.Parallel()
+	tb := httpmultibin.NewHTTPMultiBin(t)
+
+	r, err := getSimpleRunner(t, "/script.js", tb.Replacer.Replace(`
+			var http = require("k6/http");
+			var ws = require("k6/ws");
+			var closed = 0;
+			exports.default = function() {
+				// the socket from the previous iteration was closed before it ended
+				if (closed != __ITER) { throw new Error("wrong number of closed sockets: " + closed); }
+				var socket = new ws.WebSocket("WSBIN_URL/ws-echo");
+				socket.onopen = function() { socket.send("hello"); };
+				socket.onclose = function() { closed++; };
+
+				var res = http.get("HTTPBIN_URL/get");
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+			}
+		`))
+	require.NoError(t, err)
+	r.SetOptions(lib.Options{
+		Throw: null.BoolFrom(true),
+		Hosts: tb.Dialer.Hosts,
+	})
+
+	initVU, err := r.NewVU(1, 1, make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	vu := initVU.Activate(&lib.VUActivationParams{RunContext: ctx})
+	for i := 0; i < 2; i++ {
+		require.NoError(t, vu.RunOnce())
+	}
+}
+
 func TestVUIntegrationCookiesNoReset(t *testing.T) {
 	t.Parallel()
 	tb := httpmultibin.NewHTTPMultiBin(t)
@@ -86,6 +86,9 @@ type Archive struct {
 
 	Filesystems map[string]afero.Fs `json:"-"`
 
+	// The import map of the script, with the relative addresses already resolved.
+	ImportMap *loader.ImportMap `json:"importMap,omitempty"`
+
 	// Environment variables
 	Env map[string]string `json:"env"`
 
@@ -217,6 +220,37 @@ func normalizeAndAnonymizeURL(u *url.URL) {
 	}
 }
 
+// normalizeAndAnonymizeImportMap returns a copy of the import map with its file
+// URLs anonymized, like the paths of the files in the archive.
+func normalizeAndAnonymizeImportMap(m *loader.ImportMap) *loader.ImportMap {
+	if m == nil {
+		return nil
+	}
+	normalize := func(address string) string {
+		u, err := url.Parse(address)
+		if err != nil || u.Scheme != "file" {
+			return address
+		}
+		normalizeAndAnonymizeURL(u)
+		return u.String()
+	}
+	normalizeAll := func(imports map[string]string) map[string]string {
+		result := make(map[string]string, len(imports))
+		for specifier, address := range imports {
+			result[specifier] = normalize(address)
+		}
+		return result
+	}
+	result := &loader.ImportMap{Imports: normalizeAll(m.Imports)}
+	if len(m.Scopes) > 0 {
+		result.Scopes = make(map[string]map[string]string, len(m.Scopes))
+		for scope, imports := range m.Scopes {
+			result.Scopes[normalize(scope)] = normalizeAll(imports)
+		}
+	}
+	return result
+}
+
 func getURLPathOnFs(u *url.URL) (scheme string, pathOnFs string) {
 	scheme = "https"
 	switch {
@@ -251,6 +285,7 @@ func (arc *Archive) Write(out io.Writer) error {
 	normalizeAndAnonymizeURL(metaArc.PwdURL)
 	metaArc.Filename = getURLtoString(metaArc.FilenameURL)
 	metaArc.Pwd = getURLtoString(metaArc.PwdURL)
+	metaArc.ImportMap = normalizeAndAnonymizeImportMap(metaArc.ImportMap)
 	actualDataPath, err := url.PathUnescape(path.Join(getURLPathOnFs(metaArc.FilenameURL)))
 	if err != nil {
 		return err
@@ -286,6 +321,11 @@ func (arc *Archive) Write(out io.Writer) error {
 		if !ok {
 			continue
 		}
+		if cacher, ok := filesystem.(fsext.UncachedFilesCacher); ok {
+			if err = cacher.CacheUncachedFiles(); err != nil {
+				return err
+			}
+		}
 		if cachedfs, ok := filesystem.(fsext.CacheLayerGetter); ok {
 			filesystem = cachedfs.GetCachingFs()
 		}
@@ -299,6 +299,40 @@ func TestUsingCacheFromCacheOnReadFs(t *testing.T) {
 	require.Nil(t, data)
 }
 
+func TestArchiveWithUncachedFiles(t *testing.T) {
+	t.Parallel()
+	base := afero.NewMemMapFs()
+	cached := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(base, "/streamed", []byte(`test`), 0o644))
+	require.NoError(t, afero.WriteFile(cached, "/script.js", []byte(`test`), 0o644))
+	fs := fsext.NewCacheOnReadFs(base, cached, 0)
+	f, err := fs.(fsext.UncachedOpener).OpenUncached("/streamed")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = cached.Stat("/streamed")
+	require.Error(t, err)
+
+	arc := &Archive{
+		Type:        "js",
+		FilenameURL: &url.URL{Scheme: "file", Path: "/script.js"},
+		K6Version:   consts.Version,
+		Data:        []byte(`test`),
+		PwdURL:      &url.URL{Scheme: "file", Path: "/"},
+		Filesystems: map[string]afero.Fs{"file": fs},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, arc.Write(buf))
+
+	newArc, err := ReadArchive(buf)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(newArc.Filesystems["file"], "/streamed")
+	require.NoError(t, err)
+	require.Equal(t, "test", string(data))
+}
+
 func TestArchiveWithDataNotInFS(t *testing.T) {
 	t.Parallel()
 
@@ -49,6 +49,8 @@ type BaseConfig struct {
 	Env          map[string]string  `json:"env"`
 	Exec         null.String        `json:"exec"` // function name, externally validated
 	Tags         map[string]string  `json:"tags"`
+	// Network overrides the global emulated network conditions.
+	Network types.NetworkConditions `json:"network"`
 
 	// TODO: future extensions like distribution, others?
 }
@@ -295,6 +295,7 @@ func getVUActivationParams(
 		Exec:                     conf.GetExec(),
 		Env:                      conf.GetEnv(),
 		Tags:                     conf.GetTags(),
+		Network:                  conf.Network,
 		DeactivateCallback:       deactivateCallback,
 		GetNextIterationCounters: nextIterationCounters,
 	}
@@ -36,11 +36,13 @@ var ErrPathNeverRequestedBefore = errors.New("path never requested before")
 // that is used as cache
 type CacheOnReadFs struct {
 	afero.Fs
+	base  afero.Fs
 	cache afero.Fs
 
 	lock       *sync.Mutex
 	cachedOnly bool
 	cached     map[string]bool
+	uncached   map[string]bool
 }
 
 // OnlyCachedEnabler enables the mode of FS that allows to open
@@ -54,15 +56,29 @@ type CacheLayerGetter interface {
 	GetCachingFs() afero.Fs
 }
 
+// UncachedOpener opens files directly from the base filesystem, without
+// copying them in the cache layer first
+type UncachedOpener interface {
+	OpenUncached(name string) (afero.File, error)
+}
+
+// UncachedFilesCacher copies the files that were opened uncached to the cache
+// layer, e.g. before it's written to an archive
+type UncachedFilesCacher interface {
+	CacheUncachedFiles() error
+}
+
 // NewCacheOnReadFs returns a new CacheOnReadFs
 func NewCacheOnReadFs(base, layer afero.Fs, cacheTime time.Duration) afero.Fs {
 	return &CacheOnReadFs{
 		Fs:    afero.NewCacheOnReadFs(base, layer, cacheTime),
+		base:  base,
 		cache: layer,
 
 		lock:       &sync.Mutex{},
 		cachedOnly: false,
 		cached:     make(map[string]bool),
+		uncached:   make(map[string]bool),
 	}
 }
 
@@ -89,6 +105,49 @@ func (c *CacheOnReadFs) Open(name string) (afero.File, error) {
 	return c.Fs.Open(name)
 }
 
+// OpenUncached opens file from the base filesystem, so it can be read in
+// chunks without loading it in memory. It tracks the history of opened files
+// like Open, and the file is copied to the cache layer only if
+// CacheUncachedFiles is called later.
+func (c *CacheOnReadFs) OpenUncached(name string) (afero.File, error) {
+	if err := c.checkOrRemember(name); err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.uncached[name] = true
+	c.lock.Unlock()
+
+	return c.base.Open(name)
+}
+
+// CacheUncachedFiles copies the files opened with OpenUncached to the cache
+// layer, if they aren't there already
+func (c *CacheOnReadFs) CacheUncachedFiles() error {
+	c.lock.Lock()
+	names := make([]string, 0, len(c.uncached))
+	for name := range c.uncached {
+		names = append(names, name)
+	}
+	c.lock.Unlock()
+
+	for _, name := range names {
+		if _, err := c.cache.Stat(name); err == nil {
+			continue
+		}
+		// CacheOnReadFs.Open copies the file to the cache layer
+		f, err := c.Fs.Open(name)
+		if err != nil {
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Stat returns a FileInfo describing the named file, or an error, if any
 // happens.
 // if CacheOnReadFs is in the opened only mode it should return
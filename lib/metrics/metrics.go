@@ -38,21 +38,48 @@ const (
 	HTTPReqFailedName         = "http_req_failed"
 	HTTPReqDurationName       = "http_req_duration"
 	HTTPReqBlockedName        = "http_req_blocked"
+	HTTPReqLookingUpName      = "http_req_looking_up"
 	HTTPReqConnectingName     = "http_req_connecting"
 	HTTPReqTLSHandshakingName = "http_req_tls_handshaking"
 	HTTPReqSendingName        = "http_req_sending"
 	HTTPReqWaitingName        = "http_req_waiting"
 	HTTPReqReceivingName      = "http_req_receiving"
 
-	WSSessionsName         = "ws_sessions"
-	WSMessagesSentName     = "ws_msgs_sent"
-	WSMessagesReceivedName = "ws_msgs_received"
-	WSPingName             = "ws_ping"
-	WSSessionDurationName  = "ws_session_duration"
-	WSConnectingName       = "ws_connecting"
+	WSSessionsName              = "ws_sessions"
+	WSMessagesSentName          = "ws_msgs_sent"
+	WSMessagesReceivedName      = "ws_msgs_received"
+	WSMessagesSentBytesName     = "ws_msgs_sent_bytes"
+	WSMessagesReceivedBytesName = "ws_msgs_received_bytes"
+	WSPingName                  = "ws_ping"
+	WSSessionDurationName       = "ws_session_duration"
+	WSConnectingName            = "ws_connecting"
 
 	GRPCReqDurationName = "grpc_req_duration"
 
+	SSEEventsReceivedName    = "sse_events_received"
+	SSETimeToFirstEventName  = "sse_time_to_first_event"
+	SSEInterEventLatencyName = "sse_inter_event_latency"
+
+	TCPConnectingName = "tcp_connecting"
+	TCPRoundTripName  = "tcp_round_trip"
+	TCPErrorsName     = "tcp_errors"
+	UDPRoundTripName  = "udp_round_trip"
+	UDPErrorsName     = "udp_errors"
+
+	DNSQueryDurationName = "dns_query_duration"
+	DNSQueriesName       = "dns_queries"
+	DNSFailedName        = "dns_failed"
+
+	MQTTConnectingName       = "mqtt_connecting"
+	MQTTPublishDurationName  = "mqtt_publish_duration"
+	MQTTMessagesSentName     = "mqtt_msgs_sent"
+	MQTTMessagesReceivedName = "mqtt_msgs_received"
+	MQTTErrorsName           = "mqtt_errors"
+
+	SQLQueryDurationName = "sql_query_duration"
+
+	RedisCmdDurationName = "redis_cmd_duration"
+
 	DataSentName     = "data_sent"
 	DataReceivedName = "data_received"
 )
@@ -74,6 +101,7 @@ type BuiltinMetrics struct {
 	HTTPReqFailed         *stats.Metric
 	HTTPReqDuration       *stats.Metric
 	HTTPReqBlocked        *stats.Metric
+	HTTPReqLookingUp      *stats.Metric
 	HTTPReqConnecting     *stats.Metric
 	HTTPReqTLSHandshaking *stats.Metric
 	HTTPReqSending        *stats.Metric
@@ -81,16 +109,48 @@ type BuiltinMetrics struct {
 	HTTPReqReceiving      *stats.Metric
 
 	// Websocket-related
-	WSSessions         *stats.Metric
-	WSMessagesSent     *stats.Metric
-	WSMessagesReceived *stats.Metric
-	WSPing             *stats.Metric
-	WSSessionDuration  *stats.Metric
-	WSConnecting       *stats.Metric
+	WSSessions              *stats.Metric
+	WSMessagesSent          *stats.Metric
+	WSMessagesReceived      *stats.Metric
+	WSMessagesSentBytes     *stats.Metric
+	WSMessagesReceivedBytes *stats.Metric
+	WSPing                  *stats.Metric
+	WSSessionDuration       *stats.Metric
+	WSConnecting            *stats.Metric
 
 	// gRPC-related
 	GRPCReqDuration *stats.Metric
 
+	// Server-Sent Events-related
+	SSEEventsReceived    *stats.Metric
+	SSETimeToFirstEvent  *stats.Metric
+	SSEInterEventLatency *stats.Metric
+
+	// Raw socket-related
+	TCPConnecting *stats.Metric
+	TCPRoundTrip  *stats.Metric
+	TCPErrors     *stats.Metric
+	UDPRoundTrip  *stats.Metric
+	UDPErrors     *stats.Metric
+
+	// DNS-related
+	DNSQueryDuration *stats.Metric
+	DNSQueries       *stats.Metric
+	DNSFailed        *stats.Metric
+
+	// MQTT-related
+	MQTTConnecting       *stats.Metric
+	MQTTPublishDuration  *stats.Metric
+	MQTTMessagesSent     *stats.Metric
+	MQTTMessagesReceived *stats.Metric
+	MQTTErrors           *stats.Metric
+
+	// SQL-related
+	SQLQueryDuration *stats.Metric
+
+	// Redis-related
+	RedisCmdDuration *stats.Metric
+
 	// Network-related; used for future protocols as well.
 	DataSent     *stats.Metric
 	DataReceived *stats.Metric
@@ -112,21 +172,48 @@ func RegisterBuiltinMetrics(registry *Registry) *BuiltinMetrics {
 		HTTPReqFailed:         registry.MustNewMetric(HTTPReqFailedName, stats.Rate),
 		HTTPReqDuration:       registry.MustNewMetric(HTTPReqDurationName, stats.Trend, stats.Time),
 		HTTPReqBlocked:        registry.MustNewMetric(HTTPReqBlockedName, stats.Trend, stats.Time),
+		HTTPReqLookingUp:      registry.MustNewMetric(HTTPReqLookingUpName, stats.Trend, stats.Time),
 		HTTPReqConnecting:     registry.MustNewMetric(HTTPReqConnectingName, stats.Trend, stats.Time),
 		HTTPReqTLSHandshaking: registry.MustNewMetric(HTTPReqTLSHandshakingName, stats.Trend, stats.Time),
 		HTTPReqSending:        registry.MustNewMetric(HTTPReqSendingName, stats.Trend, stats.Time),
 		HTTPReqWaiting:        registry.MustNewMetric(HTTPReqWaitingName, stats.Trend, stats.Time),
 		HTTPReqReceiving:      registry.MustNewMetric(HTTPReqReceivingName, stats.Trend, stats.Time),
 
-		WSSessions:         registry.MustNewMetric(WSSessionsName, stats.Counter),
-		WSMessagesSent:     registry.MustNewMetric(WSMessagesSentName, stats.Counter),
-		WSMessagesReceived: registry.MustNewMetric(WSMessagesReceivedName, stats.Counter),
-		WSPing:             registry.MustNewMetric(WSPingName, stats.Trend, stats.Time),
-		WSSessionDuration:  registry.MustNewMetric(WSSessionDurationName, stats.Trend, stats.Time),
-		WSConnecting:       registry.MustNewMetric(WSConnectingName, stats.Trend, stats.Time),
+		WSSessions:              registry.MustNewMetric(WSSessionsName, stats.Counter),
+		WSMessagesSent:          registry.MustNewMetric(WSMessagesSentName, stats.Counter),
+		WSMessagesReceived:      registry.MustNewMetric(WSMessagesReceivedName, stats.Counter),
+		WSMessagesSentBytes:     registry.MustNewMetric(WSMessagesSentBytesName, stats.Counter, stats.Data),
+		WSMessagesReceivedBytes: registry.MustNewMetric(WSMessagesReceivedBytesName, stats.Counter, stats.Data),
+		WSPing:                  registry.MustNewMetric(WSPingName, stats.Trend, stats.Time),
+		WSSessionDuration:       registry.MustNewMetric(WSSessionDurationName, stats.Trend, stats.Time),
+		WSConnecting:            registry.MustNewMetric(WSConnectingName, stats.Trend, stats.Time),
 
 		GRPCReqDuration: registry.MustNewMetric(GRPCReqDurationName, stats.Trend, stats.Time),
 
+		SSEEventsReceived:    registry.MustNewMetric(SSEEventsReceivedName, stats.Counter),
+		SSETimeToFirstEvent:  registry.MustNewMetric(SSETimeToFirstEventName, stats.Trend, stats.Time),
+		SSEInterEventLatency: registry.MustNewMetric(SSEInterEventLatencyName, stats.Trend, stats.Time),
+
+		TCPConnecting: registry.MustNewMetric(TCPConnectingName, stats.Trend, stats.Time),
+		TCPRoundTrip:  registry.MustNewMetric(TCPRoundTripName, stats.Trend, stats.Time),
+		TCPErrors:     registry.MustNewMetric(TCPErrorsName, stats.Counter),
+		UDPRoundTrip:  registry.MustNewMetric(UDPRoundTripName, stats.Trend, stats.Time),
+		UDPErrors:     registry.MustNewMetric(UDPErrorsName, stats.Counter),
+
+		DNSQueryDuration: registry.MustNewMetric(DNSQueryDurationName, stats.Trend, stats.Time),
+		DNSQueries:       registry.MustNewMetric(DNSQueriesName, stats.Counter),
+		DNSFailed:        registry.MustNewMetric(DNSFailedName, stats.Rate),
+
+		MQTTConnecting:       registry.MustNewMetric(MQTTConnectingName, stats.Trend, stats.Time),
+		MQTTPublishDuration:  registry.MustNewMetric(MQTTPublishDurationName, stats.Trend, stats.Time),
+		MQTTMessagesSent:     registry.MustNewMetric(MQTTMessagesSentName, stats.Counter),
+		MQTTMessagesReceived: registry.MustNewMetric(MQTTMessagesReceivedName, stats.Counter),
+		MQTTErrors:           registry.MustNewMetric(MQTTErrorsName, stats.Counter),
+
+		SQLQueryDuration: registry.MustNewMetric(SQLQueryDurationName, stats.Trend, stats.Time),
+
+		RedisCmdDuration: registry.MustNewMetric(RedisCmdDurationName, stats.Trend, stats.Time),
+
 		DataSent:     registry.MustNewMetric(DataSentName, stats.Counter, stats.Data),
 		DataReceived: registry.MustNewMetric(DataReceivedName, stats.Counter, stats.Data),
 	}
@@ -35,7 +35,7 @@ import (
 )
 
 // Dialer wraps net.Dialer and provides k6 specific functionality -
-// tracing, blacklists and DNS cache and aliases.
+// tracing, blacklists, DNS cache and aliases and network emulation.
 type Dialer struct {
 	net.Dialer
 
@@ -43,6 +43,7 @@ type Dialer struct {
 	Blacklist        []*lib.IPNet
 	BlockedHostnames *types.HostnameTrie
 	Hosts            map[string]*lib.HostAddress
+	NetworkEmulator  *NetworkEmulator
 
 	BytesRead    int64
 	BytesWritten int64
@@ -78,15 +79,26 @@ func (b BlockedHostError) Error() string {
 
 // DialContext wraps the net.Dialer.DialContext and handles the k6 specifics
 func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
-	dialAddr, err := d.getDialAddr(addr)
+	dialAddr, err := d.getDialAddr(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := d.Dialer.DialContext(ctx, proto, dialAddr)
+	emulator := d.NetworkEmulator
+	if e, ok := getNetworkEmulator(ctx); ok {
+		emulator = e
+	}
+	dialer := d.Dialer
+	if emulator != nil {
+		dialer.Control = emulator.control(ctx, dialer.Control)
+	}
+	conn, err := dialer.DialContext(ctx, proto, dialAddr)
 	if err != nil {
 		return nil, err
 	}
 	conn = &Conn{conn, &d.BytesRead, &d.BytesWritten}
+	if emulator != nil {
+		conn = emulator.wrap(conn, proto)
+	}
 	return conn, err
 }
 
@@ -142,8 +154,8 @@ func (d *Dialer) GetTrail(
 	}
 }
 
-func (d *Dialer) getDialAddr(addr string) (string, error) {
-	remote, err := d.findRemote(addr)
+func (d *Dialer) getDialAddr(ctx context.Context, addr string) (string, error) {
+	remote, err := d.findRemote(ctx, addr)
 	if err != nil {
 		return "", err
 	}
@@ -157,7 +169,7 @@ func (d *Dialer) getDialAddr(addr string) (string, error) {
 	return remote.String(), nil
 }
 
-func (d *Dialer) findRemote(addr string) (*lib.HostAddress, error) {
+func (d *Dialer) findRemote(ctx context.Context, addr string) (*lib.HostAddress, error) {
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -179,7 +191,7 @@ func (d *Dialer) findRemote(addr string) (*lib.HostAddress, error) {
 		return lib.NewHostAddress(ip, port)
 	}
 
-	ip, err = d.Resolver.LookupIP(host)
+	ip, err = d.lookupIP(ctx, host)
 	if err != nil {
 		return nil, err
 	}
@@ -191,6 +203,29 @@ func (d *Dialer) findRemote(addr string) (*lib.HostAddress, error) {
 	return lib.NewHostAddress(ip, port)
 }
 
+func (d *Dialer) lookupIP(ctx context.Context, host string) (net.IP, error) {
+	trace := getLookupTrace(ctx)
+	if trace != nil && trace.LookupStart != nil {
+		trace.LookupStart(host)
+	}
+
+	var (
+		ip       net.IP
+		resolver string
+		err      error
+	)
+	if r, ok := d.Resolver.(NamedResolver); ok {
+		ip, resolver, err = r.LookupIPWithResolver(ctx, host)
+	} else {
+		ip, err = d.Resolver.LookupIP(host)
+	}
+
+	if trace != nil && trace.LookupDone != nil {
+		trace.LookupDone(host, resolver, err)
+	}
+	return ip, err
+}
+
 func (d *Dialer) getConfiguredHost(addr, host, port string) (*lib.HostAddress, error) {
 	if remote, ok := d.Hosts[addr]; ok {
 		return remote, nil
@@ -215,6 +250,28 @@ func (d *Dialer) getConfiguredHost(addr, host, port string) (*lib.HostAddress, e
 	return nil, nil
 }
 
+// LookupTrace is a set of hooks that are called when the Dialer resolves a
+// host name, similar to the DNS hooks of httptrace.ClientTrace.
+type LookupTrace struct {
+	LookupStart func(host string)
+	// LookupDone is called with the name of the DNS resolver that answered,
+	// if the Resolver is a NamedResolver.
+	LookupDone func(host, resolver string, err error)
+}
+
+type lookupTraceKey struct{}
+
+// WithLookupTrace returns a new context that makes the Dialer call the hooks
+// of the given LookupTrace.
+func WithLookupTrace(ctx context.Context, trace *LookupTrace) context.Context {
+	return context.WithValue(ctx, lookupTraceKey{}, trace)
+}
+
+func getLookupTrace(ctx context.Context) *LookupTrace {
+	trace, _ := ctx.Value(lookupTraceKey{}).(*LookupTrace)
+	return trace
+}
+
 // NetTrail contains information about the exchanged data size and length of a
 // series of connections from a particular netext.Dialer
 type NetTrail struct {
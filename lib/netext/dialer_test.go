@@ -21,6 +21,7 @@
 package netext
 
 import (
+	"context"
 	"net"
 	"testing"
 
@@ -78,7 +79,7 @@ func TestDialerAddr(t *testing.T) {
 		tc := tc
 
 		t.Run(tc.address, func(t *testing.T) {
-			addr, err := dialer.getDialAddr(tc.address)
+			addr, err := dialer.getDialAddr(context.Background(), tc.address)
 
 			if tc.expErr != "" {
 				require.EqualError(t, err, tc.expErr)
@@ -113,7 +114,7 @@ func TestDialerAddrBlockHostnamesStar(t *testing.T) {
 		tc := tc
 
 		t.Run(tc.address, func(t *testing.T) {
-			addr, err := dialer.getDialAddr(tc.address)
+			addr, err := dialer.getDialAddr(context.Background(), tc.address)
 
 			if tc.expErr != "" {
 				require.EqualError(t, err, tc.expErr)
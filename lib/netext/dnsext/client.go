@@ -0,0 +1,414 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package dnsext contains a DNS client that can query specific DNS servers over
+// UDP, TCP, TLS (DoT) and HTTPS (DoH), independently of the OS resolver.
+package dnsext
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"go.k6.io/k6/lib"
+)
+
+// The supported protocols for querying DNS servers.
+const (
+	ProtocolUDP   = "udp"
+	ProtocolTCP   = "tcp"
+	ProtocolTLS   = "tls"
+	ProtocolHTTPS = "https"
+)
+
+// DefaultTimeout is how long a single DNS server has to respond to a query.
+const DefaultTimeout = 5 * time.Second
+
+// maxMessageSize is the maximum size of a DNS message over TCP and the UDP
+// payload size advertised with EDNS(0).
+const (
+	maxMessageSize = 65535
+	ednsUDPSize    = 4096
+)
+
+// Server is a DNS server and the protocol that's used to query it.
+type Server struct {
+	Protocol string
+	// Address is host:port, or the full URL for DNS-over-HTTPS.
+	Address string
+}
+
+// ParseServer parses a DNS server address. It can be `host[:port]` or
+// `udp://host[:port]` for plain DNS over UDP, `tcp://host[:port]` for DNS over
+// TCP, `tls://host[:port]` for DNS-over-TLS and an `https://` URL for
+// DNS-over-HTTPS.
+func ParseServer(s string) (Server, error) {
+	if strings.HasPrefix(s, ProtocolHTTPS+"://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return Server{}, fmt.Errorf("invalid DNS server '%s': %w", s, err)
+		}
+		if u.Host == "" {
+			return Server{}, fmt.Errorf("invalid DNS server '%s': missing host", s)
+		}
+		return Server{Protocol: ProtocolHTTPS, Address: s}, nil
+	}
+
+	protocol, address := ProtocolUDP, s
+	if i := strings.Index(s, "://"); i >= 0 {
+		protocol, address = s[:i], s[i+3:]
+	}
+	port := "53"
+	switch protocol {
+	case ProtocolUDP, ProtocolTCP:
+	case ProtocolTLS:
+		port = "853"
+	default:
+		return Server{}, fmt.Errorf("invalid DNS server '%s': unsupported protocol '%s'", s, protocol)
+	}
+	if address == "" {
+		return Server{}, fmt.Errorf("invalid DNS server '%s': missing host", s)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), port)
+	}
+	return Server{Protocol: protocol, Address: address}, nil
+}
+
+// String returns the server in the same format that ParseServer accepts.
+func (s Server) String() string {
+	if s.Protocol == ProtocolHTTPS {
+		return s.Address
+	}
+	return s.Protocol + "://" + s.Address
+}
+
+// Client sends DNS queries to a list of servers, falling back to the next one
+// if a server can't be reached or fails to answer.
+type Client struct {
+	Servers   []Server
+	Dialer    lib.DialContexter
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+
+	httpClient *http.Client
+	randMu     sync.Mutex
+	rand       *rand.Rand
+}
+
+// NewClient returns a new Client for the given servers. The TLS configuration
+// is used for DNS-over-TLS and DNS-over-HTTPS and can be nil.
+func NewClient(servers []Server, tlsConfig *tls.Config) *Client {
+	c := &Client{
+		Servers:   servers,
+		Dialer:    &net.Dialer{Timeout: DefaultTimeout},
+		TLSConfig: tlsConfig,
+		Timeout:   DefaultTimeout,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+	c.httpClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return c.Dialer.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig:   tlsConfig,
+			ForceAttemptHTTP2: true,
+		},
+	}
+	return c
+}
+
+// NewQuestion returns a question for the name, which doesn't need to be fully
+// qualified, and the type.
+func NewQuestion(name string, qtype dnsmessage.Type) (dnsmessage.Question, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Question{}, fmt.Errorf("invalid DNS name '%s': %w", name, err)
+	}
+	return dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}, nil
+}
+
+// Query sends a query for the name and type to the servers, in order, and
+// returns the first response that isn't a server failure, together with the
+// server that sent it.
+func (c *Client) Query(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, Server, error) {
+	question, err := NewQuestion(name, qtype)
+	if err != nil {
+		return nil, Server{}, err
+	}
+
+	if len(c.Servers) == 0 {
+		return nil, Server{}, errors.New("no DNS servers are configured")
+	}
+	for _, server := range c.Servers {
+		var msg *dnsmessage.Message
+		msg, err = c.Exchange(ctx, server, question)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, server, err
+			}
+			continue
+		}
+		if msg.RCode == dnsmessage.RCodeSuccess || msg.RCode == dnsmessage.RCodeNameError {
+			return msg, server, nil
+		}
+		err = fmt.Errorf("DNS server %s responded with %s", server, RCodeName(msg.RCode))
+	}
+	return nil, c.Servers[len(c.Servers)-1], err
+}
+
+// LookupIP returns the IPv4 and IPv6 addresses of the host, as returned by the
+// first server that answered.
+func (c *Client) LookupIP(ctx context.Context, host string) ([]net.IP, Server, error) {
+	type result struct {
+		msg    *dnsmessage.Message
+		server Server
+		err    error
+	}
+	results := make(chan result, 2)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		go func(qtype dnsmessage.Type) {
+			msg, server, err := c.Query(ctx, host, qtype)
+			results <- result{msg, server, err}
+		}(qtype)
+	}
+
+	var (
+		ips      []net.IP
+		server   Server
+		err      error
+		answered bool
+	)
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			err = r.err
+			continue
+		}
+		if !answered {
+			server, answered = r.server, true
+		}
+		for _, answer := range r.msg.Answers {
+			switch rr := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(rr.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(rr.AAAA[:]))
+			}
+		}
+	}
+	if !answered {
+		return nil, server, err
+	}
+	if len(ips) == 0 {
+		return nil, server, &net.DNSError{Err: "no such host", Name: host, Server: server.String(), IsNotFound: true}
+	}
+	return ips, server, nil
+}
+
+// LookupHost is a version of LookupIP that returns the name of the server that
+// answered, which can be used as a netext.NamedMultiResolver.
+func (c *Client) LookupHost(ctx context.Context, host string) ([]net.IP, string, error) {
+	ips, server, err := c.LookupIP(ctx, host)
+	return ips, server.String(), err
+}
+
+// Exchange sends a query with the given question to a single server and
+// returns its response. Truncated UDP responses are retried over TCP.
+func (c *Client) Exchange(
+	ctx context.Context, server Server, question dnsmessage.Question,
+) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{question},
+	}
+	// DNS-over-HTTPS should use an ID of 0 to be more cache friendly
+	if server.Protocol != ProtocolHTTPS {
+		c.randMu.Lock()
+		query.ID = uint16(c.rand.Uint32())
+		c.randMu.Unlock()
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	query.Additionals = []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	switch server.Protocol {
+	case ProtocolUDP:
+		data, err = c.exchangeUDP(ctx, server.Address, packed, query.ID)
+	case ProtocolTCP, ProtocolTLS:
+		data, err = c.exchangeStream(ctx, server, packed)
+	case ProtocolHTTPS:
+		data, err = c.exchangeHTTPS(ctx, server.Address, packed)
+	default:
+		err = fmt.Errorf("unsupported DNS protocol '%s'", server.Protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DNS query to %s failed: %w", server, err)
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(data); err != nil {
+		return nil, fmt.Errorf("invalid DNS response from %s: %w", server, err)
+	}
+	if msg.ID != query.ID {
+		return nil, fmt.Errorf("invalid DNS response from %s: mismatched ID", server)
+	}
+	if msg.Truncated && server.Protocol == ProtocolUDP {
+		return c.Exchange(ctx, Server{Protocol: ProtocolTCP, Address: server.Address}, question)
+	}
+	return &msg, nil
+}
+
+func (c *Client) exchangeUDP(ctx context.Context, addr string, query []byte, id uint16) ([]byte, error) {
+	conn, err := c.Dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, ednsUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// ignore any stray responses to other queries
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+func (c *Client) exchangeStream(ctx context.Context, server Server, query []byte) ([]byte, error) {
+	conn, err := c.Dialer.DialContext(ctx, "tcp", server.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if server.Protocol == ProtocolTLS {
+		tlsConn := tls.Client(conn, c.tlsConfigFor(server.Address))
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err = conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var length uint16
+	if err = binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *Client) exchangeHTTPS(ctx context.Context, u string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", res.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(res.Body, maxMessageSize))
+}
+
+func (c *Client) tlsConfigFor(addr string) *tls.Config {
+	var cfg *tls.Config
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	} else {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	return cfg
+}
+
+//nolint:gochecknoglobals
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// RCodeName returns the mnemonic of the response code as used by most DNS
+// tools, e.g. NOERROR or NXDOMAIN.
+func RCodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return strconv.Itoa(int(rcode))
+}
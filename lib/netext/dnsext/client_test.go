@@ -0,0 +1,149 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package dnsext
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"go.k6.io/k6/lib/testutils/dnstest"
+)
+
+func TestParseServer(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		input, expected, expErr string
+	}{
+		{"1.1.1.1", "udp://1.1.1.1:53", ""},
+		{"1.1.1.1:5353", "udp://1.1.1.1:5353", ""},
+		{"udp://[2606:4700:4700::1111]", "udp://[2606:4700:4700::1111]:53", ""},
+		{"tcp://dns.example.com", "tcp://dns.example.com:53", ""},
+		{"tls://1.1.1.1", "tls://1.1.1.1:853", ""},
+		{"https://cloudflare-dns.com/dns-query", "https://cloudflare-dns.com/dns-query", ""},
+		{"quic://1.1.1.1", "", "invalid DNS server 'quic://1.1.1.1': unsupported protocol 'quic'"},
+		{"https:///dns-query", "", "invalid DNS server 'https:///dns-query': missing host"},
+		{"tls://", "", "invalid DNS server 'tls://': missing host"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+			server, err := ParseServer(tc.input)
+			if tc.expErr != "" {
+				require.EqualError(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, server.String())
+		})
+	}
+}
+
+func TestClientLookupIP(t *testing.T) {
+	t.Parallel()
+	dns := dnstest.NewServer(t)
+	dns.AddIP("k6.test", net.ParseIP("10.0.0.1"))
+	dns.AddIP("k6.test", net.ParseIP("fd00::1"))
+
+	doh := httptest.NewTLSServer(dns)
+	t.Cleanup(doh.Close)
+	tlsConfig := doh.Client().Transport.(*http.Transport).TLSClientConfig
+	dotAddr := dns.ServeTLS(t, doh.TLS)
+
+	servers := []string{"udp://" + dns.Addr, "tcp://" + dns.Addr, "tls://" + dotAddr, doh.URL + "/dns-query"}
+	for _, s := range servers {
+		s := s
+		t.Run(s, func(t *testing.T) {
+			t.Parallel()
+			server, err := ParseServer(s)
+			require.NoError(t, err)
+			client := NewClient([]Server{server}, tlsConfig)
+
+			ips, answered, err := client.LookupIP(context.Background(), "k6.test")
+			require.NoError(t, err)
+			assert.Equal(t, server, answered)
+			assert.ElementsMatch(t, []string{"10.0.0.1", "fd00::1"}, ipStrings(ips))
+
+			_, _, err = client.LookupIP(context.Background(), "missing.k6.test")
+			var dnsErr *net.DNSError
+			require.ErrorAs(t, err, &dnsErr)
+			assert.True(t, dnsErr.IsNotFound)
+		})
+	}
+}
+
+func TestClientFallback(t *testing.T) {
+	t.Parallel()
+	dns := dnstest.NewServer(t)
+	dns.AddIP("k6.test", net.ParseIP("10.0.0.1"))
+	dns.SetTruncateUDP(true)
+
+	// nothing listens on the first server
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := l.LocalAddr().String()
+	require.NoError(t, l.Close())
+
+	client := NewClient([]Server{
+		{Protocol: ProtocolUDP, Address: unreachable},
+		{Protocol: ProtocolUDP, Address: dns.Addr},
+	}, nil)
+	ips, server, err := client.LookupIP(context.Background(), "k6.test")
+	require.NoError(t, err)
+	assert.Equal(t, "udp://"+dns.Addr, server.String())
+	assert.Equal(t, []string{"10.0.0.1"}, ipStrings(ips))
+	// both truncated UDP queries were retried over TCP
+	assert.Equal(t, int64(4), atomic.LoadInt64(&dns.Queries))
+
+	msg, _, err := client.Query(context.Background(), "k6.test", dnsmessage.TypeTXT)
+	require.NoError(t, err)
+	assert.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	assert.Empty(t, msg.Answers)
+}
+
+func TestClientLookupHostCanceled(t *testing.T) {
+	t.Parallel()
+	dns := dnstest.NewServer(t)
+	dns.AddIP("k6.test", net.ParseIP("10.0.0.1"))
+	client := NewClient([]Server{{Protocol: ProtocolTCP, Address: dns.Addr}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := client.LookupHost(ctx, "k6.test")
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, atomic.LoadInt64(&dns.Queries))
+}
+
+func ipStrings(ips []net.IP) []string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return s
+}
@@ -0,0 +1,240 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsSigV4Algorithm  = "AWS4-HMAC-SHA256"
+	awsSigV4TimeFormat = "20060102T150405Z"
+	awsSigV4DateFormat = "20060102"
+)
+
+// headers that are changed by proxies or by the Go http client itself
+//nolint:gochecknoglobals
+var awsSigV4IgnoredHeaders = map[string]struct{}{
+	"authorization":   {},
+	"user-agent":      {},
+	"x-amzn-trace-id": {},
+	"content-length":  {},
+	"connection":      {},
+	"expect":          {},
+}
+
+// awsSigV4Signer signs requests with the AWS Signature Version 4 process,
+// see https://docs.aws.amazon.com/general/latest/gr/signature-version-4.html
+type awsSigV4Signer struct {
+	region          string
+	service         string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	now func() time.Time
+}
+
+var _ RequestSigner = &awsSigV4Signer{}
+
+func newAWSSigV4Signer(params map[string]interface{}) (RequestSigner, error) {
+	if params == nil {
+		// the string form of the auth param, which doesn't have any of the params
+		return nil, errors.New(`aws-sigv4: the auth param needs to be an object with the params, like ` +
+			`{ type: "aws-sigv4", region: "...", service: "...", accessKeyId: "...", secretAccessKey: "..." }`)
+	}
+	s := &awsSigV4Signer{now: time.Now}
+	for k, v := range params {
+		str, ok := v.(string)
+		if !ok && k != "type" {
+			return nil, fmt.Errorf("aws-sigv4: invalid value for %q, expected a string but got %T", k, v)
+		}
+		switch k {
+		case "region":
+			s.region = str
+		case "service":
+			s.service = str
+		case "accessKeyId":
+			s.accessKeyID = str
+		case "secretAccessKey":
+			s.secretAccessKey = str
+		case "sessionToken":
+			s.sessionToken = str
+		}
+	}
+
+	switch {
+	case s.region == "":
+		return nil, errors.New("aws-sigv4: region is required")
+	case s.service == "":
+		return nil, errors.New("aws-sigv4: service is required")
+	case s.accessKeyID == "" || s.secretAccessKey == "":
+		return nil, errors.New("aws-sigv4: accessKeyId and secretAccessKey are required")
+	}
+	return s, nil
+}
+
+// SignRequest adds the X-Amz-Date, X-Amz-Security-Token and Authorization
+// headers to the request.
+func (s *awsSigV4Signer) SignRequest(req *http.Request, body []byte) error {
+	now := s.now().UTC()
+	amzDate := now.Format(awsSigV4TimeFormat)
+	scope := strings.Join([]string{now.Format(awsSigV4DateFormat), s.region, s.service, "aws4_request"}, "/")
+
+	payloadHash := sha256.Sum256(body)
+	payloadHashHex := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	if s.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHashHex)
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		awsSigV4CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHashHex,
+	}, "\n")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		awsSigV4Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := awsSigV4HMAC([]byte("AWS4"+s.secretAccessKey), now.Format(awsSigV4DateFormat))
+	key = awsSigV4HMAC(key, s.region)
+	key = awsSigV4HMAC(key, s.service)
+	key = awsSigV4HMAC(key, "aws4_request")
+	signature := hex.EncodeToString(awsSigV4HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm, s.accessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func (s *awsSigV4Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if u.Opaque != "" {
+		path = u.Opaque
+	}
+	if path == "" {
+		return "/"
+	}
+	// S3 is the only service that doesn't expect the path to be encoded twice
+	if s.service == "s3" {
+		return path
+	}
+	return awsSigV4Escape(path, false)
+}
+
+func (s *awsSigV4Signer) canonicalHeaders(req *http.Request) (signedHeaders, canonicalHeaders string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string][]string{"host": {host}}
+	for k, vs := range req.Header {
+		name := strings.ToLower(k)
+		if _, ignored := awsSigV4IgnoredHeaders[name]; ignored || name == "host" {
+			continue
+		}
+		values[name] = append(values[name], vs...)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(trimmed, ","))
+		sb.WriteByte('\n')
+	}
+	return strings.Join(names, ";"), sb.String()
+}
+
+func awsSigV4CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(query))
+	for _, k := range keys {
+		vs := append([]string(nil), query[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsSigV4Escape(k, true)+"="+awsSigV4Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsSigV4Escape URI-encodes every byte except the unreserved characters from
+// RFC 3986, and slashes unless encodeSlash is set.
+func awsSigV4Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func awsSigV4HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,126 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The test cases are from the AWS Signature Version 4 test suite
+func TestAWSSigV4Signer(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name, method, url, body, signature string
+	}{
+		{
+			name:      "get-vanilla",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:      "get-vanilla-query-order-key-case",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:      "post-vanilla",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			signer, err := NewRequestSigner("aws-sigv4", map[string]interface{}{
+				"type":            "aws-sigv4",
+				"region":          "us-east-1",
+				"service":         "service",
+				"accessKeyId":     "AKIDEXAMPLE",
+				"secretAccessKey": "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			})
+			require.NoError(t, err)
+			signer.(*awsSigV4Signer).now = func() time.Time {
+				return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+			}
+
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			require.NoError(t, signer.SignRequest(req, []byte(tc.body)))
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders=host;x-amz-date, Signature="+tc.signature, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestAWSSigV4SignerSessionToken(t *testing.T) {
+	t.Parallel()
+	signer, err := NewRequestSigner("aws-sigv4", map[string]interface{}{
+		"region":          "eu-west-1",
+		"service":         "s3",
+		"accessKeyId":     "AKID",
+		"secretAccessKey": "secret",
+		"sessionToken":    "token",
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/some%20key", nil)
+	require.NoError(t, err)
+	require.NoError(t, signer.SignRequest(req, []byte("content")))
+
+	assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+	assert.Equal(t, "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+		req.Header.Get("X-Amz-Content-Sha256"))
+	assert.Contains(t, req.Header.Get("Authorization"),
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token")
+}
+
+func TestAWSSigV4SignerInvalidParams(t *testing.T) {
+	t.Parallel()
+	_, err := NewRequestSigner("aws-sigv4", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "aws-sigv4: the auth param needs to be an object with the params")
+
+	_, err = NewRequestSigner("aws-sigv4", map[string]interface{}{"service": "s3"})
+	assert.EqualError(t, err, "aws-sigv4: region is required")
+
+	_, err = NewRequestSigner("aws-sigv4", map[string]interface{}{"region": "us-east-1", "service": "s3"})
+	assert.EqualError(t, err, "aws-sigv4: accessKeyId and secretAccessKey are required")
+
+	_, err = NewRequestSigner("aws-sigv4", map[string]interface{}{"region": 42})
+	assert.EqualError(t, err, `aws-sigv4: invalid value for "region", expected a string but got int`)
+
+	_, err = NewRequestSigner("unknown", nil)
+	assert.EqualError(t, err, `unknown auth type "unknown", supported request signers are [aws-sigv4]`)
+}
@@ -0,0 +1,274 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The tags set on the samples of GraphQL requests, unless the user already
+// set them.
+const (
+	GraphQLOperationTag     = "graphql_operation"
+	GraphQLOperationTypeTag = "graphql_operation_type"
+)
+
+// GraphQLRequest is the payload of GraphQL requests, as it's sent both over
+// HTTP and in graphql-ws subscriptions.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Operation returns the operation that the request executes.
+func (r *GraphQLRequest) Operation() (GraphQLOperation, error) {
+	return ParseGraphQLOperation(r.Query, r.OperationName)
+}
+
+// GraphQLOperation is an operation from a GraphQL document.
+type GraphQLOperation struct {
+	// Name is empty for anonymous operations.
+	Name string
+	// Type is one of query, mutation or subscription.
+	Type string
+}
+
+// Tags sets the GraphQL tags of the operation in tags, if they aren't set.
+func (op GraphQLOperation) Tags(tags map[string]string) {
+	if _, ok := tags[GraphQLOperationTypeTag]; !ok {
+		tags[GraphQLOperationTypeTag] = op.Type
+	}
+	if _, ok := tags[GraphQLOperationTag]; !ok && op.Name != "" {
+		tags[GraphQLOperationTag] = op.Name
+	}
+}
+
+// ParseGraphQLOperation finds the operation that will be executed for the
+// given GraphQL document and operationName, following the same rules as
+// servers do: the operationName is only optional for documents with a single
+// operation. The document isn't validated, it's only tokenized far enough to
+// find the operation definitions.
+func ParseGraphQLOperation(document, operationName string) (GraphQLOperation, error) {
+	ops, err := graphQLOperations(document)
+	if err != nil {
+		return GraphQLOperation{}, err
+	}
+	if operationName == "" {
+		switch len(ops) {
+		case 0:
+			return GraphQLOperation{}, errors.New("the GraphQL document doesn't contain any operations")
+		case 1:
+			return ops[0], nil
+		default:
+			return GraphQLOperation{}, errors.New(
+				"the operationName is required for GraphQL documents with multiple operations")
+		}
+	}
+	for _, op := range ops {
+		if op.Name == operationName {
+			return op, nil
+		}
+	}
+	return GraphQLOperation{}, fmt.Errorf("the GraphQL operation '%s' isn't in the document", operationName)
+}
+
+// graphQLOperations returns all operation definitions in the document,
+// skipping fragment definitions.
+//nolint:cyclop
+func graphQLOperations(document string) ([]GraphQLOperation, error) {
+	lex := &graphQLLexer{src: document}
+	var ops []GraphQLOperation
+	for {
+		tok, err := lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case "":
+			return ops, nil
+		case "{":
+			// the query shorthand
+			ops = append(ops, GraphQLOperation{Type: "query"})
+		case "query", "mutation", "subscription":
+			op := GraphQLOperation{Type: tok}
+			if tok, err = lex.next(); err != nil {
+				return nil, err
+			}
+			if isGraphQLName(tok) {
+				op.Name = tok
+			}
+			ops = append(ops, op)
+			// skip the variable definitions and directives
+			for parens := 0; tok != "{" || parens > 0; {
+				switch tok {
+				case "(":
+					parens++
+				case ")":
+					parens--
+				case "":
+					return nil, errors.New("unexpected end of the GraphQL document")
+				}
+				if tok, err = lex.next(); err != nil {
+					return nil, err
+				}
+			}
+		case "fragment":
+			// skip to the selection set, fragments can't have variables
+			for tok != "{" {
+				if tok == "" {
+					return nil, errors.New("unexpected end of the GraphQL document")
+				}
+				if tok, err = lex.next(); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unexpected '%s' in the GraphQL document, expected an operation or a fragment", tok)
+		}
+
+		// skip the selection set
+		for depth := 1; depth > 0; {
+			if tok, err = lex.next(); err != nil {
+				return nil, err
+			}
+			switch tok {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			case "":
+				return nil, errors.New("unexpected end of the GraphQL document")
+			}
+		}
+	}
+}
+
+func isGraphQLName(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	c := tok[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// graphQLLexer is a minimal tokenizer of GraphQL documents, which is only
+// concerned with names and punctuators. Strings are returned as a single
+// `"` token, so that braces in them are ignored.
+type graphQLLexer struct {
+	src string
+	pos int
+}
+
+// next returns the next token, or an empty string at the end of the document.
+//nolint:cyclop
+func (l *graphQLLexer) next() (string, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '"':
+			return `"`, l.skipString()
+		case isGraphQLName(string(c)):
+			start := l.pos
+			for l.pos++; l.pos < len(l.src) && isGraphQLNameChar(l.src[l.pos]); l.pos++ {
+			}
+			return l.src[start:l.pos], nil
+		case c == '-' || (c >= '0' && c <= '9'):
+			start := l.pos
+			for l.pos++; l.pos < len(l.src) && (isGraphQLNameChar(l.src[l.pos]) ||
+				strings.IndexByte(".+-", l.src[l.pos]) >= 0); l.pos++ {
+			}
+			return l.src[start:l.pos], nil
+		case strings.HasPrefix(l.src[l.pos:], "..."):
+			l.pos += 3
+			return "...", nil
+		case strings.ContainsRune("!$&()/:=@[]{}|", rune(c)):
+			l.pos++
+			return string(c), nil
+		case strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		default:
+			return "", fmt.Errorf("unexpected character '%c' in the GraphQL document", c)
+		}
+	}
+	return "", nil
+}
+
+func (l *graphQLLexer) skipString() error {
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		for l.pos += 3; l.pos < len(l.src); l.pos++ {
+			if strings.HasPrefix(l.src[l.pos:], `\"""`) {
+				l.pos += 3
+			} else if strings.HasPrefix(l.src[l.pos:], `"""`) {
+				l.pos += 3
+				return nil
+			}
+		}
+		return errors.New("unterminated block string in the GraphQL document")
+	}
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '"':
+			l.pos++
+			return nil
+		case '\n', '\r':
+			return errors.New("unterminated string in the GraphQL document")
+		}
+	}
+	return errors.New("unterminated string in the GraphQL document")
+}
+
+// hasGraphQLErrors returns whether the body is a GraphQL response with a
+// non-empty errors list. Bodies that aren't JSON objects don't have errors.
+func hasGraphQLErrors(body interface{}) bool {
+	var data []byte
+	switch b := body.(type) {
+	case string:
+		data = []byte(b)
+	case []byte:
+		data = b
+	default:
+		return false
+	}
+	var res struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return false
+	}
+	return len(res.Errors) > 0
+}
@@ -0,0 +1,81 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGraphQLOperation(t *testing.T) {
+	t.Parallel()
+
+	const document = `
+		# the "query { ignored }" in comments and strings doesn't matter
+		query GetUser($id: ID!, $filter: Filter = {active: true}) @cached(ttl: 60) {
+			user(id: $id, note: "}") { ...UserFields }
+		}
+		mutation UpdateUser($id: ID!) {
+			updateUser(id: $id, bio: """a {block} \""" string""") { id }
+		}
+		fragment UserFields on User { id name friends(first: -1.5e+3) { id } }
+		subscription { userUpdated { id } }
+	`
+	testCases := []struct {
+		document, operationName string
+		expected                GraphQLOperation
+		expErr                  string
+	}{
+		{"{ users { id } }", "", GraphQLOperation{Type: "query"}, ""},
+		{"\uFEFFquery Users { users { id } }", "", GraphQLOperation{Name: "Users", Type: "query"}, ""},
+		{"query($id: ID) { user(id: $id) { id } }", "", GraphQLOperation{Type: "query"}, ""},
+		{document, "GetUser", GraphQLOperation{Name: "GetUser", Type: "query"}, ""},
+		{document, "UpdateUser", GraphQLOperation{Name: "UpdateUser", Type: "mutation"}, ""},
+		{document, "", GraphQLOperation{}, "the operationName is required"},
+		{document, "Missing", GraphQLOperation{}, "the GraphQL operation 'Missing' isn't in the document"},
+		{"fragment F on User { id }", "", GraphQLOperation{}, "doesn't contain any operations"},
+		{"query Users { users { id }", "", GraphQLOperation{}, "unexpected end of the GraphQL document"},
+		{`query { user(name: "unterminated) { id } }`, "", GraphQLOperation{}, "unterminated string"},
+		{"type User { id: ID }", "", GraphQLOperation{}, "unexpected 'type' in the GraphQL document"},
+	}
+	for _, tc := range testCases {
+		op, err := ParseGraphQLOperation(tc.document, tc.operationName)
+		if tc.expErr != "" {
+			require.Error(t, err, tc.document)
+			assert.Contains(t, err.Error(), tc.expErr, tc.document)
+			continue
+		}
+		require.NoError(t, err, tc.document)
+		assert.Equal(t, tc.expected, op, tc.document)
+	}
+}
+
+func TestHasGraphQLErrors(t *testing.T) {
+	t.Parallel()
+	assert.True(t, hasGraphQLErrors(`{"data": null, "errors": [{"message": "oops"}]}`))
+	assert.True(t, hasGraphQLErrors([]byte(`{"errors": [{"message": "oops"}]}`)))
+	assert.False(t, hasGraphQLErrors(`{"data": {"user": null}}`))
+	assert.False(t, hasGraphQLErrors(`{"data": {"user": null}, "errors": []}`))
+	assert.False(t, hasGraphQLErrors(`not json`))
+	assert.False(t, hasGraphQLErrors(nil))
+}
@@ -64,6 +64,7 @@ type ParsedHTTPRequest struct {
 	Req              *http.Request
 	Timeout          time.Duration
 	Auth             string
+	Signer           RequestSigner
 	Throw            bool
 	ResponseType     ResponseType
 	ResponseCallback func(int) bool
@@ -72,6 +73,34 @@ type ParsedHTTPRequest struct {
 	ActiveJar        *cookiejar.Jar
 	Cookies          map[string]*HTTPRequestCookie
 	Tags             map[string]string
+	// GraphQL requests are failed when the errors in their response body
+	// aren't empty, which can't be detected if the body is discarded.
+	GraphQL bool
+	// Abort cancels the request when it's done, e.g. the AbortSignal that
+	// is passed as the signal param.
+	Abort RequestAborter
+	// Transport is used instead of the Transport of the VU state if it's
+	// set, e.g. to emulate the network conditions of the network param.
+	Transport http.RoundTripper
+}
+
+// RequestAborter can abort a request like a context, Err returns the error of
+// the aborted requests.
+type RequestAborter interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+// abortError returns the error of an aborted request, or nil if the request
+// isn't aborted.
+func abortError(abort RequestAborter) error {
+	if abort == nil {
+		return nil
+	}
+	if err := abort.Err(); err != nil {
+		return NewK6Error(requestAbortedErrorCode, err.Error(), err)
+	}
+	return nil
 }
 
 // Matches non-compliant io.Closer implementations (e.g. zstd.Decoder)
@@ -119,6 +148,7 @@ func updateK6Response(k6Response *Response, finishedReq *finishedRequest) {
 	k6Response.Timings = ResponseTimings{
 		Duration:       stats.D(trail.Duration),
 		Blocked:        stats.D(trail.Blocked),
+		LookingUp:      stats.D(trail.LookingUp),
 		Connecting:     stats.D(trail.Connecting),
 		TLSHandshaking: stats.D(trail.TLSHandshaking),
 		Sending:        stats.D(trail.Sending),
@@ -187,6 +217,16 @@ func MakeRequest(ctx context.Context, state *lib.State, preq *ParsedHTTPRequest)
 		}
 	}
 
+	if preq.Signer != nil {
+		var body []byte
+		if preq.Body != nil {
+			body = preq.Body.Bytes()
+		}
+		if err := preq.Signer.SignRequest(preq.Req, body); err != nil {
+			return nil, fmt.Errorf("couldn't sign the request: %w", err)
+		}
+	}
+
 	tags := state.CloneTags()
 	// Override any global tags with request-specific ones.
 	for k, v := range preq.Tags {
@@ -208,6 +248,8 @@ func MakeRequest(ctx context.Context, state *lib.State, preq *ParsedHTTPRequest)
 	}
 
 	tracerTransport := newTransport(ctx, state, tags, preq.ResponseCallback)
+	tracerTransport.abort = preq.Abort
+	tracerTransport.roundTripper = preq.Transport
 	var transport http.RoundTripper = tracerTransport
 
 	// Combine tags with common log fields
@@ -251,6 +293,14 @@ func MakeRequest(ctx context.Context, state *lib.State, preq *ParsedHTTPRequest)
 	}
 
 	resp := &Response{URL: preq.URL.URL, Request: respReq}
+	// the requests with an already aborted signal aren't sent at all
+	if err := abortError(preq.Abort); err != nil {
+		if preq.Throw {
+			return nil, err
+		}
+		resp.ErrorCode, resp.Error = int(requestAbortedErrorCode), err.Error()
+		return resp, nil
+	}
 	client := http.Client{
 		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -283,6 +333,15 @@ func MakeRequest(ctx context.Context, state *lib.State, preq *ParsedHTTPRequest)
 
 	reqCtx, cancelFunc := context.WithTimeout(ctx, preq.Timeout)
 	defer cancelFunc()
+	if preq.Abort != nil {
+		go func() {
+			select {
+			case <-preq.Abort.Done():
+				cancelFunc()
+			case <-reqCtx.Done():
+			}
+		}()
+	}
 	mreq := preq.Req.WithContext(reqCtx)
 	res, resErr := client.Do(mreq)
 
@@ -296,11 +355,28 @@ func MakeRequest(ctx context.Context, state *lib.State, preq *ParsedHTTPRequest)
 	}
 
 	if resErr == nil {
-		resp.Body, resErr = readResponseBody(state, preq.ResponseType, res, resErr)
+		responseType := preq.ResponseType
+		if preq.GraphQL && responseType == ResponseTypeNone && tracerTransport.responseCallback != nil {
+			// the body is needed to find the GraphQL errors, it's discarded after that
+			responseType = ResponseTypeBinary
+		}
+		resp.Body, resErr = readResponseBody(state, responseType, res, resErr)
 		if resErr != nil && errors.Is(resErr, context.DeadlineExceeded) {
 			// TODO This can be more specific that the timeout happened in the middle of the reading of the body
 			resErr = NewK6Error(requestTimeoutErrorCode, requestTimeoutErrorCodeMsg, resErr)
 		}
+		if resErr == nil && preq.GraphQL {
+			tracerTransport.graphQLErrors = hasGraphQLErrors(resp.Body)
+		}
+		if responseType != preq.ResponseType {
+			resp.Body = nil
+		}
+	}
+	aborted := false
+	if resErr != nil {
+		if err := abortError(preq.Abort); err != nil {
+			resErr, aborted = err, true
+		}
 	}
 	finishedReq := tracerTransport.processLastSavedRequest(wrapDecompressionError(resErr))
 	if finishedReq != nil {
@@ -349,11 +425,14 @@ func MakeRequest(ctx context.Context, state *lib.State, preq *ParsedHTTPRequest)
 			return nil, resErr
 		}
 
-		// Do *not* log errors about the context being cancelled.
+		// Do *not* log errors about the context being cancelled or the
+		// request being aborted by the script.
 		select {
 		case <-ctx.Done():
 		default:
-			state.Logger.WithField("error", resErr).Warn("Request Failed")
+			if !aborted {
+				state.Logger.WithField("error", resErr).Warn("Request Failed")
+			}
 		}
 	}
 
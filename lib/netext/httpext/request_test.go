@@ -31,6 +31,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -43,6 +44,10 @@ import (
 
 	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext"
+	"go.k6.io/k6/lib/netext/dnsext"
+	"go.k6.io/k6/lib/testutils/dnstest"
+	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/stats"
 )
 
@@ -509,3 +514,116 @@ func TestMakeRequestTimeoutInTheBegining(t *testing.T) {
 		assert.Equal(t, expTags, s.Tags.CloneTags())
 	}
 }
+
+func TestTrailNetworkEmulation(t *testing.T) {
+	t.Parallel()
+	body := bytes.Repeat([]byte("k6"), 2500)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	dialer := netext.NewDialer(net.Dialer{}, netext.NewResolver(net.LookupIP, 0, types.DNSfirst, types.DNSpreferIPv4))
+	dialer.NetworkEmulator = netext.NewNetworkEmulator(types.NetworkConditions{
+		Latency:  types.NewNullDuration(100*time.Millisecond, true),
+		Download: null.IntFrom(80), // 10 kB/s
+	})
+	samples := make(chan stats.SampleContainer, 10)
+	registry := metrics.NewRegistry()
+	state := &lib.State{
+		Options: lib.Options{
+			RunTags:    &stats.SampleTags{},
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		Transport:      &http.Transport{DialContext: dialer.DialContext},
+		Samples:        samples,
+		Logger:         logrus.New(),
+		BPool:          bpool.NewBufferPool(2),
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(registry),
+		Tags:           lib.NewTagMap(nil),
+	}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	preq := &ParsedHTTPRequest{
+		Req:              req,
+		URL:              &URL{u: req.URL, URL: srv.URL},
+		Body:             new(bytes.Buffer),
+		Timeout:          10 * time.Second,
+		ResponseType:     ResponseTypeText,
+		ResponseCallback: func(int) bool { return true },
+	}
+	res, err := MakeRequest(context.Background(), state, preq)
+	require.NoError(t, err)
+	assert.Equal(t, string(body), res.Body)
+
+	require.Len(t, samples, 1)
+	trail, ok := (<-samples).(*Trail)
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, int64(trail.Connecting), int64(100*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(trail.Waiting), int64(100*time.Millisecond))
+	// the first 512 bytes are a burst, the rest is throttled
+	assert.GreaterOrEqual(t, int64(trail.Receiving), int64(400*time.Millisecond))
+}
+
+func TestTrailLookingUp(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(httpbin.New().Handler())
+	t.Cleanup(srv.Close)
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	dns := dnstest.NewServer(t)
+	dns.AddIP("httpbin.test", net.ParseIP("127.0.0.1"))
+	dnsServer := dnsext.Server{Protocol: dnsext.ProtocolTCP, Address: dns.Addr}
+	client := dnsext.NewClient([]dnsext.Server{dnsServer}, nil)
+
+	dialer := netext.NewDialer(net.Dialer{}, netext.NewNamedResolver(
+		client.LookupHost, time.Minute, types.DNSfirst, types.DNSpreferIPv4))
+	samples := make(chan stats.SampleContainer, 10)
+	registry := metrics.NewRegistry()
+	state := &lib.State{
+		Options: lib.Options{
+			RunTags:    &stats.SampleTags{},
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		Transport:      &http.Transport{DialContext: dialer.DialContext, DisableKeepAlives: true},
+		Samples:        samples,
+		Logger:         logrus.New(),
+		BPool:          bpool.NewBufferPool(2),
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(registry),
+		Tags:           lib.NewTagMap(nil),
+	}
+
+	for _, expResolver := range []string{dnsServer.String(), netext.CacheResolverName} {
+		u := "http://httpbin.test:" + port + "/get"
+		req, _ := http.NewRequest("GET", u, nil)
+		preq := &ParsedHTTPRequest{
+			Req:     req,
+			URL:     &URL{u: req.URL, URL: u},
+			Body:    new(bytes.Buffer),
+			Timeout: 10 * time.Second,
+		}
+		res, err := MakeRequest(context.Background(), state, preq)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.Status)
+
+		require.Len(t, samples, 1)
+		trail, ok := (<-samples).(*Trail)
+		require.True(t, ok)
+		assert.Equal(t, expResolver, trail.Resolver)
+		assert.Equal(t, stats.D(trail.LookingUp), res.Timings.LookingUp)
+
+		var found bool
+		for _, s := range trail.GetSamples() {
+			if s.Metric.Name != metrics.HTTPReqLookingUpName {
+				continue
+			}
+			found = true
+			resolver, _ := s.Tags.Get("resolver")
+			assert.Equal(t, expResolver, resolver)
+			name, _ := s.Tags.Get("name")
+			assert.Equal(t, u, name)
+		}
+		assert.True(t, found)
+	}
+	assert.Equal(t, int64(2), atomic.LoadInt64(&dns.Queries)) // A and AAAA
+}
@@ -0,0 +1,93 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// RequestSigner signs a request right before it is sent, after its body has
+// been compressed and its headers have been finalized, so the signature can
+// cover them. It's called only once per request, redirects aren't re-signed.
+type RequestSigner interface {
+	SignRequest(req *http.Request, body []byte) error
+}
+
+// RequestSignerConstructor creates a RequestSigner from the options that were
+// passed in the `auth` request param of a user script.
+type RequestSignerConstructor func(params map[string]interface{}) (RequestSigner, error)
+
+//nolint:gochecknoglobals
+var (
+	requestSigners = map[string]RequestSignerConstructor{
+		"aws-sigv4": newAWSSigV4Signer,
+	}
+	requestSignersMx sync.RWMutex
+)
+
+// RegisterRequestSigner makes a request signer available to scripts under the
+// given name, i.e. `auth: { type: name, ... }`. The name must be unique,
+// otherwise this function will panic, so it should be called from init().
+func RegisterRequestSigner(name string, constructor RequestSignerConstructor) {
+	requestSignersMx.Lock()
+	defer requestSignersMx.Unlock()
+
+	if _, ok := requestSigners[name]; ok {
+		panic(fmt.Sprintf("request signer already registered: %s", name))
+	}
+	requestSigners[name] = constructor
+}
+
+// HasRequestSigner returns whether a request signer with that name was registered.
+func HasRequestSigner(name string) bool {
+	requestSignersMx.RLock()
+	defer requestSignersMx.RUnlock()
+
+	_, ok := requestSigners[name]
+	return ok
+}
+
+// NewRequestSigner creates a new instance of the request signer registered
+// under the given name with the provided params.
+func NewRequestSigner(name string, params map[string]interface{}) (RequestSigner, error) {
+	requestSignersMx.RLock()
+	constructor, ok := requestSigners[name]
+	requestSignersMx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown auth type %q, supported request signers are %v", name, requestSignerNames())
+	}
+	return constructor(params)
+}
+
+func requestSignerNames() []string {
+	requestSignersMx.RLock()
+	defer requestSignersMx.RUnlock()
+
+	names := make([]string, 0, len(requestSigners))
+	for name := range requestSigners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
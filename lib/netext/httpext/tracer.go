@@ -27,9 +27,11 @@ import (
 	"sync/atomic"
 	"time"
 
+	"gopkg.in/guregu/null.v3"
+
 	"go.k6.io/k6/lib/metrics"
+	"go.k6.io/k6/lib/netext"
 	"go.k6.io/k6/stats"
-	"gopkg.in/guregu/null.v3"
 )
 
 // A Trail represents detailed information about an HTTP request.
@@ -44,6 +46,7 @@ type Trail struct {
 	Duration time.Duration
 
 	Blocked        time.Duration // Waiting to acquire a connection.
+	LookingUp      time.Duration // Resolving the host name, part of Blocked.
 	Connecting     time.Duration // Connecting to remote host.
 	TLSHandshaking time.Duration // Executing TLS handshake.
 	Sending        time.Duration // Writing request.
@@ -53,6 +56,8 @@ type Trail struct {
 	// Detailed connection information.
 	ConnReused     bool
 	ConnRemoteAddr net.Addr
+	// The name of the DNS resolver, only set if a lookup was made.
+	Resolver string
 
 	Failed null.Bool
 	// Populated by SaveSamples()
@@ -63,7 +68,7 @@ type Trail struct {
 // SaveSamples populates the Trail's sample slice so they're accesible via GetSamples()
 func (tr *Trail) SaveSamples(builtinMetrics *metrics.BuiltinMetrics, tags *stats.SampleTags) {
 	tr.Tags = tags
-	tr.Samples = make([]stats.Sample, 0, 9) // this is with 1 more for a possible HTTPReqFailed
+	tr.Samples = make([]stats.Sample, 0, 10) // this is with 2 more for a possible HTTPReqFailed and HTTPReqLookingUp
 	tr.Samples = append(tr.Samples, []stats.Sample{
 		{Metric: builtinMetrics.HTTPReqs, Time: tr.EndTime, Tags: tags, Value: 1},
 		{Metric: builtinMetrics.HTTPReqDuration, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Duration)},
@@ -74,6 +79,14 @@ func (tr *Trail) SaveSamples(builtinMetrics *metrics.BuiltinMetrics, tags *stats
 		{Metric: builtinMetrics.HTTPReqWaiting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Waiting)},
 		{Metric: builtinMetrics.HTTPReqReceiving, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Receiving)},
 	}...)
+	if tr.Resolver != "" {
+		lookupTags := tags.CloneTags()
+		lookupTags["resolver"] = tr.Resolver
+		tr.Samples = append(tr.Samples, stats.Sample{
+			Metric: builtinMetrics.HTTPReqLookingUp, Time: tr.EndTime,
+			Tags: stats.IntoSampleTags(&lookupTags), Value: stats.D(tr.LookingUp),
+		})
+	}
 }
 
 // GetSamples implements the stats.SampleContainer interface.
@@ -108,9 +121,12 @@ type Tracer struct {
 	gotConn              int64
 	wroteRequest         int64
 	gotFirstResponseByte int64
+	lookupStart          int64
+	lookupDone           int64
 
 	connReused     bool
 	connRemoteAddr net.Addr
+	resolver       atomic.Value
 }
 
 // Trace returns a premade ClientTrace that calls all of the Tracer's hooks.
@@ -127,6 +143,15 @@ func (t *Tracer) Trace() *httptrace.ClientTrace {
 	}
 }
 
+// LookupTrace returns a premade netext.LookupTrace that calls the Tracer's DNS
+// lookup hooks.
+func (t *Tracer) LookupTrace() *netext.LookupTrace {
+	return &netext.LookupTrace{
+		LookupStart: t.LookupStart,
+		LookupDone:  t.LookupDone,
+	}
+}
+
 func now() int64 {
 	return time.Now().UnixNano()
 }
@@ -143,6 +168,20 @@ func (t *Tracer) GetConn(hostPort string) {
 	t.getConn = now()
 }
 
+// LookupStart is called by the netext.Dialer when it starts resolving the host
+// name of a new connection. It's not called for IPs and configured hosts.
+func (t *Tracer) LookupStart(host string) {
+	atomic.CompareAndSwapInt64(&t.lookupStart, 0, now())
+}
+
+// LookupDone is called by the netext.Dialer when the lookup has finished, with
+// the name of the DNS resolver that answered.
+func (t *Tracer) LookupDone(host, resolver string, err error) {
+	if err == nil && resolver != "" && atomic.CompareAndSwapInt64(&t.lookupDone, 0, now()) {
+		t.resolver.Store(resolver)
+	}
+}
+
 // ConnectStart is called when a new connection's Dial begins.
 // If net.Dialer.DualStack (IPv6 "Happy Eyeballs") support is
 // enabled, this may be called multiple times.
@@ -279,6 +318,13 @@ func (t *Tracer) Done() *Trail {
 		trail.Blocked = time.Duration(t.gotConn - t.getConn)
 	}
 
+	lookupStart := atomic.LoadInt64(&t.lookupStart)
+	lookupDone := atomic.LoadInt64(&t.lookupDone)
+	if resolver, ok := t.resolver.Load().(string); ok && lookupStart != 0 && lookupDone >= lookupStart {
+		trail.LookingUp = time.Duration(lookupDone - lookupStart)
+		trail.Resolver = resolver
+	}
+
 	// It's possible for some of the methods of httptrace.ClientTrace to
 	// actually be called after the http.Client or http.RoundTripper have
 	// already returned our result and we've called Done(). This happens
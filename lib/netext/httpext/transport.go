@@ -23,12 +23,15 @@ package httpext
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptrace"
 	"strconv"
 	"sync"
 
+	"golang.org/x/net/http2"
+
 	"go.k6.io/k6/lib"
 	"go.k6.io/k6/lib/netext"
 	"go.k6.io/k6/stats"
@@ -41,6 +44,14 @@ type transport struct {
 	state            *lib.State
 	tags             map[string]string
 	responseCallback func(int) bool
+	// graphQLErrors is set when the response of the last request contained
+	// GraphQL errors, which makes it unexpected regardless of its status
+	graphQLErrors bool
+	// abort is the RequestAborter of the request, its error replaces the
+	// one of the cancelled context when it's aborted
+	abort RequestAborter
+	// roundTripper is used instead of the Transport of the state if it's set
+	roundTripper http.RoundTripper
 
 	lastRequest     *unfinishedRequest
 	lastRequestLock *sync.Mutex
@@ -174,7 +185,7 @@ func (t *transport) measureAndEmitMetrics(unfReq *unfinishedRequest) *finishedRe
 		if unfReq.err == nil {
 			statusCode = unfReq.response.StatusCode
 		}
-		expected := t.responseCallback(statusCode)
+		expected := t.responseCallback(statusCode) && !t.graphQLErrors
 		if !expected {
 			failed = 1
 		}
@@ -241,8 +252,13 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	ctx := req.Context()
 	tracer := &Tracer{}
+	ctx = netext.WithLookupTrace(ctx, tracer.LookupTrace())
 	reqWithTracer := req.WithContext(httptrace.WithClientTrace(ctx, tracer.Trace()))
-	resp, err := t.state.Transport.RoundTrip(reqWithTracer)
+	roundTripper := t.state.Transport
+	if t.roundTripper != nil {
+		roundTripper = t.roundTripper
+	}
+	resp, err := roundTripper.RoundTrip(reqWithTracer)
 
 	var netError net.Error
 	if errors.As(err, &netError) && netError.Timeout() {
@@ -253,6 +269,11 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 			err = NewK6Error(requestTimeoutErrorCode, requestTimeoutErrorCodeMsg, netError)
 		}
 	}
+	if err != nil {
+		if abortErr := abortError(t.abort); abortErr != nil {
+			err = abortErr
+		}
+	}
 
 	t.saveCurrentRequest(&unfinishedRequest{
 		ctx:      ctx,
@@ -264,3 +285,30 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	return resp, err
 }
+
+// NewNetworkTransport returns a copy of the transport that makes all of its
+// connections with the network emulator. Its connections aren't shared with
+// the original transport, so the emulated conditions apply to all requests.
+func NewNetworkTransport(original http.RoundTripper, emulator *netext.NetworkEmulator) (http.RoundTripper, error) {
+	t, ok := original.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("network emulation isn't supported with the transport %T", original)
+	}
+	clone := t.Clone()
+	if _, ok := clone.TLSNextProto["h2"]; ok {
+		// the cloned HTTP/2 upgrade would put the connections in the pool
+		// of the original transport
+		clone.TLSNextProto = nil
+		if err := http2.ConfigureTransport(clone); err != nil {
+			return nil, err
+		}
+	}
+	dial := clone.DialContext
+	if dial == nil {
+		return nil, errors.New("network emulation needs a transport with a DialContext")
+	}
+	clone.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(netext.WithNetworkEmulator(ctx, emulator), network, addr)
+	}
+	return clone, nil
+}
@@ -0,0 +1,515 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mqttext
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/lib/netext"
+)
+
+// ErrClosed is returned by the methods of closed clients.
+var ErrClosed = errors.New("the MQTT connection is closed")
+
+// ReasonCodeError is returned for the failure reason codes of acks.
+type ReasonCodeError struct {
+	Packet string
+	Code   byte
+	Reason string
+}
+
+func (e *ReasonCodeError) Error() string {
+	msg := fmt.Sprintf("%s failed with reason code 0x%02x", e.Packet, e.Code)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// connackErrors are the CONNACK return codes of MQTT 3.1.1.
+//
+//nolint:gochecknoglobals
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Options are the options of the CONNECT packet.
+type Options struct {
+	Version    byte
+	ClientID   string
+	Username   string
+	Password   string
+	CleanStart bool
+	KeepAlive  time.Duration
+	// SessionExpiry is only sent with MQTT 5.
+	SessionExpiry time.Duration
+	Will          *Message
+	// OnMessage, if set, is called by the read loop for every received
+	// message before it's queued.
+	OnMessage func(*Message)
+}
+
+// Client is an MQTT client. Its methods can be called concurrently, messages
+// are read by a separate goroutine and queued until they are received.
+type Client struct {
+	conn    net.Conn
+	version byte
+	opts    Options
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   uint16
+	pending  map[uint16]chan Packet
+	messages []*Message
+	received map[uint16]*Message // QoS 2 messages that weren't released yet
+	notify   chan struct{}
+	err      error
+	done     chan struct{}
+
+	// ClientID is the client identifier, either the one from the options
+	// or the one assigned by an MQTT 5 server.
+	ClientID string
+	// SessionPresent is whether the server had a session for the client.
+	SessionPresent bool
+}
+
+// NewClient starts an MQTT session over the connection, which is closed if
+// that fails.
+func NewClient(ctx context.Context, conn net.Conn, opts Options) (*Client, error) {
+	if opts.Version == 0 {
+		opts.Version = Version311
+	}
+	connect := &Connect{
+		Version:    opts.Version,
+		ClientID:   opts.ClientID,
+		CleanStart: opts.CleanStart,
+		KeepAlive:  uint16(opts.KeepAlive / time.Second),
+		Will:       opts.Will,
+		Properties: Properties{SessionExpiryInterval: uint32(opts.SessionExpiry / time.Second)},
+	}
+	connect.SetCredentials(opts.Username, opts.Password)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := netext.CloseOnDone(ctx, conn)
+	r := bufio.NewReader(conn)
+	connack, err := handshake(conn, r, connect)
+	stop()
+	if err != nil {
+		_ = conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	c := &Client{
+		conn:           conn,
+		version:        opts.Version,
+		opts:           opts,
+		pending:        make(map[uint16]chan Packet),
+		received:       make(map[uint16]*Message),
+		notify:         make(chan struct{}, 1),
+		done:           make(chan struct{}),
+		ClientID:       opts.ClientID,
+		SessionPresent: connack.SessionPresent,
+	}
+	if connack.Properties.AssignedClientID != "" {
+		c.ClientID = connack.Properties.AssignedClientID
+	}
+	go c.readLoop(r)
+	if opts.KeepAlive > 0 {
+		go c.keepAlive(opts.KeepAlive)
+	}
+	return c, nil
+}
+
+func handshake(conn net.Conn, r *bufio.Reader, connect *Connect) (*Connack, error) {
+	if err := WritePacket(conn, connect.Version, connect); err != nil {
+		return nil, err
+	}
+	packet, err := ReadPacket(r, connect.Version)
+	if err != nil {
+		return nil, err
+	}
+	connack, ok := packet.(*Connack)
+	if !ok {
+		return nil, fmt.Errorf("expected a CONNACK packet, received %T", packet)
+	}
+	if connack.ReasonCode != ReasonSuccess {
+		reason := connack.Properties.ReasonString
+		if connect.Version == Version311 && reason == "" {
+			reason = connackErrors[connack.ReasonCode]
+		}
+		return nil, &ReasonCodeError{Packet: "CONNECT", Code: connack.ReasonCode, Reason: reason}
+	}
+	return connack, nil
+}
+
+func (c *Client) write(p Packet) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := WritePacket(c.conn, c.version, p); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// request writes a packet with a new packet identifier and returns the
+// channel that its acks are sent to.
+func (c *Client) request(newPacket func(id uint16) Packet) (uint16, chan Packet, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return 0, nil, err
+	}
+	for {
+		c.nextID++
+		if _, inUse := c.pending[c.nextID]; c.nextID != 0 && !inUse {
+			break
+		}
+	}
+	id, acks := c.nextID, make(chan Packet, 1)
+	c.pending[id] = acks
+	c.mu.Unlock()
+
+	if err := c.write(newPacket(id)); err != nil {
+		c.release(id)
+		return 0, nil, err
+	}
+	return id, acks, nil
+}
+
+func (c *Client) release(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// wait waits for the next ack of a request.
+func (c *Client) wait(ctx context.Context, acks chan Packet) (Packet, error) {
+	select {
+	case packet := <-acks:
+		return packet, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.Err()
+	}
+}
+
+// Publish publishes the message and, for QoS 1 and 2, waits until the server
+// acknowledged it.
+func (c *Client) Publish(ctx context.Context, msg *Message) error {
+	if msg.QoS == 0 {
+		return c.write(&Publish{Message: *msg})
+	}
+
+	id, acks, err := c.request(func(id uint16) Packet { return &Publish{Message: *msg, PacketID: id} })
+	if err != nil {
+		return err
+	}
+	defer c.release(id)
+
+	packet, err := c.wait(ctx, acks)
+	if err != nil {
+		return err
+	}
+	if err = ackError("PUBLISH", packet); err != nil || msg.QoS == 1 {
+		return err
+	}
+
+	// QoS 2: the PUBREC is followed by PUBREL and PUBCOMP
+	if err = c.write(&Ack{Type: TypePubrel, PacketID: id}); err != nil {
+		return err
+	}
+	packet, err = c.wait(ctx, acks)
+	if err != nil {
+		return err
+	}
+	return ackError("PUBREL", packet)
+}
+
+func ackError(request string, packet Packet) error {
+	ack, ok := packet.(*Ack)
+	if !ok {
+		return fmt.Errorf("unexpected %T for %s", packet, request)
+	}
+	if ack.ReasonCode >= ReasonUnspecifiedError {
+		return &ReasonCodeError{Packet: request, Code: ack.ReasonCode, Reason: ack.Properties.ReasonString}
+	}
+	return nil
+}
+
+// Subscribe subscribes to the topic filters and returns the QoS that the
+// server granted for each of them.
+func (c *Client) Subscribe(ctx context.Context, subscriptions []Subscription) ([]byte, error) {
+	id, acks, err := c.request(func(id uint16) Packet {
+		return &Subscribe{PacketID: id, Subscriptions: subscriptions}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(id)
+
+	packet, err := c.wait(ctx, acks)
+	if err != nil {
+		return nil, err
+	}
+	suback, ok := packet.(*Suback)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %T for SUBSCRIBE", packet)
+	}
+	for i, code := range suback.ReasonCodes {
+		if code >= ReasonUnspecifiedError && i < len(subscriptions) {
+			return suback.ReasonCodes, &ReasonCodeError{
+				Packet: fmt.Sprintf("SUBSCRIBE to %q", subscriptions[i].Filter), Code: code,
+				Reason: suback.Properties.ReasonString,
+			}
+		}
+	}
+	return suback.ReasonCodes, nil
+}
+
+// Unsubscribe removes the subscriptions to the topic filters.
+func (c *Client) Unsubscribe(ctx context.Context, filters []string) error {
+	id, acks, err := c.request(func(id uint16) Packet { return &Unsubscribe{PacketID: id, Filters: filters} })
+	if err != nil {
+		return err
+	}
+	defer c.release(id)
+
+	packet, err := c.wait(ctx, acks)
+	if err != nil {
+		return err
+	}
+	unsuback, ok := packet.(*Unsuback)
+	if !ok {
+		return fmt.Errorf("unexpected %T for UNSUBSCRIBE", packet)
+	}
+	for i, code := range unsuback.ReasonCodes {
+		if code >= ReasonUnspecifiedError && i < len(filters) {
+			return &ReasonCodeError{
+				Packet: fmt.Sprintf("UNSUBSCRIBE from %q", filters[i]), Code: code,
+				Reason: unsuback.Properties.ReasonString,
+			}
+		}
+	}
+	return nil
+}
+
+// Receive returns the next message, waiting for one until the context is done.
+func (c *Client) Receive(ctx context.Context) (*Message, error) {
+	for {
+		c.mu.Lock()
+		if len(c.messages) > 0 {
+			msg := c.messages[0]
+			c.messages[0] = nil
+			c.messages = c.messages[1:]
+			c.mu.Unlock()
+			return msg, nil
+		}
+		err := c.err
+		c.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-c.notify:
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close ends the session. With sendWill, the server is asked to publish the
+// will message, MQTT 3.1.1 servers do that if the connection is just closed.
+func (c *Client) Close(sendWill bool) error {
+	if c.Err() != nil {
+		return nil
+	}
+	var err error
+	if !sendWill || c.version == Version5 {
+		code := ReasonSuccess
+		if sendWill {
+			code = ReasonDisconnectWithWill
+		}
+		err = c.write(&Disconnect{ReasonCode: code})
+	}
+	c.fail(ErrClosed)
+	if closeErr := c.conn.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) && err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Err returns the error that ended the session, if it ended.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// fail ends the session with the error, if it didn't end yet.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	_ = c.conn.Close()
+}
+
+func (c *Client) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if c.write(&Pingreq{}) != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+//nolint:cyclop
+func (c *Client) readLoop(r *bufio.Reader) {
+	for {
+		packet, err := ReadPacket(r, c.version)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		switch p := packet.(type) {
+		case *Publish:
+			err = c.handlePublish(p)
+		case *Ack:
+			if p.Type == TypePubrel {
+				err = c.release2(p.PacketID)
+			} else {
+				c.ack(p.PacketID, p)
+			}
+		case *Suback:
+			c.ack(p.PacketID, p)
+		case *Unsuback:
+			c.ack(p.PacketID, p)
+		case *Pingresp:
+		case *Disconnect:
+			err = &ReasonCodeError{Packet: "server DISCONNECT", Code: p.ReasonCode, Reason: p.Properties.ReasonString}
+		default:
+			err = fmt.Errorf("unexpected MQTT packet %T", packet)
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+func (c *Client) ack(id uint16, packet Packet) {
+	c.mu.Lock()
+	acks := c.pending[id]
+	c.mu.Unlock()
+	if acks != nil {
+		select {
+		case acks <- packet:
+		default:
+		}
+	}
+}
+
+func (c *Client) handlePublish(p *Publish) error {
+	msg := p.Message
+	switch p.QoS {
+	case 0:
+		c.queue(&msg)
+		return nil
+	case 1:
+		c.queue(&msg)
+		return c.write(&Ack{Type: TypePuback, PacketID: p.PacketID})
+	default:
+		// the message is delivered once it's released, so duplicates
+		// are only delivered once
+		c.mu.Lock()
+		c.received[p.PacketID] = &msg
+		c.mu.Unlock()
+		return c.write(&Ack{Type: TypePubrec, PacketID: p.PacketID})
+	}
+}
+
+// release2 delivers a QoS 2 message after its PUBREL.
+func (c *Client) release2(id uint16) error {
+	c.mu.Lock()
+	msg := c.received[id]
+	delete(c.received, id)
+	c.mu.Unlock()
+
+	if msg != nil {
+		c.queue(msg)
+	}
+	code := ReasonSuccess
+	if msg == nil {
+		code = ReasonPacketIDNotFound
+	}
+	return c.write(&Ack{Type: TypePubcomp, PacketID: id, ReasonCode: code})
+}
+
+func (c *Client) queue(msg *Message) {
+	if c.opts.OnMessage != nil {
+		c.opts.OnMessage(msg)
+	}
+	c.mu.Lock()
+	c.messages = append(c.messages, msg)
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,685 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package mqttext implements the MQTT 3.1.1 and 5 wire protocol and a client
+// that works over any connection, like the ones from the k6 dialer.
+package mqttext
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The supported protocol versions, as in the protocol level of CONNECT packets.
+const (
+	Version311 byte = 4
+	Version5   byte = 5
+)
+
+// The control packet types.
+const (
+	TypeConnect     byte = 1
+	TypeConnack     byte = 2
+	TypePublish     byte = 3
+	TypePuback      byte = 4
+	TypePubrec      byte = 5
+	TypePubrel      byte = 6
+	TypePubcomp     byte = 7
+	TypeSubscribe   byte = 8
+	TypeSuback      byte = 9
+	TypeUnsubscribe byte = 10
+	TypeUnsuback    byte = 11
+	TypePingreq     byte = 12
+	TypePingresp    byte = 13
+	TypeDisconnect  byte = 14
+)
+
+// The reason codes that are used by the client and the test broker. MQTT 3.1.1
+// uses 0x80 as the only failure code of SUBACK packets, same as MQTT 5.
+const (
+	ReasonSuccess               byte = 0x00
+	ReasonDisconnectWithWill    byte = 0x04
+	ReasonNoSubscriptionExisted byte = 0x11
+	ReasonUnspecifiedError      byte = 0x80
+	ReasonNotAuthorized         byte = 0x87
+	ReasonPacketIDNotFound      byte = 0x92
+)
+
+// maxRemainingLength is the largest remaining length that a variable byte
+// integer can encode.
+const maxRemainingLength = 268435455
+
+var errMalformed = errors.New("malformed MQTT packet")
+
+// Packet is an MQTT control packet.
+type Packet interface {
+	packetType() byte
+}
+
+// Message is an application message, which is published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// UserProperty is an MQTT 5 user property.
+type UserProperty struct {
+	Key, Value string
+}
+
+// Properties are the MQTT 5 properties that the client and the test broker
+// use, the others are skipped when packets are read.
+type Properties struct {
+	SessionExpiryInterval uint32
+	AssignedClientID      string
+	ReasonString          string
+	ContentType           string
+	UserProperties        []UserProperty
+}
+
+// Connect is a CONNECT packet.
+type Connect struct {
+	Version     byte
+	ClientID    string
+	Username    string
+	Password    string
+	CleanStart  bool
+	KeepAlive   uint16
+	Will        *Message
+	Properties  Properties
+	hasUsername bool
+	hasPassword bool
+}
+
+// SetCredentials sets the username and the password, which are only sent if
+// they aren't empty.
+func (p *Connect) SetCredentials(username, password string) {
+	p.Username, p.hasUsername = username, username != ""
+	p.Password, p.hasPassword = password, password != ""
+}
+
+// Connack is a CONNACK packet, the return codes of MQTT 3.1.1 are used as
+// reason codes.
+type Connack struct {
+	SessionPresent bool
+	ReasonCode     byte
+	Properties     Properties
+}
+
+// Publish is a PUBLISH packet.
+type Publish struct {
+	Message
+	PacketID   uint16
+	Dup        bool
+	Properties Properties
+}
+
+// Ack is a PUBACK, PUBREC, PUBREL or PUBCOMP packet.
+type Ack struct {
+	Type       byte
+	PacketID   uint16
+	ReasonCode byte
+	Properties Properties
+}
+
+// Subscription is a topic filter and the maximum QoS of the messages that
+// are sent for it.
+type Subscription struct {
+	Filter string
+	QoS    byte
+}
+
+// Subscribe is a SUBSCRIBE packet.
+type Subscribe struct {
+	PacketID      uint16
+	Subscriptions []Subscription
+	Properties    Properties
+}
+
+// Suback is a SUBACK packet.
+type Suback struct {
+	PacketID    uint16
+	ReasonCodes []byte
+	Properties  Properties
+}
+
+// Unsubscribe is an UNSUBSCRIBE packet.
+type Unsubscribe struct {
+	PacketID   uint16
+	Filters    []string
+	Properties Properties
+}
+
+// Unsuback is an UNSUBACK packet. MQTT 3.1.1 doesn't have any reason codes.
+type Unsuback struct {
+	PacketID    uint16
+	ReasonCodes []byte
+	Properties  Properties
+}
+
+// Pingreq is a PINGREQ packet.
+type Pingreq struct{}
+
+// Pingresp is a PINGRESP packet.
+type Pingresp struct{}
+
+// Disconnect is a DISCONNECT packet, which only has a reason code in MQTT 5.
+type Disconnect struct {
+	ReasonCode byte
+	Properties Properties
+}
+
+func (*Connect) packetType() byte     { return TypeConnect }
+func (*Connack) packetType() byte     { return TypeConnack }
+func (*Publish) packetType() byte     { return TypePublish }
+func (p *Ack) packetType() byte       { return p.Type }
+func (*Subscribe) packetType() byte   { return TypeSubscribe }
+func (*Suback) packetType() byte      { return TypeSuback }
+func (*Unsubscribe) packetType() byte { return TypeUnsubscribe }
+func (*Unsuback) packetType() byte    { return TypeUnsuback }
+func (*Pingreq) packetType() byte     { return TypePingreq }
+func (*Pingresp) packetType() byte    { return TypePingresp }
+func (*Disconnect) packetType() byte  { return TypeDisconnect }
+
+// WritePacket encodes the packet for the protocol version and writes it.
+//
+//nolint:funlen,cyclop
+func WritePacket(w io.Writer, version byte, packet Packet) error {
+	var e encoder
+	e.v5 = version == Version5
+	var flags byte
+	switch p := packet.(type) {
+	case *Connect:
+		e.string("MQTT")
+		e.byte(p.Version)
+		var connectFlags byte
+		if p.CleanStart {
+			connectFlags |= 0x02
+		}
+		if p.Will != nil {
+			connectFlags |= 0x04 | p.Will.QoS<<3
+			if p.Will.Retain {
+				connectFlags |= 0x20
+			}
+		}
+		if p.hasPassword {
+			connectFlags |= 0x40
+		}
+		if p.hasUsername {
+			connectFlags |= 0x80
+		}
+		e.byte(connectFlags)
+		e.uint16(p.KeepAlive)
+		e.v5 = p.Version == Version5
+		e.properties(p.Properties)
+		e.string(p.ClientID)
+		if p.Will != nil {
+			e.properties(Properties{})
+			e.string(p.Will.Topic)
+			e.binary(p.Will.Payload)
+		}
+		if p.hasUsername {
+			e.string(p.Username)
+		}
+		if p.hasPassword {
+			e.string(p.Password)
+		}
+	case *Connack:
+		if p.SessionPresent {
+			e.byte(1)
+		} else {
+			e.byte(0)
+		}
+		e.byte(p.ReasonCode)
+		e.properties(p.Properties)
+	case *Publish:
+		flags = p.QoS << 1
+		if p.Dup {
+			flags |= 0x08
+		}
+		if p.Retain {
+			flags |= 0x01
+		}
+		e.string(p.Topic)
+		if p.QoS > 0 {
+			e.uint16(p.PacketID)
+		}
+		e.properties(p.Properties)
+		e.buf = append(e.buf, p.Payload...)
+	case *Ack:
+		if p.Type == TypePubrel {
+			flags = 0x02
+		}
+		e.uint16(p.PacketID)
+		if e.v5 && (p.ReasonCode != ReasonSuccess || p.Properties.ReasonString != "") {
+			e.byte(p.ReasonCode)
+			e.properties(p.Properties)
+		}
+	case *Subscribe:
+		flags = 0x02
+		e.uint16(p.PacketID)
+		e.properties(p.Properties)
+		for _, s := range p.Subscriptions {
+			e.string(s.Filter)
+			e.byte(s.QoS)
+		}
+	case *Suback:
+		e.uint16(p.PacketID)
+		e.properties(p.Properties)
+		e.buf = append(e.buf, p.ReasonCodes...)
+	case *Unsubscribe:
+		flags = 0x02
+		e.uint16(p.PacketID)
+		e.properties(p.Properties)
+		for _, filter := range p.Filters {
+			e.string(filter)
+		}
+	case *Unsuback:
+		e.uint16(p.PacketID)
+		if e.v5 {
+			e.properties(p.Properties)
+			e.buf = append(e.buf, p.ReasonCodes...)
+		}
+	case *Pingreq, *Pingresp:
+	case *Disconnect:
+		if e.v5 {
+			e.byte(p.ReasonCode)
+			e.properties(p.Properties)
+		}
+	default:
+		return fmt.Errorf("unsupported MQTT packet %T", packet)
+	}
+
+	if len(e.buf) > maxRemainingLength {
+		return fmt.Errorf("the MQTT packet is too large: %d bytes", len(e.buf))
+	}
+	header := []byte{packet.packetType()<<4 | flags}
+	header = appendVarint(header, uint32(len(e.buf)))
+	_, err := w.Write(append(header, e.buf...))
+	return err
+}
+
+// ReadPacket reads the next packet. The version is only used for the packets
+// that differ between the versions, CONNECT packets have their own.
+//
+//nolint:funlen,gocognit,cyclop
+func ReadPacket(r io.ByteReader, version byte) (Packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, err := readVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, length)
+	for i := range body {
+		if body[i], err = r.ReadByte(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+
+	d := &decoder{buf: body, v5: version == Version5}
+	packetType, flags := first>>4, first&0x0f
+	var packet Packet
+	switch packetType {
+	case TypeConnect:
+		p := &Connect{}
+		if name := d.string(); name != "MQTT" && d.err == nil {
+			return nil, fmt.Errorf("unsupported MQTT protocol name %q", name)
+		}
+		p.Version = d.byte()
+		if d.err == nil && p.Version != Version311 && p.Version != Version5 {
+			return nil, fmt.Errorf("unsupported MQTT protocol level %d", p.Version)
+		}
+		d.v5 = p.Version == Version5
+		connectFlags := d.byte()
+		p.CleanStart = connectFlags&0x02 != 0
+		p.KeepAlive = d.uint16()
+		p.Properties = d.properties()
+		p.ClientID = d.string()
+		if connectFlags&0x04 != 0 {
+			d.properties()
+			p.Will = &Message{
+				Topic: d.string(), Payload: d.binary(), QoS: connectFlags >> 3 & 0x03, Retain: connectFlags&0x20 != 0,
+			}
+		}
+		if connectFlags&0x80 != 0 {
+			p.Username, p.hasUsername = d.string(), true
+		}
+		if connectFlags&0x40 != 0 {
+			p.Password, p.hasPassword = d.string(), true
+		}
+		packet = p
+	case TypeConnack:
+		packet = &Connack{SessionPresent: d.byte()&0x01 != 0, ReasonCode: d.byte(), Properties: d.properties()}
+	case TypePublish:
+		p := &Publish{Dup: flags&0x08 != 0}
+		p.QoS, p.Retain = flags>>1&0x03, flags&0x01 != 0
+		if p.QoS > 2 {
+			return nil, errMalformed
+		}
+		p.Topic = d.string()
+		if p.QoS > 0 {
+			p.PacketID = d.uint16()
+		}
+		p.Properties = d.properties()
+		p.Payload = d.rest()
+		packet = p
+	case TypePuback, TypePubrec, TypePubrel, TypePubcomp:
+		p := &Ack{Type: packetType, PacketID: d.uint16()}
+		if d.v5 && len(d.buf) > 0 {
+			p.ReasonCode = d.byte()
+			if len(d.buf) > 0 {
+				p.Properties = d.properties()
+			}
+		}
+		packet = p
+	case TypeSubscribe:
+		p := &Subscribe{PacketID: d.uint16(), Properties: d.properties()}
+		for len(d.buf) > 0 && d.err == nil {
+			p.Subscriptions = append(p.Subscriptions, Subscription{Filter: d.string(), QoS: d.byte() & 0x03})
+		}
+		packet = p
+	case TypeSuback:
+		packet = &Suback{PacketID: d.uint16(), Properties: d.properties(), ReasonCodes: d.rest()}
+	case TypeUnsubscribe:
+		p := &Unsubscribe{PacketID: d.uint16(), Properties: d.properties()}
+		for len(d.buf) > 0 && d.err == nil {
+			p.Filters = append(p.Filters, d.string())
+		}
+		packet = p
+	case TypeUnsuback:
+		p := &Unsuback{PacketID: d.uint16()}
+		if d.v5 {
+			p.Properties, p.ReasonCodes = d.properties(), d.rest()
+		}
+		packet = p
+	case TypePingreq:
+		packet = &Pingreq{}
+	case TypePingresp:
+		packet = &Pingresp{}
+	case TypeDisconnect:
+		p := &Disconnect{}
+		if d.v5 && len(d.buf) > 0 {
+			p.ReasonCode = d.byte()
+			if len(d.buf) > 0 {
+				p.Properties = d.properties()
+			}
+		}
+		packet = p
+	default:
+		return nil, fmt.Errorf("unsupported MQTT packet type %d", packetType)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return packet, nil
+}
+
+func appendVarint(b []byte, n uint32) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func readVarint(r io.ByteReader) (uint32, error) {
+	var n, multiplier uint32 = 0, 1
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n += uint32(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			return n, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errMalformed
+}
+
+type encoder struct {
+	buf []byte
+	v5  bool
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uint16(n uint16) {
+	e.buf = append(e.buf, byte(n>>8), byte(n))
+}
+
+func (e *encoder) uint32(n uint32) {
+	e.buf = append(e.buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func (e *encoder) binary(b []byte) {
+	e.uint16(uint16(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.binary([]byte(s))
+}
+
+// The identifiers of the properties, see the "Properties" section of the MQTT 5 spec.
+const (
+	propPayloadFormat         = 0x01
+	propMessageExpiry         = 0x02
+	propContentType           = 0x03
+	propResponseTopic         = 0x08
+	propCorrelationData       = 0x09
+	propSubscriptionID        = 0x0B
+	propSessionExpiryInterval = 0x11
+	propAssignedClientID      = 0x12
+	propServerKeepAlive       = 0x13
+	propAuthMethod            = 0x15
+	propAuthData              = 0x16
+	propRequestProblemInfo    = 0x17
+	propWillDelayInterval     = 0x18
+	propRequestResponseInfo   = 0x19
+	propResponseInfo          = 0x1A
+	propServerReference       = 0x1C
+	propReasonString          = 0x1F
+	propReceiveMaximum        = 0x21
+	propTopicAliasMaximum     = 0x22
+	propTopicAlias            = 0x23
+	propMaximumQoS            = 0x24
+	propRetainAvailable       = 0x25
+	propUserProperty          = 0x26
+	propMaximumPacketSize     = 0x27
+	propWildcardSubAvailable  = 0x28
+	propSubIDAvailable        = 0x29
+	propSharedSubAvailable    = 0x2A
+)
+
+func (e *encoder) properties(p Properties) {
+	if !e.v5 {
+		return
+	}
+	var props encoder
+	if p.SessionExpiryInterval != 0 {
+		props.byte(propSessionExpiryInterval)
+		props.uint32(p.SessionExpiryInterval)
+	}
+	if p.AssignedClientID != "" {
+		props.byte(propAssignedClientID)
+		props.string(p.AssignedClientID)
+	}
+	if p.ReasonString != "" {
+		props.byte(propReasonString)
+		props.string(p.ReasonString)
+	}
+	if p.ContentType != "" {
+		props.byte(propContentType)
+		props.string(p.ContentType)
+	}
+	for _, up := range p.UserProperties {
+		props.byte(propUserProperty)
+		props.string(up.Key)
+		props.string(up.Value)
+	}
+	e.buf = appendVarint(e.buf, uint32(len(props.buf)))
+	e.buf = append(e.buf, props.buf...)
+}
+
+type decoder struct {
+	buf []byte
+	v5  bool
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = errMalformed
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) varint() uint32 {
+	if d.err != nil {
+		return 0
+	}
+	r := &byteSliceReader{buf: d.buf}
+	n, err := readVarint(r)
+	if err != nil {
+		d.err = errMalformed
+		return 0
+	}
+	d.buf = r.buf
+	return n
+}
+
+func (d *decoder) binary() []byte {
+	n := d.uint16()
+	b := d.take(int(n))
+	return append([]byte(nil), b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+func (d *decoder) rest() []byte {
+	b := d.buf
+	d.buf = nil
+	return append([]byte(nil), b...)
+}
+
+//nolint:cyclop
+func (d *decoder) properties() Properties {
+	var p Properties
+	if !d.v5 {
+		return p
+	}
+	n := d.varint()
+	props := &decoder{buf: d.take(int(n)), v5: true, err: d.err}
+	for len(props.buf) > 0 && props.err == nil {
+		switch id := props.byte(); id {
+		case propSessionExpiryInterval:
+			p.SessionExpiryInterval = props.uint32()
+		case propAssignedClientID:
+			p.AssignedClientID = props.string()
+		case propReasonString:
+			p.ReasonString = props.string()
+		case propContentType:
+			p.ContentType = props.string()
+		case propUserProperty:
+			p.UserProperties = append(p.UserProperties, UserProperty{Key: props.string(), Value: props.string()})
+		case propPayloadFormat, propRequestProblemInfo, propRequestResponseInfo, propMaximumQoS,
+			propRetainAvailable, propWildcardSubAvailable, propSubIDAvailable, propSharedSubAvailable:
+			props.byte()
+		case propServerKeepAlive, propReceiveMaximum, propTopicAliasMaximum, propTopicAlias:
+			props.uint16()
+		case propMessageExpiry, propWillDelayInterval, propMaximumPacketSize:
+			props.uint32()
+		case propResponseTopic, propAuthMethod, propResponseInfo, propServerReference:
+			props.string()
+		case propCorrelationData, propAuthData:
+			props.binary()
+		case propSubscriptionID:
+			props.varint()
+		default:
+			props.err = fmt.Errorf("unknown MQTT property 0x%02x", id)
+		}
+	}
+	if props.err != nil && d.err == nil {
+		d.err = props.err
+	}
+	return p
+}
+
+type byteSliceReader struct {
+	buf []byte
+}
+
+func (r *byteSliceReader) ReadByte() (byte, error) {
+	if len(r.buf) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b, nil
+}
@@ -0,0 +1,124 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mqttext
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	t.Parallel()
+	connect := func(version byte) *Connect {
+		p := &Connect{
+			Version:    version,
+			ClientID:   "k6",
+			CleanStart: true,
+			KeepAlive:  30,
+			Will:       &Message{Topic: "status/k6", Payload: []byte("offline"), QoS: 1, Retain: true},
+		}
+		p.SetCredentials("user", "")
+		if version == Version5 {
+			p.Properties.SessionExpiryInterval = 60
+		}
+		return p
+	}
+	properties := Properties{
+		AssignedClientID: "assigned",
+		ReasonString:     "because",
+		ContentType:      "text/plain",
+		UserProperties:   []UserProperty{{Key: "k", Value: "v"}, {Key: "k", Value: "w"}},
+	}
+	packets := func(version byte) []Packet {
+		var props Properties
+		if version == Version5 {
+			props = properties
+		}
+		return []Packet{
+			connect(version),
+			&Connack{SessionPresent: true, Properties: props},
+			&Publish{Message: Message{Topic: "a/b", Payload: []byte("hello")}},
+			&Publish{Message: Message{Topic: "a/b", QoS: 2, Retain: true}, PacketID: 7, Dup: true},
+			&Ack{Type: TypePuback, PacketID: 1},
+			&Ack{Type: TypePubrel, PacketID: 2},
+			&Subscribe{PacketID: 3, Subscriptions: []Subscription{{Filter: "a/+", QoS: 1}, {Filter: "#", QoS: 2}}},
+			&Suback{PacketID: 3, ReasonCodes: []byte{1, ReasonUnspecifiedError}},
+			&Unsubscribe{PacketID: 4, Filters: []string{"a/+", "#"}},
+			&Pingreq{},
+			&Pingresp{},
+			&Disconnect{},
+		}
+	}
+
+	for _, version := range []byte{Version311, Version5} {
+		version := version
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			t.Parallel()
+			for _, packet := range packets(version) {
+				var buf bytes.Buffer
+				require.NoError(t, WritePacket(&buf, version, packet))
+				decoded, err := ReadPacket(&buf, version)
+				require.NoError(t, err)
+				assert.Equal(t, packet, decoded)
+				assert.Zero(t, buf.Len())
+			}
+		})
+	}
+}
+
+func TestPacketV5ReasonCodes(t *testing.T) {
+	t.Parallel()
+	packets := []Packet{
+		&Ack{Type: TypePubcomp, PacketID: 1, ReasonCode: ReasonPacketIDNotFound},
+		&Ack{Type: TypePuback, PacketID: 2, Properties: Properties{ReasonString: "ok"}},
+		&Unsuback{PacketID: 3, ReasonCodes: []byte{ReasonSuccess, ReasonNoSubscriptionExisted}},
+		&Disconnect{ReasonCode: ReasonDisconnectWithWill},
+	}
+	for _, packet := range packets {
+		var buf bytes.Buffer
+		require.NoError(t, WritePacket(&buf, Version5, packet))
+		decoded, err := ReadPacket(&buf, Version5)
+		require.NoError(t, err)
+		assert.Equal(t, packet, decoded)
+	}
+}
+
+func TestPacketLength(t *testing.T) {
+	t.Parallel()
+	// the remaining length needs 3 bytes
+	msg := &Publish{Message: Message{Topic: "big", Payload: []byte(strings.Repeat("x", 20000))}}
+	var buf bytes.Buffer
+	require.NoError(t, WritePacket(&buf, Version311, msg))
+	assert.Equal(t, []byte{0x30, 0xa5, 0x9c, 0x01}, buf.Bytes()[:4])
+	decoded, err := ReadPacket(&buf, Version311)
+	require.NoError(t, err)
+	assert.Equal(t, msg, decoded)
+
+	_, err = ReadPacket(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff}), Version311)
+	assert.Error(t, err)
+	_, err = ReadPacket(bytes.NewReader([]byte{0x30, 0x05, 0x00, 0x10}), Version311)
+	assert.Error(t, err)
+}
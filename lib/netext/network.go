@@ -0,0 +1,285 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/types"
+)
+
+// minRetransmissionTimeout is the minimum TCP retransmission timeout used by
+// Linux, which is how much a lost TCP segment is delayed on top of the latency.
+const minRetransmissionTimeout = 200 * time.Millisecond
+
+// NetworkEmulator applies emulated network conditions to the connections
+// created by a Dialer. The bandwidth limits are shared by all of them.
+type NetworkEmulator struct {
+	conditions types.NetworkConditions
+
+	latency, jitter  time.Duration
+	packetLoss       float64
+	download, upload *rate.Limiter
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// NewNetworkEmulator returns a new NetworkEmulator for the given conditions,
+// or nil if they don't have any effect.
+func NewNetworkEmulator(conditions types.NetworkConditions) *NetworkEmulator {
+	c := conditions.Effective()
+	if c.Latency.Duration <= 0 && c.Jitter.Duration <= 0 && c.Download.Int64 <= 0 &&
+		c.Upload.Int64 <= 0 && c.PacketLoss.Float64 <= 0 {
+		return nil
+	}
+	return &NetworkEmulator{
+		conditions: conditions,
+		latency:    time.Duration(c.Latency.Duration),
+		jitter:     time.Duration(c.Jitter.Duration),
+		packetLoss: c.PacketLoss.Float64 / 100,
+		download:   newBandwidthLimiter(c.Download.Int64),
+		upload:     newBandwidthLimiter(c.Upload.Int64),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+}
+
+// NewClientNetworkEmulator returns a new NetworkEmulator for a single client,
+// with the given conditions applied on top of the ones of the dialer.
+func NewClientNetworkEmulator(dialer lib.DialContexter, conditions types.NetworkConditions) *NetworkEmulator {
+	return NewNetworkEmulator(DialerNetworkConditions(dialer).Apply(conditions))
+}
+
+// DialerNetworkConditions returns the conditions emulated by the dialer, or
+// empty ones if it isn't a Dialer.
+func DialerNetworkConditions(dialer lib.DialContexter) types.NetworkConditions {
+	if d, ok := dialer.(*Dialer); ok {
+		return d.NetworkEmulator.Conditions()
+	}
+	return types.NetworkConditions{}
+}
+
+// newBandwidthLimiter returns a limiter for the given kbit/s, which allows
+// bursts of up to 50ms worth of data, or nil if there's no limit.
+func newBandwidthLimiter(kbps int64) *rate.Limiter {
+	if kbps <= 0 {
+		return nil
+	}
+	bytesPerSecond := float64(kbps) * 1000 / 8
+	burst := int(bytesPerSecond / 20)
+	if burst < 512 {
+		burst = 512
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// Conditions returns the network conditions the emulator was created with.
+// It's safe to call on a nil emulator.
+func (e *NetworkEmulator) Conditions() types.NetworkConditions {
+	if e == nil {
+		return types.NetworkConditions{}
+	}
+	return e.conditions
+}
+
+// delay returns the latency with the jitter applied.
+func (e *NetworkEmulator) delay() time.Duration {
+	if e.jitter <= 0 {
+		return e.latency
+	}
+	e.randMu.Lock()
+	d := e.latency + time.Duration(e.rand.Int63n(int64(2*e.jitter)+1)) - e.jitter
+	e.randMu.Unlock()
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// lost decides whether a packet should be lost.
+func (e *NetworkEmulator) lost() bool {
+	if e.packetLoss <= 0 {
+		return false
+	}
+	e.randMu.Lock()
+	defer e.randMu.Unlock()
+	return e.rand.Float64() < e.packetLoss
+}
+
+// control returns a net.Dialer.Control function that adds the latency to the
+// connection setup, so it's measured as part of the connecting time.
+func (e *NetworkEmulator) control(ctx context.Context, next func(string, string, syscall.RawConn) error,
+) func(string, string, syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if !isPacketNetwork(network) {
+			if err := sleepContext(ctx, e.delay()); err != nil {
+				return err
+			}
+		}
+		if next != nil {
+			return next(network, address, c)
+		}
+		return nil
+	}
+}
+
+func (e *NetworkEmulator) wrap(conn net.Conn, network string) net.Conn {
+	return &emulatedConn{
+		Conn:     conn,
+		emulator: e,
+		packet:   isPacketNetwork(network),
+		closed:   make(chan struct{}),
+	}
+}
+
+func isPacketNetwork(network string) bool {
+	return strings.HasPrefix(network, "udp") || network == "ip" || strings.HasPrefix(network, "ip:") ||
+		network == "unixgram"
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type networkEmulatorKey struct{}
+
+// WithNetworkEmulator returns a new context that makes the Dialer use the
+// given emulator instead of its own, e.g. for a single client.
+func WithNetworkEmulator(ctx context.Context, e *NetworkEmulator) context.Context {
+	return context.WithValue(ctx, networkEmulatorKey{}, e)
+}
+
+func getNetworkEmulator(ctx context.Context) (*NetworkEmulator, bool) {
+	e, ok := ctx.Value(networkEmulatorKey{}).(*NetworkEmulator)
+	return e, ok
+}
+
+// emulatedConn wraps a net.Conn and applies the emulated network conditions to
+// it. The latency is added to the first read after a write, i.e. once per round
+// trip, and the bandwidth limits are applied after each read and before each
+// write, so the delays are measured as waiting, receiving and sending time.
+type emulatedConn struct {
+	net.Conn
+	emulator *NetworkEmulator
+	packet   bool
+
+	awaitingResponse uint32
+	closeOnce        sync.Once
+	closed           chan struct{}
+}
+
+func (c *emulatedConn) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-c.closed:
+	}
+}
+
+func (c *emulatedConn) throttle(limiter *rate.Limiter, n int) {
+	if limiter == nil || n <= 0 {
+		return
+	}
+	c.sleep(limiter.ReserveN(time.Now(), n).Delay())
+}
+
+func (c *emulatedConn) Read(b []byte) (int, error) {
+	e := c.emulator
+	if !c.packet && e.download != nil && len(b) > e.download.Burst() {
+		b = b[:e.download.Burst()]
+	}
+	for {
+		n, err := c.Conn.Read(b)
+		if n > 0 && c.packet && e.lost() {
+			continue
+		}
+		if n > 0 {
+			if atomic.CompareAndSwapUint32(&c.awaitingResponse, 1, 0) {
+				c.sleep(e.delay())
+			}
+			if !c.packet && e.lost() {
+				c.sleep(minRetransmissionTimeout + 2*e.delay())
+			}
+			c.throttle(e.download, n)
+		}
+		return n, err
+	}
+}
+
+func (c *emulatedConn) Write(b []byte) (int, error) {
+	e := c.emulator
+	atomic.StoreUint32(&c.awaitingResponse, 1)
+	if c.packet {
+		c.throttle(e.upload, len(b))
+		if e.lost() {
+			return len(b), nil
+		}
+		return c.Conn.Write(b)
+	}
+
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if e.upload != nil && len(chunk) > e.upload.Burst() {
+			chunk = chunk[:e.upload.Burst()]
+		}
+		c.throttle(e.upload, len(chunk))
+		if e.lost() {
+			c.sleep(minRetransmissionTimeout + 2*e.delay())
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (c *emulatedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
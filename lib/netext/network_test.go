@@ -0,0 +1,175 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"go.k6.io/k6/lib/types"
+)
+
+func newEchoServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNewNetworkEmulator(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, NewNetworkEmulator(types.NetworkConditions{}))
+	assert.Nil(t, NewNetworkEmulator(types.NetworkConditions{Latency: types.NewNullDuration(0, true)}))
+
+	conditions := types.NetworkConditions{Preset: null.StringFrom("3g"), PacketLoss: null.FloatFrom(5)}
+	e := NewNetworkEmulator(conditions)
+	require.NotNil(t, e)
+	assert.Equal(t, conditions, e.Conditions())
+	assert.Equal(t, 300*time.Millisecond, e.latency)
+	assert.Equal(t, 0.05, e.packetLoss)
+	assert.Equal(t, 200000.0, float64(e.download.Limit()))
+	assert.Equal(t, 96000.0, float64(e.upload.Limit()))
+
+	for i := 0; i < 100; i++ {
+		d := e.delay()
+		assert.True(t, d >= 270*time.Millisecond && d <= 330*time.Millisecond, d)
+	}
+}
+
+func TestNetworkEmulatorLatency(t *testing.T) {
+	t.Parallel()
+	addr := newEchoServer(t)
+	dialer := NewDialer(net.Dialer{}, newResolver())
+	dialer.NetworkEmulator = NewNetworkEmulator(types.NetworkConditions{
+		Latency: types.NewNullDuration(50*time.Millisecond, true),
+	})
+
+	start := time.Now()
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	buf := make([]byte, 4)
+	for i := 0; i < 2; i++ {
+		start = time.Now()
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	}
+	assert.Equal(t, int64(8), dialer.BytesWritten)
+	assert.Equal(t, int64(8), dialer.BytesRead)
+}
+
+func TestNetworkEmulatorBandwidth(t *testing.T) {
+	t.Parallel()
+	addr := newEchoServer(t)
+	dialer := NewDialer(net.Dialer{}, newResolver())
+	// 8 kB/s and the minimum burst of 512 bytes
+	dialer.NetworkEmulator = NewNetworkEmulator(types.NetworkConditions{Upload: null.IntFrom(64)})
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	start := time.Now()
+	n, err := conn.Write(make([]byte, 2512))
+	require.NoError(t, err)
+	assert.Equal(t, 2512, n)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(250*time.Millisecond))
+}
+
+func TestNetworkEmulatorContextOverride(t *testing.T) {
+	t.Parallel()
+	addr := newEchoServer(t)
+	dialer := NewDialer(net.Dialer{}, newResolver())
+	dialer.NetworkEmulator = NewNetworkEmulator(types.NetworkConditions{
+		Latency: types.NewNullDuration(time.Minute, true),
+	})
+
+	emulator := NewClientNetworkEmulator(dialer, types.NetworkConditions{
+		Latency: types.NewNullDuration(0, true),
+		Upload:  null.IntFrom(1000),
+	})
+	require.NotNil(t, emulator)
+	assert.Equal(t, types.NetworkConditions{
+		Latency: types.NewNullDuration(0, true),
+		Upload:  null.IntFrom(1000),
+	}, emulator.Conditions())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.DialContext(WithNetworkEmulator(ctx, emulator), "tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// the minute of latency of the dialer's own emulator is interrupted
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = dialer.DialContext(ctx, "tcp", addr)
+	require.Error(t, err)
+}
+
+func TestNetworkEmulatorPacketLoss(t *testing.T) {
+	t.Parallel()
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+
+	dialer := NewDialer(net.Dialer{}, newResolver())
+	dialer.NetworkEmulator = NewNetworkEmulator(types.NetworkConditions{PacketLoss: null.FloatFrom(100)})
+	conn, err := dialer.DialContext(context.Background(), "udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	n, err := conn.Write([]byte("lost"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	require.NoError(t, l.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = l.ReadFrom(make([]byte, 4))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+}
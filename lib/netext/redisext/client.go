@@ -0,0 +1,383 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package redisext
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/lib/netext"
+)
+
+// ErrClosed is returned by the methods of closed clients and subscriptions.
+var ErrClosed = errors.New("the Redis client is closed")
+
+// DefaultPoolSize is the default maximum number of connections of a client.
+const DefaultPoolSize = 10
+
+// Options are the options of a client.
+type Options struct {
+	// Dial opens a new connection, which is already upgraded to TLS if
+	// that's needed.
+	Dial     func(ctx context.Context) (net.Conn, error)
+	Username string
+	Password string
+	DB       int
+	// PoolSize is the maximum number of connections, the commands wait
+	// for a free one if all of them are in use.
+	PoolSize int
+}
+
+// Client is a Redis client with a pool of connections, its methods can be
+// called concurrently.
+type Client struct {
+	opts Options
+	// slots limits the number of open connections
+	slots chan struct{}
+	idle  chan *conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewClient returns a new client, which opens connections with the first
+// commands.
+func NewClient(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = DefaultPoolSize
+	}
+	return &Client{
+		opts:  opts,
+		slots: make(chan struct{}, opts.PoolSize),
+		idle:  make(chan *conn, opts.PoolSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Do sends a command and returns its reply. Error replies are returned as
+// errors of the Error type.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := c.Pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(Error); ok {
+		return nil, replyErr
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends the commands at once and returns their replies in the same
+// order. Error replies are Error values, the returned error is only for
+// failures of the connection.
+func (c *Client) Pipeline(ctx context.Context, commands [][]string) ([]interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := roundTrip(ctx, cn, commands)
+	c.put(cn, err)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return replies, nil
+}
+
+// roundTrip writes the commands and reads their replies.
+func roundTrip(ctx context.Context, cn *conn, commands [][]string) ([]interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if ctx.Done() != nil {
+		stop := netext.CloseOnDone(ctx, cn)
+		defer stop()
+	}
+
+	for _, args := range commands {
+		if err := WriteCommand(cn.w, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(commands))
+	for i := range replies {
+		var err error
+		if replies[i], err = ReadValue(cn.r); err != nil {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// get returns an idle connection or opens a new one, if the pool isn't full.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case <-c.done:
+		return nil, ErrClosed
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case <-c.done:
+		return nil, ErrClosed
+	case cn := <-c.idle:
+		return cn, nil
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	cn, err := c.dial(ctx)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return cn, nil
+}
+
+// put returns the connection to the pool, unless it failed.
+func (c *Client) put(cn *conn, err error) {
+	select {
+	case <-c.done:
+		err = ErrClosed
+	default:
+	}
+	if err != nil {
+		_ = cn.Close()
+		<-c.slots
+		return
+	}
+	c.idle <- cn
+}
+
+// dial opens a connection, authenticates and selects the database.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	nc, err := c.opts.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var commands [][]string
+	switch {
+	case c.opts.Username != "":
+		commands = append(commands, []string{"AUTH", c.opts.Username, c.opts.Password})
+	case c.opts.Password != "":
+		commands = append(commands, []string{"AUTH", c.opts.Password})
+	}
+	if c.opts.DB != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	if len(commands) == 0 {
+		return cn, nil
+	}
+	replies, err := roundTrip(ctx, cn, commands)
+	if err == nil {
+		for i, reply := range replies {
+			if replyErr, ok := reply.(Error); ok {
+				err = fmt.Errorf("%s failed: %w", commands[i][0], replyErr)
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = cn.Close()
+		return nil, err
+	}
+	return cn, nil
+}
+
+// Close closes the connections of the client. The subscriptions have their
+// own connections and need to be closed separately.
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.done) })
+	for {
+		select {
+		case cn := <-c.idle:
+			_ = cn.Close()
+			<-c.slots
+		default:
+			return nil
+		}
+	}
+}
+
+// Message is a message that was published to a channel.
+type Message struct {
+	Channel string
+	// Pattern is the pattern of the subscription, if it was a PSUBSCRIBE.
+	Pattern string
+	Payload string
+}
+
+// Subscription receives the messages of channels over its own connection.
+type Subscription struct {
+	cn *conn
+
+	mu       sync.Mutex
+	messages []*Message
+	notify   chan struct{}
+	err      error
+	done     chan struct{}
+}
+
+// Subscribe opens a connection that is subscribed to the channels, or to the
+// channel patterns with patterns, which is like PSUBSCRIBE.
+func (c *Client) Subscribe(ctx context.Context, patterns bool, channels ...string) (*Subscription, error) {
+	select {
+	case <-c.done:
+		return nil, ErrClosed
+	default:
+	}
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	command := "SUBSCRIBE"
+	if patterns {
+		command = "PSUBSCRIBE"
+	}
+
+	// every channel is confirmed with a reply
+	deadline, _ := ctx.Deadline()
+	_ = cn.SetDeadline(deadline)
+	stop := netext.CloseOnDone(ctx, cn)
+	err = WriteCommand(cn.w, append([]string{command}, channels...))
+	if err == nil {
+		err = cn.w.Flush()
+	}
+	for i := 0; i < len(channels) && err == nil; i++ {
+		var reply interface{}
+		if reply, err = ReadValue(cn.r); err == nil {
+			if replyErr, ok := reply.(Error); ok {
+				err = replyErr
+			}
+		}
+	}
+	stop()
+	if err != nil {
+		_ = cn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	_ = cn.SetDeadline(time.Time{})
+
+	s := &Subscription{cn: cn, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	go s.readLoop()
+	return s, nil
+}
+
+func (s *Subscription) readLoop() {
+	for {
+		reply, err := ReadValue(s.cn.r)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) < 3 {
+			continue
+		}
+		kind, _ := items[0].(string)
+		msg := &Message{}
+		switch {
+		case kind == "message":
+			msg.Channel, _ = items[1].(string)
+			msg.Payload, _ = items[2].(string)
+		case kind == "pmessage" && len(items) == 4:
+			msg.Pattern, _ = items[1].(string)
+			msg.Channel, _ = items[2].(string)
+			msg.Payload, _ = items[3].(string)
+		default:
+			continue
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Receive returns the next message, waiting for one until the context is done.
+func (s *Subscription) Receive(ctx context.Context) (*Message, error) {
+	for {
+		s.mu.Lock()
+		if len(s.messages) > 0 {
+			msg := s.messages[0]
+			s.messages[0] = nil
+			s.messages = s.messages[1:]
+			s.mu.Unlock()
+			return msg, nil
+		}
+		err := s.err
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close closes the connection of the subscription.
+func (s *Subscription) Close() error {
+	s.fail(ErrClosed)
+	return nil
+}
+
+func (s *Subscription) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	close(s.done)
+	_ = s.cn.Close()
+}
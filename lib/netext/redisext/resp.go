@@ -0,0 +1,175 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package redisext implements the Redis serialization protocol (RESP2) and a
+// pooled Redis client that works over any connection, like the ones from the
+// k6 dialer.
+package redisext
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error is an error reply of the server, e.g. "WRONGTYPE Operation against a
+// key holding the wrong kind of value".
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// maxBulkLength is the largest bulk string that is accepted, same as the
+// default proto-max-bulk-len of Redis.
+const maxBulkLength = 512 << 20
+
+// WriteCommand writes a command as an array of bulk strings.
+func WriteCommand(w *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteValue writes a reply. Its type is one of the ones that are returned
+// by ReadValue, simple strings are written for the SimpleString type and
+// nil is written as a null bulk string.
+func WriteValue(w *bufio.Writer, v interface{}) error {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		_, err = w.WriteString("$-1\r\n")
+	case SimpleString:
+		_, err = fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		_, err = fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		_, err = fmt.Fprintf(w, ":%d\r\n", v)
+	case int:
+		_, err = fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		_, err = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		if _, err = fmt.Fprintf(w, "*%d\r\n", len(v)); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err = WriteValue(w, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported RESP value %T", v)
+	}
+	return err
+}
+
+// SimpleString is a simple string reply, like OK.
+type SimpleString string
+
+// ReadValue reads a reply, whose type is either SimpleString, Error, int64,
+// string for bulk strings, []interface{} for arrays or nil for null bulk
+// strings and arrays.
+func ReadValue(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("empty RESP line")
+	}
+
+	switch line[0] {
+	case '+':
+		return SimpleString(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 || n > maxBulkLength {
+			return nil, fmt.Errorf("invalid RESP bulk string length %q", line[1:])
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("invalid RESP array length %q", line[1:])
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = ReadValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("invalid RESP type %q", line[0])
+	}
+}
+
+// ReadCommand reads a command, which is an array of bulk strings.
+func ReadCommand(r *bufio.Reader) ([]string, error) {
+	v, err := ReadValue(r)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("invalid command %v", v)
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		if args[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("invalid command argument %v", item)
+		}
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("invalid RESP line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
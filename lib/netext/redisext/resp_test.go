@@ -0,0 +1,90 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package redisext
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	t.Parallel()
+	values := []interface{}{
+		nil,
+		SimpleString("OK"),
+		Error("ERR unknown command"),
+		int64(-42),
+		"",
+		"binary\r\n\x00value",
+		[]interface{}{"message", "news", "hello"},
+		[]interface{}{int64(1), []interface{}{"nested", nil}},
+	}
+	for _, v := range values {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		require.NoError(t, WriteValue(w, v))
+		require.NoError(t, w.Flush())
+
+		got, err := ReadValue(bufio.NewReader(&buf))
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+		assert.Zero(t, buf.Len())
+	}
+}
+
+func TestCommandRoundTrip(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	require.NoError(t, WriteCommand(w, []string{"SET", "key", "a value"}))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$7\r\na value\r\n", buf.String())
+
+	args, err := ReadCommand(bufio.NewReader(&buf))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SET", "key", "a value"}, args)
+}
+
+func TestReadValueErrors(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"!3\r\n":       "invalid RESP type",
+		"$nope\r\n":    "invalid RESP bulk string length",
+		"*-2\r\n":      "invalid RESP array length",
+		":1\n":         "invalid RESP line",
+		"\r\n":         "empty RESP line",
+		"$5\r\nab\r\n": "EOF",
+	}
+	for input, expected := range testCases {
+		_, err := ReadValue(bufio.NewReader(strings.NewReader(input)))
+		require.Error(t, err, input)
+		assert.Contains(t, err.Error(), expected, input)
+	}
+
+	_, err := ReadCommand(bufio.NewReader(strings.NewReader(":1\r\n")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid command")
+}
@@ -21,6 +21,7 @@
 package netext
 
 import (
+	"context"
 	"math/rand"
 	"net"
 	"sync"
@@ -29,16 +30,34 @@ import (
 	"go.k6.io/k6/lib/types"
 )
 
+// The resolver names reported for lookups made by the OS resolver and for the
+// ones that were answered from the cache.
+const (
+	SystemResolverName = "system"
+	CacheResolverName  = "cache"
+)
+
 // MultiResolver returns all IP addresses for the given host.
 type MultiResolver func(host string) ([]net.IP, error)
 
+// NamedMultiResolver returns all IP addresses for the given host and the name
+// of the DNS resolver that returned them. The lookup is bound to ctx.
+type NamedMultiResolver func(ctx context.Context, host string) ([]net.IP, string, error)
+
 // Resolver is an interface that returns DNS information about a given host.
 type Resolver interface {
 	LookupIP(host string) (net.IP, error)
 }
 
+// NamedResolver is a Resolver that can also return the name of the DNS
+// resolver that answered.
+type NamedResolver interface {
+	Resolver
+	LookupIPWithResolver(ctx context.Context, host string) (net.IP, string, error)
+}
+
 type resolver struct {
-	resolve     MultiResolver
+	resolve     NamedMultiResolver
 	selectIndex types.DNSSelect
 	policy      types.DNSPolicy
 	rrm         *sync.Mutex
@@ -64,6 +83,17 @@ type cacheResolver struct {
 func NewResolver(
 	actRes MultiResolver, ttl time.Duration, sel types.DNSSelect, pol types.DNSPolicy,
 ) Resolver {
+	return NewNamedResolver(func(_ context.Context, host string) ([]net.IP, string, error) {
+		ips, err := actRes(host)
+		return ips, SystemResolverName, err
+	}, ttl, sel, pol)
+}
+
+// NewNamedResolver is like NewResolver, but the returned Resolver also
+// implements NamedResolver.
+func NewNamedResolver(
+	actRes NamedMultiResolver, ttl time.Duration, sel types.DNSSelect, pol types.DNSPolicy,
+) NamedResolver {
 	r := rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
 	res := resolver{
 		resolve:     actRes,
@@ -87,13 +117,20 @@ func NewResolver(
 // LookupIP returns a single IP resolved for host, selected according to the
 // configured select and policy options.
 func (r *resolver) LookupIP(host string) (net.IP, error) {
-	ips, err := r.resolve(host)
+	ip, _, err := r.LookupIPWithResolver(context.Background(), host)
+	return ip, err
+}
+
+// LookupIPWithResolver is like LookupIP, but also returns the name of the DNS
+// resolver that answered.
+func (r *resolver) LookupIPWithResolver(ctx context.Context, host string) (net.IP, string, error) {
+	ips, name, err := r.resolve(ctx, host)
 	if err != nil {
-		return nil, err
+		return nil, name, err
 	}
 
 	ips = r.applyPolicy(ips)
-	return r.selectOne(host, ips), nil
+	return r.selectOne(host, ips), name, nil
 }
 
 // LookupIP returns a single IP resolved for host, selected according to the
@@ -101,18 +138,26 @@ func (r *resolver) LookupIP(host string) (net.IP, error) {
 // refreshed if the last lookup time exceeds the configured TTL (not the TTL
 // returned in the DNS record).
 func (r *cacheResolver) LookupIP(host string) (net.IP, error) {
+	ip, _, err := r.LookupIPWithResolver(context.Background(), host)
+	return ip, err
+}
+
+// LookupIPWithResolver is like LookupIP, but also returns the name of the DNS
+// resolver that answered, or CacheResolverName if it was a cached result.
+func (r *cacheResolver) LookupIPWithResolver(ctx context.Context, host string) (net.IP, string, error) {
 	r.cm.Lock()
 
 	var ips []net.IP
+	name := CacheResolverName
 	// TODO: Invalidate? When?
 	if cr, ok := r.cache[host]; ok && time.Now().Before(cr.lastLookup.Add(r.ttl)) {
 		ips = cr.ips
 	} else {
 		r.cm.Unlock() // The lookup could take some time, so unlock momentarily.
 		var err error
-		ips, err = r.resolve(host)
+		ips, name, err = r.resolve(ctx, host)
 		if err != nil {
-			return nil, err
+			return nil, name, err
 		}
 		ips = r.applyPolicy(ips)
 		r.cm.Lock()
@@ -121,7 +166,7 @@ func (r *cacheResolver) LookupIP(host string) (net.IP, error) {
 
 	r.cm.Unlock()
 
-	return r.selectOne(host, ips), nil
+	return r.selectOne(host, ips), name, nil
 }
 
 func (r *resolver) selectOne(host string, ips []net.IP) net.IP {
@@ -21,6 +21,7 @@
 package netext
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"testing"
@@ -114,3 +115,43 @@ func TestResolver(t *testing.T) {
 		}
 	})
 }
+
+func TestNamedResolver(t *testing.T) {
+	t.Parallel()
+
+	var lookups int
+	lookup := func(_ context.Context, host string) ([]net.IP, string, error) {
+		lookups++
+		if host == "missing" {
+			return nil, "udp://10.0.0.53:53", fmt.Errorf("lookup %s: no such host", host)
+		}
+		return []net.IP{net.ParseIP("2001:db8::10"), net.ParseIP("127.0.0.10")}, "udp://10.0.0.53:53", nil
+	}
+
+	r := NewNamedResolver(lookup, 0, types.DNSfirst, types.DNSpreferIPv4)
+	ip, name, err := r.LookupIPWithResolver(context.Background(), "myhost")
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("127.0.0.10"), ip)
+	assert.Equal(t, "udp://10.0.0.53:53", name)
+	_, name, err = r.LookupIPWithResolver(context.Background(), "missing")
+	require.EqualError(t, err, "lookup missing: no such host")
+	assert.Equal(t, "udp://10.0.0.53:53", name)
+
+	r = NewNamedResolver(lookup, time.Minute, types.DNSfirst, types.DNSpreferIPv4)
+	lookups = 0
+	for _, expName := range []string{"udp://10.0.0.53:53", CacheResolverName, CacheResolverName} {
+		ip, name, err = r.LookupIPWithResolver(context.Background(), "myhost")
+		require.NoError(t, err)
+		assert.Equal(t, net.ParseIP("127.0.0.10"), ip)
+		assert.Equal(t, expName, name)
+	}
+	assert.Equal(t, 1, lookups)
+
+	system, ok := NewResolver(func(string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("127.0.0.10")}, nil
+	}, 0, types.DNSfirst, types.DNSpreferIPv4).(NamedResolver)
+	require.True(t, ok)
+	_, name, err = system.LookupIPWithResolver(context.Background(), "myhost")
+	require.NoError(t, err)
+	assert.Equal(t, SystemResolverName, name)
+}
@@ -308,6 +308,9 @@ type Options struct {
 	// DNS handling configuration.
 	DNS types.DNSConfig `json:"dns" envconfig:"K6_DNS"`
 
+	// Emulated network conditions, e.g. bandwidth, latency and packet loss.
+	Network types.NetworkConditions `json:"network" envconfig:"K6_NETWORK"`
+
 	// How many HTTP redirects do we follow?
 	MaxRedirects null.Int `json:"maxRedirects" envconfig:"K6_MAX_REDIRECTS"`
 
@@ -552,6 +555,12 @@ func (o Options) Apply(opts Options) Options {
 	if opts.DNS.Policy.Valid {
 		o.DNS.Policy = opts.DNS.Policy
 	}
+	if opts.DNS.Servers != nil {
+		o.DNS.Servers = opts.DNS.Servers
+	}
+	if opts.Network.IsSet() {
+		o.Network = o.Network.Apply(opts.Network)
+	}
 
 	return o
 }
@@ -592,8 +601,9 @@ func (o Options) ForEachSpecified(structTag string, callback func(key string, va
 		shouldCall := false
 		switch fieldType.Type.Kind() {
 		case reflect.Struct:
-			// Unpack any guregu/null values
-			shouldCall = fieldVal.FieldByName("Valid").Bool()
+			// Unpack any guregu/null values, the other structs are skipped
+			valid := fieldVal.FieldByName("Valid")
+			shouldCall = valid.IsValid() && valid.Bool()
 			valOrZero := fieldVal.MethodByName("ValueOrZero")
 			if shouldCall && valOrZero.IsValid() {
 				value = valOrZero.Call([]reflect.Value{})[0].Interface()
@@ -25,6 +25,7 @@ import (
 	"io"
 	"time"
 
+	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/stats"
 )
 
@@ -56,6 +57,7 @@ type VUActivationParams struct {
 	Env, Tags                map[string]string
 	Exec, Scenario           string
 	GetNextIterationCounters func() (uint64, uint64)
+	Network                  types.NetworkConditions
 }
 
 // A Runner is a factory for VUs. It should precompute as much as possible upon
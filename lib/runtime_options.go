@@ -55,6 +55,14 @@ type RuntimeOptions struct {
 	// Environment variables passed onto the runner
 	Env map[string]string `json:"env"`
 
+	// The import map that maps the module specifiers of the imports
+	ImportMap null.String `json:"importMap"`
+
+	// The directory of the cache of the remote modules, and whether they are
+	// only loaded from it
+	ModuleCache null.String `json:"moduleCache"`
+	Offline     null.Bool   `json:"offline"`
+
 	NoThresholds  null.Bool   `json:"noThresholds"`
 	NoSummary     null.Bool   `json:"noSummary"`
 	SummaryExport null.String `json:"summaryExport"`
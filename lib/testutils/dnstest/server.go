@@ -0,0 +1,238 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package dnstest contains an in-process authoritative DNS server for tests,
+// which answers queries over UDP, TCP, TLS and HTTPS.
+package dnstest
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type recordKey struct {
+	name  string
+	rtype dnsmessage.Type
+}
+
+// Server is a DNS server that answers with the records that were added to it
+// and with NXDOMAIN for any names it doesn't know.
+type Server struct {
+	// Addr is the address of the server for both UDP and TCP.
+	Addr string
+	// Queries is the number of queries the server has answered.
+	Queries int64
+
+	mu          sync.RWMutex
+	records     map[recordKey][]dnsmessage.ResourceBody
+	truncateUDP bool
+}
+
+// NewServer starts a new DNS server on a random local port, which is stopped
+// at the end of the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{records: make(map[recordKey][]dnsmessage.ResourceBody)}
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	udpConn, err := net.ListenPacket("udp", tcpListener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = tcpListener.Close()
+		_ = udpConn.Close()
+	})
+	s.Addr = tcpListener.Addr().String()
+
+	go s.serveUDP(udpConn)
+	go s.serveStream(tcpListener)
+	return s
+}
+
+// AddRecord adds a record with the given name and type.
+func (s *Server) AddRecord(name string, rtype dnsmessage.Type, body dnsmessage.ResourceBody) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := recordKey{name: canonicalName(name), rtype: rtype}
+	s.records[key] = append(s.records[key], body)
+}
+
+// AddIP adds an A or AAAA record, depending on the IP version.
+func (s *Server) AddIP(name string, ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		var a [4]byte
+		copy(a[:], ip4)
+		s.AddRecord(name, dnsmessage.TypeA, &dnsmessage.AResource{A: a})
+		return
+	}
+	var aaaa [16]byte
+	copy(aaaa[:], ip.To16())
+	s.AddRecord(name, dnsmessage.TypeAAAA, &dnsmessage.AAAAResource{AAAA: aaaa})
+}
+
+// SetTruncateUDP makes all UDP responses truncated, so clients retry over TCP.
+func (s *Server) SetTruncateUDP(truncate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncateUDP = truncate
+}
+
+// ServeTLS starts a DNS-over-TLS listener with the given configuration and
+// returns its address.
+func (s *Server) ServeTLS(t testing.TB, config *tls.Config) string {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go s.serveStream(l)
+	return l.Addr().String()
+}
+
+// ServeHTTP implements http.Handler for DNS-over-HTTPS POST requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+		http.Error(w, "unsupported DNS request", http.StatusBadRequest)
+		return
+	}
+	query, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response, ok := s.answer(query, false)
+	if !ok {
+		http.Error(w, "invalid DNS message", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/dns-message")
+	_, _ = w.Write(response)
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.mu.RLock()
+		truncate := s.truncateUDP
+		s.mu.RUnlock()
+		if response, ok := s.answer(buf[:n], truncate); ok {
+			_, _ = conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func (s *Server) serveStream(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			for {
+				var length uint16
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				response, ok := s.answer(query, false)
+				if !ok {
+					return
+				}
+				msg := make([]byte, 2+len(response))
+				binary.BigEndian.PutUint16(msg, uint16(len(response)))
+				copy(msg[2:], response)
+				if _, err := conn.Write(msg); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) answer(query []byte, truncate bool) ([]byte, bool) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil, false
+	}
+	atomic.AddInt64(&s.Queries, 1)
+
+	q := msg.Questions[0]
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 msg.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   msg.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: msg.Questions,
+	}
+	if truncate {
+		response.Truncated = true
+	} else {
+		s.mu.RLock()
+		name := canonicalName(q.Name.String())
+		bodies := s.records[recordKey{name: name, rtype: q.Type}]
+		known := len(bodies) > 0
+		for key := range s.records {
+			known = known || key.name == name
+		}
+		s.mu.RUnlock()
+
+		if !known {
+			response.RCode = dnsmessage.RCodeNameError
+		}
+		for _, body := range bodies {
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   body,
+			})
+		}
+	}
+
+	packed, err := response.Pack()
+	return packed, err == nil
+}
+
+func canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
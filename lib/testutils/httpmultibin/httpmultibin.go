@@ -145,6 +145,36 @@ func getWebsocketHandler(echo bool, closePrematurely bool) http.Handler {
 	})
 }
 
+// getSSEHandler returns a handler that serves a short event stream and closes
+// it, and resumes the stream once the client reconnects with a Last-Event-ID.
+func getSSEHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		lastEventID := req.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			_, _ = io.WriteString(w, "retry: 50\n\n"+
+				"id: 1\nevent: greeting\ndata: hello\n\n"+
+				": a comment\n"+
+				"id: 2\ndata: line1\ndata: line2\n\n")
+			flusher.Flush()
+			// close the stream, so the client has to reconnect
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "id: 3\ndata: resumed after %s\n\n", lastEventID)
+		flusher.Flush()
+		<-req.Context().Done()
+	})
+}
+
 func writeJSON(w io.Writer, v interface{}) error {
 	e := json.NewEncoder(w)
 	e.SetIndent("", "  ")
@@ -262,6 +292,7 @@ func NewHTTPMultiBin(t testing.TB) *HTTPMultiBin {
 	mux.Handle("/ws-echo-invalid", getWebsocketHandler(true, true))
 	mux.Handle("/ws-close", getWebsocketHandler(false, false))
 	mux.Handle("/ws-close-invalid", getWebsocketHandler(false, true))
+	mux.Handle("/sse", getSSEHandler())
 	mux.Handle("/zstd", getEncodedHandler(t, "zstd"))
 	mux.Handle("/zstd-br", getZstdBrHandler(t))
 	mux.Handle("/", httpbin.New().Handler())
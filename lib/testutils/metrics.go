@@ -0,0 +1,46 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package testutils
+
+import "go.k6.io/k6/stats"
+
+// CountMetric returns the number of samples of the metric that have all of the
+// tags, a nil map matches all of them.
+func CountMetric(sampleContainers []stats.SampleContainer, metricName string, tags map[string]string) int {
+	count := 0
+	for _, sampleContainer := range sampleContainers {
+		for _, sample := range sampleContainer.GetSamples() {
+			if sample.Metric.Name != metricName {
+				continue
+			}
+			matches := true
+			for k, v := range tags {
+				if got, _ := sample.Tags.Get(k); got != v {
+					matches = false
+				}
+			}
+			if matches {
+				count++
+			}
+		}
+	}
+	return count
+}
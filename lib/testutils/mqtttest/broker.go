@@ -0,0 +1,383 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package mqtttest contains an in-process MQTT 3.1.1 and 5 broker for tests.
+// It routes messages with all QoS levels, keeps retained messages and
+// publishes the will messages of clients that disconnect abnormally, but it
+// doesn't persist sessions.
+package mqtttest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib/netext/mqttext"
+)
+
+// Broker is an MQTT broker that listens on a random local port.
+type Broker struct {
+	// Addr is the host:port address of the broker.
+	Addr string
+
+	mu       sync.Mutex
+	users    map[string]string
+	clients  map[*client]struct{}
+	retained map[string]mqttext.Message
+	nextID   int
+}
+
+type client struct {
+	conn    net.Conn
+	version byte
+	id      string
+
+	writeMu sync.Mutex
+	// only accessed with the lock of the broker
+	subscriptions map[string]byte
+	nextID        uint16
+}
+
+// NewBroker starts a new broker, which is stopped at the end of the test.
+func NewBroker(t testing.TB) *Broker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return startBroker(t, listener)
+}
+
+// NewTLSBroker starts a new broker that only accepts TLS connections.
+func NewTLSBroker(t testing.TB, config *tls.Config) *Broker {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	return startBroker(t, listener)
+}
+
+func startBroker(t testing.TB, listener net.Listener) *Broker {
+	b := &Broker{
+		Addr:     listener.Addr().String(),
+		clients:  make(map[*client]struct{}),
+		retained: make(map[string]mqttext.Message),
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for c := range b.clients {
+			_ = c.conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+// AddUser makes the broker require a username and password from clients.
+func (b *Broker) AddUser(username, password string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.users == nil {
+		b.users = make(map[string]string)
+	}
+	b.users[username] = password
+}
+
+// Publish publishes a message to the subscribers, as if a client did.
+func (b *Broker) Publish(msg mqttext.Message) {
+	b.route(msg)
+}
+
+// Clients returns the number of connected clients.
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+//nolint:funlen,cyclop
+func (b *Broker) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	packet, err := mqttext.ReadPacket(r, 0)
+	if err != nil {
+		return
+	}
+	connect, ok := packet.(*mqttext.Connect)
+	if !ok {
+		return
+	}
+
+	c := &client{conn: conn, version: connect.Version, id: connect.ClientID, subscriptions: make(map[string]byte)}
+	connack := &mqttext.Connack{}
+	if !b.authorized(connect) {
+		connack.ReasonCode = mqttext.ReasonNotAuthorized
+		if c.version == mqttext.Version311 {
+			connack.ReasonCode = 5 // not authorized
+		}
+		_ = c.write(connack)
+		return
+	}
+	if c.id == "" {
+		b.mu.Lock()
+		b.nextID++
+		c.id = fmt.Sprintf("mqtttest-%d", b.nextID)
+		b.mu.Unlock()
+		connack.Properties.AssignedClientID = c.id
+	}
+	if c.write(connack) != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+	will := connect.Will
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		if will != nil {
+			b.route(*will)
+		}
+	}()
+
+	// the QoS 2 messages that were received, but not released yet
+	received := make(map[uint16]mqttext.Message)
+	for {
+		packet, err := mqttext.ReadPacket(r, c.version)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *mqttext.Publish:
+			switch p.QoS {
+			case 0:
+				b.route(p.Message)
+			case 1:
+				b.route(p.Message)
+				err = c.write(&mqttext.Ack{Type: mqttext.TypePuback, PacketID: p.PacketID})
+			default:
+				received[p.PacketID] = p.Message
+				err = c.write(&mqttext.Ack{Type: mqttext.TypePubrec, PacketID: p.PacketID})
+			}
+		case *mqttext.Ack:
+			switch p.Type {
+			case mqttext.TypePubrel:
+				code := mqttext.ReasonPacketIDNotFound
+				if msg, ok := received[p.PacketID]; ok {
+					delete(received, p.PacketID)
+					b.route(msg)
+					code = mqttext.ReasonSuccess
+				}
+				err = c.write(&mqttext.Ack{Type: mqttext.TypePubcomp, PacketID: p.PacketID, ReasonCode: code})
+			case mqttext.TypePubrec:
+				err = c.write(&mqttext.Ack{Type: mqttext.TypePubrel, PacketID: p.PacketID})
+			}
+		case *mqttext.Subscribe:
+			err = b.subscribe(c, p)
+		case *mqttext.Unsubscribe:
+			err = b.unsubscribe(c, p)
+		case *mqttext.Pingreq:
+			err = c.write(&mqttext.Pingresp{})
+		case *mqttext.Disconnect:
+			if p.ReasonCode != mqttext.ReasonDisconnectWithWill {
+				will = nil
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *Broker) authorized(connect *mqttext.Connect) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.users == nil {
+		return true
+	}
+	password, ok := b.users[connect.Username]
+	return ok && password == connect.Password
+}
+
+func (b *Broker) subscribe(c *client, p *mqttext.Subscribe) error {
+	suback := &mqttext.Suback{PacketID: p.PacketID}
+	var retained []mqttext.Message
+	b.mu.Lock()
+	for _, s := range p.Subscriptions {
+		if !validFilter(s.Filter) || s.QoS > 2 {
+			suback.ReasonCodes = append(suback.ReasonCodes, mqttext.ReasonUnspecifiedError)
+			continue
+		}
+		c.subscriptions[s.Filter] = s.QoS
+		suback.ReasonCodes = append(suback.ReasonCodes, s.QoS)
+		for topic, msg := range b.retained {
+			if matches(s.Filter, topic) {
+				msg.QoS = minQoS(msg.QoS, s.QoS)
+				retained = append(retained, msg)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	if err := c.write(suback); err != nil {
+		return err
+	}
+	for _, msg := range retained {
+		if err := b.deliver(c, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Broker) unsubscribe(c *client, p *mqttext.Unsubscribe) error {
+	unsuback := &mqttext.Unsuback{PacketID: p.PacketID}
+	b.mu.Lock()
+	for _, filter := range p.Filters {
+		code := mqttext.ReasonSuccess
+		if _, ok := c.subscriptions[filter]; !ok {
+			code = mqttext.ReasonNoSubscriptionExisted
+		}
+		delete(c.subscriptions, filter)
+		unsuback.ReasonCodes = append(unsuback.ReasonCodes, code)
+	}
+	b.mu.Unlock()
+	return c.write(unsuback)
+}
+
+// route sends the message to all of the matching subscriptions and keeps it
+// if it's retained. Messages are sent with the maximum QoS of the matching
+// subscriptions of each client.
+func (b *Broker) route(msg mqttext.Message) {
+	type delivery struct {
+		c   *client
+		msg mqttext.Message
+	}
+	var deliveries []delivery
+	b.mu.Lock()
+	if msg.Retain {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+	}
+	for c := range b.clients {
+		qos, matched := byte(0), false
+		for filter, subQoS := range c.subscriptions {
+			if matches(filter, msg.Topic) {
+				matched = true
+				if subQoS > qos {
+					qos = subQoS
+				}
+			}
+		}
+		if matched {
+			// the retain flag is only kept for messages that are sent
+			// because of a new subscription
+			deliveries = append(deliveries, delivery{c, mqttext.Message{
+				Topic: msg.Topic, Payload: msg.Payload, QoS: minQoS(msg.QoS, qos),
+			}})
+		}
+	}
+	b.mu.Unlock()
+
+	for _, d := range deliveries {
+		_ = b.deliver(d.c, d.msg)
+	}
+}
+
+func (b *Broker) deliver(c *client, msg mqttext.Message) error {
+	p := &mqttext.Publish{Message: msg}
+	if msg.QoS > 0 {
+		b.mu.Lock()
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID++
+		}
+		p.PacketID = c.nextID
+		b.mu.Unlock()
+	}
+	return c.write(p)
+}
+
+func (c *client) write(p mqttext.Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return mqttext.WritePacket(c.conn, c.version, p)
+}
+
+func minQoS(a, b byte) byte {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func validFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if level == "#" && i != len(levels)-1 {
+			return false
+		}
+		if level != "#" && level != "+" && strings.ContainsAny(level, "#+") {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns whether the topic matches the filter, with the + and #
+// wildcards for one and any number of levels.
+func matches(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	// wildcards at the first level don't match topics starting with $
+	if strings.HasPrefix(topic, "$") && (filterLevels[0] == "#" || filterLevels[0] == "+") {
+		return false
+	}
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
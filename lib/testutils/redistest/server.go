@@ -0,0 +1,609 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package redistest contains an in-process stand-in for a Redis server for
+// tests. It supports the commands for strings, counters, hashes, lists and
+// pub/sub that the k6/redis module has helpers for, with 16 databases and
+// optional password authentication, but without persistence.
+package redistest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib/netext/redisext"
+)
+
+const (
+	errWrongType = redisext.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = redisext.Error("ERR value is not an integer or out of range")
+	errSyntax    = redisext.Error("ERR syntax error")
+	errNoAuth    = redisext.Error("NOAUTH Authentication required.")
+	replyOK      = redisext.SimpleString("OK")
+	databases    = 16
+)
+
+// Server is a Redis server that listens on a random local port.
+type Server struct {
+	// Addr is the host:port address of the server.
+	Addr string
+
+	mu       sync.Mutex
+	password string
+	dbs      [databases]map[string]*entry
+	subs     map[*client]struct{}
+	// commands is the number of commands that were received.
+	commands int
+	// conns is the number of accepted connections.
+	conns int
+}
+
+type entry struct {
+	value   interface{} // string, map[string]string or []string
+	expires time.Time
+}
+
+type client struct {
+	conn    net.Conn
+	w       *bufio.Writer
+	writeMu sync.Mutex
+	db      int
+	authed  bool
+	// channels and patterns are only accessed with the lock of the server
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// NewServer starts a new server, which is stopped at the end of the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return startServer(t, listener)
+}
+
+// NewTLSServer starts a new server that only accepts TLS connections.
+func NewTLSServer(t testing.TB, config *tls.Config) *Server {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	return startServer(t, listener)
+}
+
+func startServer(t testing.TB, listener net.Listener) *Server {
+	s := &Server{Addr: listener.Addr().String(), subs: make(map[*client]struct{})}
+	for i := range s.dbs {
+		s.dbs[i] = make(map[string]*entry)
+	}
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsMu sync.Mutex
+	t.Cleanup(func() {
+		_ = listener.Close()
+		connsMu.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		connsMu.Unlock()
+		wg.Wait()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connsMu.Lock()
+			conns[conn] = struct{}{}
+			connsMu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+				connsMu.Lock()
+				delete(conns, conn)
+				connsMu.Unlock()
+			}()
+		}
+	}()
+	return s
+}
+
+// SetPassword makes the server require the password with AUTH.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// Stats returns the number of accepted connections and received commands.
+func (s *Server) Stats() (conns, commands int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns, s.commands
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	c := &client{
+		conn:     conn,
+		w:        bufio.NewWriter(conn),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	s.mu.Lock()
+	s.conns++
+	c.authed = s.password == ""
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, c)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		args, err := redisext.ReadCommand(r)
+		if err != nil {
+			return
+		}
+		// pub/sub replies are written by the command, and a pipeline is
+		// flushed once all of its commands were read
+		if reply, ok := s.handle(c, args); ok {
+			c.writeMu.Lock()
+			err = redisext.WriteValue(c.w, reply)
+			c.writeMu.Unlock()
+		}
+		if err == nil && r.Buffered() == 0 {
+			err = c.flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *client) write(v interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = redisext.WriteValue(c.w, v)
+}
+
+func (c *client) flush() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.w.Flush()
+}
+
+// handle runs the command and returns its reply, unless the command writes
+// its replies itself.
+//
+//nolint:funlen,cyclop
+func (s *Server) handle(c *client, args []string) (interface{}, bool) {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands++
+
+	if name == "AUTH" {
+		switch {
+		case len(args) == 0 || len(args) > 2:
+			return redisext.Error("ERR wrong number of arguments for 'auth' command"), true
+		case s.password == "":
+			return redisext.Error("ERR AUTH <password> called without any password configured"), true
+		case args[len(args)-1] != s.password:
+			return redisext.Error("WRONGPASS invalid username-password pair or user is disabled."), true
+		}
+		c.authed = true
+		return replyOK, true
+	}
+	if !c.authed {
+		return errNoAuth, true
+	}
+
+	arity, known := arities[name]
+	if !known {
+		return redisext.Error("ERR unknown command '" + strings.ToLower(name) + "'"), true
+	}
+	if len(args) < arity {
+		return redisext.Error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command"), true
+	}
+
+	db := s.dbs[c.db]
+	switch name {
+	case "PING":
+		if len(args) > 0 {
+			return args[0], true
+		}
+		return redisext.SimpleString("PONG"), true
+	case "ECHO":
+		return args[0], true
+	case "SELECT":
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 || n >= databases {
+			return redisext.Error("ERR DB index is out of range"), true
+		}
+		c.db = n
+		return replyOK, true
+	case "FLUSHALL":
+		for i := range s.dbs {
+			s.dbs[i] = make(map[string]*entry)
+		}
+		return replyOK, true
+	case "GET":
+		v, err := getString(db, args[0])
+		if err != nil {
+			return err, true
+		}
+		if v == nil {
+			return nil, true
+		}
+		return *v, true
+	case "SET":
+		return set(db, args), true
+	case "DEL":
+		var n int64
+		for _, key := range args {
+			if lookup(db, key) != nil {
+				delete(db, key)
+				n++
+			}
+		}
+		return n, true
+	case "EXISTS":
+		var n int64
+		for _, key := range args {
+			if lookup(db, key) != nil {
+				n++
+			}
+		}
+		return n, true
+	case "EXPIRE":
+		seconds, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt, true
+		}
+		e := lookup(db, args[0])
+		if e == nil {
+			return int64(0), true
+		}
+		e.expires = time.Now().Add(time.Duration(seconds) * time.Second)
+		return int64(1), true
+	case "TTL":
+		e := lookup(db, args[0])
+		switch {
+		case e == nil:
+			return int64(-2), true
+		case e.expires.IsZero():
+			return int64(-1), true
+		default:
+			return int64((time.Until(e.expires) + time.Second/2) / time.Second), true
+		}
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		by := int64(1)
+		if len(args) > 1 {
+			var err error
+			if by, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return errNotInt, true
+			}
+		}
+		if strings.HasPrefix(name, "DECR") {
+			by = -by
+		}
+		return incr(db, args[0], by), true
+	case "HSET":
+		if len(args)%2 != 1 {
+			return redisext.Error("ERR wrong number of arguments for 'hset' command"), true
+		}
+		h, err := getHash(db, args[0], true)
+		if err != nil {
+			return err, true
+		}
+		var n int64
+		for i := 1; i < len(args); i += 2 {
+			if _, exists := h[args[i]]; !exists {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return n, true
+	case "HGET":
+		h, err := getHash(db, args[0], false)
+		if err != nil {
+			return err, true
+		}
+		if v, exists := h[args[1]]; exists {
+			return v, true
+		}
+		return nil, true
+	case "HGETALL":
+		h, err := getHash(db, args[0], false)
+		if err != nil {
+			return err, true
+		}
+		items := make([]interface{}, 0, len(h)*2)
+		for k, v := range h {
+			items = append(items, k, v)
+		}
+		return items, true
+	case "HDEL":
+		h, err := getHash(db, args[0], false)
+		if err != nil {
+			return err, true
+		}
+		var n int64
+		for _, field := range args[1:] {
+			if _, exists := h[field]; exists {
+				delete(h, field)
+				n++
+			}
+		}
+		if len(h) == 0 {
+			delete(db, args[0])
+		}
+		return n, true
+	case "LPUSH", "RPUSH":
+		return push(db, args[0], args[1:], name == "LPUSH"), true
+	case "LPOP", "RPOP":
+		return pop(db, args[0], name == "LPOP"), true
+	case "LLEN":
+		l, err := getList(db, args[0])
+		if err != nil {
+			return err, true
+		}
+		return int64(len(l)), true
+	case "LRANGE":
+		return lrange(db, args), true
+	case "PUBLISH":
+		return s.publish(args[0], args[1]), true
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		subscriptions := c.channels
+		kind := "subscribe"
+		if name == "PSUBSCRIBE" {
+			subscriptions, kind = c.patterns, "psubscribe"
+		}
+		for _, channel := range args {
+			subscriptions[channel] = struct{}{}
+			c.write([]interface{}{kind, channel, int64(len(c.channels) + len(c.patterns))})
+		}
+		s.subs[c] = struct{}{}
+		return nil, false
+	}
+	return redisext.Error("ERR unknown command '" + strings.ToLower(name) + "'"), true
+}
+
+// arities are the minimum numbers of arguments of the commands.
+//
+//nolint:gochecknoglobals
+var arities = map[string]int{
+	"PING": 0, "ECHO": 1, "SELECT": 1, "FLUSHALL": 0,
+	"GET": 1, "SET": 2, "DEL": 1, "EXISTS": 1, "EXPIRE": 2, "TTL": 1,
+	"INCR": 1, "DECR": 1, "INCRBY": 2, "DECRBY": 2,
+	"HSET": 3, "HGET": 2, "HGETALL": 1, "HDEL": 2,
+	"LPUSH": 2, "RPUSH": 2, "LPOP": 1, "RPOP": 1, "LLEN": 1, "LRANGE": 3,
+	"PUBLISH": 2, "SUBSCRIBE": 1, "PSUBSCRIBE": 1,
+}
+
+// lookup returns the entry of the key, unless it expired.
+func lookup(db map[string]*entry, key string) *entry {
+	e := db[key]
+	if e != nil && !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(db, key)
+		return nil
+	}
+	return e
+}
+
+func getString(db map[string]*entry, key string) (*string, error) {
+	e := lookup(db, key)
+	if e == nil {
+		return nil, nil //nolint:nilnil
+	}
+	v, isString := e.value.(string)
+	if !isString {
+		return nil, errWrongType
+	}
+	return &v, nil
+}
+
+func getHash(db map[string]*entry, key string, create bool) (map[string]string, error) {
+	e := lookup(db, key)
+	if e == nil {
+		h := make(map[string]string)
+		if create {
+			db[key] = &entry{value: h}
+		}
+		return h, nil
+	}
+	h, isHash := e.value.(map[string]string)
+	if !isHash {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func getList(db map[string]*entry, key string) ([]string, error) {
+	e := lookup(db, key)
+	if e == nil {
+		return nil, nil
+	}
+	l, isList := e.value.([]string)
+	if !isList {
+		return nil, errWrongType
+	}
+	return l, nil
+}
+
+// set implements SET with the EX, PX, NX and XX options.
+func set(db map[string]*entry, args []string) interface{} {
+	e := &entry{value: args[1]}
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return redisext.Error("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			e.expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	exists := lookup(db, args[0]) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	db[args[0]] = e
+	return replyOK
+}
+
+func incr(db map[string]*entry, key string, by int64) interface{} {
+	v, err := getString(db, key)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v != nil {
+		if n, err = strconv.ParseInt(*v, 10, 64); err != nil {
+			return errNotInt
+		}
+	}
+	n += by
+	if e := lookup(db, key); e != nil {
+		e.value = strconv.FormatInt(n, 10)
+	} else {
+		db[key] = &entry{value: strconv.FormatInt(n, 10)}
+	}
+	return n
+}
+
+func push(db map[string]*entry, key string, values []string, left bool) interface{} {
+	l, err := getList(db, key)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if left {
+			l = append([]string{v}, l...)
+		} else {
+			l = append(l, v)
+		}
+	}
+	if e := lookup(db, key); e != nil {
+		e.value = l
+	} else {
+		db[key] = &entry{value: l}
+	}
+	return int64(len(l))
+}
+
+func pop(db map[string]*entry, key string, left bool) interface{} {
+	l, err := getList(db, key)
+	if err != nil {
+		return err
+	}
+	if len(l) == 0 {
+		return nil
+	}
+	var v string
+	if left {
+		v, l = l[0], l[1:]
+	} else {
+		v, l = l[len(l)-1], l[:len(l)-1]
+	}
+	if len(l) == 0 {
+		delete(db, key)
+	} else {
+		db[key].value = l
+	}
+	return v
+}
+
+func lrange(db map[string]*entry, args []string) interface{} {
+	l, err := getList(db, args[0])
+	if err != nil {
+		return err
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return errNotInt
+	}
+	// negative indexes are from the end of the list
+	if start < 0 {
+		start += len(l)
+	}
+	if stop < 0 {
+		stop += len(l)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(l) {
+		stop = len(l) - 1
+	}
+	items := []interface{}{}
+	for i := start; i <= stop; i++ {
+		items = append(items, l[i])
+	}
+	return items
+}
+
+// publish sends the message to the subscribers and returns their number.
+func (s *Server) publish(channel, message string) int64 {
+	var n int64
+	for c := range s.subs {
+		if _, subscribed := c.channels[channel]; subscribed {
+			c.write([]interface{}{"message", channel, message})
+			n++
+		}
+		for pattern := range c.patterns {
+			if matched, _ := path.Match(pattern, channel); matched {
+				c.write([]interface{}{"pmessage", pattern, channel, message})
+				n++
+			}
+		}
+		_ = c.flush()
+	}
+	return n
+}
@@ -37,6 +37,10 @@ type DNSConfig struct {
 	Select NullDNSSelect `json:"select"`
 	// Policy specifies how to handle returning of IPv4 or IPv6 addresses.
 	Policy NullDNSPolicy `json:"policy"`
+	// Servers are queried in order instead of using the OS resolver. They can
+	// be `host:port` for UDP, `tcp://host:port`, `tls://host:port` for
+	// DNS-over-TLS or an `https://` URL for DNS-over-HTTPS.
+	Servers []string `json:"servers"`
 	// FIXME: Valid is unused and is only added to satisfy some logic in
 	// lib.Options.ForEachSpecified(), otherwise it would panic with
 	// `reflect: call of reflect.Value.Bool on zero Value`.
@@ -187,16 +191,21 @@ func (d NullDNSSelect) MarshalJSON() ([]byte, error) {
 
 // String implements fmt.Stringer.
 func (c DNSConfig) String() string {
-	return fmt.Sprintf("ttl=%s,select=%s,policy=%s",
+	s := fmt.Sprintf("ttl=%s,select=%s,policy=%s",
 		c.TTL.String, c.Select.String(), c.Policy.String())
+	if len(c.Servers) > 0 {
+		s += ",servers=" + strings.Join(c.Servers, ";")
+	}
+	return s
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
 func (c *DNSConfig) UnmarshalJSON(data []byte) error {
 	var s struct {
-		TTL    null.String   `json:"ttl"`
-		Select NullDNSSelect `json:"select"`
-		Policy NullDNSPolicy `json:"policy"`
+		TTL     null.String   `json:"ttl"`
+		Select  NullDNSSelect `json:"select"`
+		Policy  NullDNSPolicy `json:"policy"`
+		Servers []string      `json:"servers"`
 	}
 	if err := json.Unmarshal(data, &s); err != nil {
 		return err
@@ -204,6 +213,7 @@ func (c *DNSConfig) UnmarshalJSON(data []byte) error {
 	c.TTL = s.TTL
 	c.Select = s.Select
 	c.Policy = s.Policy
+	c.Servers = s.Servers
 	return nil
 }
 
@@ -244,6 +254,14 @@ func (c *DNSConfig) unmarshal(params map[string]string) error {
 			c.Select.Valid = true
 		case "ttl":
 			c.TTL = null.StringFrom(v)
+		case "servers":
+			// servers are separated with semicolons, since commas separate the fields
+			c.Servers = nil
+			for _, server := range strings.Split(v, ";") {
+				if server = strings.TrimSpace(server); server != "" {
+					c.Servers = append(c.Servers, server)
+				}
+			}
 		default:
 			return fmt.Errorf("unknown DNS configuration field: %s", k)
 		}
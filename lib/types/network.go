@@ -0,0 +1,294 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// NetworkConditions describes the emulated network conditions that are
+// applied to the connections created by a VU.
+type NetworkConditions struct {
+	// Preset is the name of one of the predefined network profiles. Any other
+	// specified field takes precedence over the preset values.
+	Preset null.String `json:"preset"`
+	// Latency is added once per round trip, i.e. to the connection setup and
+	// to the first read after a write.
+	Latency NullDuration `json:"latency"`
+	// Jitter randomly varies every added latency by up to +/- its value.
+	Jitter NullDuration `json:"jitter"`
+	// Download and Upload are the bandwidth limits in kbit/s.
+	Download null.Int `json:"download"`
+	Upload   null.Int `json:"upload"`
+	// PacketLoss is the percentage of lost packets. Lost TCP segments are
+	// delayed by a retransmission timeout, lost UDP datagrams are dropped.
+	PacketLoss null.Float `json:"packetLoss"`
+}
+
+//nolint:gochecknoglobals
+var networkPresets = map[string]NetworkConditions{
+	"3g": {
+		Latency:  NewNullDuration(300*time.Millisecond, true),
+		Jitter:   NewNullDuration(30*time.Millisecond, true),
+		Download: null.IntFrom(1600),
+		Upload:   null.IntFrom(768),
+	},
+	"4g": {
+		Latency:  NewNullDuration(50*time.Millisecond, true),
+		Jitter:   NewNullDuration(10*time.Millisecond, true),
+		Download: null.IntFrom(20000),
+		Upload:   null.IntFrom(10000),
+	},
+	"dsl": {
+		Latency:  NewNullDuration(25*time.Millisecond, true),
+		Jitter:   NewNullDuration(5*time.Millisecond, true),
+		Download: null.IntFrom(8000),
+		Upload:   null.IntFrom(1000),
+	},
+}
+
+// NetworkPresets returns the sorted names of the predefined network profiles.
+func NetworkPresets() []string {
+	names := make([]string, 0, len(networkPresets))
+	for name := range networkPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsSet returns true if any of the fields were specified.
+func (c NetworkConditions) IsSet() bool {
+	return c.Preset.Valid || c.Latency.Valid || c.Jitter.Valid ||
+		c.Download.Valid || c.Upload.Valid || c.PacketLoss.Valid
+}
+
+// Apply returns the result of overriding c with the specified fields of
+// other. A preset in other discards everything specified in c, since it
+// describes a completely different network.
+func (c NetworkConditions) Apply(other NetworkConditions) NetworkConditions {
+	if other.Preset.Valid {
+		c = NetworkConditions{Preset: other.Preset}
+	}
+	if other.Latency.Valid {
+		c.Latency = other.Latency
+	}
+	if other.Jitter.Valid {
+		c.Jitter = other.Jitter
+	}
+	if other.Download.Valid {
+		c.Download = other.Download
+	}
+	if other.Upload.Valid {
+		c.Upload = other.Upload
+	}
+	if other.PacketLoss.Valid {
+		c.PacketLoss = other.PacketLoss
+	}
+	return c
+}
+
+// Effective returns the conditions with the preset values filled in for all
+// of the fields that weren't explicitly specified.
+func (c NetworkConditions) Effective() NetworkConditions {
+	if !c.Preset.Valid {
+		return c
+	}
+	preset := networkPresets[strings.ToLower(c.Preset.String)]
+	preset.Preset = c.Preset
+	return preset.Apply(NetworkConditions{
+		Latency:    c.Latency,
+		Jitter:     c.Jitter,
+		Download:   c.Download,
+		Upload:     c.Upload,
+		PacketLoss: c.PacketLoss,
+	})
+}
+
+// Validate checks that the preset exists and the values are in range.
+func (c NetworkConditions) Validate() error {
+	if c.Preset.Valid {
+		if _, ok := networkPresets[strings.ToLower(c.Preset.String)]; !ok {
+			return fmt.Errorf("unknown network preset '%s', supported presets are %v", c.Preset.String, NetworkPresets())
+		}
+	}
+	if c.Latency.Duration < 0 {
+		return fmt.Errorf("network latency can't be negative")
+	}
+	if c.Jitter.Duration < 0 {
+		return fmt.Errorf("network jitter can't be negative")
+	}
+	if c.Download.Int64 < 0 || c.Upload.Int64 < 0 {
+		return fmt.Errorf("network bandwidth can't be negative")
+	}
+	if c.PacketLoss.Float64 < 0 || c.PacketLoss.Float64 > 100 {
+		return fmt.Errorf("network packet loss should be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// String implements fmt.Stringer.
+func (c NetworkConditions) String() string {
+	var parts []string
+	if c.Preset.Valid {
+		parts = append(parts, "preset="+c.Preset.String)
+	}
+	if c.Latency.Valid {
+		parts = append(parts, "latency="+c.Latency.Duration.String())
+	}
+	if c.Jitter.Valid {
+		parts = append(parts, "jitter="+c.Jitter.Duration.String())
+	}
+	if c.Download.Valid {
+		parts = append(parts, "download="+strconv.FormatInt(c.Download.Int64, 10))
+	}
+	if c.Upload.Valid {
+		parts = append(parts, "upload="+strconv.FormatInt(c.Upload.Int64, 10))
+	}
+	if c.PacketLoss.Valid {
+		parts = append(parts, "packetLoss="+strconv.FormatFloat(c.PacketLoss.Float64, 'f', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Besides an object, the name of a
+// preset is also accepted as a shorthand.
+func (c *NetworkConditions) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte(`null`)) {
+		return nil
+	}
+	var preset string
+	if err := json.Unmarshal(data, &preset); err == nil {
+		nc := NetworkConditions{Preset: null.StringFrom(preset)}
+		if err := nc.Validate(); err != nil {
+			return err
+		}
+		*c = nc
+		return nil
+	}
+	var s struct {
+		Preset     null.String  `json:"preset"`
+		Latency    NullDuration `json:"latency"`
+		Jitter     NullDuration `json:"jitter"`
+		Download   null.Int     `json:"download"`
+		Upload     null.Int     `json:"upload"`
+		PacketLoss null.Float   `json:"packetLoss"`
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	nc := NetworkConditions{
+		Preset:     s.Preset,
+		Latency:    s.Latency,
+		Jitter:     s.Jitter,
+		Download:   s.Download,
+		Upload:     s.Upload,
+		PacketLoss: s.PacketLoss,
+	}
+	if err := nc.Validate(); err != nil {
+		return err
+	}
+	*c = nc
+	return nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts either the
+// name of a preset or a list of key=value pairs, e.g.
+// `preset=3g,latency=500ms,packetLoss=1`.
+func (c *NetworkConditions) UnmarshalText(text []byte) error {
+	nc := NetworkConditions{}
+	for _, value := range strings.Split(string(text), ",") {
+		args := strings.SplitN(value, "=", 2)
+		if len(args) == 1 {
+			if nc.Preset.Valid {
+				return fmt.Errorf("no value for key %s", value)
+			}
+			nc.Preset = null.StringFrom(args[0])
+			continue
+		}
+		if err := nc.unmarshal(args[0], args[1]); err != nil {
+			return err
+		}
+	}
+	if err := nc.Validate(); err != nil {
+		return err
+	}
+	*c = nc
+	return nil
+}
+
+func (c *NetworkConditions) unmarshal(k, v string) error {
+	switch k {
+	case "preset":
+		c.Preset = null.StringFrom(v)
+	case "latency", "jitter":
+		d, err := ParseExtendedDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid network %s value: %w", k, err)
+		}
+		if k == "latency" {
+			c.Latency = NewNullDuration(d, true)
+		} else {
+			c.Jitter = NewNullDuration(d, true)
+		}
+	case "download", "upload":
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid network %s value: %w", k, err)
+		}
+		if k == "download" {
+			c.Download = null.IntFrom(i)
+		} else {
+			c.Upload = null.IntFrom(i)
+		}
+	case "packetLoss":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid network %s value: %w", k, err)
+		}
+		c.PacketLoss = null.FloatFrom(f)
+	default:
+		return fmt.Errorf("unknown network configuration field: %s", k)
+	}
+	return nil
+}
+
+// GetNetworkConditions converts a JS-exported value, either the name of a
+// preset or an object, to NetworkConditions.
+func GetNetworkConditions(v interface{}) (NetworkConditions, error) {
+	var c NetworkConditions
+	data, err := json.Marshal(v)
+	if err != nil {
+		return c, err
+	}
+	if err := c.UnmarshalJSON(data); err != nil {
+		return c, err
+	}
+	return c, nil
+}
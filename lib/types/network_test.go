@@ -0,0 +1,114 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNetworkConditionsUnmarshal(t *testing.T) {
+	t.Parallel()
+	expected := NetworkConditions{
+		Preset:     null.StringFrom("3g"),
+		Latency:    NewNullDuration(500*time.Millisecond, true),
+		Download:   null.IntFrom(1000),
+		PacketLoss: null.FloatFrom(1.5),
+	}
+
+	testCases := []struct {
+		text, json, expErr string
+		expected           NetworkConditions
+	}{
+		{text: "3g", json: `"3g"`, expected: NetworkConditions{Preset: null.StringFrom("3g")}},
+		{
+			text:     "preset=3g,latency=500ms,download=1000,packetLoss=1.5",
+			json:     `{"preset":"3g","latency":"500ms","download":1000,"packetLoss":1.5}`,
+			expected: expected,
+		},
+		{text: "3g,latency=500,download=1000,packetLoss=1.5", json: `{}`, expected: expected},
+		{text: "5g", json: `"5g"`, expErr: "unknown network preset '5g', supported presets are [3g 4g dsl]"},
+		{text: "3g,4g", json: `{"preset":"4g","latency":"-1s"}`, expErr: "no value for key 4g"},
+		{text: "jitter=-1s", json: `{"jitter":"-1s"}`, expErr: "network jitter can't be negative"},
+		{text: "packetLoss=101", json: `{"packetLoss":101}`, expErr: "network packet loss should be a percentage between 0 and 100"},
+		{text: "speed=1", json: `{"upload":-1}`, expErr: "unknown network configuration field: speed"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.text, func(t *testing.T) {
+			t.Parallel()
+			var c NetworkConditions
+			err := c.UnmarshalText([]byte(tc.text))
+			if tc.expErr != "" {
+				require.EqualError(t, err, tc.expErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, c)
+			}
+
+			if tc.json == `{}` {
+				return
+			}
+			var j NetworkConditions
+			err = json.Unmarshal([]byte(tc.json), &j)
+			if tc.expErr != "" {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, j)
+			}
+		})
+	}
+}
+
+func TestNetworkConditionsApply(t *testing.T) {
+	t.Parallel()
+	global := NetworkConditions{Preset: null.StringFrom("3g"), PacketLoss: null.FloatFrom(1)}
+
+	c := global.Apply(NetworkConditions{Latency: NewNullDuration(time.Second, true)})
+	assert.Equal(t, NetworkConditions{
+		Preset:     null.StringFrom("3g"),
+		Latency:    NewNullDuration(time.Second, true),
+		PacketLoss: null.FloatFrom(1),
+	}, c)
+	assert.Equal(t, NetworkConditions{
+		Preset:     null.StringFrom("3g"),
+		Latency:    NewNullDuration(time.Second, true),
+		Jitter:     NewNullDuration(30*time.Millisecond, true),
+		Download:   null.IntFrom(1600),
+		Upload:     null.IntFrom(768),
+		PacketLoss: null.FloatFrom(1),
+	}, c.Effective())
+
+	// a different preset replaces everything
+	c = global.Apply(NetworkConditions{Preset: null.StringFrom("dsl")})
+	assert.Equal(t, NetworkConditions{Preset: null.StringFrom("dsl")}, c)
+	assert.False(t, c.Effective().PacketLoss.Valid)
+
+	assert.Equal(t, global, global.Apply(NetworkConditions{}))
+	assert.Equal(t, "preset=3g,packetLoss=1", global.String())
+}
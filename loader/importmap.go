@@ -0,0 +1,129 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ImportMap maps module specifiers to other module specifiers, like the import
+// maps of the browsers, see https://github.com/WICG/import-maps. The keys that
+// end with a slash map all the specifiers that start with them.
+type ImportMap struct {
+	Imports map[string]string            `json:"imports"`
+	Scopes  map[string]map[string]string `json:"scopes,omitempty"`
+}
+
+// ParseImportMap parses the JSON of an import map from the file at base. The
+// relative addresses in it are resolved from the directory of the file, so the
+// import map works the same from any script.
+func ParseImportMap(data []byte, base *url.URL) (*ImportMap, error) {
+	var m ImportMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("couldn't parse the import map %s: %w", base, err)
+	}
+	dir := Dir(base)
+	resolveAll := func(imports map[string]string) error {
+		for specifier, address := range imports {
+			if address == "" {
+				return fmt.Errorf("the import map %s has an empty address for %q", base, specifier)
+			}
+			if strings.HasSuffix(specifier, "/") != strings.HasSuffix(address, "/") {
+				return fmt.Errorf("the import map %s maps %q to %q, but only one of them ends with a slash",
+					base, specifier, address)
+			}
+			if address[0] != '.' && address[0] != '/' {
+				continue
+			}
+			u, err := resolveFilePath(dir, address)
+			if err != nil {
+				return err
+			}
+			imports[specifier] = u.String()
+		}
+		return nil
+	}
+	if err := resolveAll(m.Imports); err != nil {
+		return nil, err
+	}
+	scopes := make(map[string]map[string]string, len(m.Scopes))
+	for scope, imports := range m.Scopes {
+		if err := resolveAll(imports); err != nil {
+			return nil, err
+		}
+		if scope != "" && (scope[0] == '.' || scope[0] == '/') {
+			u, err := resolveFilePath(dir, scope)
+			if err != nil {
+				return nil, err
+			}
+			scope = u.String()
+		}
+		scopes[scope] = imports
+	}
+	m.Scopes = scopes
+	return &m, nil
+}
+
+// Resolve returns what the specifier is mapped to when it's imported from the
+// referrer, the imports of the most specific scope of the referrer are used
+// first. The second result is false if the specifier isn't mapped.
+func (m *ImportMap) Resolve(moduleSpecifier string, referrer *url.URL) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	if referrer != nil {
+		ref := referrer.String()
+		scopes := make([]string, 0, len(m.Scopes))
+		for scope := range m.Scopes {
+			if ref == scope || (strings.HasSuffix(scope, "/") && strings.HasPrefix(ref, scope)) {
+				scopes = append(scopes, scope)
+			}
+		}
+		sort.Slice(scopes, func(i, j int) bool { return len(scopes[i]) > len(scopes[j]) })
+		for _, scope := range scopes {
+			if address, ok := resolveImports(m.Scopes[scope], moduleSpecifier); ok {
+				return address, true
+			}
+		}
+	}
+	return resolveImports(m.Imports, moduleSpecifier)
+}
+
+func resolveImports(imports map[string]string, moduleSpecifier string) (string, bool) {
+	if address, ok := imports[moduleSpecifier]; ok {
+		return address, true
+	}
+	var prefix string
+	for specifier := range imports {
+		if strings.HasSuffix(specifier, "/") && strings.HasPrefix(moduleSpecifier, specifier) &&
+			len(specifier) > len(prefix) {
+			prefix = specifier
+		}
+	}
+	if prefix == "" {
+		return "", false
+	}
+	return imports[prefix] + moduleSpecifier[len(prefix):], true
+}
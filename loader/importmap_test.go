@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loader_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/loader"
+)
+
+func TestImportMap(t *testing.T) {
+	t.Parallel()
+	base := &url.URL{Scheme: "file", Path: "/test/importmap.json"}
+	m, err := loader.ParseImportMap([]byte(`{
+		"imports": {
+			"lodash": "./vendor/lodash.js",
+			"utils/": "/lib/utils/",
+			"utils/special": "https://example.com/special.js",
+			"k6-utils": "https://jslib.k6.io/k6-utils/1.2.0/index.js",
+			"uuid": "uuid-v4"
+		},
+		"scopes": {
+			"./legacy/": {"lodash": "./vendor/lodash-3.js"}
+		}
+	}`), base)
+	require.NoError(t, err)
+
+	script := &url.URL{Scheme: "file", Path: "/test/script.js"}
+	legacy := &url.URL{Scheme: "file", Path: "/test/legacy/script.js"}
+	testCases := []struct {
+		specifier string
+		referrer  *url.URL
+		expected  string
+	}{
+		{"lodash", script, "file:///test/vendor/lodash.js"},
+		{"lodash", legacy, "file:///test/vendor/lodash-3.js"},
+		{"lodash", nil, "file:///test/vendor/lodash.js"},
+		{"utils/a.js", script, "file:///lib/utils/a.js"},
+		{"utils/special", legacy, "https://example.com/special.js"},
+		{"k6-utils", script, "https://jslib.k6.io/k6-utils/1.2.0/index.js"},
+		{"uuid", script, "uuid-v4"},
+	}
+	for _, tc := range testCases {
+		address, ok := m.Resolve(tc.specifier, tc.referrer)
+		assert.True(t, ok, tc.specifier)
+		assert.Equal(t, tc.expected, address, tc.specifier)
+	}
+
+	for _, specifier := range []string{"./lodash", "lodash/fp", "utils", "k6/http"} {
+		_, ok := m.Resolve(specifier, script)
+		assert.False(t, ok, specifier)
+	}
+
+	var empty *loader.ImportMap
+	_, ok := empty.Resolve("lodash", script)
+	assert.False(t, ok)
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		_, err := loader.ParseImportMap([]byte(`{"imports": []}`), base)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "couldn't parse the import map file:///test/importmap.json")
+
+		_, err = loader.ParseImportMap([]byte(`{"imports": {"utils/": "./utils.js"}}`), base)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `maps "utils/" to "./utils.js", but only one of them ends with a slash`)
+
+		_, err = loader.ParseImportMap([]byte(`{"imports": {"utils": ""}}`), base)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `has an empty address for "utils"`)
+	})
+}
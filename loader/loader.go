@@ -82,8 +82,8 @@ type noSchemeRemoteModuleResolutionError struct {
 func (n noSchemeRemoteModuleResolutionError) Error() string {
 	return fmt.Sprintf(
 		`Module specifier "%s" was tried to be loaded as remote module by prepending "https://" to it, `+
-			`which didn't work. If you are trying to import a nodejs module, this is not supported `+
-			`as k6 is _not_ nodejs based. Please read https://k6.io/docs/using-k6/modules for more information. `+
+			`which didn't work. If you are trying to import a nodejs module, it needs to be installed `+
+			`in a node_modules directory next to the script or one of its parents. Please read https://k6.io/docs/using-k6/modules for more information. `+
 			`Remote resolution error: "%s"`, n.moduleSpecifier, n.err)
 }
 
@@ -209,44 +209,60 @@ func Load(
 		return nil, err
 	}
 	if scheme == "https" {
-		finalModuleSpecifierURL := &url.URL{}
-
-		switch {
-		case moduleSpecifier.Opaque != "": // This is loader
-			finalModuleSpecifierURL, err = resolveUsingLoaders(logger, moduleSpecifier.Opaque)
-			if err != nil {
-				return nil, err
-			}
-		case moduleSpecifier.Scheme == "":
-			logger.Warningf(`The moduleSpecifier "%s" has no scheme but we will try to resolve it as remote module. `+
-				`This will be deprecated in the future and all remote modules will `+
-				`need to explicitly use "https" as scheme.`, originalModuleSpecifier)
-			*finalModuleSpecifierURL = *moduleSpecifier
-			finalModuleSpecifierURL.Scheme = scheme
-		default:
-			finalModuleSpecifierURL = moduleSpecifier
+		fetch := func() ([]byte, error) {
+			return fetchRemoteModule(logger, moduleSpecifier, originalModuleSpecifier)
 		}
-		var result *SourceData
-		result, err = loadRemoteURL(logger, finalModuleSpecifierURL)
-		if err == nil {
-			result.URL = moduleSpecifier
-			// TODO maybe make an afero.Fs which makes request directly and than use CacheOnReadFs
-			// on top of as with the `file` scheme fs
-			_ = afero.WriteFile(filesystems[scheme], pathOnFs, result.Data, 0o644)
-			return result, nil
+		if cache, ok := filesystems[scheme].(ModuleCacheGetter); ok {
+			data, err = cache.GetModuleCache().Load(logger, moduleSpecifier.String(), fetch)
+		} else {
+			data, err = fetch()
 		}
-
-		if moduleSpecifier.Scheme == "" || moduleSpecifier.Opaque == "" {
-			// we have an error and we did remote module resolution without a scheme
-			// let's write the coolest error message to try to help the lost soul who got to here
-			return nil, noSchemeRemoteModuleResolutionError{err: err, moduleSpecifier: originalModuleSpecifier}
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf(httpsSchemeCouldntBeLoadedMsg, originalModuleSpecifier, finalModuleSpecifierURL, err)
+		// TODO maybe make an afero.Fs which makes request directly and than use CacheOnReadFs
+		// on top of as with the `file` scheme fs
+		_ = afero.WriteFile(filesystems[scheme], pathOnFs, data, 0o644)
+		return &SourceData{URL: moduleSpecifier, Data: data}, nil
 	}
 
 	return nil, fmt.Errorf(fileSchemeCouldntBeLoadedMsg, originalModuleSpecifier)
 }
 
+// fetchRemoteModule fetches the remote module, resolving it with the loaders first if needed.
+func fetchRemoteModule(
+	logger logrus.FieldLogger, moduleSpecifier *url.URL, originalModuleSpecifier string,
+) ([]byte, error) {
+	finalModuleSpecifierURL := &url.URL{}
+	var err error
+	switch {
+	case moduleSpecifier.Opaque != "": // This is loader
+		finalModuleSpecifierURL, err = resolveUsingLoaders(logger, moduleSpecifier.Opaque)
+		if err != nil {
+			return nil, err
+		}
+	case moduleSpecifier.Scheme == "":
+		logger.Warningf(`The moduleSpecifier "%s" has no scheme but we will try to resolve it as remote module. `+
+			`This will be deprecated in the future and all remote modules will `+
+			`need to explicitly use "https" as scheme.`, originalModuleSpecifier)
+		*finalModuleSpecifierURL = *moduleSpecifier
+		finalModuleSpecifierURL.Scheme = "https"
+	default:
+		finalModuleSpecifierURL = moduleSpecifier
+	}
+	result, err := loadRemoteURL(logger, finalModuleSpecifierURL)
+	if err == nil {
+		return result.Data, nil
+	}
+
+	if moduleSpecifier.Scheme == "" || moduleSpecifier.Opaque == "" {
+		// we have an error and we did remote module resolution without a scheme
+		// let's write the coolest error message to try to help the lost soul who got to here
+		return nil, noSchemeRemoteModuleResolutionError{err: err, moduleSpecifier: originalModuleSpecifier}
+	}
+	return nil, fmt.Errorf(httpsSchemeCouldntBeLoadedMsg, originalModuleSpecifier, finalModuleSpecifierURL, err)
+}
+
 func resolveUsingLoaders(logger logrus.FieldLogger, name string) (*url.URL, error) {
 	_, loader, loaderArgs := pickLoader(name)
 	if loader != nil {
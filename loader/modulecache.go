@@ -0,0 +1,245 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// LockFileName is the name of the lockfile with the hashes of the remote modules.
+const LockFileName = "k6.lock"
+
+const (
+	lockFileVersion = 1
+	hashPrefix      = "sha256:"
+)
+
+// ErrModuleChanged is returned when the content of a remote module doesn't
+// match the hash of it in the lockfile.
+var ErrModuleChanged = errors.New("the module doesn't match the hash in the lockfile")
+
+// ModuleCache is a content-addressed cache of the remote modules, each one is
+// stored in a file named after the SHA-256 of its content. The hashes of the
+// modules are pinned in a lockfile, so a module that changes between runs is
+// an error instead of a different test. In the offline mode, the remote modules
+// are only loaded from the cache.
+type ModuleCache struct {
+	fs       afero.Fs
+	dir      string
+	lockPath string
+	offline  bool
+
+	mu   sync.Mutex
+	lock lockFile
+}
+
+type lockFile struct {
+	Version int               `json:"version"`
+	Modules map[string]string `json:"modules"`
+}
+
+// NewModuleCache returns a cache of the remote modules in dir, with their
+// hashes in the lockfile at lockPath, which is read if it exists.
+func NewModuleCache(fs afero.Fs, dir, lockPath string, offline bool) (*ModuleCache, error) {
+	c := &ModuleCache{
+		fs:       fs,
+		dir:      dir,
+		lockPath: lockPath,
+		offline:  offline,
+		lock:     lockFile{Version: lockFileVersion, Modules: make(map[string]string)},
+	}
+	data, err := afero.ReadFile(fs, lockPath)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &c.lock); err != nil {
+		return nil, fmt.Errorf("couldn't parse the lockfile %s: %w", lockPath, err)
+	}
+	if c.lock.Version != lockFileVersion {
+		return nil, fmt.Errorf("the lockfile %s has the unsupported version %d", lockPath, c.lock.Version)
+	}
+	if c.lock.Modules == nil {
+		c.lock.Modules = make(map[string]string)
+	}
+	return c, nil
+}
+
+// Modules returns the hashes of the modules in the lockfile by their URLs.
+func (c *ModuleCache) Modules() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	modules := make(map[string]string, len(c.lock.Modules))
+	for u, hash := range c.lock.Modules {
+		modules[u] = hash
+	}
+	return modules
+}
+
+// Load returns the module with the specifier from the cache if its hash is in
+// the lockfile, otherwise it's fetched, cached and its hash is added to the
+// lockfile. Errors writing the cache are only logged, so it's still possible
+// to run a test without a writable cache. The cache isn't locked while the
+// module is fetched, so slow modules don't block the loading of the others.
+func (c *ModuleCache) Load(
+	logger logrus.FieldLogger, moduleSpecifier string, fetch func() ([]byte, error),
+) ([]byte, error) {
+	c.mu.Lock()
+	hash, locked := c.lock.Modules[moduleSpecifier]
+	if locked {
+		data, err := c.readModule(hash)
+		if err == nil {
+			c.mu.Unlock()
+			logger.WithField("url", moduleSpecifier).Debug("Loaded the module from the module cache")
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("couldn't load %s from the module cache: %w", moduleSpecifier, err)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.offline {
+		if locked {
+			return nil, fmt.Errorf("the module %s isn't in the module cache %s, "+
+				"run `k6 vendor` to download it before running offline", moduleSpecifier, c.dir)
+		}
+		return nil, fmt.Errorf("the module %s isn't in the lockfile %s, "+
+			"run `k6 vendor` to download it before running offline", moduleSpecifier, c.lockPath)
+	}
+
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	sum := hashOf(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the module could have been added to the lockfile while it was fetched
+	hash, locked = c.lock.Modules[moduleSpecifier]
+	if locked && sum != hash {
+		return nil, fmt.Errorf("%s has the hash %s instead of %s, which is in %s: %w",
+			moduleSpecifier, sum, hash, c.lockPath, ErrModuleChanged)
+	}
+
+	if err = c.writeModule(sum, data); err != nil {
+		logger.WithError(err).Warnf("Couldn't write %s to the module cache", moduleSpecifier)
+	}
+	if !locked {
+		c.lock.Modules[moduleSpecifier] = sum
+		if err = c.writeLockFile(); err != nil {
+			logger.WithError(err).Warnf("Couldn't write the lockfile %s", c.lockPath)
+		}
+	}
+	return data, nil
+}
+
+func (c *ModuleCache) modulePath(hash string) (string, error) {
+	sum := strings.TrimPrefix(hash, hashPrefix)
+	if sum == hash || len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid hash %q", hash)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("invalid hash %q", hash)
+	}
+	return filepath.Join(c.dir, "sha256", sum), nil
+}
+
+func (c *ModuleCache) readModule(hash string) ([]byte, error) {
+	p, err := c.modulePath(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := afero.ReadFile(c.fs, p)
+	if err != nil {
+		return nil, err
+	}
+	if sum := hashOf(data); sum != hash {
+		return nil, fmt.Errorf("the cached file %s has the hash %s: %w", p, sum, ErrModuleChanged)
+	}
+	return data, nil
+}
+
+func (c *ModuleCache) writeModule(hash string, data []byte) error {
+	p, err := c.modulePath(hash)
+	if err != nil {
+		return err
+	}
+	if err = c.fs.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return afero.WriteFile(c.fs, p, data, 0o644)
+}
+
+func (c *ModuleCache) writeLockFile() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(c.lock); err != nil {
+		return err
+	}
+	return afero.WriteFile(c.fs, c.lockPath, buf.Bytes(), 0o644)
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// ModuleCacheGetter is implemented by the filesystems of the remote modules
+// that are cached by a ModuleCache.
+type ModuleCacheGetter interface {
+	GetModuleCache() *ModuleCache
+}
+
+type moduleCacheFs struct {
+	afero.Fs
+	cache *ModuleCache
+}
+
+// NewModuleCacheFs returns the filesystem of the remote modules with the
+// cache, which is used by Load when a module isn't in fs.
+func NewModuleCacheFs(fs afero.Fs, cache *ModuleCache) afero.Fs {
+	return &moduleCacheFs{Fs: fs, cache: cache}
+}
+
+// GetModuleCache returns the cache of the remote modules.
+func (fs *moduleCacheFs) GetModuleCache() *ModuleCache {
+	return fs.cache
+}
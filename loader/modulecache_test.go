@@ -0,0 +1,185 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loader_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib/testutils"
+	"go.k6.io/k6/loader"
+)
+
+const (
+	moduleURL  = "https://example.com/lib.js"
+	moduleData = "export default 1;"
+	moduleHash = "sha256:56332e0a55734bc2b73df56a2df8635ed5c5b24b6d7a456b41de7cab9a2f3814"
+)
+
+func TestModuleCache(t *testing.T) {
+	t.Parallel()
+	logger := testutils.NewLogger(t)
+
+	newCache := func(t *testing.T, fs afero.Fs, offline bool) *loader.ModuleCache {
+		cache, err := loader.NewModuleCache(fs, "/cache", "/project/k6.lock", offline)
+		require.NoError(t, err)
+		return cache
+	}
+	fetcher := func(data string) (func() ([]byte, error), *int) {
+		calls := new(int)
+		return func() ([]byte, error) {
+			*calls++
+			return []byte(data), nil
+		}, calls
+	}
+
+	t.Run("Lock", func(t *testing.T) {
+		t.Parallel()
+		fs := afero.NewMemMapFs()
+		fetch, calls := fetcher(moduleData)
+		data, err := newCache(t, fs, false).Load(logger, moduleURL, fetch)
+		require.NoError(t, err)
+		assert.Equal(t, moduleData, string(data))
+		assert.Equal(t, 1, *calls)
+
+		lock, err := afero.ReadFile(fs, "/project/k6.lock")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"version": 1, "modules": {"`+moduleURL+`": "`+moduleHash+`"}}`, string(lock))
+		cached, err := afero.ReadFile(fs, "/cache/sha256/"+moduleHash[len("sha256:"):])
+		require.NoError(t, err)
+		assert.Equal(t, moduleData, string(cached))
+
+		// the next runs use the cache, even offline
+		for _, offline := range []bool{false, true} {
+			cache := newCache(t, fs, offline)
+			data, err = cache.Load(logger, moduleURL, fetch)
+			require.NoError(t, err)
+			assert.Equal(t, moduleData, string(data))
+			assert.Equal(t, 1, *calls)
+			assert.Equal(t, map[string]string{moduleURL: moduleHash}, cache.Modules())
+		}
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		t.Parallel()
+		fs := afero.NewMemMapFs()
+		fetch, _ := fetcher(moduleData)
+		_, err := newCache(t, fs, false).Load(logger, moduleURL, fetch)
+		require.NoError(t, err)
+
+		// the cached file is missing, so the module is fetched again, but it changed
+		require.NoError(t, fs.RemoveAll("/cache"))
+		fetch, _ = fetcher("export default 2;")
+		_, err = newCache(t, fs, false).Load(logger, moduleURL, fetch)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, loader.ErrModuleChanged))
+		assert.Contains(t, err.Error(), "instead of "+moduleHash+", which is in /project/k6.lock")
+
+		// the cached file was modified
+		require.NoError(t, afero.WriteFile(fs, "/cache/sha256/"+moduleHash[len("sha256:"):], []byte("changed"), 0o644))
+		_, err = newCache(t, fs, false).Load(logger, moduleURL, fetch)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, loader.ErrModuleChanged))
+	})
+
+	t.Run("Offline", func(t *testing.T) {
+		t.Parallel()
+		fs := afero.NewMemMapFs()
+		fetch, calls := fetcher(moduleData)
+		_, err := newCache(t, fs, true).Load(logger, moduleURL, fetch)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the module "+moduleURL+" isn't in the lockfile /project/k6.lock")
+		assert.Equal(t, 0, *calls)
+
+		require.NoError(t, afero.WriteFile(fs, "/project/k6.lock",
+			[]byte(`{"version": 1, "modules": {"`+moduleURL+`": "`+moduleHash+`"}}`), 0o644))
+		_, err = newCache(t, fs, true).Load(logger, moduleURL, fetch)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the module "+moduleURL+" isn't in the module cache /cache")
+		assert.Equal(t, 0, *calls)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		t.Parallel()
+		cache := newCache(t, afero.NewMemMapFs(), false)
+		fetching := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			_, err := cache.Load(logger, "https://example.com/slow.js", func() ([]byte, error) {
+				close(fetching)
+				<-release
+				return []byte("export default 2;"), nil
+			})
+			done <- err
+		}()
+		<-fetching
+
+		// the cache isn't locked while the slow module is fetched
+		fetch, _ := fetcher(moduleData)
+		data, err := cache.Load(logger, moduleURL, fetch)
+		require.NoError(t, err)
+		assert.Equal(t, moduleData, string(data))
+
+		close(release)
+		require.NoError(t, <-done)
+		assert.Len(t, cache.Modules(), 2)
+	})
+
+	t.Run("InvalidLock", func(t *testing.T) {
+		t.Parallel()
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/project/k6.lock", []byte(`{"version": 2}`), 0o644))
+		_, err := loader.NewModuleCache(fs, "/cache", "/project/k6.lock", false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the lockfile /project/k6.lock has the unsupported version 2")
+
+		require.NoError(t, afero.WriteFile(fs, "/project/k6.lock", []byte(`{`), 0o644))
+		_, err = loader.NewModuleCache(fs, "/cache", "/project/k6.lock", false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "couldn't parse the lockfile /project/k6.lock")
+	})
+
+	t.Run("Load", func(t *testing.T) {
+		t.Parallel()
+		fs := afero.NewMemMapFs()
+		fetch, _ := fetcher(moduleData)
+		_, err := newCache(t, fs, false).Load(logger, moduleURL, fetch)
+		require.NoError(t, err)
+
+		// the module isn't fetched by Load, as it's in the cache
+		filesystems := map[string]afero.Fs{
+			"https": loader.NewModuleCacheFs(afero.NewMemMapFs(), newCache(t, fs, true)),
+		}
+		u, err := url.Parse(moduleURL)
+		require.NoError(t, err)
+		src, err := loader.Load(logrus.New(), filesystems, u, moduleURL)
+		require.NoError(t, err)
+		assert.Equal(t, moduleData, string(src.Data))
+		assert.Equal(t, moduleURL, src.URL.String())
+	})
+}
@@ -0,0 +1,265 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// exportsConditions are the conditions of the package.json exports that k6
+// matches, both the ES modules and the CommonJS ones can be loaded. Which one
+// is used depends on the order of the conditions in the package.json, as in
+// Node.js.
+var exportsConditions = map[string]bool{ //nolint:gochecknoglobals
+	"k6": true, "import": true, "module": true, "require": true, "default": true,
+}
+
+// moduleExtensions are tried in order when a module is imported without one.
+var moduleExtensions = []string{"", ".js", ".mjs", ".cjs", "/index.js"} //nolint:gochecknoglobals
+
+// packageJSON has the fields of a package.json that are used to find the
+// entry point of a package.
+type packageJSON struct {
+	Module  string          `json:"module"`
+	Main    string          `json:"main"`
+	Exports json.RawMessage `json:"exports"`
+}
+
+// IsBareSpecifier returns whether the module specifier is neither a path nor a
+// URL, nor handled by one of the loaders, like "lodash" or "@scope/pkg/file.js".
+func IsBareSpecifier(moduleSpecifier string) bool {
+	if moduleSpecifier == "" || moduleSpecifier[0] == '.' || moduleSpecifier[0] == '/' ||
+		filepath.IsAbs(moduleSpecifier) || strings.Contains(moduleSpecifier, "://") {
+		return false
+	}
+	_, loader, _ := pickLoader(moduleSpecifier)
+	return loader == nil
+}
+
+// ResolveNodeModule resolves a bare specifier like Node.js does, by looking for
+// the package in the node_modules directories of pwd and of all its parents.
+// The package.json exports, module and main fields are used in that order to
+// find the file. It returns nil if there is no such package, so that the
+// specifier can be resolved as a remote module instead.
+func ResolveNodeModule(fs afero.Fs, pwd *url.URL, moduleSpecifier string) (*url.URL, error) {
+	if pwd.Scheme != "file" || !IsBareSpecifier(moduleSpecifier) {
+		return nil, nil
+	}
+	name, subpath := splitPackageSpecifier(moduleSpecifier)
+	if name == "" {
+		return nil, nil
+	}
+
+	for dir := path.Clean(pwd.Path); ; dir = path.Dir(dir) {
+		pkgDir := path.Join(dir, "node_modules", name)
+		if isDir(fs, pkgDir) {
+			file, err := resolvePackage(fs, pkgDir, subpath)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't resolve %q from %s: %w", moduleSpecifier, pkgDir, err)
+			}
+			return &url.URL{Scheme: "file", Path: file}, nil
+		}
+		if dir == "/" || dir == "." {
+			return nil, nil
+		}
+	}
+}
+
+// splitPackageSpecifier splits a bare specifier into the package name, which
+// can be scoped, and the subpath in the package, which is empty or starts
+// with a slash.
+func splitPackageSpecifier(moduleSpecifier string) (name, subpath string) {
+	parts := strings.SplitN(moduleSpecifier, "/", 3)
+	if strings.HasPrefix(moduleSpecifier, "@") {
+		if len(parts) < 2 || parts[1] == "" {
+			return "", ""
+		}
+		name = parts[0] + "/" + parts[1]
+	} else {
+		name = parts[0]
+	}
+	if strings.ContainsAny(name, `%\`) {
+		return "", ""
+	}
+	return name, moduleSpecifier[len(name):]
+}
+
+func resolvePackage(fs afero.Fs, pkgDir, subpath string) (string, error) {
+	var pkg packageJSON
+	data, err := afero.ReadFile(fs, filepath.FromSlash(path.Join(pkgDir, "package.json")))
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, &pkg); err != nil {
+			return "", fmt.Errorf("invalid package.json: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	if len(pkg.Exports) > 0 && !bytes.Equal(pkg.Exports, []byte("null")) {
+		target, err := resolvePackageExports(pkg.Exports, "."+subpath)
+		if err != nil {
+			return "", err
+		}
+		file := path.Join(pkgDir, target)
+		if !isFile(fs, file) {
+			return "", fmt.Errorf("the exported file %s doesn't exist", file)
+		}
+		return file, nil
+	}
+
+	if subpath != "" {
+		return resolveModuleFile(fs, path.Join(pkgDir, subpath))
+	}
+	for _, entry := range []string{pkg.Module, pkg.Main} {
+		if entry == "" {
+			continue
+		}
+		if file, err := resolveModuleFile(fs, path.Join(pkgDir, entry)); err == nil {
+			return file, nil
+		}
+	}
+	return resolveModuleFile(fs, path.Join(pkgDir, "index.js"))
+}
+
+// resolvePackageExports returns the file that the exports of a package.json
+// map the subpath to, see https://nodejs.org/api/packages.html#exports
+func resolvePackageExports(exports json.RawMessage, subpath string) (string, error) {
+	entries, isObject := orderedObject(exports)
+	if !isObject || len(entries) == 0 || !strings.HasPrefix(entries[0].key, ".") {
+		// the exports are only for the main entry point
+		entries = []jsonEntry{{key: ".", value: exports}}
+	}
+
+	var (
+		target  json.RawMessage
+		match   string
+		matched = -1 // the length of the prefix of the best pattern
+	)
+	for _, entry := range entries {
+		if entry.key == subpath {
+			target, match, matched = entry.value, "", len(subpath)+1
+			break
+		}
+		star := strings.Index(entry.key, "*")
+		if star < 0 || star < matched {
+			continue
+		}
+		prefix, suffix := entry.key[:star], entry.key[star+1:]
+		if len(subpath) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(subpath, prefix) && strings.HasSuffix(subpath, suffix) {
+			target, match, matched = entry.value, subpath[len(prefix):len(subpath)-len(suffix)], star
+		}
+	}
+	if matched < 0 {
+		return "", fmt.Errorf("the subpath %q isn't exported", subpath)
+	}
+	file, ok := resolveExportsTarget(target, match)
+	if !ok {
+		return "", fmt.Errorf("the subpath %q isn't exported for any of the supported conditions", subpath)
+	}
+	return file, nil
+}
+
+func resolveExportsTarget(target json.RawMessage, match string) (string, bool) {
+	var file string
+	if err := json.Unmarshal(target, &file); err == nil {
+		if !strings.HasPrefix(file, "./") {
+			return "", false
+		}
+		return strings.ReplaceAll(file, "*", match), true
+	}
+	var targets []json.RawMessage
+	if err := json.Unmarshal(target, &targets); err == nil {
+		for _, t := range targets {
+			if file, ok := resolveExportsTarget(t, match); ok {
+				return file, true
+			}
+		}
+		return "", false
+	}
+	entries, _ := orderedObject(target)
+	for _, entry := range entries {
+		if !exportsConditions[entry.key] {
+			continue
+		}
+		if file, ok := resolveExportsTarget(entry.value, match); ok {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+type jsonEntry struct {
+	key   string
+	value json.RawMessage
+}
+
+// orderedObject returns the entries of a JSON object in their order, which
+// matters for the conditions of the package.json exports.
+func orderedObject(data json.RawMessage) ([]jsonEntry, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, false
+	}
+	var entries []jsonEntry
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := t.(string)
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		entries = append(entries, jsonEntry{key: key, value: value})
+	}
+	return entries, true
+}
+
+func resolveModuleFile(fs afero.Fs, file string) (string, error) {
+	for _, ext := range moduleExtensions {
+		if isFile(fs, file+ext) {
+			return file + ext, nil
+		}
+	}
+	return "", fmt.Errorf("couldn't find %s: %w", file, os.ErrNotExist)
+}
+
+func isFile(fs afero.Fs, file string) bool {
+	info, err := fs.Stat(filepath.FromSlash(file))
+	return err == nil && !info.IsDir()
+}
+
+func isDir(fs afero.Fs, dir string) bool {
+	info, err := fs.Stat(filepath.FromSlash(dir))
+	return err == nil && info.IsDir()
+}
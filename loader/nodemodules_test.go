@@ -0,0 +1,152 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2022 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loader_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/loader"
+)
+
+func TestResolveNodeModule(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		"/test/node_modules/main/package.json":           `{"main": "lib/main.js"}`,
+		"/test/node_modules/main/lib/main.js":            ``,
+		"/test/node_modules/module/package.json":         `{"main": "main.js", "module": "module.mjs"}`,
+		"/test/node_modules/module/main.js":              ``,
+		"/test/node_modules/module/module.mjs":           ``,
+		"/test/node_modules/index/index.js":              ``,
+		"/test/node_modules/index/utils/index.js":        ``,
+		"/test/node_modules/index/file.js":               ``,
+		"/test/node_modules/@scope/pkg/package.json":     `{"exports": "./pkg.js"}`,
+		"/test/node_modules/@scope/pkg/pkg.js":           ``,
+		"/test/sub/node_modules/main/package.json":       `{"main": "sub.js"}`,
+		"/test/sub/node_modules/main/sub.js":             ``,
+		"/test/node_modules/exports/package.json":        exportsPackageJSON,
+		"/test/node_modules/exports/dist/node.cjs":       ``,
+		"/test/node_modules/exports/dist/esm.mjs":        ``,
+		"/test/node_modules/exports/dist/feature.js":     ``,
+		"/test/node_modules/exports/dist/utils/a.js":     ``,
+		"/test/node_modules/exports/dist/utils/b.js":     ``,
+		"/test/node_modules/exports/dist/internal.js":    ``,
+		"/test/node_modules/conditions/package.json":     `{"exports": {"node": "./node.js", "default": "./default.js"}}`,
+		"/test/node_modules/conditions/default.js":       ``,
+		"/test/node_modules/invalid/package.json":        `{"main": `,
+		"/test/node_modules/missing/package.json":        `{"exports": "./missing.js"}`,
+		"/test/node_modules/missing-main/package.json":   `{"main": "missing.js"}`,
+		"/test/node_modules/missing-main/index.js":       ``,
+		"/test/node_modules/extension/package.json":      `{"main": "./lib"}`,
+		"/test/node_modules/extension/lib/index.js":      ``,
+		"/test/node_modules/extension/other.mjs":         ``,
+		"/test/node_modules/not-exported/package.json":   `{"exports": {".": "./index.js"}}`,
+		"/test/node_modules/not-exported/index.js":       ``,
+		"/test/node_modules/not-exported/private.js":     ``,
+		"/test/node_modules/not-conditions/package.json": `{"exports": {"node": "./node.js"}}`,
+	}
+	for name, data := range files {
+		require.NoError(t, afero.WriteFile(fs, name, []byte(data), 0o644))
+	}
+
+	pwd := &url.URL{Scheme: "file", Path: "/test/"}
+	testCases := []struct {
+		pwd, specifier, expected string
+	}{
+		{"/test/", "main", "/test/node_modules/main/lib/main.js"},
+		{"/test/", "module", "/test/node_modules/module/module.mjs"},
+		{"/test/", "index", "/test/node_modules/index/index.js"},
+		{"/test/", "index/utils", "/test/node_modules/index/utils/index.js"},
+		{"/test/", "index/file", "/test/node_modules/index/file.js"},
+		{"/test/", "@scope/pkg", "/test/node_modules/@scope/pkg/pkg.js"},
+		{"/test/sub/", "main", "/test/sub/node_modules/main/sub.js"},
+		{"/test/other/dir/", "main", "/test/node_modules/main/lib/main.js"},
+		{"/test/", "exports", "/test/node_modules/exports/dist/esm.mjs"},
+		{"/test/", "exports/feature", "/test/node_modules/exports/dist/feature.js"},
+		{"/test/", "exports/utils/a", "/test/node_modules/exports/dist/utils/a.js"},
+		{"/test/", "exports/utils/b", "/test/node_modules/exports/dist/utils/b.js"},
+		{"/test/", "conditions", "/test/node_modules/conditions/default.js"},
+		{"/test/", "missing-main", "/test/node_modules/missing-main/index.js"},
+		{"/test/", "extension", "/test/node_modules/extension/lib/index.js"},
+		{"/test/", "extension/other", "/test/node_modules/extension/other.mjs"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.pwd+" "+tc.specifier, func(t *testing.T) {
+			t.Parallel()
+			u, err := loader.ResolveNodeModule(fs, &url.URL{Scheme: "file", Path: tc.pwd}, tc.specifier)
+			require.NoError(t, err)
+			require.NotNil(t, u)
+			assert.Equal(t, "file://"+tc.expected, u.String())
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		t.Parallel()
+		for _, specifier := range []string{"unknown", "./main", "/main", "https://example.com/main.js",
+			"github.com/k6io/k6/samples/http_get.js", "@scope"} {
+			u, err := loader.ResolveNodeModule(fs, pwd, specifier)
+			require.NoError(t, err, specifier)
+			assert.Nil(t, u, specifier)
+		}
+		u, err := loader.ResolveNodeModule(fs, &url.URL{Scheme: "https", Host: "example.com", Path: "/"}, "main")
+		require.NoError(t, err)
+		assert.Nil(t, u)
+	})
+
+	errorCases := map[string]string{
+		"invalid":              "invalid package.json",
+		"missing":              "the exported file /test/node_modules/missing/missing.js doesn't exist",
+		"not-exported/private": `the subpath "./private" isn't exported`,
+		"exports/internal":     `the subpath "./internal" isn't exported`,
+		"not-conditions":       `the subpath "." isn't exported for any of the supported conditions`,
+		"index/unknown":        "couldn't find /test/node_modules/index/unknown",
+	}
+	for specifier, expected := range errorCases {
+		specifier, expected := specifier, expected
+		t.Run("Error "+specifier, func(t *testing.T) {
+			t.Parallel()
+			_, err := loader.ResolveNodeModule(fs, pwd, specifier)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), expected)
+		})
+	}
+}
+
+const exportsPackageJSON = `{
+	"name": "exports",
+	"main": "./dist/node.cjs",
+	"exports": {
+		".": {
+			"types": "./dist/index.d.ts",
+			"import": "./dist/esm.mjs",
+			"require": "./dist/node.cjs"
+		},
+		"./feature": "./dist/feature.js",
+		"./utils/*": {"default": "./dist/utils/*.js"},
+		"./internal": null
+	}
+}`